@@ -1,17 +1,24 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	log "github.com/sirupsen/logrus"
 	"gopkg.in/alecthomas/kingpin.v2"
 	"os"
 
 	sh_app "github.com/flant/shell-operator/pkg/app"
 	"github.com/flant/shell-operator/pkg/debug"
+	"github.com/flant/shell-operator/pkg/kube"
 	utils_signal "github.com/flant/shell-operator/pkg/utils/signal"
 
 	"github.com/flant/addon-operator/pkg/addon-operator"
 	"github.com/flant/addon-operator/pkg/app"
+	"github.com/flant/addon-operator/pkg/helm"
+	"github.com/flant/addon-operator/pkg/helm/client"
+	"github.com/flant/addon-operator/pkg/helm/post_renderer"
+	"github.com/flant/addon-operator/pkg/manifests_validator"
 )
 
 func main() {
@@ -49,6 +56,97 @@ func main() {
 		})
 	app.DefineStartCommandFlags(kpApp, startCmd)
 
+	// post-render manifests for the helm binary
+	var postRenderModule, postRenderNamespace, postRenderConfig string
+	postRenderCmd := kpApp.Command(post_renderer.CommandName, "Transform rendered manifests from stdin. It is run by helm as a post-renderer.").
+		Hidden().
+		Action(func(c *kingpin.ParseContext) error {
+			err := post_renderer.Init(postRenderConfig)
+			if err != nil {
+				return err
+			}
+			manifests, err := ioutil.ReadAll(os.Stdin)
+			if err != nil {
+				return err
+			}
+			out, err := client.PostRender(post_renderer.ForModule(postRenderModule, postRenderNamespace), string(manifests))
+			if err != nil {
+				return err
+			}
+			fmt.Print(out)
+			return nil
+		})
+	postRenderCmd.Flag("module", "Module name.").Required().StringVar(&postRenderModule)
+	postRenderCmd.Flag("namespace", "Namespace of the module.").Required().StringVar(&postRenderNamespace)
+	postRenderCmd.Flag("config", "Path to the post-render config.").StringVar(&postRenderConfig)
+
+	// validate manifests offline
+	var validateFiles []string
+	validateCmd := kpApp.Command("validate-manifests", "Validate rendered manifests from files or stdin with OpenAPI schemas for the Kubernetes version.").
+		Action(func(c *kingpin.ParseContext) error {
+			validator, err := manifests_validator.NewFilesValidator(app.OpenAPISchemasDir, app.KubernetesVersion)
+			if err != nil {
+				return err
+			}
+			var manifests []byte
+			if len(validateFiles) == 0 {
+				manifests, err = ioutil.ReadAll(os.Stdin)
+				if err != nil {
+					return err
+				}
+			}
+			for _, path := range validateFiles {
+				content, err := ioutil.ReadFile(path)
+				if err != nil {
+					return err
+				}
+				manifests = append(manifests, []byte("\n---\n")...)
+				manifests = append(manifests, content...)
+			}
+			err = validator.Validate(string(manifests))
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			return nil
+		})
+	validateCmd.Arg("files", "Files with manifests. Manifests are read from stdin if no files are specified.").StringsVar(&validateFiles)
+	app.DefineOpenAPISchemasFlags(validateCmd)
+
+	// migrate Tiller releases to Helm 3
+	var migrateDryRun bool
+	migrateCmd := kpApp.Command("helm-migrate-2to3", "Convert Tiller releases of modules into Helm 3 releases and exit.").
+		Action(func(c *kingpin.ParseContext) error {
+			sh_app.SetupLogging()
+			instance, err := app.NewInstance()
+			if err != nil {
+				return err
+			}
+			kubeClient := kube.NewKubernetesClient()
+			kubeClient.WithContextName(sh_app.KubeContext)
+			kubeClient.WithConfigPath(sh_app.KubeConfig)
+			kubeClient.WithRateLimiterSettings(sh_app.KubeClientQps, sh_app.KubeClientBurst)
+			err = kubeClient.Init()
+			if err != nil {
+				return err
+			}
+
+			res, err := helm.Migrate2To3(kubeClient, instance, migrateDryRun)
+			out, _ := json.MarshalIndent(res, "", "  ")
+			fmt.Println(string(out))
+			return err
+		})
+	migrateCmd.Flag("namespace", "Namespace of addon-operator with Tiller releases.").
+		Envar("ADDON_OPERATOR_NAMESPACE").
+		Required().
+		StringVar(&app.Namespace)
+	migrateCmd.Flag("instance-id", "Identifier of the Addon-operator instance. Only releases owned by the instance are converted.").
+		Envar("ADDON_OPERATOR_INSTANCE_ID").
+		StringVar(&app.InstanceID)
+	migrateCmd.Flag("dry-run", "Check that releases can be converted without creating Helm 3 releases.").
+		BoolVar(&migrateDryRun)
+	sh_app.DefineKubeClientFlags(migrateCmd)
+
 	debug.DefineDebugCommands(kpApp)
 	app.DefineDebugCommands(kpApp)
 
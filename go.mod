@@ -7,11 +7,14 @@ require (
 	github.com/evanphx/json-patch v4.5.0+incompatible
 	github.com/flant/shell-operator v1.0.0-beta.13 // branch: master
 	github.com/go-chi/chi v4.0.3+incompatible
-	github.com/go-openapi/spec v0.19.3
+	github.com/go-openapi/spec v0.19.4 // required by sigs.k8s.io/kustomize/api v0.3.2
+	github.com/golang/protobuf v1.3.2
+	github.com/googleapis/gnostic v0.0.0-20170729233727-0c5108395e2d
 	github.com/kennygrant/sanitize v1.2.4
 	github.com/onsi/ginkgo v1.11.0
 	github.com/onsi/gomega v1.9.0
 	github.com/peterbourgon/mergemap v0.0.0-20130613134717-e21c03b7a721
+	github.com/pmezard/go-difflib v1.0.0
 	github.com/prometheus/client_golang v1.0.0
 	github.com/segmentio/go-camelcase v0.0.0-20160726192923-7085f1e3c734
 	github.com/sirupsen/logrus v1.4.2
@@ -21,9 +24,13 @@ require (
 	gopkg.in/alecthomas/kingpin.v2 v2.2.6
 	gopkg.in/satori/go.uuid.v1 v1.2.0
 	gopkg.in/yaml.v3 v3.0.0-20191120175047-4206685974f2
-	k8s.io/api v0.17.0
-	k8s.io/apimachinery v0.17.0
-	k8s.io/client-go v0.17.0
+	helm.sh/helm/v3 v3.1.3
+	k8s.io/api v0.17.2
+	k8s.io/apimachinery v0.17.2
+	k8s.io/cli-runtime v0.17.2
+	k8s.io/client-go v0.17.2
+	k8s.io/kubectl v0.17.2
+	sigs.k8s.io/kustomize/api v0.3.2
 	sigs.k8s.io/yaml v1.1.1-0.20191128155103-745ef44e09d6 // branch master, commit 745ef44e09d6, with fixes in yaml.v2.2.7
 )
 
@@ -39,6 +39,7 @@ func RegisterHookMetrics(metricStorage *metric_storage.MetricStorage) {
 	// modules
 	metricStorage.RegisterCounter("{PREFIX}modules_discover_errors_total", map[string]string{})
 	metricStorage.RegisterCounter("{PREFIX}module_delete_errors_total", map[string]string{"module": ""})
+	metricStorage.RegisterCounter("{PREFIX}module_purge_decisions_total", map[string]string{"module": "", "decision": ""})
 
 	// module
 	metricStorage.RegisterHistogramWithBuckets(
@@ -50,6 +51,18 @@ func RegisterHookMetrics(metricStorage *metric_storage.MetricStorage) {
 		buckets_1msTo10s,
 	)
 	metricStorage.RegisterCounter("{PREFIX}module_run_errors_total", map[string]string{"module": ""})
+	metricStorage.RegisterGauge("{PREFIX}module_failed", map[string]string{"module": ""})
+	metricStorage.RegisterGauge("{PREFIX}module_paused", map[string]string{"module": ""})
+
+	// failed tasks
+	taskRetryLabels := map[string]string{
+		"queue":  "",
+		"task":   "",
+		"module": "",
+		"hook":   "",
+	}
+	metricStorage.RegisterGauge("{PREFIX}task_failures", taskRetryLabels)
+	metricStorage.RegisterGauge("{PREFIX}task_next_retry_timestamp_seconds", taskRetryLabels)
 
 	moduleHookLabels := map[string]string{
 		"module":     "",
@@ -97,10 +110,27 @@ func RegisterHookMetrics(metricStorage *metric_storage.MetricStorage) {
 		"{PREFIX}helm_operation_seconds",
 		map[string]string{
 			"module":     "",
+			"chart":      "",
 			"activation": "",
 			"operation":  "",
 		},
 		buckets_1msTo10s)
+	metricStorage.RegisterCounter(
+		"{PREFIX}helm_rollbacks_total",
+		map[string]string{
+			"module": "",
+			"chart":  "",
+			"result": "",
+		})
+	metricStorage.RegisterCounter(
+		"{PREFIX}helm_pending_release_recoveries_total",
+		map[string]string{
+			"module":  "",
+			"release": "",
+			"status":  "",
+		})
+	metricStorage.RegisterCounter("{PREFIX}helm_render_cache_hits_total", map[string]string{"module": "", "chart": ""})
+	metricStorage.RegisterCounter("{PREFIX}helm_render_cache_misses_total", map[string]string{"module": "", "chart": ""})
 
 	// task age
 	// hook_run task waiting time
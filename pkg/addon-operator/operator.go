@@ -1,6 +1,7 @@
 package addon_operator
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -9,13 +10,19 @@ import (
 	"os"
 	"path"
 	"runtime/trace"
+	"sort"
 	"strings"
+	"sync"
+	"text/tabwriter"
 	"time"
 
 	"github.com/go-chi/chi"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	log "github.com/sirupsen/logrus"
 	"gopkg.in/satori/go.uuid.v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"sigs.k8s.io/yaml"
 
 	sh_app "github.com/flant/shell-operator/pkg/app"
@@ -31,9 +38,12 @@ import (
 
 	"github.com/flant/addon-operator/pkg/app"
 	"github.com/flant/addon-operator/pkg/helm"
+	"github.com/flant/addon-operator/pkg/helm/client"
+	"github.com/flant/addon-operator/pkg/helm/post_renderer"
 	"github.com/flant/addon-operator/pkg/helm_resources_manager"
 	. "github.com/flant/addon-operator/pkg/hook/types"
 	"github.com/flant/addon-operator/pkg/kube_config_manager"
+	"github.com/flant/addon-operator/pkg/manifests_validator"
 	"github.com/flant/addon-operator/pkg/module_manager"
 	"github.com/flant/addon-operator/pkg/task"
 	"github.com/flant/addon-operator/pkg/utils"
@@ -49,6 +59,12 @@ type AddonOperator struct {
 	ModulesDir     string
 	GlobalHooksDir string
 
+	// Instance is a configuration of this Addon-operator instance.
+	Instance *app.Instance
+
+	// Helm creates Helm clients and release names for this instance.
+	Helm *helm.Helm
+
 	KubeConfigManager kube_config_manager.KubeConfigManager
 
 	// ModuleManager is the module manager object, which monitors configuration
@@ -62,11 +78,47 @@ type AddonOperator struct {
 	StartupConvergeDone    bool
 	ConvergeStarted        int64
 	ConvergeActivation     string
+
+	// moduleRunLock serializes onStartup and Synchronization phases of ModuleRun tasks
+	// executed in parallel queues: hook queues and kubernetes monitors are not thread-safe.
+	moduleRunLock sync.Mutex
+
+	// failedModulesLock serializes ModuleRun tasks in queues for failed modules
+	// with stopping these queues before module is deleted.
+	failedModulesLock   sync.Mutex
+	failedModuleRunning map[string]bool
+	// failedModuleStopped marks running retries of deleted modules, they are dropped when finished.
+	failedModuleStopped map[string]bool
+
+	// parallelModuleRunDone is signaled when ModuleRun task in a parallel queue is handled.
+	parallelModuleRunDone chan struct{}
+
+	// hotReloadChecksum is a checksum of global hooks and modules directories
+	// calculated on init. It is a starting point for the hot reload goroutine.
+	hotReloadChecksum string
+
+	// purgeLock protects last purge decisions and purge confirmations.
+	purgeLock      sync.Mutex
+	purgeDecisions map[string]string
+	purgeConfirmed map[string]bool
 }
 
+// Purge decisions for releases of unknown modules.
+const (
+	PurgeDecisionPurged   = "purged"
+	PurgeDecisionFailed   = "failed"
+	PurgeDecisionDryRun   = "dry-run"
+	PurgeDecisionPending  = "pending-confirmation"
+	PurgeDecisionNotOwned = "not-owned"
+	PurgeDecisionPaused   = "paused"
+)
+
 func NewAddonOperator() *AddonOperator {
 	return &AddonOperator{
-		ShellOperator: &shell_operator.ShellOperator{},
+		ShellOperator:         &shell_operator.ShellOperator{},
+		purgeDecisions:        make(map[string]string),
+		purgeConfirmed:        make(map[string]bool),
+		parallelModuleRunDone: make(chan struct{}, 1),
 	}
 }
 
@@ -78,6 +130,10 @@ func (op *AddonOperator) WithGlobalHooksDir(dir string) {
 	op.GlobalHooksDir = dir
 }
 
+func (op *AddonOperator) WithInstance(instance *app.Instance) {
+	op.Instance = instance
+}
+
 func (op *AddonOperator) WithContext(ctx context.Context) *AddonOperator {
 	op.ctx, op.cancel = context.WithCancel(ctx)
 	op.ShellOperator.WithContext(op.ctx)
@@ -101,6 +157,12 @@ func (op *AddonOperator) InitMetricStorage() {
 	metricStorage := metric_storage.NewMetricStorage()
 	metricStorage.WithContext(op.ctx)
 	metricStorage.WithPrefix(sh_app.PrometheusMetricsPrefix)
+	if op.Instance != nil && op.Instance.ID != "" {
+		// Add instance_id label to all metrics of this instance.
+		registerer := prometheus.WrapRegistererWith(prometheus.Labels{"instance_id": op.Instance.ID}, metricStorage.Registerer)
+		metricStorage.Registerer = registerer
+		metricStorage.GroupedVault.Registerer = registerer
+	}
 	metricStorage.Start()
 	RegisterAddonOperatorMetrics(metricStorage)
 	op.MetricStorage = metricStorage
@@ -148,8 +210,23 @@ func (op *AddonOperator) InitModuleManager() error {
 
 	logEntry.Infof("Addon-operator namespace: %s", app.Namespace)
 
+	err = task.InitRetryPolicies(app.TaskRetryPolicies)
+	if err != nil {
+		return err
+	}
+
 	// Initialize helm client, choose helm3 or helm2+tiller
-	err = helm.Init(op.KubeClient)
+	op.Helm, err = helm.Init(op.KubeClient, op.Instance)
+	if err != nil {
+		return err
+	}
+
+	err = post_renderer.Init(app.PostRenderConfig)
+	if err != nil {
+		return err
+	}
+
+	err = manifests_validator.Init(app.ManifestsValidation, app.OpenAPISchemasDir, app.KubernetesVersion, op.KubeClient.Discovery())
 	if err != nil {
 		return err
 	}
@@ -159,27 +236,32 @@ func (op *AddonOperator) InitModuleManager() error {
 	op.KubeConfigManager.WithKubeClient(op.KubeClient)
 	op.KubeConfigManager.WithContext(op.ctx)
 	op.KubeConfigManager.WithNamespace(app.Namespace)
-	op.KubeConfigManager.WithConfigMapName(app.ConfigMapName)
+	op.KubeConfigManager.WithConfigMapName(op.Instance.ConfigMapName)
 	op.KubeConfigManager.WithValuesChecksumsAnnotation(app.ValuesChecksumsAnnotation)
 
-	err = op.KubeConfigManager.Init()
-	if err != nil {
-		return fmt.Errorf("init kube config manager: %s", err)
-	}
-
 	op.ModuleManager = module_manager.NewMainModuleManager()
 	op.ModuleManager.WithContext(op.ctx)
 	op.ModuleManager.WithDirectories(op.ModulesDir, op.GlobalHooksDir, op.TempDir)
 	op.ModuleManager.WithKubeConfigManager(op.KubeConfigManager)
+	op.ModuleManager.WithKubeClient(op.KubeClient)
 	op.ModuleManager.WithScheduleManager(op.ScheduleManager)
 	op.ModuleManager.WithKubeEventManager(op.KubeEventsManager)
 	op.ModuleManager.WithMetricStorage(op.MetricStorage)
 	op.ModuleManager.WithHookMetricStorage(op.HookMetricStorage)
+	op.ModuleManager.WithHelm(op.Helm)
+	op.ModuleManager.WithConfigMapName(op.Instance.ConfigMapName)
 	err = op.ModuleManager.Init()
 	if err != nil {
 		return fmt.Errorf("init module manager: %s", err)
 	}
 
+	if app.HotReloadInterval > 0 {
+		op.hotReloadChecksum, err = utils.CalculateChecksumOfPaths(op.ModulesDir, op.GlobalHooksDir)
+		if err != nil {
+			return fmt.Errorf("calculate checksum of directories for hot reload: %s", err)
+		}
+	}
+
 	op.DefineEventHandlers()
 
 	// Init helm resources manager
@@ -358,6 +440,10 @@ func (op *AddonOperator) Start() {
 
 	op.ModuleManager.Start()
 	op.StartModuleManagerEventHandler()
+
+	if app.HotReloadInterval > 0 {
+		op.StartHotReload()
+	}
 }
 
 // PrepopulateMainQueue adds tasks to run hooks with OnStartup bindings
@@ -620,7 +706,7 @@ func (op *AddonOperator) StartModuleManagerEventHandler() {
 					logEntry := eventLogEntry.WithFields(utils.LabelsToLogFields(logLabels))
 					for _, moduleChange := range moduleEvent.ModulesChanges {
 						// Do not add ModuleRun task if it is already queued.
-						hasTask := QueueHasModuleRunTask(op.TaskQueues.GetMain(), moduleChange.Name)
+						hasTask := op.IsModuleRunQueued(moduleChange.Name)
 						if !hasTask {
 							logEntry.WithField("module", moduleChange.Name).Infof("module values are changed, queue ModuleRun task")
 							newLabels := utils.MergeLabels(logLabels)
@@ -682,13 +768,16 @@ func (op *AddonOperator) StartModuleManagerEventHandler() {
 					"event.id": uuid.NewV4().String(),
 					"module":   absentResourcesEvent.ModuleName,
 				}
+				if absentResourcesEvent.Part != "" {
+					logLabels["chart"] = absentResourcesEvent.Part
+				}
 				eventLogEntry := log.WithField("operator.component", "handleManagerEvents").
 					WithFields(utils.LabelsToLogFields(logLabels))
 
 				//eventLogEntry.Debugf("Got %d absent resources from module", len(absentResourcesEvent.Absent))
 
 				// Do not add ModuleRun task if it is already queued.
-				hasTask := QueueHasModuleRunTask(op.TaskQueues.GetMain(), absentResourcesEvent.ModuleName)
+				hasTask := op.IsModuleRunQueued(absentResourcesEvent.ModuleName)
 				if !hasTask {
 					newTask := sh_task.NewTask(task.ModuleRun).
 						WithLogLabels(logLabels).
@@ -884,10 +973,27 @@ func (op *AddonOperator) TaskHandler(t sh_task.Task) queue.TaskResult {
 
 	case task.ModuleRun:
 		res = op.HandleModuleRun(t, taskLogLabels)
+		if task.HookMetadataAccessor(t).ParallelRunId != "" {
+			// Wake up ParallelModuleRun task when ModuleRun is removed from the parallel queue.
+			res.AfterHandle = op.notifyParallelModuleRunDone
+		}
+
+	case task.ParallelModuleRun:
+		res = op.HandleParallelModuleRun(t, taskLogLabels)
 
 	case task.ModuleDelete:
-		// TODO wait while module's tasks in other queues are done.
 		hm := task.HookMetadataAccessor(t)
+		// Paused module is not touched: release is kept until unpause.
+		if op.ModuleManager.IsModulePaused(hm.ModuleName) {
+			if module := op.ModuleManager.GetModule(hm.ModuleName); module != nil {
+				module.State.DeletePaused = true
+			}
+			taskLogEntry.Infof("Module is paused, skip ModuleDelete: module is deleted after unpause")
+			res.Status = "Success"
+			break
+		}
+		// Retry of the failed module can install release again, so it should be stopped first.
+		op.StopFailedModule(hm.ModuleName)
 		taskLogEntry.Infof("Module delete '%s'", hm.ModuleName)
 		err := op.ModuleManager.DeleteModule(hm.ModuleName, t.GetLogLabels())
 		if err != nil {
@@ -898,6 +1004,9 @@ func (op *AddonOperator) TaskHandler(t sh_task.Task) queue.TaskResult {
 			res.Status = "Fail"
 		} else {
 			taskLogEntry.Infof("Module delete success '%s'", hm.ModuleName)
+			if module := op.ModuleManager.GetModule(hm.ModuleName); module != nil {
+				module.State.DeletePaused = false
+			}
 			res.Status = "Success"
 		}
 
@@ -905,17 +1014,7 @@ func (op *AddonOperator) TaskHandler(t sh_task.Task) queue.TaskResult {
 		res = op.HandleModuleHookRun(t, taskLogLabels)
 
 	case task.ModulePurge:
-		// Purge is for unknown modules, so error is just ignored.
-		taskLogEntry.Infof("Module purge start")
-		hm := task.HookMetadataAccessor(t)
-
-		err := helm.NewClient(t.GetLogLabels()).DeleteRelease(hm.ModuleName)
-		if err != nil {
-			taskLogEntry.Warnf("Module purge failed, no retry. Error: %s", err)
-		} else {
-			taskLogEntry.Infof("Module purge success")
-		}
-		res.Status = "Success"
+		res = op.HandleModulePurge(t, taskLogLabels)
 
 	case task.ModuleManagerRetry:
 		op.MetricStorage.CounterAdd("{PREFIX}modules_discover_errors_total", 1.0, map[string]string{})
@@ -924,6 +1023,21 @@ func (op *AddonOperator) TaskHandler(t sh_task.Task) queue.TaskResult {
 
 		res.Status = "Success"
 		res.DelayBeforeNextTask = queue.DelayOnFailedTask
+
+	case task.HotReload:
+		res = op.HandleHotReload(t, taskLogLabels)
+	}
+
+	switch res.Status {
+	case "Fail":
+		if res.DelayBeforeNextTask == 0 {
+			res.DelayBeforeNextTask = op.RetryPolicyForTask(t).Delay(t.GetFailureCount())
+		}
+		op.UpdateTaskRetryState(t, res.DelayBeforeNextTask)
+	case "Success":
+		if t.GetFailureCount() > 0 {
+			op.UpdateTaskRetryState(t, 0)
+		}
 	}
 
 	if res.Status == "Success" {
@@ -939,6 +1053,327 @@ func (op *AddonOperator) TaskHandler(t sh_task.Task) queue.TaskResult {
 	return res
 }
 
+// StartHotReload periodically checks global hooks and modules directories
+// and queues a HotReload task if something is changed.
+func (op *AddonOperator) StartHotReload() {
+	logEntry := log.WithField("operator.component", "hotReload")
+	logEntry.Infof("Hot reload is enabled, check directories every %s", app.HotReloadInterval.String())
+
+	// Checksum is owned by the goroutine.
+	lastChecksum := op.hotReloadChecksum
+
+	go func() {
+		ticker := time.NewTicker(app.HotReloadInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-op.ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			checksum, err := utils.CalculateChecksumOfPaths(op.ModulesDir, op.GlobalHooksDir)
+			if err != nil {
+				logEntry.Errorf("Calculate checksum of directories: %v", err)
+				continue
+			}
+			if checksum == lastChecksum {
+				continue
+			}
+			lastChecksum = checksum
+
+			mainQueue := op.TaskQueues.GetMain()
+			hasHotReload := false
+			mainQueue.Iterate(func(t sh_task.Task) {
+				if t.GetType() == task.HotReload {
+					hasHotReload = true
+				}
+			})
+			if hasHotReload {
+				continue
+			}
+
+			logLabels := map[string]string{
+				"event.id": uuid.NewV4().String(),
+				"queue":    "main",
+				"binding":  string(task.HotReload),
+			}
+			newTask := sh_task.NewTask(task.HotReload).
+				WithLogLabels(logLabels).
+				WithQueueName("main").
+				WithMetadata(task.HookMetadata{
+					EventDescription: "HotReload",
+				})
+			mainQueue.AddLast(newTask.WithQueuedAt(time.Now()))
+			logEntry.WithFields(utils.LabelsToLogFields(newTask.LogLabels)).
+				Infof("Directories are changed, queue task %s", newTask.GetDescription())
+		}
+	}()
+}
+
+// HandleHotReload reloads changed global hooks and modules. Bindings of changed global hooks
+// are enabled again, changed modules are restarted, and modules discovery is started
+// if modules are added or removed.
+func (op *AddonOperator) HandleHotReload(t sh_task.Task, labels map[string]string) (res queue.TaskResult) {
+	logEntry := log.WithFields(utils.LabelsToLogFields(labels))
+	hm := task.HookMetadataAccessor(t)
+
+	op.moduleRunLock.Lock()
+	changes, err := op.ModuleManager.ReloadDirectories(t.GetLogLabels())
+	if err == nil {
+		// Start queues for new bindings of global hooks.
+		op.InitAndStartHookQueues()
+	}
+	op.moduleRunLock.Unlock()
+
+	if err != nil {
+		logEntry.Errorf("Hot reload failed, requeue task to retry after delay. Failed count is %d. Error: %s", t.GetFailureCount()+1, err)
+		t.UpdateFailureMessage(err.Error())
+		t.WithQueuedAt(time.Now())
+		res.Status = "Fail"
+		return
+	}
+
+	res.Status = "Success"
+	if changes.IsEmpty() {
+		logEntry.Infof("Hot reload: no changes in hooks and modules")
+		return
+	}
+	logEntry.Infof("Hot reload: changed global hooks %v, changed modules %v, discovery needed: %v", changes.GlobalHooks, changes.Modules, changes.DiscoveryNeeded)
+
+	newLogLabels := utils.MergeLabels(t.GetLogLabels())
+	delete(newLogLabels, "task.id")
+
+	tasks := make([]sh_task.Task, 0)
+	kubeTasksQueued := false
+	for _, hookName := range changes.GlobalHooks {
+		globalHook := op.ModuleManager.GetGlobalHook(hookName)
+		if globalHook.Config.HasBinding(Schedule) {
+			tasks = append(tasks, sh_task.NewTask(task.GlobalHookEnableScheduleBindings).
+				WithLogLabels(utils.MergeLabels(newLogLabels, map[string]string{
+					"hook":      hookName,
+					"hook.type": "global",
+					"binding":   string(task.GlobalHookEnableScheduleBindings),
+				})).
+				WithQueueName("main").
+				WithMetadata(task.HookMetadata{
+					EventDescription: hm.EventDescription,
+					HookName:         hookName,
+				}))
+		}
+		if globalHook.Config.HasBinding(OnKubernetesEvent) {
+			tasks = append(tasks, sh_task.NewTask(task.GlobalHookEnableKubernetesBindings).
+				WithLogLabels(utils.MergeLabels(newLogLabels, map[string]string{
+					"hook":      hookName,
+					"hook.type": "global",
+					"binding":   string(task.GlobalHookEnableKubernetesBindings),
+				})).
+				WithQueueName("main").
+				WithMetadata(task.HookMetadata{
+					EventDescription: hm.EventDescription,
+					HookName:         hookName,
+				}))
+			kubeTasksQueued = true
+		}
+	}
+	if kubeTasksQueued {
+		tasks = append(tasks, sh_task.NewTask(task.GlobalHookWaitKubernetesSynchronization).
+			WithLogLabels(utils.MergeLabels(newLogLabels, map[string]string{
+				"binding": string(task.GlobalHookWaitKubernetesSynchronization),
+			})).
+			WithQueueName("main").
+			WithMetadata(task.HookMetadata{
+				EventDescription: hm.EventDescription,
+			}))
+	}
+
+	// Global hooks can change values for all modules, so run all modules.
+	if len(changes.GlobalHooks) > 0 || changes.DiscoveryNeeded {
+		tasks = append(tasks, sh_task.NewTask(task.ReloadAllModules).
+			WithLogLabels(utils.MergeLabels(newLogLabels, map[string]string{
+				"binding": string(task.ReloadAllModules),
+			})).
+			WithQueueName("main").
+			WithMetadata(task.HookMetadata{
+				EventDescription: hm.EventDescription,
+				OnStartupHooks:   false,
+			}))
+	} else {
+		for _, moduleName := range changes.Modules {
+			tasks = append(tasks, sh_task.NewTask(task.ModuleRun).
+				WithLogLabels(utils.MergeLabels(newLogLabels, map[string]string{
+					"module": moduleName,
+				})).
+				WithQueueName("main").
+				WithMetadata(task.HookMetadata{
+					EventDescription: hm.EventDescription,
+					ModuleName:       moduleName,
+					OnStartupHooks:   true,
+				}))
+		}
+	}
+
+	for _, tsk := range tasks {
+		tsk.WithQueuedAt(time.Now())
+		logEntry.WithFields(utils.LabelsToLogFields(tsk.GetLogLabels())).
+			Infof("queue task %s", tsk.GetDescription())
+	}
+	res.AfterTasks = tasks
+	return
+}
+
+// HandleModulePurge deletes a Helm release of an unknown module according to the purge mode.
+func (op *AddonOperator) HandleModulePurge(t sh_task.Task, labels map[string]string) (res queue.TaskResult) {
+	logEntry := log.WithFields(utils.LabelsToLogFields(labels))
+	hm := task.HookMetadataAccessor(t)
+	res.Status = "Success"
+
+	switch app.PurgeMode {
+	case app.PurgeModeDryRun:
+		logEntry.Infof("Module purge is skipped in the '%s' purge mode", app.PurgeMode)
+		op.ReportPurgeDecision(hm.ModuleName, PurgeDecisionDryRun, "Release of unknown module is not purged in the dry-run mode")
+		return
+	case app.PurgeModeConfirm:
+		if !op.IsPurgeConfirmed(hm.ModuleName) {
+			logEntry.Infof("Module purge is waiting for confirmation: run 'addon-operator module purge %s'", hm.ModuleName)
+			op.ReportPurgeDecision(hm.ModuleName, PurgeDecisionPending, "Release of unknown module is waiting for purge confirmation")
+			return
+		}
+	}
+
+	// Paused release is not touched. Purge is queued again by modules discovery after unpause.
+	if op.ModuleManager.IsModulePaused(hm.ModuleName) {
+		logEntry.Infof("Module is paused, skip ModulePurge")
+		op.ReportPurgeDecision(hm.ModuleName, PurgeDecisionPaused, "Release of unknown module is paused and is not purged")
+		return
+	}
+
+	op.StopFailedModule(hm.ModuleName)
+
+	// Purge is for unknown modules, so error is just ignored.
+	logEntry.Infof("Module purge start")
+	err := op.Helm.NewClient(t.GetLogLabels()).DeleteRelease(hm.ModuleName)
+	if err != nil {
+		logEntry.Warnf("Module purge failed, no retry. Error: %s", err)
+		op.ReportPurgeDecision(hm.ModuleName, PurgeDecisionFailed, fmt.Sprintf("Release of unknown module is not purged: %v", err))
+	} else {
+		logEntry.Infof("Module purge success")
+		op.ReportPurgeDecision(hm.ModuleName, PurgeDecisionPurged, "Release of unknown module is purged")
+	}
+	return
+}
+
+// UpdatePurgeCandidates reports releases that are not owned by Addon-operator and
+// forgets decisions for releases that are deleted or belong to known modules now.
+func (op *AddonOperator) UpdatePurgeCandidates(state *module_manager.ModulesState) {
+	for _, releaseName := range state.NotOwnedUnknownReleases {
+		op.ReportPurgeDecision(releaseName, PurgeDecisionNotOwned, "Release of unknown module is not purged: it is not owned by addon-operator")
+	}
+
+	candidates := make(map[string]bool)
+	for _, releaseName := range state.ReleasedUnknownModules {
+		candidates[releaseName] = true
+	}
+	for _, releaseName := range state.NotOwnedUnknownReleases {
+		candidates[releaseName] = true
+	}
+
+	op.purgeLock.Lock()
+	defer op.purgeLock.Unlock()
+	for releaseName := range op.purgeDecisions {
+		if !candidates[releaseName] {
+			delete(op.purgeDecisions, releaseName)
+			delete(op.purgeConfirmed, releaseName)
+		}
+	}
+}
+
+// ReportPurgeDecision increases a metric and creates an event when the purge
+// decision for the release is changed.
+func (op *AddonOperator) ReportPurgeDecision(releaseName string, decision string, message string) {
+	op.purgeLock.Lock()
+	if op.purgeDecisions[releaseName] == decision {
+		op.purgeLock.Unlock()
+		return
+	}
+	op.purgeDecisions[releaseName] = decision
+	if decision == PurgeDecisionPurged || decision == PurgeDecisionFailed {
+		delete(op.purgeConfirmed, releaseName)
+	}
+	op.purgeLock.Unlock()
+
+	op.MetricStorage.CounterAdd("{PREFIX}module_purge_decisions_total", 1.0, map[string]string{
+		"module":   releaseName,
+		"decision": decision,
+	})
+
+	if op.KubeClient == nil {
+		return
+	}
+	eventType := v1.EventTypeNormal
+	if decision == PurgeDecisionFailed {
+		eventType = v1.EventTypeWarning
+	}
+	now := metav1.Now()
+	event := &v1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			// Name is generated like client-go event recorder does: <object name>.<timestamp>.
+			Name:      fmt.Sprintf("%s.%x", op.Instance.ConfigMapName, now.UnixNano()),
+			Namespace: app.Namespace,
+		},
+		// Events are attached to the ConfigMap with modules configuration.
+		InvolvedObject: v1.ObjectReference{
+			APIVersion: "v1",
+			Kind:       "ConfigMap",
+			Namespace:  app.Namespace,
+			Name:       op.Instance.ConfigMapName,
+		},
+		Reason:         "ModulePurge",
+		Message:        fmt.Sprintf("%s: release '%s', decision '%s'", message, releaseName, decision),
+		Type:           eventType,
+		Source:         v1.EventSource{Component: "addon-operator"},
+		FirstTimestamp: now,
+		LastTimestamp:  now,
+		Count:          1,
+	}
+	_, err := op.KubeClient.CoreV1().Events(app.Namespace).Create(event)
+	if err != nil {
+		log.Warnf("Cannot create event for purge decision '%s' of release '%s': %v", decision, releaseName, err)
+	}
+}
+
+// IsPurgeConfirmed returns true if the release purge is confirmed in the 'confirm' purge mode.
+func (op *AddonOperator) IsPurgeConfirmed(releaseName string) bool {
+	op.purgeLock.Lock()
+	defer op.purgeLock.Unlock()
+	return op.purgeConfirmed[releaseName]
+}
+
+// ConfirmPurge confirms the purge of the release that is waiting for confirmation.
+func (op *AddonOperator) ConfirmPurge(releaseName string) bool {
+	op.purgeLock.Lock()
+	defer op.purgeLock.Unlock()
+	if op.purgeDecisions[releaseName] != PurgeDecisionPending {
+		return false
+	}
+	op.purgeConfirmed[releaseName] = true
+	return true
+}
+
+// PendingPurges returns sorted names of releases that are waiting for purge confirmation.
+func (op *AddonOperator) PendingPurges() []string {
+	op.purgeLock.Lock()
+	defer op.purgeLock.Unlock()
+	res := make([]string, 0)
+	for releaseName, decision := range op.purgeDecisions {
+		if decision == PurgeDecisionPending {
+			res = append(res, releaseName)
+		}
+	}
+	sort.Strings(res)
+	return res
+}
+
 // TODO pass queue name from handler, not from task
 func (op *AddonOperator) UpdateWaitInQueueMetric(t sh_task.Task) {
 	metricLabels := map[string]string{
@@ -965,7 +1400,8 @@ func (op *AddonOperator) UpdateWaitInQueueMetric(t sh_task.Task) {
 
 	case task.ReloadAllModules,
 		task.DiscoverModulesState,
-		task.ModuleManagerRetry:
+		task.ModuleManagerRetry,
+		task.ParallelModuleRun:
 		// no action required
 	}
 
@@ -1000,6 +1436,43 @@ func (op *AddonOperator) HandleModuleRun(t sh_task.Task, labels map[string]strin
 	hm := task.HookMetadataAccessor(t)
 	module := op.ModuleManager.GetModule(hm.ModuleName)
 
+	// Paused module is not touched: no hooks and no Helm.
+	if op.ModuleManager.IsModulePaused(hm.ModuleName) {
+		if !module.State.Paused {
+			op.PauseModule(hm.ModuleName, logEntry)
+		}
+		logEntry.Infof("Module is paused, skip ModuleRun")
+		res.Status = "Success"
+		return
+	}
+	if module.State.Paused {
+		op.UnpauseModule(hm.ModuleName, logEntry)
+	}
+	// Module is enabled again.
+	module.State.DeletePaused = false
+
+	// Module can be paused before the first run or restarted by the hot reload.
+	if !module.State.OnStartupDone {
+		hm.OnStartupHooks = true
+	}
+
+	// Failed module is retried in the background, so ModuleRun should not block the current queue.
+	if module.State.Failed && t.GetQueueName() != FailedModuleQueueName(hm.ModuleName) {
+		logEntry.Infof("Module is in the Failed state, ModuleRun is moved to the queue '%s'", FailedModuleQueueName(hm.ModuleName))
+		op.QueueFailedModuleRun(t)
+		res.Status = "Success"
+		return
+	}
+	isFailedModuleRetry := t.GetQueueName() == FailedModuleQueueName(hm.ModuleName)
+	if isFailedModuleRetry {
+		if !op.startFailedModuleRun(t) {
+			logEntry.Infof("Queue '%s' is stopped, skip ModuleRun", t.GetQueueName())
+			res.Status = "Success"
+			return
+		}
+		defer op.doneFailedModuleRun(hm.ModuleName)
+	}
+
 	metricLabels := map[string]string{
 		"module":     hm.ModuleName,
 		"activation": labels["event.type"],
@@ -1009,10 +1482,13 @@ func (op *AddonOperator) HandleModuleRun(t sh_task.Task, labels map[string]strin
 		op.MetricStorage.HistogramObserve("{PREFIX}module_run_seconds", d.Seconds(), metricLabels)
 	})()
 
-	var syncQueueName = fmt.Sprintf("main-subqueue-kubernetes-Synchronization-module-%s", hm.ModuleName)
+	var syncQueueName = ModuleSynchronizationQueueName(hm.ModuleName)
 	var moduleRunErr error
 	var valuesChanged = false
 
+	// ModuleRun can be executed in a parallel queue, so startup phases are serialized.
+	op.moduleRunLock.Lock()
+
 	if hm.OnStartupHooks && !module.State.OnStartupDone {
 		treg := trace.StartRegion(context.Background(), "ModuleRun-OnStartup")
 		logEntry.WithField("module.state", "startup").
@@ -1052,7 +1528,7 @@ func (op *AddonOperator) HandleModuleRun(t sh_task.Task, labels map[string]strin
 
 		err := op.ModuleManager.HandleModuleEnableKubernetesBindings(hm.ModuleName, func(hook *module_manager.ModuleHook, info controller.BindingExecutionInfo) {
 			queueName := info.QueueName
-			if queueName == t.GetQueueName() {
+			if queueName == "main" {
 				// main
 				queueName = syncQueueName
 			}
@@ -1082,7 +1558,7 @@ func (op *AddonOperator) HandleModuleRun(t sh_task.Task, labels map[string]strin
 				WithQueueName(queueName).
 				WithMetadata(taskMeta)
 
-			if info.QueueName == t.GetQueueName() {
+			if info.QueueName == "main" {
 				mainSyncTasks = append(mainSyncTasks, newTask)
 			} else {
 				if info.WaitForSynchronization {
@@ -1193,6 +1669,7 @@ func (op *AddonOperator) HandleModuleRun(t sh_task.Task, labels map[string]strin
 			op.TaskQueues.Remove(syncQueueName)
 		} else {
 			logEntry.Debugf("Module run repeat")
+			op.moduleRunLock.Unlock()
 			t.WithQueuedAt(time.Now())
 			res.Status = "Repeat"
 			return
@@ -1206,6 +1683,15 @@ func (op *AddonOperator) HandleModuleRun(t sh_task.Task, labels map[string]strin
 		module.State.MonitorsStarted = true
 	}
 
+	op.moduleRunLock.Unlock()
+
+	// Retry of the deleted module is dropped before the release is installed again.
+	if isFailedModuleRetry && op.isFailedModuleStopped(hm.ModuleName) {
+		logEntry.Infof("Module is deleted, drop ModuleRun retry")
+		res.Status = "Success"
+		return
+	}
+
 	// Phase with helm hooks and helm chart.
 	if moduleRunErr == nil && module.State.OnStartupDone && module.State.SynchronizationDone {
 		logEntry.Info("ModuleRun 'Helm' phase")
@@ -1213,14 +1699,60 @@ func (op *AddonOperator) HandleModuleRun(t sh_task.Task, labels map[string]strin
 		valuesChanged, moduleRunErr = module.Run(t.GetLogLabels())
 	}
 
+	if isFailedModuleRetry && op.isFailedModuleStopped(hm.ModuleName) {
+		logEntry.Infof("Module is deleted while the 'Helm' phase is running, drop ModuleRun retry")
+		res.Status = "Success"
+		// Release can be installed after it is deleted, so the disabled module is deleted again.
+		if !utils.ListFullyIn([]string{hm.ModuleName}, op.ModuleManager.GetModuleNamesInOrder()) {
+			newLogLabels := utils.MergeLabels(t.GetLogLabels())
+			newLogLabels["queue"] = "main"
+			delete(newLogLabels, "task.id")
+			newTask := sh_task.NewTask(task.ModuleDelete).
+				WithLogLabels(newLogLabels).
+				WithQueueName("main").
+				WithMetadata(task.HookMetadata{
+					EventDescription: hm.EventDescription,
+					ModuleName:       hm.ModuleName,
+				})
+			op.TaskQueues.GetMain().AddLast(newTask.WithQueuedAt(time.Now()))
+			logEntry.WithFields(utils.LabelsToLogFields(newTask.LogLabels)).
+				Infof("queue task %s", newTask.GetDescription())
+		}
+		return
+	}
+
 	if moduleRunErr != nil {
+		module.State.SetFailure(moduleRunErr)
 		op.MetricStorage.CounterAdd("{PREFIX}module_run_errors_total", 1.0, map[string]string{"module": hm.ModuleName})
-		logEntry.WithField("module.state", "failed").
-			Errorf("ModuleRun failed. Requeue task to retry after delay. Failed count is %d. Error: %s", t.GetFailureCount()+1, moduleRunErr)
 		t.UpdateFailureMessage(moduleRunErr.Error())
 		t.WithQueuedAt(time.Now())
 		res.Status = "Fail"
+
+		switch {
+		case module.State.Failed:
+			// Retry in the background with exponential backoff.
+			res.DelayBeforeNextTask = op.FailedModuleRetryPolicy(t, module).Delay(module.State.FailureCount)
+			logEntry.WithField("module.state", "failed").
+				Errorf("ModuleRun failed in the Failed state. Retry after %s. Failed count is %d. Error: %s", res.DelayBeforeNextTask.String(), module.State.FailureCount, moduleRunErr)
+		case ShouldPutModuleInFailedState(module.State):
+			// Too many failures: remove task from the critical path.
+			module.State.Failed = true
+			op.MetricStorage.GaugeSet("{PREFIX}module_failed", 1.0, map[string]string{"module": hm.ModuleName})
+			logEntry.WithField("module.state", "failed").
+				Errorf("ModuleRun failed %d times since %s, module is put into the Failed state and will be retried in the queue '%s'. Error: %s", module.State.FailureCount, module.State.FirstFailureTime.Format(time.RFC3339), FailedModuleQueueName(hm.ModuleName), moduleRunErr)
+			op.QueueFailedModuleRun(t)
+			res.Status = "Success"
+		default:
+			logEntry.WithField("module.state", "failed").
+				Errorf("ModuleRun failed. Requeue task to retry after delay. Failed count is %d. Error: %s", t.GetFailureCount()+1, moduleRunErr)
+		}
 	} else {
+		if module.State.Failed {
+			logEntry.WithField("module.state", "recovered").
+				Infof("ModuleRun success after %d failures, module is not in the Failed state anymore", module.State.FailureCount)
+			op.MetricStorage.GaugeSet("{PREFIX}module_failed", 0.0, map[string]string{"module": hm.ModuleName})
+		}
+		module.State.ResetFailure()
 		res.Status = "Success"
 		if valuesChanged {
 			logEntry.WithField("module.state", "restart").
@@ -1248,58 +1780,476 @@ func (op *AddonOperator) HandleModuleRun(t sh_task.Task, labels map[string]strin
 	return
 }
 
-func (op *AddonOperator) HandleModuleHookRun(t sh_task.Task, labels map[string]string) (res queue.TaskResult) {
-	defer trace.StartRegion(context.Background(), "ModuleHookRun").End()
+// FailedModuleQueueName returns a name of the queue to retry module in the Failed state.
+func FailedModuleQueueName(moduleName string) string {
+	return fmt.Sprintf("failed-module-%s", moduleName)
+}
 
-	logEntry := log.WithFields(utils.LabelsToLogFields(labels))
+// ShouldPutModuleInFailedState returns true if module is failed more times than
+// ModuleFailureThreshold or fails longer than ModuleFailureTimeout.
+func ShouldPutModuleInFailedState(state *module_manager.ModuleState) bool {
+	if app.ModuleFailureThreshold > 0 && state.FailureCount >= app.ModuleFailureThreshold {
+		return true
+	}
+	if app.ModuleFailureTimeout > 0 && state.FailureCount > 0 && time.Since(state.FirstFailureTime) >= app.ModuleFailureTimeout {
+		return true
+	}
+	return false
+}
 
+// QueueFailedModuleRun copies ModuleRun task into the module's background queue.
+// The queue is created and started on demand.
+func (op *AddonOperator) QueueFailedModuleRun(t sh_task.Task) {
 	hm := task.HookMetadataAccessor(t)
-	taskHook := op.ModuleManager.GetModuleHook(hm.HookName)
+	queueName := FailedModuleQueueName(hm.ModuleName)
 
-	metricLabels := map[string]string{
-		"module":     hm.ModuleName,
-		"hook":       hm.HookName,
-		"binding":    string(hm.BindingType),
-		"queue":      t.GetQueueName(),
-		"activation": labels["event.type"],
+	if op.TaskQueues.GetByName(queueName) == nil {
+		op.TaskQueues.DoWithLock(func(tqs *queue.TaskQueueSet) {
+			tqs.NewNamedQueue(queueName, op.TaskHandler)
+		})
+		op.TaskQueues.GetByName(queueName).Start()
+		log.Infof("Queue '%s' started for module in the Failed state", queueName)
 	}
+	q := op.TaskQueues.GetByName(queueName)
 
-	defer Duration(func(d time.Duration) {
-		op.MetricStorage.HistogramObserve("{PREFIX}module_hook_run_seconds", d.Seconds(), metricLabels)
-	})()
+	if QueueHasModuleRunTask(q, hm.ModuleName) {
+		return
+	}
 
-	logEntry.Infof("Module hook start '%s'", hm.HookName)
+	// Task is not a part of parallel run anymore.
+	hm.ParallelRunId = ""
+	newLabels := utils.MergeLabels(t.GetLogLabels())
+	newLabels["queue"] = queueName
+	delete(newLabels, "task.id")
+	newTask := sh_task.NewTask(task.ModuleRun).
+		WithLogLabels(newLabels).
+		WithQueueName(queueName).
+		WithMetadata(hm)
+	q.AddLast(newTask.WithQueuedAt(time.Now()))
+}
 
-	if taskHook.Config.Version == "v1" {
-		// save kubernetes binding ids
-		kubeIds := make(map[string]bool)
-		op.TaskQueues.GetByName(t.GetQueueName()).Iterate(func(tsk sh_task.Task) {
-			thm := task.HookMetadataAccessor(tsk)
-			logEntry.Debugf("kubeId: hook %s id %s", thm.HookName, thm.KubernetesBindingId)
-			if thm.HookName == hm.HookName && thm.KubernetesBindingId != "" {
-				kubeIds[thm.KubernetesBindingId] = false
-			}
-		})
-		logEntry.Debugf("kubeIds: %+v", kubeIds)
+// ModuleSynchronizationQueueName returns a name of the temporary queue for module's Synchronization tasks.
+func ModuleSynchronizationQueueName(moduleName string) string {
+	return fmt.Sprintf("main-subqueue-kubernetes-Synchronization-module-%s", moduleName)
+}
 
-		bcs := op.CombineBindingContextForHook(op.TaskQueues.GetByName(t.GetQueueName()), t, func(tsk sh_task.Task) bool {
-			thm := task.HookMetadataAccessor(tsk)
-			// Stop combining on different WaitForSynchronization setting in Synchronization tasks.
-			if hm.KubernetesBindingId != "" && thm.KubernetesBindingId != "" {
-				if hm.WaitForSynchronization != thm.WaitForSynchronization {
-					return true
-				}
-			}
-			return false
-		})
-		if bcs != nil {
-			hm.BindingContext = bcs
-			t.UpdateMetadata(hm)
-		}
+// PauseModule disables module's kubernetes and schedule bindings and pauses resources monitor.
+// Kubernetes bindings are enabled again with Synchronization by the first ModuleRun after unpause.
+func (op *AddonOperator) PauseModule(moduleName string, logEntry *log.Entry) {
+	module := op.ModuleManager.GetModule(moduleName)
+
+	// Serialize with startup phases of ModuleRun tasks in parallel queues.
+	op.moduleRunLock.Lock()
+	op.ModuleManager.DisableModuleHooks(moduleName)
+	op.moduleRunLock.Unlock()
+
+	// Forget Synchronization tasks: they will be queued again after unpause.
+	op.TaskQueues.Remove(ModuleSynchronizationQueueName(moduleName))
+	for _, hookName := range op.ModuleManager.GetModuleHookNames(moduleName) {
+		moduleHook := op.ModuleManager.GetModuleHook(hookName)
+		moduleHook.KubernetesBindingSynchronizationState = make(map[string]*module_manager.KubernetesBindingSynchronizationState)
+	}
+	module.State.ResetSynchronization()
 
-		// mark remain kubernetes binding ids
-		op.TaskQueues.GetByName(t.GetQueueName()).Iterate(func(tsk sh_task.Task) {
-			thm := task.HookMetadataAccessor(tsk)
+	op.HelmResourcesManager.PauseMonitor(moduleName)
+
+	module.State.Paused = true
+	op.MetricStorage.GaugeSet("{PREFIX}module_paused", 1.0, map[string]string{"module": moduleName})
+	logEntry.WithField("module.state", "paused").
+		Infof("Module is paused: bindings are disabled, ModuleRun and hooks are not executed")
+}
+
+// UnpauseModule resumes resources monitor. Bindings are enabled by the current ModuleRun.
+func (op *AddonOperator) UnpauseModule(moduleName string, logEntry *log.Entry) {
+	module := op.ModuleManager.GetModule(moduleName)
+
+	op.HelmResourcesManager.ResumeMonitor(moduleName)
+
+	module.State.Paused = false
+	op.MetricStorage.GaugeSet("{PREFIX}module_paused", 0.0, map[string]string{"module": moduleName})
+	logEntry.WithField("module.state", "unpaused").
+		Infof("Module is unpaused: run ModuleRun to enable bindings")
+}
+
+// PausedModules returns names of paused modules.
+func (op *AddonOperator) PausedModules() []string {
+	paused := make([]string, 0)
+	for _, moduleName := range op.ModuleManager.GetModuleNamesInOrder() {
+		module := op.ModuleManager.GetModule(moduleName)
+		if module != nil && module.State.Paused {
+			paused = append(paused, moduleName)
+		}
+	}
+	return paused
+}
+
+// RetryPolicyForTask returns a retry policy for the failed task. Policy for the task type
+// can be overridden by module settings and then by the hook configuration for the binding.
+func (op *AddonOperator) RetryPolicyForTask(t sh_task.Task) task.RetryPolicy {
+	policy := task.RetryPolicyForTaskType(t.GetType())
+
+	hm, ok := t.GetMetadata().(task.HookMetadata)
+	if !ok {
+		return policy
+	}
+
+	var cfgs []*task.RetryPolicyConfig
+	if hm.ModuleName != "" {
+		module := op.ModuleManager.GetModule(hm.ModuleName)
+		if module != nil && module.Settings != nil {
+			cfgs = append(cfgs, module.Settings.RetryPolicy)
+		}
+	}
+
+	bindingName := hm.Binding
+	if bindingName == "" && len(hm.BindingContext) > 0 {
+		bindingName = hm.BindingContext[0].Binding
+	}
+	switch t.GetType() {
+	case task.GlobalHookRun:
+		globalHook := op.ModuleManager.GetGlobalHook(hm.HookName)
+		if globalHook != nil && globalHook.Config != nil {
+			cfgs = append(cfgs, module_manager.RetryPolicyConfigForBinding(globalHook.Config.RetryPolicies, bindingName, hm.BindingType))
+		}
+	case task.ModuleHookRun:
+		moduleHook := op.ModuleManager.GetModuleHook(hm.HookName)
+		if moduleHook != nil && moduleHook.Config != nil {
+			cfgs = append(cfgs, module_manager.RetryPolicyConfigForBinding(moduleHook.Config.RetryPolicies, bindingName, hm.BindingType))
+		}
+	}
+
+	for _, cfg := range cfgs {
+		// Configs are validated on load, so error is not expected here.
+		if p, err := policy.WithConfig(cfg); err == nil {
+			policy = p
+		}
+	}
+	return policy
+}
+
+// FailedModuleRetryPolicy returns a retry policy for ModuleRun of the module in the Failed state.
+// The maximum delay for failed modules is used unless the module sets maxDelay in its retryPolicy.
+func (op *AddonOperator) FailedModuleRetryPolicy(t sh_task.Task, module *module_manager.Module) task.RetryPolicy {
+	policy := op.RetryPolicyForTask(t)
+	if module.Settings == nil || module.Settings.RetryPolicy == nil || module.Settings.RetryPolicy.MaxDelay == "" {
+		policy.MaxDelay = app.FailedModuleRetryMaxDelay
+	}
+	return policy
+}
+
+// UpdateTaskRetryState saves the next retry time into the task metadata for queue dumps
+// and updates task failures metrics. Zero delay means the task is not failed anymore.
+func (op *AddonOperator) UpdateTaskRetryState(t sh_task.Task, delay time.Duration) {
+	metricLabels := map[string]string{
+		"queue":  t.GetQueueName(),
+		"task":   string(t.GetType()),
+		"module": "",
+		"hook":   "",
+	}
+
+	hm, ok := t.GetMetadata().(task.HookMetadata)
+	if ok {
+		metricLabels["module"] = hm.ModuleName
+		metricLabels["hook"] = hm.HookName
+	}
+
+	if delay == 0 {
+		if ok {
+			hm.NextRetryTime = time.Time{}
+			t.UpdateMetadata(hm)
+		}
+		op.MetricStorage.GaugeSet("{PREFIX}task_failures", 0.0, metricLabels)
+		op.MetricStorage.GaugeSet("{PREFIX}task_next_retry_timestamp_seconds", 0.0, metricLabels)
+		return
+	}
+
+	nextRetryTime := time.Now().Add(delay)
+	if ok {
+		hm.NextRetryTime = nextRetryTime
+		t.UpdateMetadata(hm)
+	}
+	// Failure count is incremented by the queue after the handler is returned.
+	op.MetricStorage.GaugeSet("{PREFIX}task_failures", float64(t.GetFailureCount()+1), metricLabels)
+	op.MetricStorage.GaugeSet("{PREFIX}task_next_retry_timestamp_seconds", float64(nextRetryTime.Unix()), metricLabels)
+}
+
+// StopFailedModule removes the background queue of the failed module and resets the Failed state.
+// A running ModuleRun is not waited: it is marked as stopped and dropped when it finishes.
+func (op *AddonOperator) StopFailedModule(moduleName string) {
+	op.failedModulesLock.Lock()
+	defer op.failedModulesLock.Unlock()
+
+	if op.failedModuleRunning[moduleName] {
+		if op.failedModuleStopped == nil {
+			op.failedModuleStopped = make(map[string]bool)
+		}
+		op.failedModuleStopped[moduleName] = true
+	}
+
+	queueName := FailedModuleQueueName(moduleName)
+	if q := op.TaskQueues.GetByName(queueName); q != nil {
+		q.Filter(func(t sh_task.Task) bool {
+			return t.GetType() != task.ModuleRun
+		})
+		op.TaskQueues.Remove(queueName)
+		log.Infof("Queue '%s' stopped before module delete", queueName)
+	}
+
+	module := op.ModuleManager.GetModule(moduleName)
+	if module != nil && module.State.Failed {
+		module.State.ResetFailure()
+		op.MetricStorage.GaugeSet("{PREFIX}module_failed", 0.0, map[string]string{"module": moduleName})
+	}
+}
+
+// isFailedModuleStopped returns true if the running ModuleRun retry is stopped by StopFailedModule.
+func (op *AddonOperator) isFailedModuleStopped(moduleName string) bool {
+	op.failedModulesLock.Lock()
+	defer op.failedModulesLock.Unlock()
+	return op.failedModuleStopped[moduleName]
+}
+
+// startFailedModuleRun marks ModuleRun in the failed module's queue as running.
+// It returns false if the task was removed by StopFailedModule.
+func (op *AddonOperator) startFailedModuleRun(t sh_task.Task) bool {
+	hm := task.HookMetadataAccessor(t)
+	op.failedModulesLock.Lock()
+	defer op.failedModulesLock.Unlock()
+
+	q := op.TaskQueues.GetByName(t.GetQueueName())
+	if q == nil || q.Get(t.GetId()) == nil {
+		return false
+	}
+	if op.failedModuleRunning == nil {
+		op.failedModuleRunning = make(map[string]bool)
+	}
+	op.failedModuleRunning[hm.ModuleName] = true
+	return true
+}
+
+func (op *AddonOperator) doneFailedModuleRun(moduleName string) {
+	op.failedModulesLock.Lock()
+	delete(op.failedModuleRunning, moduleName)
+	delete(op.failedModuleStopped, moduleName)
+	op.failedModulesLock.Unlock()
+}
+
+// FailedModules returns names of modules in the Failed state.
+func (op *AddonOperator) FailedModules() []string {
+	failed := make([]string, 0)
+	for _, moduleName := range op.ModuleManager.GetModuleNamesInOrder() {
+		module := op.ModuleManager.GetModule(moduleName)
+		if module != nil && module.State.Failed {
+			failed = append(failed, moduleName)
+		}
+	}
+	return failed
+}
+
+// HandleParallelModuleRun runs a group of independent modules in parallel queues.
+// The task stays at the head of the 'main' queue until all ModuleRun tasks
+// of the group are done, so afterAll hooks and ModuleDelete tasks are executed
+// after all modules are run as in sequential mode.
+func (op *AddonOperator) HandleParallelModuleRun(t sh_task.Task, labels map[string]string) (res queue.TaskResult) {
+	logEntry := log.WithFields(utils.LabelsToLogFields(labels))
+
+	hm := task.HookMetadataAccessor(t)
+	if hm.ParallelRunId == "" {
+		hm.ParallelRunId = t.GetId()
+		t.UpdateMetadata(hm)
+	}
+
+	// Queue ModuleRun tasks into idle parallel queues until all modules of this group
+	// are queued and done. Wait is limited to check the group periodically if the signal is lost.
+	for {
+		hm = op.QueueParallelModuleRuns(t, logEntry)
+		if len(hm.ParallelRunQueued) == len(hm.ParallelRunModules) && op.ParallelModuleRunTasks(hm.ParallelRunId) == 0 {
+			break
+		}
+		select {
+		case <-op.parallelModuleRunDone:
+		case <-time.After(ParallelModuleRunCheckInterval):
+			t.WithQueuedAt(time.Now())
+			res.Status = "Repeat"
+			return
+		}
+	}
+
+	logEntry.Infof("Parallel ModuleRun success for %d modules", len(hm.ParallelRunModules))
+	res.Status = "Success"
+	return
+}
+
+// QueueParallelModuleRuns queues ModuleRun tasks for modules of the group into idle parallel
+// queues in the modules order. A failing ModuleRun is retried in its queue and does not
+// delay next modules while other queues are idle. It returns the updated metadata of the task.
+func (op *AddonOperator) QueueParallelModuleRuns(t sh_task.Task, logEntry *log.Entry) task.HookMetadata {
+	hm := task.HookMetadataAccessor(t)
+
+	moduleNames := make([]string, 0, len(hm.ParallelRunModules))
+	for moduleName := range hm.ParallelRunModules {
+		if !hm.ParallelRunQueued[moduleName] {
+			moduleNames = append(moduleNames, moduleName)
+		}
+	}
+	if len(moduleNames) == 0 {
+		return hm
+	}
+	moduleNames = utils.SortByReference(moduleNames, op.ModuleManager.GetModuleNamesInOrder())
+
+	// Metadata is read by IsModuleRunQueued, so the map is copied and not modified in place.
+	queued := make(map[string]bool, len(hm.ParallelRunModules))
+	for moduleName := range hm.ParallelRunQueued {
+		queued[moduleName] = true
+	}
+
+	for _, queueName := range op.InitParallelModuleRunQueues() {
+		if len(moduleNames) == 0 {
+			break
+		}
+		q := op.TaskQueues.GetByName(queueName)
+		if !q.IsEmpty() {
+			continue
+		}
+		moduleName := moduleNames[0]
+		moduleNames = moduleNames[1:]
+
+		newLogLabels := utils.MergeLabels(t.GetLogLabels())
+		newLogLabels["module"] = moduleName
+		newLogLabels["queue"] = queueName
+		delete(newLogLabels, "task.id")
+
+		newTask := sh_task.NewTask(task.ModuleRun).
+			WithLogLabels(newLogLabels).
+			WithQueueName(queueName).
+			WithMetadata(task.HookMetadata{
+				EventDescription: hm.EventDescription,
+				ModuleName:       moduleName,
+				OnStartupHooks:   hm.ParallelRunModules[moduleName],
+				ParallelRunId:    hm.ParallelRunId,
+			})
+		q.AddLast(newTask.WithQueuedAt(time.Now()))
+		queued[moduleName] = true
+
+		logEntry.WithFields(utils.LabelsToLogFields(newTask.LogLabels)).
+			Infof("queue task %s", newTask.GetDescription())
+	}
+
+	hm.ParallelRunQueued = queued
+	t.UpdateMetadata(hm)
+	return hm
+}
+
+// ParallelModuleRunCheckInterval is a maximum time to wait for a signal from ModuleRun tasks in parallel queues.
+const ParallelModuleRunCheckInterval = 5 * time.Second
+
+// notifyParallelModuleRunDone wakes up the waiting ParallelModuleRun task.
+func (op *AddonOperator) notifyParallelModuleRunDone() {
+	select {
+	case op.parallelModuleRunDone <- struct{}{}:
+	default:
+	}
+}
+
+// ParallelModuleRunQueueName returns a name of the i-th queue for parallel ModuleRun tasks.
+func ParallelModuleRunQueueName(i int) string {
+	return fmt.Sprintf("main-parallel-%d", i)
+}
+
+// InitParallelModuleRunQueues creates and starts queues for parallel ModuleRun tasks.
+func (op *AddonOperator) InitParallelModuleRunQueues() []string {
+	queueNames := make([]string, 0, app.ModuleRunWorkers)
+	for i := 0; i < app.ModuleRunWorkers; i++ {
+		queueName := ParallelModuleRunQueueName(i)
+		queueNames = append(queueNames, queueName)
+		if op.TaskQueues.GetByName(queueName) != nil {
+			continue
+		}
+		op.TaskQueues.DoWithLock(func(tqs *queue.TaskQueueSet) {
+			tqs.NewNamedQueue(queueName, op.TaskHandler)
+		})
+		op.TaskQueues.GetByName(queueName).Start()
+		log.Infof("Queue '%s' started for parallel ModuleRun tasks", queueName)
+	}
+	return queueNames
+}
+
+// ParallelModuleRunTasks returns a number of ModuleRun tasks queued by ParallelModuleRun task.
+func (op *AddonOperator) ParallelModuleRunTasks(parallelRunId string) int {
+	count := 0
+	for i := 0; i < app.ModuleRunWorkers; i++ {
+		q := op.TaskQueues.GetByName(ParallelModuleRunQueueName(i))
+		if q == nil {
+			continue
+		}
+		q.Iterate(func(t sh_task.Task) {
+			if t.GetType() == task.ModuleRun && task.HookMetadataAccessor(t).ParallelRunId == parallelRunId {
+				count++
+			}
+		})
+	}
+	return count
+}
+
+func (op *AddonOperator) HandleModuleHookRun(t sh_task.Task, labels map[string]string) (res queue.TaskResult) {
+	defer trace.StartRegion(context.Background(), "ModuleHookRun").End()
+
+	logEntry := log.WithFields(utils.LabelsToLogFields(labels))
+
+	hm := task.HookMetadataAccessor(t)
+	taskHook := op.ModuleManager.GetModuleHook(hm.HookName)
+
+	// Hooks of paused module are not executed. Bindings will be synchronized after unpause.
+	if taskHook.Module.State.Paused {
+		logEntry.Infof("Module '%s' is paused, skip hook '%s'", hm.ModuleName, hm.HookName)
+		res.Status = "Success"
+		return
+	}
+
+	metricLabels := map[string]string{
+		"module":     hm.ModuleName,
+		"hook":       hm.HookName,
+		"binding":    string(hm.BindingType),
+		"queue":      t.GetQueueName(),
+		"activation": labels["event.type"],
+	}
+
+	defer Duration(func(d time.Duration) {
+		op.MetricStorage.HistogramObserve("{PREFIX}module_hook_run_seconds", d.Seconds(), metricLabels)
+	})()
+
+	logEntry.Infof("Module hook start '%s'", hm.HookName)
+
+	if taskHook.Config.Version == "v1" {
+		// save kubernetes binding ids
+		kubeIds := make(map[string]bool)
+		op.TaskQueues.GetByName(t.GetQueueName()).Iterate(func(tsk sh_task.Task) {
+			thm := task.HookMetadataAccessor(tsk)
+			logEntry.Debugf("kubeId: hook %s id %s", thm.HookName, thm.KubernetesBindingId)
+			if thm.HookName == hm.HookName && thm.KubernetesBindingId != "" {
+				kubeIds[thm.KubernetesBindingId] = false
+			}
+		})
+		logEntry.Debugf("kubeIds: %+v", kubeIds)
+
+		bcs := op.CombineBindingContextForHook(op.TaskQueues.GetByName(t.GetQueueName()), t, func(tsk sh_task.Task) bool {
+			thm := task.HookMetadataAccessor(tsk)
+			// Stop combining on different WaitForSynchronization setting in Synchronization tasks.
+			if hm.KubernetesBindingId != "" && thm.KubernetesBindingId != "" {
+				if hm.WaitForSynchronization != thm.WaitForSynchronization {
+					return true
+				}
+			}
+			return false
+		})
+		if bcs != nil {
+			hm.BindingContext = bcs
+			t.UpdateMetadata(hm)
+		}
+
+		// mark remain kubernetes binding ids
+		op.TaskQueues.GetByName(t.GetQueueName()).Iterate(func(tsk sh_task.Task) {
+			thm := task.HookMetadataAccessor(tsk)
 			if thm.HookName == hm.HookName && thm.KubernetesBindingId != "" {
 				kubeIds[thm.KubernetesBindingId] = true
 			}
@@ -1563,6 +2513,8 @@ func (op *AddonOperator) RunDiscoverModulesState(discoverTask sh_task.Task, logL
 		return nil, err
 	}
 
+	op.UpdatePurgeCandidates(modulesState)
+
 	var newTasks []sh_task.Task
 
 	hm := task.HookMetadataAccessor(discoverTask)
@@ -1572,30 +2524,72 @@ func (op *AddonOperator) RunDiscoverModulesState(discoverTask sh_task.Task, logL
 		eventDescription += ".DiscoverModulesState"
 	}
 
+	// Run OnStartup hooks on application startup or if module become enabled
+	runOnStartupHooks := func(moduleName string) bool {
+		if hm.OnStartupHooks {
+			return true
+		}
+		for _, name := range modulesState.NewlyEnabledModules {
+			if name == moduleName {
+				return true
+			}
+		}
+		return false
+	}
+
+	// Modules are run sequentially unless parallel workers are enabled.
+	moduleGroups := make([][]string, 0, len(modulesState.EnabledModules))
+	if app.ModuleRunWorkers > 0 {
+		// Enabled script gets a list of preceding enabled modules, so the module depends on them.
+		moduleGroups = GroupIndependentModules(modulesState.EnabledModules, func(moduleName string) int {
+			return op.ModuleManager.GetModule(moduleName).Order()
+		}, func(moduleName string) bool {
+			return op.ModuleManager.GetModule(moduleName).HasEnabledScript()
+		})
+	} else {
+		for _, moduleName := range modulesState.EnabledModules {
+			moduleGroups = append(moduleGroups, []string{moduleName})
+		}
+	}
+
 	// queue ModuleRun tasks for enabled modules
-	for _, moduleName := range modulesState.EnabledModules {
+	for _, moduleGroup := range moduleGroups {
+		if len(moduleGroup) > 1 {
+			// queue ParallelModuleRun task for a group of independent modules
+			newLogLabels := utils.MergeLabels(logLabels)
+			delete(newLogLabels, "task.id")
+
+			parallelRunModules := make(map[string]bool)
+			for _, moduleName := range moduleGroup {
+				parallelRunModules[moduleName] = runOnStartupHooks(moduleName)
+			}
+
+			newTask := sh_task.NewTask(task.ParallelModuleRun).
+				WithLogLabels(newLogLabels).
+				WithQueueName("main").
+				WithMetadata(task.HookMetadata{
+					EventDescription:   eventDescription,
+					ParallelRunModules: parallelRunModules,
+				})
+			newTasks = append(newTasks, newTask)
+
+			logEntry.WithFields(utils.LabelsToLogFields(newTask.LogLabels)).
+				Infof("queue task %s", newTask.GetDescription())
+			continue
+		}
+
+		moduleName := moduleGroup[0]
 		newLogLabels := utils.MergeLabels(logLabels)
 		newLogLabels["module"] = moduleName
 		delete(newLogLabels, "task.id")
 
-		// Run OnStartup hooks on application startup or if module become enabled
-		runOnStartupHooks := hm.OnStartupHooks
-		if !runOnStartupHooks {
-			for _, name := range modulesState.NewlyEnabledModules {
-				if name == moduleName {
-					runOnStartupHooks = true
-					break
-				}
-			}
-		}
-
 		newTask := sh_task.NewTask(task.ModuleRun).
 			WithLogLabels(newLogLabels).
 			WithQueueName("main").
 			WithMetadata(task.HookMetadata{
 				EventDescription: eventDescription,
 				ModuleName:       moduleName,
-				OnStartupHooks:   runOnStartupHooks,
+				OnStartupHooks:   runOnStartupHooks(moduleName),
 			})
 		newTasks = append(newTasks, newTask)
 
@@ -1823,22 +2817,175 @@ func (op *AddonOperator) SetupDebugServerHandles() {
 			return
 		}
 
-		valuesPath, err := m.PrepareValuesYamlFile()
+		output, err := m.Render(map[string]string{"module": m.Name})
 		if err != nil {
 			writer.WriteHeader(http.StatusInternalServerError)
 			_, _ = writer.Write([]byte(err.Error()))
 			return
 		}
 
-		helmCl := helm.NewClient()
-		output, err := helmCl.Render(m.Name, m.Path, []string{valuesPath}, nil, app.Namespace)
+		if request.URL.Query().Get("validate") == "yes" {
+			if !manifests_validator.Enabled() {
+				writer.WriteHeader(http.StatusBadRequest)
+				_, _ = writer.Write([]byte("Manifests validation is disabled"))
+				return
+			}
+			err = manifests_validator.Validate(output)
+			if err != nil {
+				writer.WriteHeader(http.StatusInternalServerError)
+				_, _ = writer.Write([]byte(err.Error()))
+				return
+			}
+		}
+
+		_, _ = writer.Write([]byte(output))
+	})
+
+	op.DebugServer.Router.Get("/module/{name}/history.{format:(json|yaml|text)}", func(writer http.ResponseWriter, request *http.Request) {
+		modName := chi.URLParam(request, "name")
+		format := chi.URLParam(request, "format")
+
+		m := op.ModuleManager.GetModule(modName)
+		if m == nil {
+			writer.WriteHeader(http.StatusNotFound)
+			_, _ = writer.Write([]byte("Module not found"))
+			return
+		}
+
+		history, err := m.ReleaseHistory()
 		if err != nil {
 			writer.WriteHeader(http.StatusInternalServerError)
 			_, _ = writer.Write([]byte(err.Error()))
 			return
 		}
 
-		_, _ = writer.Write([]byte(output))
+		var outBytes []byte
+		switch format {
+		case "yaml":
+			outBytes, err = yaml.Marshal(history)
+		case "json":
+			outBytes, err = json.Marshal(history)
+		case "text":
+			outBytes = formatReleaseHistory(history, m.PausedReleases())
+		}
+		if err != nil {
+			writer.WriteHeader(http.StatusInternalServerError)
+			_, _ = fmt.Fprintf(writer, "Error: %s", err)
+		}
+		_, _ = writer.Write(outBytes)
+	})
+
+	op.DebugServer.Router.Get("/module/{name}/rollback/{revision:[0-9]+}", func(writer http.ResponseWriter, request *http.Request) {
+		modName := chi.URLParam(request, "name")
+		revision := chi.URLParam(request, "revision")
+		chartName := request.URL.Query().Get("chart")
+
+		m := op.ModuleManager.GetModule(modName)
+		if m == nil {
+			writer.WriteHeader(http.StatusNotFound)
+			_, _ = writer.Write([]byte("Module not found"))
+			return
+		}
+
+		releaseName, err := m.ManualRollback(chartName, revision)
+		if err != nil {
+			writer.WriteHeader(http.StatusInternalServerError)
+			_, _ = writer.Write([]byte(err.Error()))
+			return
+		}
+		_, _ = fmt.Fprintf(writer, "Release '%s' is rolled back to revision %s. Upgrades are paused until the chart or values are changed.\n", releaseName, revision)
+	})
+
+	op.DebugServer.Router.Get("/module/{name}/diff", func(writer http.ResponseWriter, request *http.Request) {
+		modName := chi.URLParam(request, "name")
+		format := request.URL.Query().Get("format")
+
+		m := op.ModuleManager.GetModule(modName)
+		if m == nil {
+			writer.WriteHeader(http.StatusNotFound)
+			_, _ = writer.Write([]byte("Module not found"))
+			return
+		}
+
+		diffs := m.Diffs()
+		var outBytes []byte
+		var err error
+		switch format {
+		case "yaml":
+			outBytes, err = yaml.Marshal(diffs)
+		case "text":
+			buf := new(bytes.Buffer)
+			for _, diff := range diffs {
+				_, _ = fmt.Fprintf(buf, "%s release '%s': %s\n", diff.Time.Format(time.RFC3339), diff.Release, diff.Summary)
+			}
+			outBytes = buf.Bytes()
+		default:
+			outBytes, err = json.Marshal(diffs)
+		}
+		if err != nil {
+			writer.WriteHeader(http.StatusInternalServerError)
+			_, _ = fmt.Fprintf(writer, "Error: %s", err)
+		}
+		_, _ = writer.Write(outBytes)
+	})
+
+	op.DebugServer.Router.Get("/module/{name}/failed-diff", func(writer http.ResponseWriter, request *http.Request) {
+		modName := chi.URLParam(request, "name")
+
+		m := op.ModuleManager.GetModule(modName)
+		if m == nil {
+			writer.WriteHeader(http.StatusNotFound)
+			_, _ = writer.Write([]byte("Module not found"))
+			return
+		}
+
+		diffs := m.FailedUpgradeDiffs()
+		if len(diffs) == 0 {
+			_, _ = fmt.Fprintf(writer, "No rolled back upgrades for module '%s'\n", m.Name)
+			return
+		}
+		releases := make([]string, 0, len(diffs))
+		for releaseName := range diffs {
+			releases = append(releases, releaseName)
+		}
+		sort.Strings(releases)
+		for _, releaseName := range releases {
+			_, _ = fmt.Fprintf(writer, "# Release '%s'\n%s\n", releaseName, diffs[releaseName])
+		}
+	})
+
+	op.DebugServer.Router.Get("/module/{name}/purge", func(writer http.ResponseWriter, request *http.Request) {
+		releaseName := chi.URLParam(request, "name")
+
+		if app.PurgeMode != app.PurgeModeConfirm {
+			writer.WriteHeader(http.StatusBadRequest)
+			_, _ = fmt.Fprintf(writer, "Purge confirmation is available only in the '%s' purge mode, current mode is '%s'\n", app.PurgeModeConfirm, app.PurgeMode)
+			return
+		}
+
+		if !op.ConfirmPurge(releaseName) {
+			writer.WriteHeader(http.StatusNotFound)
+			_, _ = fmt.Fprintf(writer, "No pending purge for release '%s'\n", releaseName)
+			return
+		}
+
+		logLabels := map[string]string{
+			"event.id": uuid.NewV4().String(),
+			"module":   releaseName,
+			"queue":    "main",
+		}
+		newTask := sh_task.NewTask(task.ModulePurge).
+			WithLogLabels(logLabels).
+			WithQueueName("main").
+			WithMetadata(task.HookMetadata{
+				EventDescription: "PurgeConfirmed",
+				ModuleName:       releaseName,
+			})
+		op.TaskQueues.GetMain().AddLast(newTask.WithQueuedAt(time.Now()))
+		log.WithFields(utils.LabelsToLogFields(logLabels)).
+			Infof("Purge is confirmed, queue task %s", newTask.GetDescription())
+
+		_, _ = fmt.Fprintf(writer, "Purge of release '%s' is confirmed\n", releaseName)
 	})
 
 	op.DebugServer.Router.Get("/module/{name}/patches.json", func(writer http.ResponseWriter, request *http.Request) {
@@ -1872,8 +3019,17 @@ func (op *AddonOperator) SetupDebugServerHandles() {
 				continue
 			}
 
-			ids := op.HelmResourcesManager.GetMonitor(moduleName).ResourceIds()
-			dump[moduleName] = ids
+			monitors := op.HelmResourcesManager.GetMonitors(moduleName)
+			if monitor, has := monitors[""]; has && len(monitors) == 1 {
+				dump[moduleName] = monitor.ResourceIds()
+				continue
+			}
+			// Module with several charts.
+			partsDump := map[string]interface{}{}
+			for part, monitor := range monitors {
+				partsDump[part] = monitor.ResourceIds()
+			}
+			dump[moduleName] = partsDump
 		}
 
 		var outBytes []byte
@@ -1910,16 +3066,21 @@ func (op *AddonOperator) SetupHttpServerHandles() {
 	http.Handle("/metrics", promhttp.Handler())
 
 	http.HandleFunc("/healthz", func(writer http.ResponseWriter, request *http.Request) {
-		if helm.HealthzHandler == nil {
+		if op.Helm == nil || op.Helm.HealthzHandler == nil {
 			writer.WriteHeader(http.StatusOK)
 			return
 		}
-		helm.HealthzHandler(writer, request)
+		op.Helm.HealthzHandler(writer, request)
 	})
 
 	http.HandleFunc("/ready", func(w http.ResponseWriter, request *http.Request) {
 		if op.StartupConvergeDone {
 			w.WriteHeader(200)
+			failedModules := op.FailedModules()
+			if len(failedModules) > 0 {
+				_, _ = w.Write([]byte(fmt.Sprintf("Startup converge done, degraded: failed modules: %s\n", strings.Join(failedModules, ", "))))
+				return
+			}
 			_, _ = w.Write([]byte("Startup converge done.\n"))
 		} else {
 			w.WriteHeader(500)
@@ -1950,6 +3111,21 @@ func (op *AddonOperator) SetupHttpServerHandles() {
 			}
 		}
 
+		failedModules := op.FailedModules()
+		if len(failedModules) > 0 {
+			statusLines = append(statusLines, fmt.Sprintf("DEGRADED: failed modules: %s", strings.Join(failedModules, ", ")))
+		}
+
+		pausedModules := op.PausedModules()
+		if len(pausedModules) > 0 {
+			statusLines = append(statusLines, fmt.Sprintf("PAUSED: %s", strings.Join(pausedModules, ", ")))
+		}
+
+		pendingPurges := op.PendingPurges()
+		if len(pendingPurges) > 0 {
+			statusLines = append(statusLines, fmt.Sprintf("PURGE_PENDING: %s", strings.Join(pendingPurges, ", ")))
+		}
+
 		_, _ = writer.Write([]byte(strings.Join(statusLines, "\n") + "\n"))
 	})
 }
@@ -1959,7 +3135,7 @@ func (op *AddonOperator) MainQueueHasConvergeTasks() int {
 	op.TaskQueues.GetMain().Iterate(func(t sh_task.Task) {
 		ttype := t.GetType()
 		switch ttype {
-		case task.ModuleRun, task.DiscoverModulesState, task.ModuleDelete, task.ModulePurge, task.ModuleManagerRetry, task.ReloadAllModules, task.GlobalHookEnableKubernetesBindings, task.GlobalHookEnableScheduleBindings:
+		case task.ModuleRun, task.ParallelModuleRun, task.DiscoverModulesState, task.ModuleDelete, task.ModulePurge, task.ModuleManagerRetry, task.ReloadAllModules, task.GlobalHookEnableKubernetesBindings, task.GlobalHookEnableScheduleBindings, task.HotReload:
 			convergeTasks++
 			return
 		}
@@ -2022,6 +3198,15 @@ func DefaultOperator() *AddonOperator {
 }
 
 func InitAndStart(operator *AddonOperator) error {
+	if operator.Instance == nil {
+		instance, err := app.NewInstance()
+		if err != nil {
+			log.Errorf("INIT failed: %v", err)
+			return err
+		}
+		operator.WithInstance(instance)
+	}
+
 	err := operator.StartHttpServer(sh_app.ListenAddress, sh_app.ListenPort, http.DefaultServeMux)
 	if err != nil {
 		log.Errorf("HTTP SERVER start failed: %v", err)
@@ -2056,6 +3241,56 @@ func InitAndStart(operator *AddonOperator) error {
 	return nil
 }
 
+// GroupIndependentModules splits an ordered list of modules into groups of independent modules.
+// Adjacent modules with the same order prefix are independent and can be run in parallel
+// unless a module depends on preceding modules: such module starts a new group
+// to run after all preceding modules.
+func GroupIndependentModules(moduleNames []string, orderFn func(moduleName string) int, dependsOnPrecedingFn func(moduleName string) bool) [][]string {
+	groups := make([][]string, 0)
+	lastOrder := -1
+	for _, moduleName := range moduleNames {
+		order := orderFn(moduleName)
+		if len(groups) > 0 && order == lastOrder && !dependsOnPrecedingFn(moduleName) {
+			groups[len(groups)-1] = append(groups[len(groups)-1], moduleName)
+			continue
+		}
+		groups = append(groups, []string{moduleName})
+		lastOrder = order
+	}
+	return groups
+}
+
+// IsModuleRunQueued returns true if ModuleRun task for the module is queued in the 'main' queue,
+// in one of parallel queues or in the queue for the failed module.
+func (op *AddonOperator) IsModuleRunQueued(moduleName string) bool {
+	hasTask := false
+	op.TaskQueues.GetMain().Filter(func(t sh_task.Task) bool {
+		if t.GetType() == task.ParallelModuleRun {
+			hm := task.HookMetadataAccessor(t)
+			// ModuleRun task is not queued into the parallel queue yet.
+			if _, has := hm.ParallelRunModules[moduleName]; has && !hm.ParallelRunQueued[moduleName] {
+				hasTask = true
+			}
+		}
+		return true
+	})
+	if hasTask || QueueHasModuleRunTask(op.TaskQueues.GetMain(), moduleName) {
+		return true
+	}
+
+	queueNames := []string{FailedModuleQueueName(moduleName)}
+	for i := 0; i < app.ModuleRunWorkers; i++ {
+		queueNames = append(queueNames, ParallelModuleRunQueueName(i))
+	}
+	for _, queueName := range queueNames {
+		q := op.TaskQueues.GetByName(queueName)
+		if q != nil && QueueHasModuleRunTask(q, moduleName) {
+			return true
+		}
+	}
+	return false
+}
+
 func QueueHasModuleRunTask(q *queue.TaskQueue, moduleName string) bool {
 	hasTask := false
 	q.Filter(func(t sh_task.Task) bool {
@@ -2069,3 +3304,32 @@ func QueueHasModuleRunTask(q *queue.TaskQueue, moduleName string) bool {
 	})
 	return hasTask
 }
+
+// formatReleaseHistory returns histories of module releases as tables like 'helm history' does.
+func formatReleaseHistory(history map[string][]client.ReleaseRevision, pausedReleases []string) []byte {
+	paused := make(map[string]bool)
+	for _, releaseName := range pausedReleases {
+		paused[releaseName] = true
+	}
+	releases := make([]string, 0, len(history))
+	for releaseName := range history {
+		releases = append(releases, releaseName)
+	}
+	sort.Strings(releases)
+
+	buf := new(bytes.Buffer)
+	for _, releaseName := range releases {
+		if paused[releaseName] {
+			fmt.Fprintf(buf, "# Release '%s' (upgrades are paused after manual rollback)\n", releaseName)
+		} else {
+			fmt.Fprintf(buf, "# Release '%s'\n", releaseName)
+		}
+		w := tabwriter.NewWriter(buf, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(w, "REVISION\tUPDATED\tSTATUS\tCHART\tDESCRIPTION")
+		for _, rev := range history[releaseName] {
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\n", rev.Revision, rev.Updated, rev.Status, rev.Chart, rev.Description)
+		}
+		_ = w.Flush()
+	}
+	return buf.Bytes()
+}
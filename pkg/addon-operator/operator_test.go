@@ -2,15 +2,22 @@ package addon_operator
 
 import (
 	"context"
+	"fmt"
 	"testing"
+	"time"
 
 	. "github.com/onsi/gomega"
+	log "github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	sh_app "github.com/flant/shell-operator/pkg/app"
 	. "github.com/flant/shell-operator/pkg/hook/types"
 	"github.com/flant/shell-operator/pkg/kube"
 	sh_task "github.com/flant/shell-operator/pkg/task"
+	"github.com/flant/shell-operator/pkg/task/queue"
 
+	"github.com/flant/addon-operator/pkg/app"
+	"github.com/flant/addon-operator/pkg/module_manager"
 	"github.com/flant/addon-operator/pkg/task"
 )
 
@@ -136,3 +143,258 @@ func Test_Operator_Startup(t *testing.T) {
 	//assert.True(t, hookRun.hookGlobal2)
 	//assert.Equalf(t, 0, TasksQueue.Length(), "%d tasks remain in queue after TasksRunner", TasksQueue.Length())
 }
+
+func Test_GroupIndependentModules(t *testing.T) {
+	g := NewWithT(t)
+
+	orders := map[string]int{
+		"module-a": 100,
+		"module-b": 200,
+		"module-c": 200,
+		"module-d": 300,
+		"module-e": 200,
+		"module-f": 400,
+		"module-g": 400,
+		"module-h": 400,
+	}
+	orderFn := func(moduleName string) int {
+		return orders[moduleName]
+	}
+	// module-g has an enabled script.
+	dependsFn := func(moduleName string) bool {
+		return moduleName == "module-g"
+	}
+
+	groups := GroupIndependentModules([]string{"module-a", "module-b", "module-c", "module-d", "module-e", "module-f", "module-g", "module-h"}, orderFn, dependsFn)
+	g.Expect(groups).To(Equal([][]string{
+		{"module-a"},
+		{"module-b", "module-c"},
+		{"module-d"},
+		{"module-e"},
+		{"module-f"},
+		{"module-g", "module-h"},
+	}))
+
+	groups = GroupIndependentModules([]string{}, orderFn, dependsFn)
+	g.Expect(groups).To(BeEmpty())
+}
+
+func Test_IsModuleRunQueued(t *testing.T) {
+	g := NewWithT(t)
+
+	defer func(workers int) {
+		app.ModuleRunWorkers = workers
+	}(app.ModuleRunWorkers)
+	app.ModuleRunWorkers = 1
+
+	op := NewAddonOperator()
+	op.TaskQueues = queue.NewTaskQueueSet()
+	op.TaskQueues.WithContext(context.Background())
+	op.TaskQueues.WithMainName("main")
+	op.TaskQueues.NewNamedQueue("main", nil)
+	op.TaskQueues.NewNamedQueue(ParallelModuleRunQueueName(0), nil)
+	op.TaskQueues.NewNamedQueue(FailedModuleQueueName("module-failed"), nil)
+
+	op.TaskQueues.GetMain().AddLast(sh_task.NewTask(task.ParallelModuleRun).WithMetadata(task.HookMetadata{
+		ParallelRunModules: map[string]bool{"module-group": false},
+	}))
+	op.TaskQueues.GetByName(ParallelModuleRunQueueName(0)).AddLast(sh_task.NewTask(task.ModuleRun).WithMetadata(task.HookMetadata{
+		ModuleName:    "module-parallel",
+		ParallelRunId: "1",
+	}))
+	op.TaskQueues.GetByName(FailedModuleQueueName("module-failed")).AddLast(sh_task.NewTask(task.ModuleRun).WithMetadata(task.HookMetadata{
+		ModuleName: "module-failed",
+	}))
+
+	g.Expect(op.IsModuleRunQueued("module-group")).To(BeTrue())
+	g.Expect(op.IsModuleRunQueued("module-parallel")).To(BeTrue())
+	g.Expect(op.IsModuleRunQueued("module-failed")).To(BeTrue())
+	g.Expect(op.IsModuleRunQueued("module-other")).To(BeFalse())
+}
+
+// orderedModuleManager returns module names in order without loading modules.
+type orderedModuleManager struct {
+	module_manager.ModuleManager
+	names []string
+}
+
+func (mm *orderedModuleManager) GetModuleNamesInOrder() []string {
+	return mm.names
+}
+
+func Test_QueueParallelModuleRuns(t *testing.T) {
+	g := NewWithT(t)
+
+	defer func(workers int) {
+		app.ModuleRunWorkers = workers
+	}(app.ModuleRunWorkers)
+	app.ModuleRunWorkers = 2
+
+	op := NewAddonOperator()
+	op.ModuleManager = &orderedModuleManager{names: []string{"module-a", "module-b", "module-c"}}
+	op.TaskQueues = queue.NewTaskQueueSet()
+	op.TaskQueues.WithContext(context.Background())
+	op.TaskQueues.WithMainName("main")
+	op.TaskQueues.NewNamedQueue("main", nil)
+	// Queues without handlers are not started, so tasks stay in queues.
+	op.TaskQueues.NewNamedQueue(ParallelModuleRunQueueName(0), nil)
+	op.TaskQueues.NewNamedQueue(ParallelModuleRunQueueName(1), nil)
+
+	parallelRun := sh_task.NewTask(task.ParallelModuleRun).WithMetadata(task.HookMetadata{
+		ParallelRunModules: map[string]bool{"module-a": true, "module-b": true, "module-c": true},
+		ParallelRunId:      "1",
+	})
+	op.TaskQueues.GetMain().AddLast(parallelRun)
+	logEntry := log.WithField("test", t.Name())
+
+	queuedModule := func(i int) string {
+		return task.HookMetadataAccessor(op.TaskQueues.GetByName(ParallelModuleRunQueueName(i)).GetFirst()).ModuleName
+	}
+
+	hm := op.QueueParallelModuleRuns(parallelRun, logEntry)
+	g.Expect(hm.ParallelRunQueued).To(Equal(map[string]bool{"module-a": true, "module-b": true}))
+	g.Expect(queuedModule(0)).To(Equal("module-a"))
+	g.Expect(queuedModule(1)).To(Equal("module-b"))
+	g.Expect(op.IsModuleRunQueued("module-c")).To(BeTrue(), "module should be queued until ModuleRun is queued into the parallel queue")
+
+	// ModuleRun for module-b is retried in its queue, module-c is queued into the idle queue.
+	op.TaskQueues.GetByName(ParallelModuleRunQueueName(0)).RemoveFirst()
+	hm = op.QueueParallelModuleRuns(parallelRun, logEntry)
+	g.Expect(hm.ParallelRunQueued).To(HaveLen(3))
+	g.Expect(queuedModule(0)).To(Equal("module-c"))
+	g.Expect(op.TaskQueues.GetByName(ParallelModuleRunQueueName(1)).Length()).To(Equal(1))
+	g.Expect(op.ParallelModuleRunTasks("1")).To(Equal(2))
+}
+
+func Test_FailedModuleRetryPolicy(t *testing.T) {
+	g := NewWithT(t)
+
+	defer func(maxDelay time.Duration) {
+		app.FailedModuleRetryMaxDelay = maxDelay
+	}(app.FailedModuleRetryMaxDelay)
+	app.FailedModuleRetryMaxDelay = 42 * time.Minute
+
+	op := NewAddonOperator()
+	op.ModuleManager = module_manager.NewMainModuleManager()
+	moduleRun := sh_task.NewTask(task.ModuleRun).
+		WithMetadata(task.HookMetadata{ModuleName: "module-a"})
+
+	module := module_manager.NewModule("module-a", "/modules/module-a")
+	g.Expect(op.FailedModuleRetryPolicy(moduleRun, module).MaxDelay).To(Equal(42 * time.Minute))
+
+	module.Settings = &module_manager.ModuleSettings{RetryPolicy: &task.RetryPolicyConfig{InitialDelay: "10s"}}
+	g.Expect(op.FailedModuleRetryPolicy(moduleRun, module).MaxDelay).To(Equal(42*time.Minute), "global max delay should be used if module does not set it")
+
+	module.Settings = &module_manager.ModuleSettings{RetryPolicy: &task.RetryPolicyConfig{MaxDelay: "10m"}}
+	g.Expect(op.FailedModuleRetryPolicy(moduleRun, module).MaxDelay).To(Equal(op.RetryPolicyForTask(moduleRun).MaxDelay), "module max delay should not be overridden")
+}
+
+func Test_ShouldPutModuleInFailedState(t *testing.T) {
+	g := NewWithT(t)
+
+	defer func(threshold int, timeout time.Duration) {
+		app.ModuleFailureThreshold = threshold
+		app.ModuleFailureTimeout = timeout
+	}(app.ModuleFailureThreshold, app.ModuleFailureTimeout)
+
+	state := &module_manager.ModuleState{}
+	state.SetFailure(fmt.Errorf("error"))
+
+	// Quarantine is disabled by default.
+	app.ModuleFailureThreshold = 0
+	app.ModuleFailureTimeout = 0
+	g.Expect(ShouldPutModuleInFailedState(state)).To(BeFalse())
+
+	app.ModuleFailureThreshold = 3
+	g.Expect(ShouldPutModuleInFailedState(state)).To(BeFalse())
+	state.SetFailure(fmt.Errorf("error"))
+	state.SetFailure(fmt.Errorf("error"))
+	g.Expect(state.FailureCount).To(Equal(3))
+	g.Expect(ShouldPutModuleInFailedState(state)).To(BeTrue())
+
+	state.ResetFailure()
+	g.Expect(ShouldPutModuleInFailedState(state)).To(BeFalse())
+
+	app.ModuleFailureThreshold = 0
+	app.ModuleFailureTimeout = time.Minute
+	state.SetFailure(fmt.Errorf("error"))
+	g.Expect(ShouldPutModuleInFailedState(state)).To(BeFalse())
+	state.FirstFailureTime = time.Now().Add(-2 * time.Minute)
+	g.Expect(ShouldPutModuleInFailedState(state)).To(BeTrue())
+}
+
+func Test_PurgeDecisions(t *testing.T) {
+	g := NewWithT(t)
+
+	kubeClient := kube.NewFakeKubernetesClient()
+	op := NewAddonOperator()
+	op.WithKubernetesClient(kubeClient)
+	op.WithInstance(&app.Instance{Namespace: app.Namespace, ConfigMapName: app.DefaultConfigMapName})
+
+	op.UpdatePurgeCandidates(&module_manager.ModulesState{
+		ReleasedUnknownModules:  []string{"module-a", "module-b"},
+		NotOwnedUnknownReleases: []string{"foreign"},
+	})
+	g.Expect(op.purgeDecisions).To(Equal(map[string]string{"foreign": PurgeDecisionNotOwned}))
+
+	op.ReportPurgeDecision("module-a", PurgeDecisionPending, "pending")
+	op.ReportPurgeDecision("module-a", PurgeDecisionPending, "pending")
+	op.ReportPurgeDecision("module-b", PurgeDecisionPending, "pending")
+	g.Expect(op.PendingPurges()).To(Equal([]string{"module-a", "module-b"}))
+
+	// Only pending releases can be confirmed.
+	g.Expect(op.ConfirmPurge("foreign")).To(BeFalse())
+	g.Expect(op.ConfirmPurge("module-a")).To(BeTrue())
+	g.Expect(op.IsPurgeConfirmed("module-a")).To(BeTrue())
+	g.Expect(op.IsPurgeConfirmed("module-b")).To(BeFalse())
+
+	op.ReportPurgeDecision("module-a", PurgeDecisionPurged, "purged")
+	g.Expect(op.IsPurgeConfirmed("module-a")).To(BeFalse())
+	g.Expect(op.PendingPurges()).To(Equal([]string{"module-b"}))
+
+	// Decisions for deleted releases are forgotten.
+	op.UpdatePurgeCandidates(&module_manager.ModulesState{
+		ReleasedUnknownModules: []string{"module-b"},
+	})
+	g.Expect(op.purgeDecisions).To(Equal(map[string]string{"module-b": PurgeDecisionPending}))
+
+	// An event is created for each decision change.
+	events, err := kubeClient.CoreV1().Events(app.Namespace).List(metav1.ListOptions{})
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(events.Items).To(HaveLen(4))
+}
+
+func Test_StopFailedModule(t *testing.T) {
+	g := NewWithT(t)
+
+	op := NewAddonOperator()
+	op.TaskQueues = queue.NewTaskQueueSet()
+	op.TaskQueues.WithContext(context.Background())
+	op.ModuleManager = module_manager.NewMainModuleManager()
+
+	queueName := FailedModuleQueueName("module-a")
+	op.TaskQueues.NewNamedQueue(queueName, nil)
+	moduleRun := sh_task.NewTask(task.ModuleRun).
+		WithQueueName(queueName).
+		WithMetadata(task.HookMetadata{ModuleName: "module-a"})
+	op.TaskQueues.GetByName(queueName).AddLast(moduleRun)
+
+	// Delete does not wait for the running retry: it is marked and dropped when finished.
+	g.Expect(op.startFailedModuleRun(moduleRun)).To(BeTrue())
+	op.StopFailedModule("module-a")
+	g.Expect(op.TaskQueues.GetByName(queueName)).To(BeNil())
+	g.Expect(op.isFailedModuleStopped("module-a")).To(BeTrue())
+
+	op.doneFailedModuleRun("module-a")
+	g.Expect(op.isFailedModuleStopped("module-a")).To(BeFalse())
+
+	// Retry dequeued before the queue is stopped is not started.
+	g.Expect(op.startFailedModuleRun(moduleRun)).To(BeFalse())
+
+	// Queue without the running retry is stopped without marks.
+	op.TaskQueues.NewNamedQueue(queueName, nil)
+	op.TaskQueues.GetByName(queueName).AddLast(moduleRun)
+	op.StopFailedModule("module-a")
+	g.Expect(op.TaskQueues.GetByName(queueName)).To(BeNil())
+	g.Expect(op.isFailedModuleStopped("module-a")).To(BeFalse())
+}
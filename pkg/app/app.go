@@ -1,12 +1,15 @@
 package app
 
 import (
+	"fmt"
 	"strconv"
+	"strings"
 	"time"
 
 	sh_app "github.com/flant/shell-operator/pkg/app"
 
 	"gopkg.in/alecthomas/kingpin.v2"
+	"k8s.io/apimachinery/pkg/util/validation"
 )
 
 var AppName = "addon-operator"
@@ -26,14 +29,89 @@ var TillerMaxHistory int32 = 0
 var Helm3HistoryMax int32 = 10
 var Helm3Timeout time.Duration = 5 * time.Minute
 
+// Helm 3 clients: 'cli' runs the helm binary, 'library' runs helm actions in-process.
+const (
+	Helm3ClientCLI     = "cli"
+	Helm3ClientLibrary = "library"
+)
+
+// Helm3Client selects the implementation of the Helm 3 client.
+var Helm3Client = Helm3ClientCLI
+
+// InstanceID distinguishes Addon-operator instances in one cluster, see Instance.
+var InstanceID = ""
+
+// HelmReleasePrefix is a prefix for Helm release names to share Tiller between Addon-operator instances.
+var HelmReleasePrefix = ""
+
+// HelmReleaseNameTemplate is a Go template for Helm release names.
+// Available fields are .ModuleName, .Namespace and .Prefix.
+var HelmReleaseNameTemplate = "{{ .Prefix }}{{ .ModuleName }}"
+
 var Namespace = ""
-var ConfigMapName = "addon-operator"
+var DefaultConfigMapName = "addon-operator"
+var ConfigMapName = DefaultConfigMapName
 var ValuesChecksumsAnnotation = "addon-operator/values-checksums"
 
 var GlobalHooksDir = "global-hooks"
 var ModulesDir = "modules"
 var DefaultTempDir = "/tmp/addon-operator"
 
+// ModuleRunWorkers is a number of parallel queues for ModuleRun tasks during converge.
+// Modules are run sequentially if ModuleRunWorkers is 0.
+var ModuleRunWorkers = 0
+
+// ModuleFailureThreshold is a number of consecutive ModuleRun failures to put module into the Failed state.
+var ModuleFailureThreshold = 0
+
+// ModuleFailureTimeout is a duration of consecutive ModuleRun failures to put module into the Failed state.
+var ModuleFailureTimeout time.Duration = 0
+
+// FailedModuleRetryMaxDelay is a maximum delay between background retries of a failed module.
+var FailedModuleRetryMaxDelay = 5 * time.Minute
+
+// ModuleDiffHistory is a number of manifest diffs kept for each module. Diffs are not computed if it is 0.
+var ModuleDiffHistory = 5
+
+// PostRenderConfig is a path to the config of built-in transformers for rendered manifests.
+var PostRenderConfig = ""
+
+// Sources of OpenAPI schemas to validate rendered manifests.
+const (
+	ManifestsValidationNone    = "none"
+	ManifestsValidationCluster = "cluster"
+	ManifestsValidationFiles   = "files"
+)
+
+// ManifestsValidation is a source of OpenAPI schemas to validate rendered manifests before
+// they are installed: 'cluster' fetches schemas from the API server, 'files' loads them
+// from OpenAPISchemasDir for KubernetesVersion. Validation is disabled with 'none'.
+var ManifestsValidation = ManifestsValidationNone
+
+// OpenAPISchemasDir is a directory with '<major>.<minor>.json' files with OpenAPI schemas.
+var OpenAPISchemasDir = ""
+
+// KubernetesVersion is a target Kubernetes version to choose the file with OpenAPI schemas.
+var KubernetesVersion = ""
+
+// HotReloadInterval is an interval to check global hooks and modules directories for changes.
+// Hot reload is disabled if HotReloadInterval is 0.
+var HotReloadInterval time.Duration = 0
+
+// Purge modes for Helm releases of unknown modules.
+const (
+	PurgeModePurge   = "purge"
+	PurgeModeDryRun  = "dry-run"
+	PurgeModeConfirm = "confirm"
+)
+
+// PurgeMode defines how Helm releases of unknown modules are purged: 'purge' deletes
+// releases, 'dry-run' only reports them, 'confirm' waits for a confirmation via the debug socket.
+var PurgeMode = PurgeModePurge
+
+// TaskRetryPolicies are retry policies for failed tasks in format '<TaskType>:key=value,...'.
+var TaskRetryPolicies []string
+
 var DefaultDebugUnixSocket = "/var/run/addon-operator/debug.socket"
 
 // DefineStartCommandFlags init global flags with default values
@@ -89,11 +167,81 @@ func DefineStartCommandFlags(kpApp *kingpin.Application, cmd *kingpin.CmdClause)
 		Default(Helm3Timeout.String()).
 		DurationVar(&Helm3Timeout)
 
+	cmd.Flag("helm3-client", "Helm: 'cli' runs the helm binary for every operation, 'library' runs Helm 3 actions in-process without the helm binary.").
+		Envar("ADDON_OPERATOR_HELM3_CLIENT").
+		Default(Helm3Client).
+		EnumVar(&Helm3Client, Helm3ClientCLI, Helm3ClientLibrary)
+
+	cmd.Flag("helm-release-prefix", "Helm: prefix for release names. Use it to share Tiller or namespace between Addon-operator instances.").
+		Envar("ADDON_OPERATOR_HELM_RELEASE_PREFIX").
+		Default(HelmReleasePrefix).
+		StringVar(&HelmReleasePrefix)
+
+	cmd.Flag("helm-release-name-template", "Helm: Go template for release names. Available fields are .ModuleName, .Namespace and .Prefix. Names are sanitized and truncated to 53 characters with a hash suffix.").
+		Envar("ADDON_OPERATOR_HELM_RELEASE_NAME_TEMPLATE").
+		Default(HelmReleaseNameTemplate).
+		StringVar(&HelmReleaseNameTemplate)
+
+	cmd.Flag("instance-id", "Identifier of the Addon-operator instance to run several instances in one cluster. It is used as a suffix for the default ConfigMap name, a default prefix for release names, a value of the release owner label and an 'instance_id' label for metrics.").
+		Envar("ADDON_OPERATOR_INSTANCE_ID").
+		Default(InstanceID).
+		StringVar(&InstanceID)
+
 	cmd.Flag("config-map", "Name of a ConfigMap to store values.").
 		Envar("ADDON_OPERATOR_CONFIG_MAP").
 		Default(ConfigMapName).
 		StringVar(&ConfigMapName)
 
+	cmd.Flag("module-run-workers", "Number of parallel workers to run independent modules during converge. Modules with the same order prefix are independent. Use 0 to run modules sequentially.").
+		Envar("ADDON_OPERATOR_MODULE_RUN_WORKERS").
+		Default(strconv.Itoa(ModuleRunWorkers)).
+		IntVar(&ModuleRunWorkers)
+
+	cmd.Flag("module-failure-threshold", "Number of consecutive ModuleRun failures to put module into the Failed state and retry it in the background. Use 0 to retry failed module in the main queue.").
+		Envar("ADDON_OPERATOR_MODULE_FAILURE_THRESHOLD").
+		Default(strconv.Itoa(ModuleFailureThreshold)).
+		IntVar(&ModuleFailureThreshold)
+
+	cmd.Flag("module-failure-timeout", "Duration of consecutive ModuleRun failures to put module into the Failed state and retry it in the background. Use 0 to disable.").
+		Envar("ADDON_OPERATOR_MODULE_FAILURE_TIMEOUT").
+		Default(ModuleFailureTimeout.String()).
+		DurationVar(&ModuleFailureTimeout)
+
+	cmd.Flag("failed-module-retry-max-delay", "Maximum delay between background retries of a module in the Failed state.").
+		Envar("ADDON_OPERATOR_FAILED_MODULE_RETRY_MAX_DELAY").
+		Default(FailedModuleRetryMaxDelay.String()).
+		DurationVar(&FailedModuleRetryMaxDelay)
+
+	cmd.Flag("module-diff-history", "Number of diffs between deployed and rendered manifests kept for each module. Use 0 to disable diffs.").
+		Envar("ADDON_OPERATOR_MODULE_DIFF_HISTORY").
+		Default(strconv.Itoa(ModuleDiffHistory)).
+		IntVar(&ModuleDiffHistory)
+
+	cmd.Flag("post-render-config", "Path to a YAML file with labels, annotations, image pull secrets and image rewrite rules applied to rendered manifests of all modules.").
+		Envar("ADDON_OPERATOR_POST_RENDER_CONFIG").
+		Default(PostRenderConfig).
+		StringVar(&PostRenderConfig)
+
+	cmd.Flag("manifests-validation", "A source of OpenAPI schemas to validate rendered manifests before install: 'cluster' fetches schemas from the API server, 'files' loads them from the directory for the Kubernetes version, 'none' disables validation.").
+		Envar("ADDON_OPERATOR_MANIFESTS_VALIDATION").
+		Default(ManifestsValidation).
+		EnumVar(&ManifestsValidation, ManifestsValidationNone, ManifestsValidationCluster, ManifestsValidationFiles)
+	DefineOpenAPISchemasFlags(cmd)
+
+	cmd.Flag("hot-reload-interval", "Interval to check global hooks and modules directories for changes and reload changed hooks and modules. Use 0 to disable.").
+		Envar("ADDON_OPERATOR_HOT_RELOAD_INTERVAL").
+		Default(HotReloadInterval.String()).
+		DurationVar(&HotReloadInterval)
+
+	cmd.Flag("purge-mode", "How to purge Helm releases of unknown modules: 'purge' deletes releases, 'dry-run' only reports them, 'confirm' deletes releases confirmed with 'module purge' command.").
+		Envar("ADDON_OPERATOR_PURGE_MODE").
+		Default(PurgeMode).
+		EnumVar(&PurgeMode, PurgeModePurge, PurgeModeDryRun, PurgeModeConfirm)
+
+	cmd.Flag("task-retry-policy", "Retry policy for failed tasks of a type: '<TaskType>:initialDelay=5s,maxDelay=5m,multiplier=2,jitter=0.1'. Use 'default' as a type to change policy for all tasks. Can be specified multiple times.").
+		Envar("ADDON_OPERATOR_TASK_RETRY_POLICY").
+		StringsVar(&TaskRetryPolicies)
+
 	sh_app.DefineKubeClientFlags(cmd)
 	sh_app.DefineJqFlags(cmd)
 	sh_app.DefineLoggingFlags(cmd)
@@ -101,3 +249,64 @@ func DefineStartCommandFlags(kpApp *kingpin.Application, cmd *kingpin.CmdClause)
 	sh_app.DebugUnixSocket = DefaultDebugUnixSocket
 	sh_app.DefineDebugFlags(kpApp, cmd)
 }
+
+// DefineOpenAPISchemasFlags defines flags to load OpenAPI schemas from files.
+func DefineOpenAPISchemasFlags(cmd *kingpin.CmdClause) {
+	cmd.Flag("openapi-schemas-dir", "A directory with OpenAPI schemas of Kubernetes versions in '<major>.<minor>.json' files.").
+		Envar("ADDON_OPERATOR_OPENAPI_SCHEMAS_DIR").
+		Default(OpenAPISchemasDir).
+		StringVar(&OpenAPISchemasDir)
+	cmd.Flag("kubernetes-version", "A target Kubernetes version to validate manifests with OpenAPI schemas from files, e.g. '1.17'.").
+		Envar("ADDON_OPERATOR_KUBERNETES_VERSION").
+		Default(KubernetesVersion).
+		StringVar(&KubernetesVersion)
+}
+
+// Instance is a configuration of one Addon-operator instance. It is created from flags
+// and passed to the operator, so several instances can be run in one process.
+type Instance struct {
+	// ID distinguishes instances in one cluster. It scopes the ConfigMap name,
+	// release names, release ownership and metrics.
+	ID string
+	// Namespace is a namespace of the Addon-operator.
+	Namespace string
+	// ConfigMapName is a name of the ConfigMap with values.
+	ConfigMapName string
+	// HelmReleasePrefix is a prefix for release names.
+	HelmReleasePrefix string
+	// HelmReleaseNameTemplate is a Go template for release names.
+	HelmReleaseNameTemplate string
+}
+
+// NewInstance returns a configuration of the instance from flags. Instance id is used
+// to scope the ConfigMap name and the release names prefix if they are not set explicitly.
+func NewInstance() (*Instance, error) {
+	instance := &Instance{
+		ID:                      InstanceID,
+		Namespace:               Namespace,
+		ConfigMapName:           ConfigMapName,
+		HelmReleasePrefix:       HelmReleasePrefix,
+		HelmReleaseNameTemplate: HelmReleaseNameTemplate,
+	}
+	if instance.ID == "" {
+		return instance, nil
+	}
+	if errs := validation.IsDNS1123Label(instance.ID); len(errs) > 0 {
+		return nil, fmt.Errorf("invalid instance id '%s': %s", instance.ID, strings.Join(errs, ", "))
+	}
+	if instance.ConfigMapName == DefaultConfigMapName {
+		instance.ConfigMapName = DefaultConfigMapName + "-" + instance.ID
+	}
+	if instance.HelmReleasePrefix == "" {
+		instance.HelmReleasePrefix = instance.ID + "-"
+	}
+	return instance, nil
+}
+
+// OwnerID returns a value to mark objects owned by this Addon-operator instance.
+func (i *Instance) OwnerID() string {
+	if i.ID != "" {
+		return i.ID
+	}
+	return i.Namespace
+}
@@ -80,9 +80,10 @@ func DefineDebugCommands(kpApp *kingpin.Application) {
 	AddOutputJsonYamlFlag(moduleValuesCmd)
 	sh_app.DefineDebugUnixSocketFlag(moduleValuesCmd)
 
+	var renderValidate bool
 	moduleRenderCmd := moduleCmd.Command("render", "Render module manifests.").
 		Action(func(c *kingpin.ParseContext) error {
-			dump, err := Module(sh_debug.DefaultClient()).Name(moduleName).Render()
+			dump, err := Module(sh_debug.DefaultClient()).Name(moduleName).Render(renderValidate)
 			if err != nil {
 				return err
 			}
@@ -90,6 +91,8 @@ func DefineDebugCommands(kpApp *kingpin.Application) {
 			return nil
 		})
 	moduleRenderCmd.Arg("module_name", "").Required().StringVar(&moduleName)
+	moduleRenderCmd.Flag("validate", "Validate rendered manifests with OpenAPI schemas of the running Addon-operator.").
+		BoolVar(&renderValidate)
 	AddOutputJsonYamlFlag(moduleRenderCmd)
 	sh_app.DefineDebugUnixSocketFlag(moduleRenderCmd)
 
@@ -120,6 +123,77 @@ func DefineDebugCommands(kpApp *kingpin.Application) {
 	// --debug-unix-socket <file>
 	sh_app.DefineDebugUnixSocketFlag(modulePatchesCmd)
 
+	modulePurgeCmd := moduleCmd.Command("purge", "Confirm purge of a Helm release of an unknown module.").
+		Action(func(c *kingpin.ParseContext) error {
+			out, err := Module(sh_debug.DefaultClient()).Name(moduleName).Purge()
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(out))
+			return nil
+		})
+	modulePurgeCmd.Arg("module_name", "").Required().StringVar(&moduleName)
+	// --debug-unix-socket <file>
+	sh_app.DefineDebugUnixSocketFlag(modulePurgeCmd)
+
+	moduleHistoryCmd := moduleCmd.Command("history", "Dump history of module Helm releases.").
+		Action(func(c *kingpin.ParseContext) error {
+			out, err := Module(sh_debug.DefaultClient()).Name(moduleName).History(sh_debug.OutputFormat)
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(out))
+			return nil
+		})
+	moduleHistoryCmd.Arg("module_name", "").Required().StringVar(&moduleName)
+	// -o json|yaml|text and --debug-unix-socket <file>
+	sh_debug.AddOutputJsonYamlTextFlag(moduleHistoryCmd)
+	sh_app.DefineDebugUnixSocketFlag(moduleHistoryCmd)
+
+	var rollbackRevision string
+	var rollbackChart string
+	moduleRollbackCmd := moduleCmd.Command("rollback", "Roll back a module Helm release to the revision. Upgrades are paused until the chart or values are changed.").
+		Action(func(c *kingpin.ParseContext) error {
+			out, err := Module(sh_debug.DefaultClient()).Name(moduleName).Rollback(rollbackRevision, rollbackChart)
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(out))
+			return nil
+		})
+	moduleRollbackCmd.Arg("module_name", "").Required().StringVar(&moduleName)
+	moduleRollbackCmd.Arg("revision", "").Required().StringVar(&rollbackRevision)
+	moduleRollbackCmd.Flag("chart", "A chart name for a module with several charts.").StringVar(&rollbackChart)
+	// --debug-unix-socket <file>
+	sh_app.DefineDebugUnixSocketFlag(moduleRollbackCmd)
+
+	moduleDiffCmd := moduleCmd.Command("diff", "Dump last diffs between deployed releases and rendered manifests.").
+		Action(func(c *kingpin.ParseContext) error {
+			out, err := Module(sh_debug.DefaultClient()).Name(moduleName).Diff(sh_debug.OutputFormat)
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(out))
+			return nil
+		})
+	moduleDiffCmd.Arg("module_name", "").Required().StringVar(&moduleName)
+	// -o json|yaml|text and --debug-unix-socket <file>
+	sh_debug.AddOutputJsonYamlTextFlag(moduleDiffCmd)
+	sh_app.DefineDebugUnixSocketFlag(moduleDiffCmd)
+
+	moduleFailedDiffCmd := moduleCmd.Command("failed-diff", "Dump diffs of rolled back Helm upgrades.").
+		Action(func(c *kingpin.ParseContext) error {
+			out, err := Module(sh_debug.DefaultClient()).Name(moduleName).FailedDiff()
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(out))
+			return nil
+		})
+	moduleFailedDiffCmd.Arg("module_name", "").Required().StringVar(&moduleName)
+	// --debug-unix-socket <file>
+	sh_app.DefineDebugUnixSocketFlag(moduleFailedDiffCmd)
+
 	moduleResourceMonitorCmd := moduleCmd.Command("resource-monitor", "Dump resource monitors.").
 		Action(func(c *kingpin.ParseContext) error {
 			out, err := Module(sh_debug.DefaultClient()).ResourceMonitor(sh_debug.OutputFormat)
@@ -193,8 +267,39 @@ func (mr *ModuleRequest) Values(format string) ([]byte, error) {
 	return mr.client.Get(url)
 }
 
-func (mr *ModuleRequest) Render() ([]byte, error) {
+func (mr *ModuleRequest) Render(validate bool) ([]byte, error) {
 	url := fmt.Sprintf("http://unix/module/%s/render", mr.name)
+	if validate {
+		url += "?validate=yes"
+	}
+	return mr.client.Get(url)
+}
+
+func (mr *ModuleRequest) Purge() ([]byte, error) {
+	url := fmt.Sprintf("http://unix/module/%s/purge", mr.name)
+	return mr.client.Get(url)
+}
+
+func (mr *ModuleRequest) History(format string) ([]byte, error) {
+	url := fmt.Sprintf("http://unix/module/%s/history.%s", mr.name, format)
+	return mr.client.Get(url)
+}
+
+func (mr *ModuleRequest) Rollback(revision string, chart string) ([]byte, error) {
+	url := fmt.Sprintf("http://unix/module/%s/rollback/%s", mr.name, revision)
+	if chart != "" {
+		url += "?chart=" + chart
+	}
+	return mr.client.Get(url)
+}
+
+func (mr *ModuleRequest) Diff(format string) ([]byte, error) {
+	url := fmt.Sprintf("http://unix/module/%s/diff?format=%s", mr.name, format)
+	return mr.client.Get(url)
+}
+
+func (mr *ModuleRequest) FailedDiff() ([]byte, error) {
+	url := fmt.Sprintf("http://unix/module/%s/failed-diff", mr.name)
 	return mr.client.Get(url)
 }
 
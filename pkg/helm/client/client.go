@@ -1,19 +1,126 @@
 package client
 
-import "github.com/flant/addon-operator/pkg/utils"
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/flant/addon-operator/pkg/utils"
+)
 
 type HelmClient interface {
+	WithNamespace(namespace string)
+	WithPostRenderer(postRenderer PostRenderer)
 	CommandEnv() []string
 	Cmd(args ...string) (string, string, error)
 	InitAndVersion() error
 	DeleteSingleFailedRevision(releaseName string) error
 	DeleteOldFailedRevisions(releaseName string) error
+	RecoverPendingRelease(releaseName string) (string, error)
 	LastReleaseStatus(releaseName string) (string, string, error)
-	UpgradeRelease(releaseName string, chart string, valuesPaths []string, setValues []string, namespace string) error
+	UpgradeRelease(opts UpgradeOptions) error
 	Render(releaseName string, chart string, valuesPaths []string, setValues []string, namespace string) (string, error)
 	GetReleaseValues(releaseName string) (utils.Values, error)
+	GetReleaseManifest(releaseName string, revision string) (string, error)
+	History(releaseName string) ([]ReleaseRevision, error)
+	Rollback(releaseName string, revision string) (string, error)
 	DeleteRelease(releaseName string) error
 	ListReleases(labelSelector map[string]string) ([]string, error)
 	ListReleasesNames(labelSelector map[string]string) ([]string, error)
+	LabelRelease(releaseName string, labels map[string]string) error
+	ReleaseLabels(releaseName string) (map[string]string, error)
 	IsReleaseExists(releaseName string) (bool, error)
 }
+
+// UpgradeOptions are arguments and flags of 'helm upgrade --install'.
+type UpgradeOptions struct {
+	ReleaseName string
+	Chart       string
+	ValuesPaths []string
+	SetValues   []string
+	Namespace   string
+	// Wait waits until all resources of the release are ready.
+	Wait bool
+	// Atomic rolls back the failed upgrade or deletes the failed install. It implies Wait.
+	Atomic bool
+	// Timeout overrides the global timeout of Kubernetes operations if not zero.
+	Timeout time.Duration
+	// HistoryMax overrides the global limit of release revisions if not zero.
+	// Helm 2 ignores it: the limit is a Tiller setting.
+	HistoryMax int32
+	// Force recreates resources that cannot be updated.
+	Force bool
+	// ResetValues ignores values stored in the release.
+	ResetValues bool
+}
+
+// PostRenderer changes rendered manifests before helm upgrade. Run is compatible
+// with the post-renderer of the helm 3 library. Args are arguments of the addon-operator
+// binary to run the post-renderer as an external program for the helm binary.
+type PostRenderer interface {
+	Run(renderedManifests *bytes.Buffer) (*bytes.Buffer, error)
+	Args() []string
+}
+
+// PostRender applies the post-renderer to rendered manifests. Manifests are
+// returned as is if the post-renderer is nil.
+func PostRender(postRenderer PostRenderer, manifests string) (string, error) {
+	if postRenderer == nil {
+		return manifests, nil
+	}
+	res, err := postRenderer.Run(bytes.NewBufferString(manifests))
+	if err != nil {
+		return "", fmt.Errorf("post-render: %v", err)
+	}
+	return res.String(), nil
+}
+
+// ReleaseRevision is a revision of the release as in 'helm history' output.
+type ReleaseRevision struct {
+	Revision    int    `json:"revision"`
+	Updated     string `json:"updated"`
+	Status      string `json:"status"`
+	Chart       string `json:"chart"`
+	AppVersion  string `json:"app_version,omitempty"`
+	Description string `json:"description"`
+}
+
+// RollbackRevision returns a revision to roll back to. An empty revision means the last
+// deployed one. The result is empty if the last deployed revision is also the last revision.
+func RollbackRevision(history []ReleaseRevision, revision string) (string, error) {
+	last, deployed := 0, 0
+	for _, rev := range history {
+		if rev.Revision > last {
+			last = rev.Revision
+		}
+		if strings.ToLower(rev.Status) == "deployed" && rev.Revision > deployed {
+			deployed = rev.Revision
+		}
+	}
+	if last == 0 {
+		return "", fmt.Errorf("release has no revisions")
+	}
+
+	if revision != "" {
+		target, err := strconv.Atoi(revision)
+		if err != nil {
+			return "", fmt.Errorf("bad revision '%s': %v", revision, err)
+		}
+		for _, rev := range history {
+			if rev.Revision == target {
+				return revision, nil
+			}
+		}
+		return "", fmt.Errorf("revision %s is not found in the release history", revision)
+	}
+
+	if deployed == 0 {
+		return "", fmt.Errorf("release has no deployed revision to rollback to")
+	}
+	if deployed == last {
+		return "", nil
+	}
+	return strconv.Itoa(deployed), nil
+}
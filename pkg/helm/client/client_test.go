@@ -0,0 +1,44 @@
+package client
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_RollbackRevision(t *testing.T) {
+	history := []ReleaseRevision{
+		{Revision: 1, Status: "superseded"},
+		{Revision: 2, Status: "deployed"},
+		{Revision: 3, Status: "failed"},
+	}
+
+	tests := []struct {
+		name     string
+		history  []ReleaseRevision
+		revision string
+		expected string
+		hasError bool
+	}{
+		{"last deployed revision", history, "", "2", false},
+		{"helm2 statuses", []ReleaseRevision{{Revision: 1, Status: "DEPLOYED"}, {Revision: 2, Status: "FAILED"}}, "", "1", false},
+		{"last revision is deployed", history[:2], "", "", false},
+		{"no deployed revision", []ReleaseRevision{{Revision: 1, Status: "failed"}}, "", "", true},
+		{"requested revision", history, "1", "1", false},
+		{"absent revision", history, "5", "", true},
+		{"bad revision", history, "one", "", true},
+		{"empty history", nil, "1", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			revision, err := RollbackRevision(tt.history, tt.revision)
+			if tt.hasError {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, revision)
+		})
+	}
+}
@@ -7,59 +7,154 @@ import (
 	"github.com/flant/addon-operator/pkg/app"
 	"github.com/flant/addon-operator/pkg/helm/client"
 	"github.com/flant/addon-operator/pkg/helm/helm2"
+	"github.com/flant/addon-operator/pkg/helm/helm2to3"
 	"github.com/flant/addon-operator/pkg/helm/helm3"
+	"github.com/flant/addon-operator/pkg/helm/helm3lib"
+	"github.com/flant/addon-operator/pkg/utils"
 	"github.com/flant/shell-operator/pkg/kube"
+	log "github.com/sirupsen/logrus"
 )
 
-var NewClient = func(logLabels ...map[string]string) client.HelmClient {
-	return nil
+// OwnerLabel is set on Helm release storage objects to mark releases created by Addon-operator.
+const OwnerLabel = "addon-operator/owner"
+
+// Helm creates Helm clients and release names for one Addon-operator instance.
+type Helm struct {
+	// NewClient returns a client for releases in the namespace of the instance.
+	NewClient func(logLabels ...map[string]string) client.HelmClient
+	// HealthzHandler checks Tiller. It is nil for Helm 3.
+	HealthzHandler func(writer http.ResponseWriter, request *http.Request)
+	// Tiller is true for Helm 2. Tiller keeps the namespace of the existing release,
+	// so the release is never installed in several namespaces.
+	Tiller bool
+	// OwnerID is a value of the owner label for releases of the instance.
+	OwnerID string
+	// ReleaseNaming generates release names for modules.
+	ReleaseNaming *ReleaseNaming
+}
+
+// OwnerLabels returns labels to mark and to select releases owned by the instance.
+func (h *Helm) OwnerLabels() map[string]string {
+	return map[string]string{OwnerLabel: h.OwnerID}
 }
 
-var HealthzHandler func(writer http.ResponseWriter, request *http.Request)
+// OtherOwner returns a value of the owner label if the release with these labels is
+// owned by another Addon-operator. Releases without the owner label are not owned by anyone.
+func (h *Helm) OtherOwner(releaseLabels map[string]string) string {
+	owner := releaseLabels[OwnerLabel]
+	if owner == "" || owner == h.OwnerID {
+		return ""
+	}
+	return owner
+}
+
+// ListOwnedReleases returns names of releases with labels that are owned by the instance.
+func (h *Helm) ListOwnedReleases(helmClient client.HelmClient, labels map[string]string) ([]string, error) {
+	return helmClient.ListReleasesNames(utils.MergeLabels(labels, h.OwnerLabels()))
+}
+
+// ReleaseName returns a release name for the module.
+func (h *Helm) ReleaseName(moduleName string, namespace string) string {
+	return h.ReleaseNaming.ReleaseName(moduleName, namespace)
+}
+
+// Init chooses helm3 or helm2 with Tiller and returns a Helm for the instance.
+func Init(kubeClient kube.KubernetesClient, instance *app.Instance) (*Helm, error) {
+	releaseNaming, err := NewReleaseNaming(instance.HelmReleaseNameTemplate, instance.HelmReleasePrefix)
+	if err != nil {
+		return nil, err
+	}
+	h := &Helm{
+		OwnerID:       instance.OwnerID(),
+		ReleaseNaming: releaseNaming,
+	}
 
-func Init(client kube.KubernetesClient) error {
 	helmVersion, err := DetectHelmVersion()
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	if helmVersion == "v3" && app.Helm3Client == app.Helm3ClientLibrary {
+		// Use helm3 library.
+		options := &helm3lib.Helm3LibOptions{
+			Namespace:  instance.Namespace,
+			HistoryMax: app.Helm3HistoryMax,
+			Timeout:    app.Helm3Timeout,
+			KubeClient: kubeClient,
+		}
+		h.NewClient = func(logLabels ...map[string]string) client.HelmClient {
+			return helm3lib.NewClient(options, logLabels...)
+		}
+		return h, helm3lib.Init(options)
 	}
 
 	if helmVersion == "v3" {
 		// Use helm3 client.
-		NewClient = helm3.NewClient
-		err = helm3.Init(&helm3.Helm3Options{
-			Namespace:  app.Namespace,
+		options := &helm3.Helm3Options{
+			Namespace:  instance.Namespace,
 			HistoryMax: app.Helm3HistoryMax,
 			Timeout:    app.Helm3Timeout,
-			KubeClient: client,
-		})
-		return err
+			KubeClient: kubeClient,
+		}
+		h.NewClient = func(logLabels ...map[string]string) client.HelmClient {
+			return helm3.NewClient(options, logLabels...)
+		}
+		return h, helm3.Init(options)
 	}
 
-	if helmVersion == "v2" {
-		// TODO make tiller cancelable
-		err = helm2.InitTillerProcess(helm2.TillerOptions{
-			Namespace:          app.Namespace,
-			HistoryMax:         app.TillerMaxHistory,
-			ListenAddress:      app.TillerListenAddress,
-			ListenPort:         app.TillerListenPort,
-			ProbeListenAddress: app.TillerProbeListenAddress,
-			ProbeListenPort:    app.TillerProbeListenPort,
-		})
-		if err != nil {
-			return fmt.Errorf("init tiller: %s", err)
-		}
+	// TODO make tiller cancelable
+	err = helm2.InitTillerProcess(helm2.TillerOptions{
+		Namespace:          instance.Namespace,
+		HistoryMax:         app.TillerMaxHistory,
+		ListenAddress:      app.TillerListenAddress,
+		ListenPort:         app.TillerListenPort,
+		ProbeListenAddress: app.TillerProbeListenAddress,
+		ProbeListenPort:    app.TillerProbeListenPort,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("init tiller: %s", err)
+	}
 
-		// Initialize helm2 client
-		err = helm2.Init(&helm2.Helm2Options{
-			Namespace:  app.Namespace,
-			KubeClient: client,
-		})
-		if err != nil {
-			return fmt.Errorf("init helm client: %s", err)
-		}
-		NewClient = helm2.NewClient
-		HealthzHandler = helm2.TillerHealthHandler()
+	// Initialize helm2 client
+	options := &helm2.Helm2Options{
+		Namespace:  instance.Namespace,
+		KubeClient: kubeClient,
+	}
+	err = helm2.Init(options)
+	if err != nil {
+		return nil, fmt.Errorf("init helm client: %s", err)
+	}
+	h.NewClient = func(logLabels ...map[string]string) client.HelmClient {
+		return helm2.NewClient(options, logLabels...)
+	}
+	h.HealthzHandler = helm2.TillerHealthHandler()
+	h.Tiller = true
+	return h, nil
+}
+
+// Migrate2To3 converts Tiller releases owned by the instance into Helm 3 releases.
+// Helm 3 library client is used to verify converted releases, so helm binary is not required.
+func Migrate2To3(kubeClient kube.KubernetesClient, instance *app.Instance, dryRun bool) ([]helm2to3.ReleaseMigration, error) {
+	options := &helm3lib.Helm3LibOptions{
+		Namespace:  instance.Namespace,
+		HistoryMax: app.Helm3HistoryMax,
+		Timeout:    app.Helm3Timeout,
+		KubeClient: kubeClient,
+	}
+	err := helm3lib.Init(options)
+	if err != nil {
+		return nil, err
 	}
 
-	return nil
+	migrator := &helm2to3.Migrator{
+		KubeClient:      kubeClient,
+		TillerNamespace: instance.Namespace,
+		OwnerLabels:     map[string]string{OwnerLabel: instance.OwnerID()},
+		NewHelm3Client: func() client.HelmClient {
+			return helm3lib.NewClient(options)
+		},
+		DryRun:   dryRun,
+		LogEntry: log.WithField("operator.component", "helm2to3"),
+	}
+	return migrator.Migrate()
 }
@@ -2,9 +2,13 @@ package helm2
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
+	"math"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"regexp"
 	"sort"
 	"strconv"
@@ -13,9 +17,11 @@ import (
 	log "github.com/sirupsen/logrus"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	kblabels "k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
 
 	"github.com/flant/addon-operator/pkg/helm/client"
 	"github.com/flant/addon-operator/pkg/utils"
+	sh_app "github.com/flant/shell-operator/pkg/app"
 	"github.com/flant/shell-operator/pkg/executor"
 	"github.com/flant/shell-operator/pkg/kube"
 )
@@ -27,29 +33,23 @@ type Helm2Options struct {
 	KubeClient kube.KubernetesClient
 }
 
-var HelmOptions *Helm2Options
-
 func Init(options *Helm2Options) error {
 	hc := &Helm2Client{
 		LogEntry: log.WithField("operator.component", "helm"),
 	}
-	err := hc.InitAndVersion()
-	if err != nil {
-		return err
-	}
-	HelmOptions = options
-	return nil
+	return hc.InitAndVersion()
 }
 
 type Helm2Client struct {
-	KubeClient kube.KubernetesClient
-	LogEntry   *log.Entry
-	Namespace  string
+	KubeClient   kube.KubernetesClient
+	LogEntry     *log.Entry
+	Namespace    string
+	PostRenderer client.PostRenderer
 }
 
 var _ client.HelmClient = &Helm2Client{}
 
-func NewClient(logLabels ...map[string]string) client.HelmClient {
+func NewClient(options *Helm2Options, logLabels ...map[string]string) client.HelmClient {
 	logEntry := log.WithField("operator.component", "helm")
 	if len(logLabels) > 0 {
 		logEntry = logEntry.WithFields(utils.LabelsToLogFields(logLabels[0]))
@@ -57,8 +57,8 @@ func NewClient(logLabels ...map[string]string) client.HelmClient {
 
 	return &Helm2Client{
 		LogEntry:   logEntry,
-		KubeClient: HelmOptions.KubeClient,
-		Namespace:  HelmOptions.Namespace,
+		KubeClient: options.KubeClient,
+		Namespace:  options.Namespace,
 	}
 }
 
@@ -66,6 +66,18 @@ func (h *Helm2Client) WithKubeClient(client kube.KubernetesClient) {
 	h.KubeClient = client
 }
 
+// WithNamespace does nothing: Helm 2 stores all releases in the Tiller namespace
+// and the release namespace is passed to UpgradeRelease and Render.
+func (h *Helm2Client) WithNamespace(_ string) {
+}
+
+// WithPostRenderer sets a post-renderer for rendered manifests. Helm 2 has no
+// post-renderers, so the chart is rendered and post-rendered manifests are upgraded
+// with a temporary chart.
+func (h *Helm2Client) WithPostRenderer(postRenderer client.PostRenderer) {
+	h.PostRenderer = postRenderer
+}
+
 func (h *Helm2Client) CommandEnv() []string {
 	res := make([]string, 0)
 	res = append(res, fmt.Sprintf("TILLER_NAMESPACE=%s", h.Namespace))
@@ -139,6 +151,11 @@ func (h *Helm2Client) DeleteSingleFailedRevision(releaseName string) (err error)
 	return
 }
 
+// RecoverPendingRelease is not implemented for helm2: Tiller runs operations and tracks their state.
+func (h *Helm2Client) RecoverPendingRelease(releaseName string) (string, error) {
+	return "", nil
+}
+
 func (h *Helm2Client) DeleteOldFailedRevisions(releaseName string) error {
 	cmNames, err := h.ListReleases(map[string]string{"STATUS": "FAILED", "NAME": releaseName})
 	if err != nil {
@@ -212,38 +229,108 @@ func (h *Helm2Client) LastReleaseStatus(releaseName string) (revision string, st
 	return
 }
 
-func (h *Helm2Client) UpgradeRelease(releaseName string, chart string, valuesPaths []string, setValues []string, namespace string) error {
+func (h *Helm2Client) UpgradeRelease(opts client.UpgradeOptions) error {
+	if h.PostRenderer != nil {
+		postRenderedChart, err := h.postRenderedChart(opts.ReleaseName, opts.Chart, opts.ValuesPaths, opts.SetValues, opts.Namespace)
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(postRenderedChart)
+		opts.Chart = postRenderedChart
+	}
+
+	h.LogEntry.Infof("Running helm upgrade for release '%s' with chart '%s' in namespace '%s' ...", opts.ReleaseName, opts.Chart, opts.Namespace)
+	stdout, stderr, err := h.Cmd(upgradeArgs(opts)...)
+	if err != nil {
+		return fmt.Errorf("helm upgrade failed: %s:\n%s %s", err, stdout, stderr)
+	}
+	h.LogEntry.Infof("Helm upgrade for release '%s' with chart '%s' in namespace '%s' successful:\n%s\n%s", opts.ReleaseName, opts.Chart, opts.Namespace, stdout, stderr)
+
+	return nil
+}
+
+// upgradeArgs returns arguments of 'helm upgrade --install'. Helm 2 expects the timeout
+// in seconds. HistoryMax is ignored: Tiller limits the history.
+func upgradeArgs(opts client.UpgradeOptions) []string {
 	args := make([]string, 0)
 	args = append(args, "upgrade")
 	args = append(args, "--install")
-	args = append(args, releaseName)
-	args = append(args, chart)
+	args = append(args, opts.ReleaseName)
+	args = append(args, opts.Chart)
 
-	if namespace != "" {
+	if opts.Namespace != "" {
 		args = append(args, "--namespace")
-		args = append(args, namespace)
+		args = append(args, opts.Namespace)
 	}
 
-	for _, valuesPath := range valuesPaths {
+	for _, valuesPath := range opts.ValuesPaths {
 		args = append(args, "--values")
 		args = append(args, valuesPath)
 	}
 
-	for _, setValue := range setValues {
+	for _, setValue := range opts.SetValues {
 		args = append(args, "--set")
 		args = append(args, setValue)
 	}
 
-	h.LogEntry.Infof("Running helm upgrade for release '%s' with chart '%s' in namespace '%s' ...", releaseName, chart, namespace)
-	stdout, stderr, err := h.Cmd(args...)
+	if opts.Timeout > 0 {
+		args = append(args, "--timeout")
+		args = append(args, strconv.Itoa(int(math.Ceil(opts.Timeout.Seconds()))))
+	}
+	if opts.Wait {
+		args = append(args, "--wait")
+	}
+	if opts.Atomic {
+		args = append(args, "--atomic")
+	}
+	if opts.Force {
+		args = append(args, "--force")
+	}
+	if opts.ResetValues {
+		args = append(args, "--reset-values")
+	}
+
+	return args
+}
+
+// postRenderedChart returns a path to a temporary chart with post-rendered manifests
+// of the chart. Manifests are stored as a chart file and are not rendered again. Values
+// are still passed to the upgrade to store them in the release.
+func (h *Helm2Client) postRenderedChart(releaseName string, chart string, valuesPaths []string, setValues []string, namespace string) (string, error) {
+	manifests, err := h.Render(releaseName, chart, valuesPaths, setValues, namespace)
 	if err != nil {
-		return fmt.Errorf("helm upgrade failed: %s:\n%s %s", err, stdout, stderr)
+		return "", err
+	}
+	chartYaml, err := ioutil.ReadFile(filepath.Join(chart, "Chart.yaml"))
+	if err != nil {
+		return "", fmt.Errorf("post-render: %v", err)
 	}
-	h.LogEntry.Infof("Helm upgrade for release '%s' with chart '%s' in namespace '%s' successful:\n%s\n%s", releaseName, chart, namespace, stdout, stderr)
 
-	return nil
+	dir, err := ioutil.TempDir(sh_app.TempDir, "post-rendered-chart-")
+	if err != nil {
+		return "", fmt.Errorf("post-render: %v", err)
+	}
+	files := map[string]string{
+		"Chart.yaml":               string(chartYaml),
+		postRenderedFile:           manifests,
+		"templates/manifests.yaml": fmt.Sprintf("{{ .Files.Get %q }}\n", postRenderedFile),
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		err = os.MkdirAll(filepath.Dir(path), 0755)
+		if err == nil {
+			err = ioutil.WriteFile(path, []byte(content), 0644)
+		}
+		if err != nil {
+			os.RemoveAll(dir)
+			return "", fmt.Errorf("post-render: %v", err)
+		}
+	}
+	return dir, nil
 }
 
+const postRenderedFile = "post-rendered.yaml"
+
 func (h *Helm2Client) GetReleaseValues(releaseName string) (utils.Values, error) {
 	stdout, stderr, err := h.Cmd("get", "values", releaseName)
 	if err != nil {
@@ -258,6 +345,59 @@ func (h *Helm2Client) GetReleaseValues(releaseName string) (utils.Values, error)
 	return values, nil
 }
 
+// GetReleaseManifest returns manifests of the release revision. Empty revision means the last one.
+func (h *Helm2Client) GetReleaseManifest(releaseName string, revision string) (string, error) {
+	args := []string{"get", "manifest", releaseName}
+	if revision != "" {
+		args = append(args, "--revision", revision)
+	}
+	stdout, stderr, err := h.Cmd(args...)
+	if err != nil {
+		return "", fmt.Errorf("cannot get manifest of helm release %s: %s\n%s %s", releaseName, err, stdout, stderr)
+	}
+	return stdout, nil
+}
+
+// History returns revisions of the release sorted by revision number.
+func (h *Helm2Client) History(releaseName string) ([]client.ReleaseRevision, error) {
+	stdout, stderr, err := h.Cmd("history", releaseName, "--max", "256", "--output", "json")
+	if err != nil {
+		return nil, fmt.Errorf("cannot get history for release '%s'\n%v %v", releaseName, stdout, stderr)
+	}
+	var history []client.ReleaseRevision
+	err = json.Unmarshal([]byte(stdout), &history)
+	if err != nil {
+		return nil, fmt.Errorf("helm history returns invalid json: %v", err)
+	}
+	sort.Slice(history, func(i, j int) bool {
+		return history[i].Revision < history[j].Revision
+	})
+	return history, nil
+}
+
+// Rollback rolls back the release to the revision or to the last DEPLOYED revision if revision is empty.
+// It returns the revision or an empty string if the last revision is already deployed.
+func (h *Helm2Client) Rollback(releaseName string, revision string) (string, error) {
+	history, err := h.History(releaseName)
+	if err != nil {
+		return "", err
+	}
+	revision, err = client.RollbackRevision(history, revision)
+	if err != nil {
+		return "", fmt.Errorf("release '%s': %v", releaseName, err)
+	}
+	if revision == "" {
+		return "", nil
+	}
+
+	h.LogEntry.Infof("Running helm rollback for release '%s' to revision %s ...", releaseName, revision)
+	stdout, stderr, err := h.Cmd("rollback", releaseName, revision)
+	if err != nil {
+		return "", fmt.Errorf("helm rollback failed: %s:\n%s %s", err, stdout, stderr)
+	}
+	return revision, nil
+}
+
 func (h *Helm2Client) DeleteRelease(releaseName string) (err error) {
 	h.LogEntry.Debugf("helm release '%s': execute helm delete --purge", releaseName)
 
@@ -310,6 +450,61 @@ func (h *Helm2Client) ListReleases(labelSelector map[string]string) ([]string, e
 	return releases, nil
 }
 
+// LabelRelease sets labels on Tiller's ConfigMaps with revisions of the release.
+func (h *Helm2Client) LabelRelease(releaseName string, labels map[string]string) error {
+	selector := kblabels.Set{"OWNER": "TILLER", "NAME": releaseName}.AsSelector().String()
+	cmList, err := h.KubeClient.CoreV1().
+		ConfigMaps(h.Namespace).
+		List(metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return fmt.Errorf("list ConfigMaps for release '%s': %v", releaseName, err)
+	}
+
+	for _, cm := range cmList.Items {
+		if kblabels.SelectorFromSet(labels).Matches(kblabels.Set(cm.Labels)) {
+			continue
+		}
+		patch, err := json.Marshal(map[string]interface{}{
+			"metadata": map[string]interface{}{
+				"labels": labels,
+			},
+		})
+		if err != nil {
+			return err
+		}
+		_, err = h.KubeClient.CoreV1().
+			ConfigMaps(h.Namespace).
+			Patch(cm.Name, types.MergePatchType, patch)
+		if err != nil {
+			return fmt.Errorf("label ConfigMap '%s' for release '%s': %v", cm.Name, releaseName, err)
+		}
+	}
+	return nil
+}
+
+// ReleaseLabels returns labels of Tiller's ConfigMap with the last revision of the release.
+// Nil is returned if the release is not found.
+func (h *Helm2Client) ReleaseLabels(releaseName string) (map[string]string, error) {
+	selector := kblabels.Set{"OWNER": "TILLER", "NAME": releaseName}.AsSelector().String()
+	cmList, err := h.KubeClient.CoreV1().
+		ConfigMaps(h.Namespace).
+		List(metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return nil, fmt.Errorf("list ConfigMaps for release '%s': %v", releaseName, err)
+	}
+
+	var labels map[string]string
+	lastVersion := -1
+	for _, cm := range cmList.Items {
+		version, _ := strconv.Atoi(cm.Labels["VERSION"])
+		if version > lastVersion {
+			lastVersion = version
+			labels = cm.Labels
+		}
+	}
+	return labels, nil
+}
+
 // ListReleasesNames returns list of release names without suffixes ".v<release_number>"
 func (h *Helm2Client) ListReleasesNames(labelSelector map[string]string) ([]string, error) {
 	// Get all release names
@@ -372,5 +567,5 @@ func (h *Helm2Client) Render(releaseName string, chart string, valuesPaths []str
 	}
 	h.LogEntry.Infof("Render helm templates for chart '%s' was successful", chart)
 
-	return stdout, nil
+	return client.PostRender(h.PostRenderer, stdout)
 }
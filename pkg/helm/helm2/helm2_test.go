@@ -0,0 +1,40 @@
+package helm2
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/flant/addon-operator/pkg/helm/client"
+)
+
+func Test_upgradeArgs(t *testing.T) {
+	assert.Equal(t, []string{
+		"upgrade", "--install", "release", "/chart",
+		"--namespace", "ns",
+		"--values", "/values.yaml",
+		"--set", "a=b",
+	}, upgradeArgs(client.UpgradeOptions{
+		ReleaseName: "release",
+		Chart:       "/chart",
+		ValuesPaths: []string{"/values.yaml"},
+		SetValues:   []string{"a=b"},
+		Namespace:   "ns",
+		HistoryMax:  3,
+	}), "history limit is a Tiller setting")
+
+	assert.Equal(t, []string{
+		"upgrade", "--install", "release", "/chart",
+		"--timeout", "91",
+		"--wait", "--atomic", "--force", "--reset-values",
+	}, upgradeArgs(client.UpgradeOptions{
+		ReleaseName: "release",
+		Chart:       "/chart",
+		Wait:        true,
+		Atomic:      true,
+		Timeout:     90*time.Second + 500*time.Millisecond,
+		Force:       true,
+		ResetValues: true,
+	}), "timeout should be rounded up to seconds")
+}
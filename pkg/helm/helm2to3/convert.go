@@ -0,0 +1,234 @@
+package helm2to3
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/release"
+	helmtime "helm.sh/helm/v3/pkg/time"
+	v1 "k8s.io/api/core/v1"
+)
+
+var gzipMagic = []byte{0x1f, 0x8b, 0x08}
+
+var statuses = map[int32]release.Status{
+	statusUnknown:         release.StatusUnknown,
+	statusDeployed:        release.StatusDeployed,
+	statusDeleted:         release.StatusUninstalled,
+	statusSuperseded:      release.StatusSuperseded,
+	statusFailed:          release.StatusFailed,
+	statusDeleting:        release.StatusUninstalling,
+	statusPendingInstall:  release.StatusPendingInstall,
+	statusPendingUpgrade:  release.StatusPendingUpgrade,
+	statusPendingRollback: release.StatusPendingRollback,
+}
+
+// hookEvents maps Helm 2 hook events to Helm 3 events. The crd-install event is
+// removed in Helm 3: CRDs are installed from the 'crds' directory.
+var hookEvents = map[int32]release.HookEvent{
+	hookEventPreInstall:         release.HookPreInstall,
+	hookEventPostInstall:        release.HookPostInstall,
+	hookEventPreDelete:          release.HookPreDelete,
+	hookEventPostDelete:         release.HookPostDelete,
+	hookEventPreUpgrade:         release.HookPreUpgrade,
+	hookEventPostUpgrade:        release.HookPostUpgrade,
+	hookEventPreRollback:        release.HookPreRollback,
+	hookEventPostRollback:       release.HookPostRollback,
+	hookEventReleaseTestSuccess: release.HookTest,
+	hookEventReleaseTestFailure: release.HookTest,
+}
+
+var hookDeletePolicies = map[int32]release.HookDeletePolicy{
+	hookDeletePolicySucceeded:          release.HookSucceeded,
+	hookDeletePolicyFailed:             release.HookFailed,
+	hookDeletePolicyBeforeHookCreation: release.HookBeforeHookCreation,
+}
+
+// DecodeTillerRelease decodes a Helm 2 release from the Tiller storage ConfigMap
+// and converts it into a Helm 3 release.
+func DecodeTillerRelease(cm *v1.ConfigMap) (*release.Release, error) {
+	data, has := cm.Data["release"]
+	if !has {
+		return nil, fmt.Errorf("ConfigMap '%s' has no release data", cm.Name)
+	}
+	b, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return nil, fmt.Errorf("decode release from ConfigMap '%s': %v", cm.Name, err)
+	}
+	if bytes.HasPrefix(b, gzipMagic) {
+		r, err := gzip.NewReader(bytes.NewReader(b))
+		if err != nil {
+			return nil, fmt.Errorf("decompress release from ConfigMap '%s': %v", cm.Name, err)
+		}
+		b, err = ioutil.ReadAll(r)
+		if err != nil {
+			return nil, fmt.Errorf("decompress release from ConfigMap '%s': %v", cm.Name, err)
+		}
+	}
+
+	rls := new(hapiRelease)
+	err = proto.Unmarshal(b, rls)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshal release from ConfigMap '%s': %v", cm.Name, err)
+	}
+	return convertRelease(rls)
+}
+
+// convertRelease converts a Helm 2 release into a Helm 3 release as 'helm 2to3 convert' does.
+func convertRelease(rls *hapiRelease) (*release.Release, error) {
+	if rls.Name == "" || rls.Version == 0 {
+		return nil, fmt.Errorf("release has no name or version")
+	}
+
+	chrt, err := convertChart(rls.Chart)
+	if err != nil {
+		return nil, fmt.Errorf("release '%s' revision %d: %v", rls.Name, rls.Version, err)
+	}
+	config, err := convertValues(rls.Config)
+	if err != nil {
+		return nil, fmt.Errorf("release '%s' revision %d: config: %v", rls.Name, rls.Version, err)
+	}
+
+	res := &release.Release{
+		Name:      rls.Name,
+		Namespace: rls.Namespace,
+		Version:   int(rls.Version),
+		Manifest:  rls.Manifest,
+		Chart:     chrt,
+		Config:    config,
+		Info:      &release.Info{Status: release.StatusUnknown},
+	}
+	if info := rls.Info; info != nil {
+		res.Info.FirstDeployed = convertTime(info.FirstDeployed)
+		res.Info.LastDeployed = convertTime(info.LastDeployed)
+		res.Info.Deleted = convertTime(info.Deleted)
+		res.Info.Description = info.Description
+		if info.Status != nil {
+			status, has := statuses[info.Status.Code]
+			if !has {
+				return nil, fmt.Errorf("release '%s' revision %d: unknown status code %d", rls.Name, rls.Version, info.Status.Code)
+			}
+			res.Info.Status = status
+			res.Info.Notes = info.Status.Notes
+		}
+	}
+
+	for _, hook := range rls.Hooks {
+		res.Hooks = append(res.Hooks, convertHook(hook))
+	}
+	return res, nil
+}
+
+func convertHook(hook *hapiHook) *release.Hook {
+	res := &release.Hook{
+		Name:     hook.Name,
+		Kind:     hook.Kind,
+		Path:     hook.Path,
+		Manifest: hook.Manifest,
+		Weight:   int(hook.Weight),
+	}
+	for _, event := range hook.Events {
+		if e, has := hookEvents[event]; has {
+			res.Events = append(res.Events, e)
+		}
+	}
+	for _, policy := range hook.DeletePolicies {
+		if p, has := hookDeletePolicies[policy]; has {
+			res.DeletePolicies = append(res.DeletePolicies, p)
+		}
+	}
+	if hook.LastRun != nil {
+		res.LastRun = release.HookExecution{
+			StartedAt:   convertTime(hook.LastRun),
+			CompletedAt: convertTime(hook.LastRun),
+			Phase:       release.HookPhaseSucceeded,
+		}
+	}
+	return res
+}
+
+func convertChart(c *hapiChart) (*chart.Chart, error) {
+	if c == nil || c.Metadata == nil {
+		return nil, fmt.Errorf("chart has no metadata")
+	}
+	values, err := convertValues(c.Values)
+	if err != nil {
+		return nil, fmt.Errorf("chart '%s' values: %v", c.Metadata.Name, err)
+	}
+
+	res := &chart.Chart{
+		Metadata: convertMetadata(c.Metadata),
+		Values:   values,
+	}
+	for _, tpl := range c.Templates {
+		res.Templates = append(res.Templates, &chart.File{Name: tpl.Name, Data: tpl.Data})
+	}
+	// Helm 2 stores files as Any with the file name in the type URL.
+	for _, file := range c.Files {
+		res.Files = append(res.Files, &chart.File{Name: file.TypeUrl, Data: file.Value})
+	}
+	for _, dep := range c.Dependencies {
+		depChart, err := convertChart(dep)
+		if err != nil {
+			return nil, err
+		}
+		res.AddDependency(depChart)
+	}
+	return res, nil
+}
+
+func convertMetadata(md *hapiMetadata) *chart.Metadata {
+	res := &chart.Metadata{
+		Name:        md.Name,
+		Home:        md.Home,
+		Sources:     md.Sources,
+		Version:     md.Version,
+		Description: md.Description,
+		Keywords:    md.Keywords,
+		Icon:        md.Icon,
+		// Helm 2 charts are v1 charts.
+		APIVersion:  chart.APIVersionV1,
+		Condition:   md.Condition,
+		Tags:        md.Tags,
+		AppVersion:  md.AppVersion,
+		Deprecated:  md.Deprecated,
+		Annotations: md.Annotations,
+		KubeVersion: md.KubeVersion,
+	}
+	for _, m := range md.Maintainers {
+		res.Maintainers = append(res.Maintainers, &chart.Maintainer{Name: m.Name, Email: m.Email, URL: m.Url})
+	}
+	return res
+}
+
+func convertValues(config *hapiConfig) (map[string]interface{}, error) {
+	if config == nil || config.Raw == "" {
+		return map[string]interface{}{}, nil
+	}
+	values, err := chartutil.ReadValues([]byte(config.Raw))
+	if err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+func convertTime(ts *timestamp.Timestamp) helmtime.Time {
+	if ts == nil {
+		return helmtime.Time{}
+	}
+	return helmtime.Unix(ts.Seconds, int64(ts.Nanos))
+}
+
+// tillerReleaseVersion returns a revision of the release from the Tiller ConfigMap labels.
+func tillerReleaseVersion(cm *v1.ConfigMap) int {
+	version, _ := strconv.Atoi(cm.Labels["VERSION"])
+	return version
+}
@@ -0,0 +1,159 @@
+package helm2to3
+
+import (
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/any"
+	"github.com/golang/protobuf/ptypes/timestamp"
+)
+
+// Messages of Helm 2 releases from hapi/release and hapi/chart protos. Only fields
+// needed to convert releases are defined, unknown fields are skipped by proto.Unmarshal.
+
+// Status codes of hapi.release.Status.
+const (
+	statusUnknown         int32 = 0
+	statusDeployed        int32 = 1
+	statusDeleted         int32 = 2
+	statusSuperseded      int32 = 3
+	statusFailed          int32 = 4
+	statusDeleting        int32 = 5
+	statusPendingInstall  int32 = 6
+	statusPendingUpgrade  int32 = 7
+	statusPendingRollback int32 = 8
+)
+
+// Events of hapi.release.Hook.
+const (
+	hookEventUnknown            int32 = 0
+	hookEventPreInstall         int32 = 1
+	hookEventPostInstall        int32 = 2
+	hookEventPreDelete          int32 = 3
+	hookEventPostDelete         int32 = 4
+	hookEventPreUpgrade         int32 = 5
+	hookEventPostUpgrade        int32 = 6
+	hookEventPreRollback        int32 = 7
+	hookEventPostRollback       int32 = 8
+	hookEventReleaseTestSuccess int32 = 9
+	hookEventReleaseTestFailure int32 = 10
+	hookEventCrdInstall         int32 = 11
+)
+
+// Delete policies of hapi.release.Hook.
+const (
+	hookDeletePolicySucceeded          int32 = 0
+	hookDeletePolicyFailed             int32 = 1
+	hookDeletePolicyBeforeHookCreation int32 = 2
+)
+
+type hapiRelease struct {
+	Name      string      `protobuf:"bytes,1,opt,name=name,proto3"`
+	Info      *hapiInfo   `protobuf:"bytes,2,opt,name=info,proto3"`
+	Chart     *hapiChart  `protobuf:"bytes,3,opt,name=chart,proto3"`
+	Config    *hapiConfig `protobuf:"bytes,4,opt,name=config,proto3"`
+	Manifest  string      `protobuf:"bytes,5,opt,name=manifest,proto3"`
+	Hooks     []*hapiHook `protobuf:"bytes,6,rep,name=hooks,proto3"`
+	Version   int32       `protobuf:"varint,7,opt,name=version,proto3"`
+	Namespace string      `protobuf:"bytes,8,opt,name=namespace,proto3"`
+}
+
+func (m *hapiRelease) Reset()         { *m = hapiRelease{} }
+func (m *hapiRelease) String() string { return proto.CompactTextString(m) }
+func (*hapiRelease) ProtoMessage()    {}
+
+type hapiInfo struct {
+	Status        *hapiStatus          `protobuf:"bytes,1,opt,name=status,proto3"`
+	FirstDeployed *timestamp.Timestamp `protobuf:"bytes,2,opt,name=first_deployed,json=firstDeployed,proto3"`
+	LastDeployed  *timestamp.Timestamp `protobuf:"bytes,3,opt,name=last_deployed,json=lastDeployed,proto3"`
+	Deleted       *timestamp.Timestamp `protobuf:"bytes,4,opt,name=deleted,proto3"`
+	Description   string               `protobuf:"bytes,5,opt,name=Description,proto3"`
+}
+
+func (m *hapiInfo) Reset()         { *m = hapiInfo{} }
+func (m *hapiInfo) String() string { return proto.CompactTextString(m) }
+func (*hapiInfo) ProtoMessage()    {}
+
+type hapiStatus struct {
+	Code      int32  `protobuf:"varint,1,opt,name=code,proto3"`
+	Resources string `protobuf:"bytes,3,opt,name=resources,proto3"`
+	Notes     string `protobuf:"bytes,4,opt,name=notes,proto3"`
+}
+
+func (m *hapiStatus) Reset()         { *m = hapiStatus{} }
+func (m *hapiStatus) String() string { return proto.CompactTextString(m) }
+func (*hapiStatus) ProtoMessage()    {}
+
+type hapiHook struct {
+	Name           string               `protobuf:"bytes,1,opt,name=name,proto3"`
+	Kind           string               `protobuf:"bytes,2,opt,name=kind,proto3"`
+	Path           string               `protobuf:"bytes,3,opt,name=path,proto3"`
+	Manifest       string               `protobuf:"bytes,4,opt,name=manifest,proto3"`
+	Events         []int32              `protobuf:"varint,5,rep,packed,name=events,proto3"`
+	LastRun        *timestamp.Timestamp `protobuf:"bytes,6,opt,name=last_run,json=lastRun,proto3"`
+	Weight         int32                `protobuf:"varint,7,opt,name=weight,proto3"`
+	DeletePolicies []int32              `protobuf:"varint,8,rep,packed,name=delete_policies,json=deletePolicies,proto3"`
+}
+
+func (m *hapiHook) Reset()         { *m = hapiHook{} }
+func (m *hapiHook) String() string { return proto.CompactTextString(m) }
+func (*hapiHook) ProtoMessage()    {}
+
+type hapiChart struct {
+	Metadata     *hapiMetadata   `protobuf:"bytes,1,opt,name=metadata,proto3"`
+	Templates    []*hapiTemplate `protobuf:"bytes,2,rep,name=templates,proto3"`
+	Dependencies []*hapiChart    `protobuf:"bytes,3,rep,name=dependencies,proto3"`
+	Values       *hapiConfig     `protobuf:"bytes,4,opt,name=values,proto3"`
+	Files        []*any.Any      `protobuf:"bytes,5,rep,name=files,proto3"`
+}
+
+func (m *hapiChart) Reset()         { *m = hapiChart{} }
+func (m *hapiChart) String() string { return proto.CompactTextString(m) }
+func (*hapiChart) ProtoMessage()    {}
+
+type hapiConfig struct {
+	Raw string `protobuf:"bytes,1,opt,name=raw,proto3"`
+}
+
+func (m *hapiConfig) Reset()         { *m = hapiConfig{} }
+func (m *hapiConfig) String() string { return proto.CompactTextString(m) }
+func (*hapiConfig) ProtoMessage()    {}
+
+type hapiTemplate struct {
+	Name string `protobuf:"bytes,1,opt,name=name,proto3"`
+	Data []byte `protobuf:"bytes,2,opt,name=data,proto3"`
+}
+
+func (m *hapiTemplate) Reset()         { *m = hapiTemplate{} }
+func (m *hapiTemplate) String() string { return proto.CompactTextString(m) }
+func (*hapiTemplate) ProtoMessage()    {}
+
+type hapiMetadata struct {
+	Name        string            `protobuf:"bytes,1,opt,name=name,proto3"`
+	Home        string            `protobuf:"bytes,2,opt,name=home,proto3"`
+	Sources     []string          `protobuf:"bytes,3,rep,name=sources,proto3"`
+	Version     string            `protobuf:"bytes,4,opt,name=version,proto3"`
+	Description string            `protobuf:"bytes,5,opt,name=description,proto3"`
+	Keywords    []string          `protobuf:"bytes,6,rep,name=keywords,proto3"`
+	Maintainers []*hapiMaintainer `protobuf:"bytes,7,rep,name=maintainers,proto3"`
+	Icon        string            `protobuf:"bytes,9,opt,name=icon,proto3"`
+	ApiVersion  string            `protobuf:"bytes,10,opt,name=apiVersion,proto3"`
+	Condition   string            `protobuf:"bytes,11,opt,name=condition,proto3"`
+	Tags        string            `protobuf:"bytes,12,opt,name=tags,proto3"`
+	AppVersion  string            `protobuf:"bytes,13,opt,name=appVersion,proto3"`
+	Deprecated  bool              `protobuf:"varint,14,opt,name=deprecated,proto3"`
+	Annotations map[string]string `protobuf:"bytes,16,rep,name=annotations,proto3" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
+	KubeVersion string            `protobuf:"bytes,17,opt,name=kubeVersion,proto3"`
+}
+
+func (m *hapiMetadata) Reset()         { *m = hapiMetadata{} }
+func (m *hapiMetadata) String() string { return proto.CompactTextString(m) }
+func (*hapiMetadata) ProtoMessage()    {}
+
+type hapiMaintainer struct {
+	Name  string `protobuf:"bytes,1,opt,name=name,proto3"`
+	Email string `protobuf:"bytes,2,opt,name=email,proto3"`
+	Url   string `protobuf:"bytes,3,opt,name=url,proto3"`
+}
+
+func (m *hapiMaintainer) Reset()         { *m = hapiMaintainer{} }
+func (m *hapiMaintainer) String() string { return proto.CompactTextString(m) }
+func (*hapiMaintainer) ProtoMessage()    {}
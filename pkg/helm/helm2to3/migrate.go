@@ -0,0 +1,159 @@
+package helm2to3
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	log "github.com/sirupsen/logrus"
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/storage"
+	"helm.sh/helm/v3/pkg/storage/driver"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kblabels "k8s.io/apimachinery/pkg/labels"
+
+	"github.com/flant/shell-operator/pkg/kube"
+
+	"github.com/flant/addon-operator/pkg/helm/client"
+)
+
+// Migrator converts Tiller releases owned by Addon-operator into Helm 3 releases.
+type Migrator struct {
+	KubeClient kube.KubernetesClient
+	// TillerNamespace is a namespace with Tiller storage ConfigMaps.
+	TillerNamespace string
+	// OwnerLabels select releases of this Addon-operator. Labels are also set on Helm 3 releases.
+	OwnerLabels map[string]string
+	// NewHelm3Client returns a Helm 3 client to label and verify converted releases.
+	NewHelm3Client func() client.HelmClient
+	// DryRun only converts releases without storing them.
+	DryRun   bool
+	LogEntry *log.Entry
+}
+
+// ReleaseMigration is a result of the release migration.
+type ReleaseMigration struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+	// Revisions is a number of revisions in the Tiller history.
+	Revisions int `json:"revisions"`
+	// Created is a number of revisions stored in Helm 3. Existing revisions are not overwritten.
+	Created  int    `json:"created"`
+	Revision string `json:"revision"`
+	Status   string `json:"status"`
+}
+
+// Migrate converts every revision of owned Tiller releases into Helm 3 release Secrets
+// in the release namespace and verifies that the Helm 3 client sees the same last revision
+// and status. Tiller ConfigMaps are not deleted. Migration can be repeated: existing Helm 3
+// revisions are kept.
+func (m *Migrator) Migrate() ([]ReleaseMigration, error) {
+	histories, err := m.tillerHistories()
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(histories))
+	for name := range histories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	res := make([]ReleaseMigration, 0, len(names))
+	for _, name := range names {
+		migration, err := m.migrateRelease(name, histories[name])
+		if err != nil {
+			return res, fmt.Errorf("release '%s': %v", name, err)
+		}
+		res = append(res, migration)
+	}
+	return res, nil
+}
+
+// tillerHistories returns Tiller storage ConfigMaps of owned releases sorted by revision.
+func (m *Migrator) tillerHistories() (map[string][]v1.ConfigMap, error) {
+	selector := kblabels.Set{"OWNER": "TILLER"}
+	for k, v := range m.OwnerLabels {
+		selector[k] = v
+	}
+	list, err := m.KubeClient.CoreV1().
+		ConfigMaps(m.TillerNamespace).
+		List(metav1.ListOptions{LabelSelector: selector.AsSelector().String()})
+	if err != nil {
+		return nil, fmt.Errorf("list Tiller ConfigMaps in namespace '%s': %v", m.TillerNamespace, err)
+	}
+
+	res := make(map[string][]v1.ConfigMap)
+	for _, cm := range list.Items {
+		name := cm.Labels["NAME"]
+		if name == "" {
+			continue
+		}
+		res[name] = append(res[name], cm)
+	}
+	for _, history := range res {
+		sort.Slice(history, func(i, j int) bool {
+			return tillerReleaseVersion(&history[i]) < tillerReleaseVersion(&history[j])
+		})
+	}
+	return res, nil
+}
+
+func (m *Migrator) migrateRelease(name string, history []v1.ConfigMap) (ReleaseMigration, error) {
+	res := ReleaseMigration{Name: name, Revisions: len(history)}
+
+	releases := make([]*release.Release, 0, len(history))
+	for i := range history {
+		rls, err := DecodeTillerRelease(&history[i])
+		if err != nil {
+			return res, err
+		}
+		if rls.Namespace == "" {
+			rls.Namespace = m.TillerNamespace
+		}
+		releases = append(releases, rls)
+	}
+	last := releases[len(releases)-1]
+	res.Namespace = last.Namespace
+	res.Revision = strconv.Itoa(last.Version)
+	res.Status = last.Info.Status.String()
+
+	if m.DryRun {
+		m.LogEntry.Infof("Release '%s' in namespace '%s' with %d revisions can be migrated, last revision %s is %s", name, res.Namespace, res.Revisions, res.Revision, res.Status)
+		return res, nil
+	}
+
+	for _, rls := range releases {
+		store := storage.Init(driver.NewSecrets(m.KubeClient.CoreV1().Secrets(rls.Namespace)))
+		if _, err := store.Get(rls.Name, rls.Version); err == nil {
+			m.LogEntry.Debugf("Release '%s' revision %d is already migrated", rls.Name, rls.Version)
+			continue
+		}
+		err := store.Create(rls)
+		if err != nil {
+			return res, fmt.Errorf("create Helm 3 release revision %d: %v", rls.Version, err)
+		}
+		res.Created++
+	}
+
+	helmClient := m.NewHelm3Client()
+	helmClient.WithNamespace(res.Namespace)
+	if len(m.OwnerLabels) > 0 {
+		err := helmClient.LabelRelease(name, m.OwnerLabels)
+		if err != nil {
+			return res, err
+		}
+	}
+
+	revision, status, err := helmClient.LastReleaseStatus(name)
+	if err != nil {
+		return res, fmt.Errorf("verify Helm 3 release: %v", err)
+	}
+	if revision != res.Revision || status != res.Status {
+		return res, fmt.Errorf("verify Helm 3 release: last revision %s is %s, expected revision %s is %s", revision, status, res.Revision, res.Status)
+	}
+
+	m.LogEntry.Infof("Release '%s' is migrated to namespace '%s': %d of %d revisions are created, last revision %s is %s", name, res.Namespace, res.Created, res.Revisions, res.Revision, res.Status)
+	return res, nil
+}
@@ -0,0 +1,182 @@
+package helm2to3
+
+import (
+	"io/ioutil"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chartutil"
+	kubefake "helm.sh/helm/v3/pkg/kube/fake"
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/storage"
+	"helm.sh/helm/v3/pkg/storage/driver"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+
+	"github.com/flant/shell-operator/pkg/kube"
+
+	"github.com/flant/addon-operator/pkg/helm/client"
+	"github.com/flant/addon-operator/pkg/helm/helm3lib"
+	"github.com/flant/addon-operator/pkg/utils"
+)
+
+var ownerLabels = map[string]string{"addon-operator/owner": "addon-operator"}
+
+// newMigrator returns a migrator for the fake cluster with Tiller releases from testdata.
+// Helm 3 library client reads releases from Secrets of the fake cluster.
+func newMigrator(t *testing.T) (*Migrator, kube.KubernetesClient) {
+	kubeClient := kube.NewFakeKubernetesClient()
+
+	content, err := ioutil.ReadFile("testdata/tiller-releases.yaml")
+	require.NoError(t, err)
+	for _, doc := range utils.SplitYamlDocuments(string(content)) {
+		cm := new(v1.ConfigMap)
+		require.NoError(t, yaml.Unmarshal([]byte(doc), cm))
+		_, err = kubeClient.CoreV1().ConfigMaps(cm.Namespace).Create(cm)
+		require.NoError(t, err)
+	}
+
+	helm3Options := &helm3lib.Helm3LibOptions{
+		Namespace:  "addon-operator",
+		HistoryMax: 10,
+		Timeout:    time.Minute,
+		KubeClient: kubeClient,
+	}
+	helm3lib.NewActionConfig = func(namespace string, logEntry *log.Entry) (*action.Configuration, error) {
+		return &action.Configuration{
+			Releases:     storage.Init(driver.NewSecrets(kubeClient.CoreV1().Secrets(namespace))),
+			KubeClient:   &kubefake.PrintingKubeClient{Out: ioutil.Discard},
+			Capabilities: chartutil.DefaultCapabilities,
+			Log:          t.Logf,
+		}, nil
+	}
+
+	return &Migrator{
+		KubeClient:      kubeClient,
+		TillerNamespace: "addon-operator",
+		OwnerLabels:     ownerLabels,
+		NewHelm3Client: func() client.HelmClient {
+			return helm3lib.NewClient(helm3Options)
+		},
+		LogEntry: log.WithField("operator.component", "helm2to3"),
+	}, kubeClient
+}
+
+func Test_Migrator_Migrate(t *testing.T) {
+	m, kubeClient := newMigrator(t)
+
+	res, err := m.Migrate()
+	require.NoError(t, err)
+	assert.Equal(t, []ReleaseMigration{
+		{Name: "module-a", Namespace: "d8-system", Revisions: 2, Created: 2, Revision: "2", Status: "deployed"},
+		{Name: "module-b", Namespace: "kube-system", Revisions: 1, Created: 1, Revision: "1", Status: "failed"},
+	}, res, "release without the owner label should not be migrated")
+
+	// History is preserved.
+	store := storage.Init(driver.NewSecrets(kubeClient.CoreV1().Secrets("d8-system")))
+	history, err := store.History("module-a")
+	require.NoError(t, err)
+	assert.Len(t, history, 2)
+
+	first, err := store.Get("module-a", 1)
+	require.NoError(t, err)
+	assert.Equal(t, release.StatusSuperseded, first.Info.Status)
+	assert.Equal(t, "0.1.0", first.Chart.Metadata.Version)
+	assert.Equal(t, 2.0, first.Config["replicas"])
+
+	rls, err := store.Get("module-a", 2)
+	require.NoError(t, err)
+	assert.Equal(t, release.StatusDeployed, rls.Info.Status)
+	assert.Equal(t, "Upgrade complete", rls.Info.Description)
+	assert.Equal(t, "Module A is upgraded", rls.Info.Notes)
+	assert.Equal(t, int64(1577836800), rls.Info.FirstDeployed.Unix())
+	assert.Equal(t, int64(1577923200), rls.Info.LastDeployed.Unix())
+	assert.Contains(t, rls.Manifest, "replicas: \"3\"")
+	assert.Equal(t, "b456", rls.Config["_addonOperatorModuleChecksum"])
+
+	assert.Equal(t, "module-a", rls.Chart.Metadata.Name)
+	assert.Equal(t, "v1", rls.Chart.Metadata.APIVersion)
+	assert.Equal(t, "ops@example.com", rls.Chart.Metadata.Maintainers[0].Email)
+	assert.Equal(t, 1.0, rls.Chart.Values["replicas"])
+	assert.Equal(t, "templates/cm.yaml", rls.Chart.Templates[0].Name)
+	assert.Equal(t, "README.md", rls.Chart.Files[0].Name)
+
+	require.Len(t, rls.Hooks, 1)
+	hook := rls.Hooks[0]
+	assert.Equal(t, "module-a-migrate", hook.Name)
+	assert.Equal(t, []release.HookEvent{release.HookPreUpgrade}, hook.Events, "crd-install event should be dropped")
+	assert.Equal(t, []release.HookDeletePolicy{release.HookBeforeHookCreation}, hook.DeletePolicies)
+	assert.Equal(t, 5, hook.Weight)
+	assert.Equal(t, release.HookPhaseSucceeded, hook.LastRun.Phase)
+
+	// Helm 3 releases are owned by Addon-operator.
+	secrets, err := kubeClient.CoreV1().Secrets("kube-system").List(metav1.ListOptions{LabelSelector: "owner=helm,name=module-b"})
+	require.NoError(t, err)
+	require.Len(t, secrets.Items, 1)
+	assert.Equal(t, "addon-operator", secrets.Items[0].Labels["addon-operator/owner"])
+	assert.Equal(t, "failed", secrets.Items[0].Labels["status"])
+
+	// Migration can be repeated.
+	res, err = m.Migrate()
+	require.NoError(t, err)
+	assert.Equal(t, 0, res[0].Created)
+	assert.Equal(t, 0, res[1].Created)
+}
+
+func Test_DecodeTillerRelease(t *testing.T) {
+	_, kubeClient := newMigrator(t)
+	cm, err := kubeClient.CoreV1().ConfigMaps("addon-operator").Get("module-a.v2", metav1.GetOptions{})
+	require.NoError(t, err)
+
+	rls, err := DecodeTillerRelease(cm)
+	require.NoError(t, err)
+	assert.Equal(t, "module-a", rls.Name)
+	assert.Equal(t, 2, rls.Version)
+	// Subcharts are not stored in Helm 3 releases, so check them after decoding.
+	require.Len(t, rls.Chart.Dependencies(), 1)
+	assert.Equal(t, "lib", rls.Chart.Dependencies()[0].Name())
+	assert.Equal(t, rls.Chart, rls.Chart.Dependencies()[0].Parent())
+
+	delete(cm.Data, "release")
+	_, err = DecodeTillerRelease(cm)
+	assert.Error(t, err)
+	cm.Data["release"] = "not base64"
+	_, err = DecodeTillerRelease(cm)
+	assert.Error(t, err)
+}
+
+func Test_Migrator_DryRun(t *testing.T) {
+	m, kubeClient := newMigrator(t)
+	m.DryRun = true
+
+	res, err := m.Migrate()
+	require.NoError(t, err)
+	require.Len(t, res, 2)
+	assert.Equal(t, 0, res[0].Created)
+	assert.Equal(t, "deployed", res[0].Status)
+
+	secrets, err := kubeClient.CoreV1().Secrets("d8-system").List(metav1.ListOptions{})
+	require.NoError(t, err)
+	assert.Len(t, secrets.Items, 0)
+}
+
+func Test_Migrator_VerifyFailed(t *testing.T) {
+	m, kubeClient := newMigrator(t)
+
+	// Helm 3 release has a newer revision than the Tiller release.
+	store := storage.Init(driver.NewSecrets(kubeClient.CoreV1().Secrets("d8-system")))
+	require.NoError(t, store.Create(&release.Release{
+		Name:      "module-a",
+		Namespace: "d8-system",
+		Version:   3,
+		Info:      &release.Info{Status: release.StatusDeployed},
+	}))
+
+	_, err := m.Migrate()
+	assert.EqualError(t, err, "release 'module-a': verify Helm 3 release: last revision 3 is deployed, expected revision 2 is deployed")
+}
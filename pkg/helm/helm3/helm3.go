@@ -2,20 +2,27 @@ package helm3
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"os/exec"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
 	log "github.com/sirupsen/logrus"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	kblabels "k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
 	k8syaml "sigs.k8s.io/yaml"
 
 	"github.com/flant/addon-operator/pkg/helm/client"
 	"github.com/flant/addon-operator/pkg/utils"
+	sh_app "github.com/flant/shell-operator/pkg/app"
 	"github.com/flant/shell-operator/pkg/executor"
 	"github.com/flant/shell-operator/pkg/kube"
 )
@@ -29,30 +36,27 @@ type Helm3Options struct {
 	KubeClient kube.KubernetesClient
 }
 
-var Options *Helm3Options
-
-// Init runs
+// Init checks that the helm binary is available.
 func Init(options *Helm3Options) error {
 	hc := &Helm3Client{
 		LogEntry: log.WithField("operator.component", "helm"),
+		Options:  options,
 	}
-	err := hc.InitAndVersion()
-	if err != nil {
-		return err
-	}
-	Options = options
-	return nil
+	return hc.InitAndVersion()
 }
 
 type Helm3Client struct {
-	KubeClient kube.KubernetesClient
-	LogEntry   *log.Entry
-	Namespace  string
+	KubeClient   kube.KubernetesClient
+	LogEntry     *log.Entry
+	Namespace    string
+	PostRenderer client.PostRenderer
+	// Options are options of the Addon-operator instance.
+	Options *Helm3Options
 }
 
 var _ client.HelmClient = &Helm3Client{}
 
-func NewClient(logLabels ...map[string]string) client.HelmClient {
+func NewClient(options *Helm3Options, logLabels ...map[string]string) client.HelmClient {
 	logEntry := log.WithField("operator.component", "helm")
 	if len(logLabels) > 0 {
 		logEntry = logEntry.WithFields(utils.LabelsToLogFields(logLabels[0]))
@@ -60,8 +64,9 @@ func NewClient(logLabels ...map[string]string) client.HelmClient {
 
 	return &Helm3Client{
 		LogEntry:   logEntry,
-		KubeClient: Options.KubeClient,
-		Namespace:  Options.Namespace,
+		KubeClient: options.KubeClient,
+		Namespace:  options.Namespace,
+		Options:    options,
 	}
 }
 
@@ -69,6 +74,18 @@ func (h *Helm3Client) WithKubeClient(client kube.KubernetesClient) {
 	h.KubeClient = client
 }
 
+// WithNamespace sets a namespace for release operations. Helm 3 stores
+// releases in the namespace of the release.
+func (h *Helm3Client) WithNamespace(namespace string) {
+	h.Namespace = namespace
+}
+
+// WithPostRenderer sets a post-renderer for rendered manifests. It is used
+// by Render and passed to helm upgrade with the --post-renderer flag.
+func (h *Helm3Client) WithPostRenderer(postRenderer client.PostRenderer) {
+	h.PostRenderer = postRenderer
+}
+
 func (h *Helm3Client) CommandEnv() []string {
 	res := make([]string, 0)
 	return res
@@ -117,6 +134,92 @@ func (h *Helm3Client) DeleteOldFailedRevisions(releaseName string) error {
 	return nil
 }
 
+// pendingStatuses are statuses of a revision while helm install, upgrade or rollback is in progress.
+var pendingStatuses = map[string]bool{
+	"pending-install":  true,
+	"pending-upgrade":  true,
+	"pending-rollback": true,
+}
+
+// RecoverPendingRelease cleans up the last revision of the release if it is stuck in a pending status.
+// It returns the status of the recovered revision or an empty string if recovery is not needed.
+func (h *Helm3Client) RecoverPendingRelease(releaseName string) (string, error) {
+	return h.RecoverPendingReleaseWith(releaseName, h.Options.Timeout, h.DeleteRelease)
+}
+
+// RecoverPendingReleaseWith recovers the release if its last revision is in one of pending statuses
+// for longer than timeout. A release interrupted by an operator restart keeps a pending status forever
+// and next helm upgrade fails with "another operation is in progress".
+// A stuck first install is uninstalled with uninstall func, so the next upgrade starts from scratch.
+// Otherwise, the stuck revision Secret is deleted and the previous revision becomes the last one.
+func (h *Helm3Client) RecoverPendingReleaseWith(releaseName string, timeout time.Duration, uninstall func(string) error) (string, error) {
+	selector := kblabels.Set{"owner": "helm", "name": releaseName}.AsSelector().String()
+	list, err := h.KubeClient.CoreV1().
+		Secrets(h.Namespace).
+		List(metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return "", fmt.Errorf("list Secrets for release '%s': %v", releaseName, err)
+	}
+	if len(list.Items) == 0 {
+		return "", nil
+	}
+
+	var last *v1.Secret
+	lastVersion := -1
+	for i, secret := range list.Items {
+		version, err := strconv.Atoi(secret.Labels["version"])
+		if err != nil {
+			continue
+		}
+		if version > lastVersion {
+			last = &list.Items[i]
+			lastVersion = version
+		}
+	}
+	if last == nil {
+		return "", nil
+	}
+
+	status := last.Labels["status"]
+	if !pendingStatuses[status] {
+		return "", nil
+	}
+	age := time.Since(revisionTime(last))
+	if age < timeout {
+		h.LogEntry.Infof("Release '%s' revision %d is in '%s' status for %s, wait for helm timeout %s", releaseName, lastVersion, status, age.Truncate(time.Second), timeout)
+		return "", nil
+	}
+
+	if status == "pending-install" && len(list.Items) == 1 {
+		h.LogEntry.Warnf("Release '%s' is stuck in '%s' status for %s, uninstall it", releaseName, status, age.Truncate(time.Second))
+		err := uninstall(releaseName)
+		if err != nil {
+			return "", fmt.Errorf("uninstall release '%s' stuck in '%s': %v", releaseName, status, err)
+		}
+		return status, nil
+	}
+
+	h.LogEntry.Warnf("Release '%s' revision %d is stuck in '%s' status for %s, delete Secret '%s'", releaseName, lastVersion, status, age.Truncate(time.Second), last.Name)
+	err = h.KubeClient.CoreV1().
+		Secrets(h.Namespace).
+		Delete(last.Name, &metav1.DeleteOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		return "", fmt.Errorf("delete Secret '%s' of release '%s' stuck in '%s': %v", last.Name, releaseName, status, err)
+	}
+	return status, nil
+}
+
+// revisionTime returns the time of the last change of the revision Secret. Helm sets
+// the "modifiedAt" label on update and the "createdAt" label on create.
+func revisionTime(secret *v1.Secret) time.Time {
+	for _, label := range []string{"modifiedAt", "createdAt"} {
+		if ts, err := strconv.ParseInt(secret.Labels[label], 10, 64); err == nil {
+			return time.Unix(ts, 0)
+		}
+	}
+	return secret.CreationTimestamp.Time
+}
+
 // LastReleaseStatus returns last known revision for release and its status
 //   Example helm history output:
 //   REVISION	UPDATED                 	STATUS    	CHART                 	DESCRIPTION
@@ -157,45 +260,84 @@ func (h *Helm3Client) LastReleaseStatus(releaseName string) (revision string, st
 	return
 }
 
-func (h *Helm3Client) UpgradeRelease(releaseName string, chart string, valuesPaths []string, setValues []string, namespace string) error {
+func (h *Helm3Client) UpgradeRelease(opts client.UpgradeOptions) error {
+	args := upgradeArgs(opts, h.Options)
+
+	if h.PostRenderer != nil {
+		postRendererPath, err := writePostRendererScript(h.PostRenderer)
+		if err != nil {
+			return err
+		}
+		defer os.Remove(postRendererPath)
+		args = append(args, "--post-renderer")
+		args = append(args, postRendererPath)
+	}
+
+	h.LogEntry.Infof("Running helm upgrade for release '%s' with chart '%s' in namespace '%s' ...", opts.ReleaseName, opts.Chart, opts.Namespace)
+	stdout, stderr, err := h.Cmd(args...)
+	if err != nil {
+		return fmt.Errorf("helm upgrade failed: %s:\n%s %s", err, stdout, stderr)
+	}
+	h.LogEntry.Infof("Helm upgrade for release '%s' with chart '%s' in namespace '%s' successful:\n%s\n%s", opts.ReleaseName, opts.Chart, opts.Namespace, stdout, stderr)
+
+	return nil
+}
+
+// upgradeArgs returns arguments of 'helm upgrade --install'. Timeout and history limit
+// of upgrade options override ones of the instance.
+func upgradeArgs(opts client.UpgradeOptions, defaults *Helm3Options) []string {
 	args := make([]string, 0)
 	args = append(args, "upgrade")
 	// releaseName and chart path are positional arguments, put them first.
-	args = append(args, releaseName)
-	args = append(args, chart)
+	args = append(args, opts.ReleaseName)
+	args = append(args, opts.Chart)
 
 	// Flags for upgrade command.
 	args = append(args, "--install")
 
+	historyMax := defaults.HistoryMax
+	if opts.HistoryMax > 0 {
+		historyMax = opts.HistoryMax
+	}
 	args = append(args, "--history-max")
-	args = append(args, fmt.Sprintf("%d", Options.HistoryMax))
+	args = append(args, fmt.Sprintf("%d", historyMax))
 
+	timeout := defaults.Timeout
+	if opts.Timeout > 0 {
+		timeout = opts.Timeout
+	}
 	args = append(args, "--timeout")
-	args = append(args, Options.Timeout.String())
+	args = append(args, timeout.String())
 
-	if namespace != "" {
+	if opts.Namespace != "" {
 		args = append(args, "--namespace")
-		args = append(args, namespace)
+		args = append(args, opts.Namespace)
 	}
 
-	for _, valuesPath := range valuesPaths {
+	for _, valuesPath := range opts.ValuesPaths {
 		args = append(args, "--values")
 		args = append(args, valuesPath)
 	}
 
-	for _, setValue := range setValues {
+	for _, setValue := range opts.SetValues {
 		args = append(args, "--set")
 		args = append(args, setValue)
 	}
 
-	h.LogEntry.Infof("Running helm upgrade for release '%s' with chart '%s' in namespace '%s' ...", releaseName, chart, namespace)
-	stdout, stderr, err := h.Cmd(args...)
-	if err != nil {
-		return fmt.Errorf("helm upgrade failed: %s:\n%s %s", err, stdout, stderr)
+	if opts.Wait {
+		args = append(args, "--wait")
+	}
+	if opts.Atomic {
+		args = append(args, "--atomic")
+	}
+	if opts.Force {
+		args = append(args, "--force")
+	}
+	if opts.ResetValues {
+		args = append(args, "--reset-values")
 	}
-	h.LogEntry.Infof("Helm upgrade for release '%s' with chart '%s' in namespace '%s' successful:\n%s\n%s", releaseName, chart, namespace, stdout, stderr)
 
-	return nil
+	return args
 }
 
 func (h *Helm3Client) GetReleaseValues(releaseName string) (utils.Values, error) {
@@ -223,6 +365,64 @@ func (h *Helm3Client) GetReleaseValues(releaseName string) (utils.Values, error)
 	return values, nil
 }
 
+// GetReleaseManifest returns manifests of the release revision. Empty revision means the last one.
+func (h *Helm3Client) GetReleaseManifest(releaseName string, revision string) (string, error) {
+	args := []string{"get", "manifest", releaseName, "--namespace", h.Namespace}
+	if revision != "" {
+		args = append(args, "--revision", revision)
+	}
+	stdout, stderr, err := h.Cmd(args...)
+	if err != nil {
+		return "", fmt.Errorf("cannot get manifest of helm release %s: %s\n%s %s", releaseName, err, stdout, stderr)
+	}
+	return stdout, nil
+}
+
+// History returns revisions of the release sorted by revision number.
+func (h *Helm3Client) History(releaseName string) ([]client.ReleaseRevision, error) {
+	stdout, stderr, err := h.Cmd("history", releaseName,
+		"--namespace", h.Namespace,
+		"--max", fmt.Sprintf("%d", h.Options.HistoryMax),
+		"--output", "json")
+	if err != nil {
+		return nil, fmt.Errorf("cannot get history for release '%s'\n%v %v", releaseName, stdout, stderr)
+	}
+	var history []client.ReleaseRevision
+	err = json.Unmarshal([]byte(stdout), &history)
+	if err != nil {
+		return nil, fmt.Errorf("helm history returns invalid json: %v", err)
+	}
+	sort.Slice(history, func(i, j int) bool {
+		return history[i].Revision < history[j].Revision
+	})
+	return history, nil
+}
+
+// Rollback rolls back the release to the revision or to the last deployed revision if revision is empty.
+// It returns the revision or an empty string if the last revision is already deployed.
+func (h *Helm3Client) Rollback(releaseName string, revision string) (string, error) {
+	history, err := h.History(releaseName)
+	if err != nil {
+		return "", err
+	}
+	revision, err = client.RollbackRevision(history, revision)
+	if err != nil {
+		return "", fmt.Errorf("release '%s': %v", releaseName, err)
+	}
+	if revision == "" {
+		return "", nil
+	}
+
+	h.LogEntry.Infof("Running helm rollback for release '%s' to revision %s ...", releaseName, revision)
+	stdout, stderr, err := h.Cmd("rollback", releaseName, revision,
+		"--namespace", h.Namespace,
+		"--timeout", h.Options.Timeout.String())
+	if err != nil {
+		return "", fmt.Errorf("helm rollback failed: %s:\n%s %s", err, stdout, stderr)
+	}
+	return revision, nil
+}
+
 func (h *Helm3Client) DeleteRelease(releaseName string) (err error) {
 	h.LogEntry.Debugf("helm release '%s': execute helm uninstall", releaseName)
 
@@ -292,6 +492,61 @@ func (h *Helm3Client) ListReleasesNames(labelSelector map[string]string) ([]stri
 	return uniqNames, nil
 }
 
+// LabelRelease sets labels on Secrets with revisions of the release.
+func (h *Helm3Client) LabelRelease(releaseName string, labels map[string]string) error {
+	selector := kblabels.Set{"owner": "helm", "name": releaseName}.AsSelector().String()
+	list, err := h.KubeClient.CoreV1().
+		Secrets(h.Namespace).
+		List(metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return fmt.Errorf("list Secrets for release '%s': %v", releaseName, err)
+	}
+
+	for _, secret := range list.Items {
+		if kblabels.SelectorFromSet(labels).Matches(kblabels.Set(secret.Labels)) {
+			continue
+		}
+		patch, err := json.Marshal(map[string]interface{}{
+			"metadata": map[string]interface{}{
+				"labels": labels,
+			},
+		})
+		if err != nil {
+			return err
+		}
+		_, err = h.KubeClient.CoreV1().
+			Secrets(h.Namespace).
+			Patch(secret.Name, types.MergePatchType, patch)
+		if err != nil {
+			return fmt.Errorf("label Secret '%s' for release '%s': %v", secret.Name, releaseName, err)
+		}
+	}
+	return nil
+}
+
+// ReleaseLabels returns labels of the Secret with the last revision of the release.
+// Nil is returned if the release is not found.
+func (h *Helm3Client) ReleaseLabels(releaseName string) (map[string]string, error) {
+	selector := kblabels.Set{"owner": "helm", "name": releaseName}.AsSelector().String()
+	list, err := h.KubeClient.CoreV1().
+		Secrets(h.Namespace).
+		List(metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return nil, fmt.Errorf("list Secrets for release '%s': %v", releaseName, err)
+	}
+
+	var labels map[string]string
+	lastVersion := -1
+	for _, secret := range list.Items {
+		version, _ := strconv.Atoi(secret.Labels["version"])
+		if version > lastVersion {
+			lastVersion = version
+			labels = secret.Labels
+		}
+	}
+	return labels, nil
+}
+
 // ListReleasesNames returns list of release names without suffixes ".v<release_number>"
 func (h *Helm3Client) Render(releaseName string, chart string, valuesPaths []string, setValues []string, namespace string) (string, error) {
 	args := make([]string, 0)
@@ -321,5 +576,38 @@ func (h *Helm3Client) Render(releaseName string, chart string, valuesPaths []str
 	}
 	h.LogEntry.Infof("Render helm templates for chart '%s' was successful", chart)
 
-	return stdout, nil
+	return client.PostRender(h.PostRenderer, stdout)
+}
+
+// writePostRendererScript writes an executable script that runs the post-renderer
+// with the addon-operator binary. Helm binary runs the post-renderer without arguments.
+func writePostRendererScript(postRenderer client.PostRenderer) (string, error) {
+	executable, err := os.Executable()
+	if err != nil {
+		return "", fmt.Errorf("post-renderer: %v", err)
+	}
+	script := "#!/bin/sh\nexec " + shellQuote(executable)
+	for _, arg := range postRenderer.Args() {
+		script += " " + shellQuote(arg)
+	}
+	script += "\n"
+
+	f, err := ioutil.TempFile(sh_app.TempDir, "post-renderer-*.sh")
+	if err != nil {
+		return "", fmt.Errorf("post-renderer: %v", err)
+	}
+	defer f.Close()
+	_, err = f.WriteString(script)
+	if err == nil {
+		err = f.Chmod(0755)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", fmt.Errorf("post-renderer: %v", err)
+	}
+	return f.Name(), nil
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
 }
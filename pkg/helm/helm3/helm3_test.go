@@ -0,0 +1,196 @@
+package helm3
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	sh_app "github.com/flant/shell-operator/pkg/app"
+	"github.com/flant/shell-operator/pkg/kube"
+
+	"github.com/flant/addon-operator/pkg/helm/client"
+)
+
+func releaseSecret(name string, version int, status string, createdAt time.Time) *v1.Secret {
+	return &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "sh.helm.release.v1." + name + ".v" + strconv.Itoa(version),
+			Namespace: "ns",
+			Labels: map[string]string{
+				"owner":     "helm",
+				"name":      name,
+				"status":    status,
+				"version":   strconv.Itoa(version),
+				"createdAt": strconv.FormatInt(createdAt.Unix(), 10),
+			},
+		},
+	}
+}
+
+func Test_Helm3Client_RecoverPendingRelease(t *testing.T) {
+	old := time.Now().Add(-time.Hour)
+	recent := time.Now()
+
+	tests := []struct {
+		name        string
+		secrets     []*v1.Secret
+		status      string
+		uninstalled bool
+		remains     []string
+	}{
+		{
+			"deployed release is not changed",
+			[]*v1.Secret{
+				releaseSecret("release", 1, "superseded", old),
+				releaseSecret("release", 2, "deployed", old),
+			},
+			"", false,
+			[]string{"sh.helm.release.v1.release.v1", "sh.helm.release.v1.release.v2"},
+		},
+		{
+			"recent pending upgrade is in progress",
+			[]*v1.Secret{
+				releaseSecret("release", 1, "deployed", old),
+				releaseSecret("release", 2, "pending-upgrade", recent),
+			},
+			"", false,
+			[]string{"sh.helm.release.v1.release.v1", "sh.helm.release.v1.release.v2"},
+		},
+		{
+			"stuck upgrade revision is deleted",
+			[]*v1.Secret{
+				releaseSecret("release", 1, "deployed", old),
+				releaseSecret("release", 2, "pending-upgrade", old),
+			},
+			"pending-upgrade", false,
+			[]string{"sh.helm.release.v1.release.v1"},
+		},
+		{
+			"stuck rollback revision is deleted",
+			[]*v1.Secret{
+				releaseSecret("release", 9, "superseded", old),
+				releaseSecret("release", 10, "deployed", old),
+				releaseSecret("release", 11, "pending-rollback", old),
+			},
+			"pending-rollback", false,
+			[]string{"sh.helm.release.v1.release.v10", "sh.helm.release.v1.release.v9"},
+		},
+		{
+			"stuck first install is uninstalled",
+			[]*v1.Secret{
+				releaseSecret("release", 1, "pending-install", old),
+			},
+			"pending-install", true,
+			[]string{"sh.helm.release.v1.release.v1"},
+		},
+		{
+			"absent release",
+			nil,
+			"", false,
+			[]string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kubeClient := kube.NewFakeKubernetesClient()
+			for _, secret := range tt.secrets {
+				_, err := kubeClient.CoreV1().Secrets("ns").Create(secret)
+				require.NoError(t, err)
+			}
+
+			hc := &Helm3Client{
+				KubeClient: kubeClient,
+				LogEntry:   log.WithField("test", t.Name()),
+				Namespace:  "ns",
+			}
+			uninstalled := false
+			status, err := hc.RecoverPendingReleaseWith("release", 5*time.Minute, func(string) error {
+				uninstalled = true
+				return nil
+			})
+			require.NoError(t, err)
+			assert.Equal(t, tt.status, status)
+			assert.Equal(t, tt.uninstalled, uninstalled)
+
+			list, err := kubeClient.CoreV1().Secrets("ns").List(metav1.ListOptions{})
+			require.NoError(t, err)
+			names := make([]string, 0)
+			for _, secret := range list.Items {
+				names = append(names, secret.Name)
+			}
+			assert.ElementsMatch(t, tt.remains, names)
+		})
+	}
+}
+
+type argsPostRenderer struct {
+	client.PostRenderer
+}
+
+func (argsPostRenderer) Args() []string {
+	return []string{"post-render", "--module", "it's"}
+}
+
+func Test_writePostRendererScript(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "addon-operator-helm3-")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+	sh_app.TempDir = tmpDir
+
+	path, err := writePostRendererScript(argsPostRenderer{})
+	require.NoError(t, err)
+	assert.Equal(t, tmpDir, filepath.Dir(path))
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0755), info.Mode().Perm())
+
+	content, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	assert.Regexp(t, `^#!/bin/sh\nexec '.+' 'post-render' '--module' 'it'\\''s'\n$`, string(content))
+}
+
+func Test_upgradeArgs(t *testing.T) {
+	defaults := &Helm3Options{HistoryMax: 10, Timeout: 5 * time.Minute}
+
+	assert.Equal(t, []string{
+		"upgrade", "release", "/chart", "--install",
+		"--history-max", "10",
+		"--timeout", "5m0s",
+		"--namespace", "ns",
+		"--values", "/values.yaml",
+		"--set", "a=b",
+	}, upgradeArgs(client.UpgradeOptions{
+		ReleaseName: "release",
+		Chart:       "/chart",
+		ValuesPaths: []string{"/values.yaml"},
+		SetValues:   []string{"a=b"},
+		Namespace:   "ns",
+	}, defaults))
+
+	assert.Equal(t, []string{
+		"upgrade", "release", "/chart", "--install",
+		"--history-max", "3",
+		"--timeout", "10m0s",
+		"--wait", "--atomic", "--force", "--reset-values",
+	}, upgradeArgs(client.UpgradeOptions{
+		ReleaseName: "release",
+		Chart:       "/chart",
+		Wait:        true,
+		Atomic:      true,
+		Timeout:     10 * time.Minute,
+		HistoryMax:  3,
+		Force:       true,
+		ResetValues: true,
+	}, defaults))
+}
@@ -0,0 +1,437 @@
+package helm3lib
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/cli/values"
+	"helm.sh/helm/v3/pkg/getter"
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/storage/driver"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+
+	sh_app "github.com/flant/shell-operator/pkg/app"
+	"github.com/flant/shell-operator/pkg/kube"
+
+	"github.com/flant/addon-operator/pkg/helm/client"
+	"github.com/flant/addon-operator/pkg/helm/helm3"
+	"github.com/flant/addon-operator/pkg/utils"
+)
+
+type Helm3LibOptions struct {
+	Namespace  string
+	HistoryMax int32
+	Timeout    time.Duration
+	KubeClient kube.KubernetesClient
+
+	// actionConfigs are cached per namespace: an initialization creates a REST mapper
+	// and a discovery client, it is too expensive to do for every action.
+	actionConfigsLock sync.Mutex
+	actionConfigs     map[string]*action.Configuration
+}
+
+// NewActionConfig returns a configuration for helm actions with releases in the namespace.
+// Releases are stored in Secrets as with the helm binary. It is a variable to use
+// an in-memory storage in tests.
+var NewActionConfig = func(namespace string, logEntry *log.Entry) (*action.Configuration, error) {
+	flags := genericclioptions.NewConfigFlags(false)
+	flags.Namespace = &namespace
+	if sh_app.KubeContext != "" {
+		flags.Context = &sh_app.KubeContext
+	}
+	if sh_app.KubeConfig != "" {
+		flags.KubeConfig = &sh_app.KubeConfig
+	}
+
+	cfg := &action.Configuration{}
+	err := cfg.Init(flags, namespace, "secret", logEntry.Debugf)
+	if err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Init checks that options are valid. Helm binary is not needed.
+func Init(options *Helm3LibOptions) error {
+	hc := &Helm3LibClient{
+		Helm3Client: &helm3.Helm3Client{
+			LogEntry: log.WithField("operator.component", "helm"),
+		},
+		LibOptions: options,
+	}
+	return hc.InitAndVersion()
+}
+
+// Helm3LibClient runs helm actions in-process with the helm v3 library.
+// Listing and labeling of releases are inherited from the CLI client,
+// they work with release Secrets directly.
+type Helm3LibClient struct {
+	*helm3.Helm3Client
+	// LibOptions are options of the Addon-operator instance.
+	LibOptions *Helm3LibOptions
+}
+
+var _ client.HelmClient = &Helm3LibClient{}
+
+func NewClient(options *Helm3LibOptions, logLabels ...map[string]string) client.HelmClient {
+	logEntry := log.WithField("operator.component", "helm")
+	if len(logLabels) > 0 {
+		logEntry = logEntry.WithFields(utils.LabelsToLogFields(logLabels[0]))
+	}
+
+	return &Helm3LibClient{
+		Helm3Client: &helm3.Helm3Client{
+			LogEntry:   logEntry,
+			KubeClient: options.KubeClient,
+			Namespace:  options.Namespace,
+			Options: &helm3.Helm3Options{
+				Namespace:  options.Namespace,
+				HistoryMax: options.HistoryMax,
+				Timeout:    options.Timeout,
+				KubeClient: options.KubeClient,
+			},
+		},
+		LibOptions: options,
+	}
+}
+
+// actionConfig returns a configuration for actions with releases in the namespace.
+// Configurations are shared by all clients of the Addon-operator instance.
+func (h *Helm3LibClient) actionConfig(namespace string) (*action.Configuration, error) {
+	if namespace == "" {
+		namespace = h.Namespace
+	}
+
+	opts := h.LibOptions
+	opts.actionConfigsLock.Lock()
+	defer opts.actionConfigsLock.Unlock()
+
+	if cfg, has := opts.actionConfigs[namespace]; has {
+		return cfg, nil
+	}
+
+	cfg, err := NewActionConfig(namespace, h.LogEntry)
+	if err != nil {
+		return nil, fmt.Errorf("init helm for namespace '%s': %v", namespace, err)
+	}
+	cfg.Releases.MaxHistory = int(opts.HistoryMax)
+
+	if opts.actionConfigs == nil {
+		opts.actionConfigs = make(map[string]*action.Configuration)
+	}
+	opts.actionConfigs[namespace] = cfg
+	return cfg, nil
+}
+
+// Cmd is not supported: helm binary is not used.
+func (h *Helm3LibClient) Cmd(args ...string) (stdout string, stderr string, err error) {
+	return "", "", fmt.Errorf("helm binary is not used by the helm 3 library client")
+}
+
+// InitAndVersion logs that helm library is used.
+func (h *Helm3LibClient) InitAndVersion() error {
+	log.Infof("Helm 3 library is used instead of the helm binary")
+	return nil
+}
+
+// LastReleaseStatus returns last known revision for release and its status.
+// Revision is "0" if release is not found.
+func (h *Helm3LibClient) LastReleaseStatus(releaseName string) (revision string, status string, err error) {
+	cfg, err := h.actionConfig("")
+	if err != nil {
+		return "", "", err
+	}
+
+	last, err := lastRelease(cfg, releaseName)
+	if err == driver.ErrReleaseNotFound {
+		return "0", "", fmt.Errorf("release '%s' not found", releaseName)
+	}
+	if err != nil {
+		return "", "", fmt.Errorf("cannot get history for release '%s': %v", releaseName, err)
+	}
+	return strconv.Itoa(last.Version), last.Info.Status.String(), nil
+}
+
+// RecoverPendingRelease cleans up the last revision of the release if it is stuck in a pending status
+// for longer than the helm timeout. A stuck first install is uninstalled in-process.
+func (h *Helm3LibClient) RecoverPendingRelease(releaseName string) (string, error) {
+	return h.RecoverPendingReleaseWith(releaseName, h.LibOptions.Timeout, h.DeleteRelease)
+}
+
+// lastRelease returns the latest revision of the release. Empty history is ErrReleaseNotFound.
+func lastRelease(cfg *action.Configuration, releaseName string) (*release.Release, error) {
+	history, err := action.NewHistory(cfg).Run(releaseName)
+	if err != nil {
+		return nil, err
+	}
+	if len(history) == 0 {
+		return nil, driver.ErrReleaseNotFound
+	}
+	sort.Slice(history, func(i, j int) bool {
+		return history[i].Version > history[j].Version
+	})
+	return history[0], nil
+}
+
+// UpgradeRelease installs the release if it is not exists or upgrades it like 'helm upgrade --install'.
+func (h *Helm3LibClient) UpgradeRelease(opts client.UpgradeOptions) error {
+	chrt, vals, err := loadChartAndValues(opts.Chart, opts.ValuesPaths, opts.SetValues)
+	if err != nil {
+		return err
+	}
+
+	cfg, err := h.actionConfig(opts.Namespace)
+	if err != nil {
+		return err
+	}
+	if opts.Namespace == "" {
+		opts.Namespace = h.Namespace
+	}
+
+	h.LogEntry.Infof("Running helm upgrade for release '%s' with chart '%s' in namespace '%s' ...", opts.ReleaseName, opts.Chart, opts.Namespace)
+
+	// Install the release if it does not exist. Other errors are ignored as in 'helm upgrade --install'.
+	if _, err := lastRelease(cfg, opts.ReleaseName); err == driver.ErrReleaseNotFound {
+		_, err = h.installAction(cfg, opts).Run(chrt, vals)
+		if err != nil {
+			return fmt.Errorf("helm upgrade failed: %v", err)
+		}
+		h.LogEntry.Infof("Helm install for release '%s' with chart '%s' in namespace '%s' successful", opts.ReleaseName, opts.Chart, opts.Namespace)
+		return nil
+	}
+
+	_, err = h.upgradeAction(cfg, opts).Run(opts.ReleaseName, chrt, vals)
+	if err != nil {
+		return fmt.Errorf("helm upgrade failed: %v", err)
+	}
+	h.LogEntry.Infof("Helm upgrade for release '%s' with chart '%s' in namespace '%s' successful", opts.ReleaseName, opts.Chart, opts.Namespace)
+
+	return nil
+}
+
+// installAction returns the install action configured as 'helm upgrade --install' does for a new release.
+func (h *Helm3LibClient) installAction(cfg *action.Configuration, opts client.UpgradeOptions) *action.Install {
+	instClient := action.NewInstall(cfg)
+	instClient.Namespace = opts.Namespace
+	instClient.ReleaseName = opts.ReleaseName
+	instClient.Timeout = h.upgradeTimeout(opts)
+	instClient.Wait = opts.Wait
+	instClient.Atomic = opts.Atomic
+	instClient.PostRenderer = h.PostRenderer
+	return instClient
+}
+
+// upgradeAction returns the upgrade action with options of the module.
+func (h *Helm3LibClient) upgradeAction(cfg *action.Configuration, opts client.UpgradeOptions) *action.Upgrade {
+	upgClient := action.NewUpgrade(cfg)
+	upgClient.Namespace = opts.Namespace
+	upgClient.Timeout = h.upgradeTimeout(opts)
+	upgClient.MaxHistory = int(h.LibOptions.HistoryMax)
+	if opts.HistoryMax > 0 {
+		upgClient.MaxHistory = int(opts.HistoryMax)
+	}
+	upgClient.Wait = opts.Wait
+	upgClient.Atomic = opts.Atomic
+	upgClient.Force = opts.Force
+	upgClient.ResetValues = opts.ResetValues
+	upgClient.PostRenderer = h.PostRenderer
+	return upgClient
+}
+
+func (h *Helm3LibClient) upgradeTimeout(opts client.UpgradeOptions) time.Duration {
+	if opts.Timeout > 0 {
+		return opts.Timeout
+	}
+	return h.LibOptions.Timeout
+}
+
+// loadChartAndValues loads the chart and merges values files and --set values as helm binary does.
+func loadChartAndValues(chartPath string, valuesPaths []string, setValues []string) (*chart.Chart, map[string]interface{}, error) {
+	chrt, err := loader.Load(chartPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("load chart '%s': %v", chartPath, err)
+	}
+	if req := chrt.Metadata.Dependencies; req != nil {
+		if err := action.CheckDependencies(chrt, req); err != nil {
+			return nil, nil, fmt.Errorf("chart '%s': %v", chartPath, err)
+		}
+	}
+
+	valuesOpts := &values.Options{
+		ValueFiles: valuesPaths,
+		Values:     setValues,
+	}
+	vals, err := valuesOpts.MergeValues(getter.Providers{})
+	if err != nil {
+		return nil, nil, fmt.Errorf("merge values: %v", err)
+	}
+	return chrt, vals, nil
+}
+
+func (h *Helm3LibClient) GetReleaseValues(releaseName string) (utils.Values, error) {
+	cfg, err := h.actionConfig("")
+	if err != nil {
+		return nil, err
+	}
+
+	vals, err := action.NewGetValues(cfg).Run(releaseName)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get values of helm release %s: %s", releaseName, err)
+	}
+	return utils.Values(vals), nil
+}
+
+// GetReleaseManifest returns manifests of the release revision. Empty revision means the last one.
+func (h *Helm3LibClient) GetReleaseManifest(releaseName string, revision string) (string, error) {
+	cfg, err := h.actionConfig("")
+	if err != nil {
+		return "", err
+	}
+
+	get := action.NewGet(cfg)
+	if revision != "" {
+		get.Version, err = strconv.Atoi(revision)
+		if err != nil {
+			return "", fmt.Errorf("bad revision '%s': %v", revision, err)
+		}
+	}
+	rel, err := get.Run(releaseName)
+	if err != nil {
+		return "", fmt.Errorf("cannot get manifest of helm release %s: %s", releaseName, err)
+	}
+	return strings.TrimSpace(rel.Manifest), nil
+}
+
+// History returns revisions of the release sorted by revision number.
+func (h *Helm3LibClient) History(releaseName string) ([]client.ReleaseRevision, error) {
+	cfg, err := h.actionConfig("")
+	if err != nil {
+		return nil, err
+	}
+
+	releases, err := action.NewHistory(cfg).Run(releaseName)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get history for release '%s': %v", releaseName, err)
+	}
+	history := make([]client.ReleaseRevision, 0, len(releases))
+	for _, rel := range releases {
+		rev := client.ReleaseRevision{
+			Revision:    rel.Version,
+			Status:      rel.Info.Status.String(),
+			Description: rel.Info.Description,
+		}
+		if !rel.Info.LastDeployed.IsZero() {
+			rev.Updated = rel.Info.LastDeployed.Format(time.RFC3339)
+		}
+		if rel.Chart != nil && rel.Chart.Metadata != nil {
+			rev.Chart = rel.Chart.Metadata.Name + "-" + rel.Chart.Metadata.Version
+			rev.AppVersion = rel.Chart.Metadata.AppVersion
+		}
+		history = append(history, rev)
+	}
+	sort.Slice(history, func(i, j int) bool {
+		return history[i].Revision < history[j].Revision
+	})
+	return history, nil
+}
+
+// Rollback rolls back the release to the revision or to the last deployed revision if revision is empty.
+// It returns the revision or an empty string if the last revision is already deployed.
+func (h *Helm3LibClient) Rollback(releaseName string, revision string) (string, error) {
+	history, err := h.History(releaseName)
+	if err != nil {
+		return "", err
+	}
+	revision, err = client.RollbackRevision(history, revision)
+	if err != nil {
+		return "", fmt.Errorf("release '%s': %v", releaseName, err)
+	}
+	if revision == "" {
+		return "", nil
+	}
+
+	cfg, err := h.actionConfig("")
+	if err != nil {
+		return "", err
+	}
+	h.LogEntry.Infof("Running helm rollback for release '%s' to revision %s ...", releaseName, revision)
+	rollback := action.NewRollback(cfg)
+	rollback.Version, _ = strconv.Atoi(revision)
+	rollback.Timeout = h.LibOptions.Timeout
+	err = rollback.Run(releaseName)
+	if err != nil {
+		return "", fmt.Errorf("helm rollback failed: %v", err)
+	}
+	return revision, nil
+}
+
+func (h *Helm3LibClient) DeleteRelease(releaseName string) error {
+	h.LogEntry.Debugf("helm release '%s': execute helm uninstall", releaseName)
+
+	cfg, err := h.actionConfig("")
+	if err != nil {
+		return err
+	}
+
+	uninstall := action.NewUninstall(cfg)
+	uninstall.Timeout = h.LibOptions.Timeout
+	_, err = uninstall.Run(releaseName)
+	if err != nil {
+		return fmt.Errorf("helm uninstall %s invocation error: %v", releaseName, err)
+	}
+	return nil
+}
+
+func (h *Helm3LibClient) IsReleaseExists(releaseName string) (bool, error) {
+	revision, _, err := h.LastReleaseStatus(releaseName)
+	if err != nil && revision == "0" {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Render renders the chart like 'helm template': templates are rendered
+// without access to the cluster, hooks are appended to manifests.
+func (h *Helm3LibClient) Render(releaseName string, chartPath string, valuesPaths []string, setValues []string, namespace string) (string, error) {
+	chrt, vals, err := loadChartAndValues(chartPath, valuesPaths, setValues)
+	if err != nil {
+		return "", err
+	}
+
+	h.LogEntry.Debugf("Render helm templates for chart '%s' in namespace '%s' ...", chartPath, namespace)
+
+	// ClientOnly install uses an in-memory storage and a fake kube client.
+	cfg := &action.Configuration{Log: h.LogEntry.Debugf}
+	inst := action.NewInstall(cfg)
+	inst.DryRun = true
+	inst.ReleaseName = releaseName
+	inst.Replace = true
+	inst.ClientOnly = true
+	inst.Namespace = namespace
+
+	rel, err := inst.Run(chrt, vals)
+	if err != nil {
+		return "", fmt.Errorf("helm template failed: %v", err)
+	}
+
+	var manifests bytes.Buffer
+	fmt.Fprintln(&manifests, strings.TrimSpace(rel.Manifest))
+	for _, m := range rel.Hooks {
+		fmt.Fprintf(&manifests, "---\n# Source: %s\n%s\n", m.Path, m.Manifest)
+	}
+	h.LogEntry.Infof("Render helm templates for chart '%s' was successful", chartPath)
+
+	// Output is trimmed as stdout of the helm binary.
+	return client.PostRender(h.PostRenderer, strings.TrimSpace(manifests.String()))
+}
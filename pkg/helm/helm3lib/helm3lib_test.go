@@ -0,0 +1,342 @@
+package helm3lib
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chartutil"
+	kubefake "helm.sh/helm/v3/pkg/kube/fake"
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/storage"
+	"helm.sh/helm/v3/pkg/storage/driver"
+
+	"github.com/flant/addon-operator/pkg/helm/client"
+	"github.com/flant/addon-operator/pkg/helm/post_renderer"
+	"github.com/flant/addon-operator/sdk"
+)
+
+// testOptions are options of clients in tests.
+var testOptions *Helm3LibOptions
+
+// initMemoryStorage makes clients use one in-memory release storage and a fake kube client.
+func initMemoryStorage(t *testing.T) *storage.Storage {
+	testOptions = &Helm3LibOptions{
+		Namespace:  "addon-operator",
+		HistoryMax: 2,
+		Timeout:    time.Minute,
+	}
+
+	store := storage.Init(driver.NewMemory())
+	NewActionConfig = func(namespace string, logEntry *log.Entry) (*action.Configuration, error) {
+		return &action.Configuration{
+			Releases:     store,
+			KubeClient:   &kubefake.PrintingKubeClient{Out: ioutil.Discard},
+			Capabilities: chartutil.DefaultCapabilities,
+			Log:          t.Logf,
+		}, nil
+	}
+	return store
+}
+
+func writeTestChart(t *testing.T, dir string) {
+	files := map[string]string{
+		"Chart.yaml":  "apiVersion: v2\nname: test-chart\nversion: 0.0.1\n",
+		"values.yaml": "replicas: 1\n",
+		"templates/cm.yaml": `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: {{ .Release.Name }}-cm
+  namespace: {{ .Release.Namespace }}
+data:
+  param: {{ .Values.param | quote }}
+  replicas: {{ .Values.replicas | quote }}
+`,
+		"templates/hook.yaml": `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: {{ .Release.Name }}-hook
+  annotations:
+    helm.sh/hook: pre-install
+`,
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, ioutil.WriteFile(path, []byte(content), 0644))
+	}
+}
+
+func Test_Helm3LibClient_ReleaseLifecycle(t *testing.T) {
+	store := initMemoryStorage(t)
+
+	tmpDir, err := ioutil.TempDir("", "addon-operator-helm3lib-")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+	chartDir := filepath.Join(tmpDir, "chart")
+	writeTestChart(t, chartDir)
+	valuesPath := filepath.Join(tmpDir, "values.yaml")
+	require.NoError(t, ioutil.WriteFile(valuesPath, []byte("param: from-file\n"), 0644))
+
+	hc := NewClient(testOptions)
+	hc.WithNamespace("ns")
+
+	exists, err := hc.IsReleaseExists("release")
+	require.NoError(t, err)
+	assert.False(t, exists)
+
+	revision, _, err := hc.LastReleaseStatus("release")
+	assert.Error(t, err)
+	assert.Equal(t, "0", revision)
+
+	// First upgrade installs the release.
+	err = hc.UpgradeRelease(client.UpgradeOptions{ReleaseName: "release", Chart: chartDir, ValuesPaths: []string{valuesPath}, SetValues: []string{"_addonOperatorModuleChecksum=a123"}, Namespace: "ns"})
+	require.NoError(t, err)
+
+	exists, err = hc.IsReleaseExists("release")
+	require.NoError(t, err)
+	assert.True(t, exists)
+
+	revision, status, err := hc.LastReleaseStatus("release")
+	require.NoError(t, err)
+	assert.Equal(t, "1", revision)
+	assert.Equal(t, "deployed", status)
+
+	values, err := hc.GetReleaseValues("release")
+	require.NoError(t, err)
+	assert.Equal(t, "from-file", values["param"])
+	assert.Equal(t, "a123", values["_addonOperatorModuleChecksum"])
+
+	// Next upgrades create new revisions, history is limited by HistoryMax.
+	for i := 0; i < 2; i++ {
+		err = hc.UpgradeRelease(client.UpgradeOptions{ReleaseName: "release", Chart: chartDir, ValuesPaths: []string{valuesPath}, SetValues: []string{"_addonOperatorModuleChecksum=b456"}, Namespace: "ns"})
+		require.NoError(t, err)
+	}
+	revision, status, err = hc.LastReleaseStatus("release")
+	require.NoError(t, err)
+	assert.Equal(t, "3", revision)
+	assert.Equal(t, "deployed", status)
+	history, err := store.History("release")
+	require.NoError(t, err)
+	assert.Len(t, history, 2)
+
+	values, err = hc.GetReleaseValues("release")
+	require.NoError(t, err)
+	assert.Equal(t, "b456", values["_addonOperatorModuleChecksum"])
+
+	err = hc.DeleteRelease("release")
+	require.NoError(t, err)
+	exists, err = hc.IsReleaseExists("release")
+	require.NoError(t, err)
+	assert.False(t, exists)
+
+	err = hc.UpgradeRelease(client.UpgradeOptions{ReleaseName: "release", Chart: filepath.Join(tmpDir, "absent"), Namespace: "ns"})
+	assert.Error(t, err)
+}
+
+func Test_Helm3LibClient_Render(t *testing.T) {
+	initMemoryStorage(t)
+
+	tmpDir, err := ioutil.TempDir("", "addon-operator-helm3lib-")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+	writeTestChart(t, tmpDir)
+
+	hc := NewClient(testOptions)
+	out, err := hc.Render("release", tmpDir, nil, []string{"param=value"}, "ns")
+	require.NoError(t, err)
+
+	assert.Contains(t, out, "# Source: test-chart/templates/cm.yaml")
+	assert.Contains(t, out, "name: release-cm")
+	assert.Contains(t, out, "namespace: ns")
+	assert.Contains(t, out, `param: "value"`)
+	assert.Contains(t, out, "---\n# Source: test-chart/templates/hook.yaml")
+
+	exists, err := hc.IsReleaseExists("release")
+	require.NoError(t, err)
+	assert.False(t, exists, "render should not create a release")
+}
+
+func Test_Helm3LibClient_PostRenderer(t *testing.T) {
+	initMemoryStorage(t)
+
+	tmpDir, err := ioutil.TempDir("", "addon-operator-helm3lib-")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+	writeTestChart(t, tmpDir)
+
+	hc := NewClient(testOptions)
+	hc.WithNamespace("ns")
+	hc.WithPostRenderer(&post_renderer.Pipeline{
+		ModuleName: "module",
+		Namespace:  "ns",
+		Transformers: []sdk.Transformer{
+			&post_renderer.MetadataTransformer{Labels: map[string]string{"team": "platform"}},
+		},
+	})
+
+	out, err := hc.Render("release", tmpDir, nil, nil, "ns")
+	require.NoError(t, err)
+	assert.Contains(t, out, "team: platform")
+
+	err = hc.UpgradeRelease(client.UpgradeOptions{ReleaseName: "release", Chart: tmpDir, Namespace: "ns"})
+	require.NoError(t, err)
+	manifest, err := hc.GetReleaseManifest("release", "")
+	require.NoError(t, err)
+	assert.Contains(t, manifest, "name: release-cm")
+	assert.Contains(t, manifest, "team: platform")
+}
+
+func Test_Helm3LibClient_Rollback(t *testing.T) {
+	store := initMemoryStorage(t)
+
+	tmpDir, err := ioutil.TempDir("", "addon-operator-helm3lib-")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+	writeTestChart(t, tmpDir)
+
+	hc := NewClient(testOptions)
+	hc.WithNamespace("ns")
+
+	_, err = hc.Rollback("release", "")
+	assert.Error(t, err, "absent release can't be rolled back")
+
+	err = hc.UpgradeRelease(client.UpgradeOptions{ReleaseName: "release", Chart: tmpDir, SetValues: []string{"param=good"}, Namespace: "ns"})
+	require.NoError(t, err)
+
+	revision, err := hc.Rollback("release", "")
+	require.NoError(t, err)
+	assert.Equal(t, "", revision, "last revision is deployed")
+
+	err = hc.UpgradeRelease(client.UpgradeOptions{ReleaseName: "release", Chart: tmpDir, SetValues: []string{"param=bad"}, Namespace: "ns"})
+	require.NoError(t, err)
+	// Mark the upgrade as failed as helm does and restore the status of the previous revision.
+	rel, err := store.Get("release", 2)
+	require.NoError(t, err)
+	rel.SetStatus(release.StatusFailed, "Upgrade failed")
+	require.NoError(t, store.Update(rel))
+	rel, err = store.Get("release", 1)
+	require.NoError(t, err)
+	rel.SetStatus(release.StatusDeployed, "Install complete")
+	require.NoError(t, store.Update(rel))
+
+	failedManifest, err := hc.GetReleaseManifest("release", "")
+	require.NoError(t, err)
+	assert.Contains(t, failedManifest, `param: "bad"`)
+	deployedManifest, err := hc.GetReleaseManifest("release", "1")
+	require.NoError(t, err)
+	assert.Contains(t, deployedManifest, `param: "good"`)
+
+	history, err := hc.History("release")
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+	assert.Equal(t, 1, history[0].Revision)
+	assert.Equal(t, "deployed", history[0].Status)
+	assert.Equal(t, "test-chart-0.0.1", history[0].Chart)
+	assert.Equal(t, "failed", history[1].Status)
+	assert.Equal(t, "Upgrade failed", history[1].Description)
+
+	revision, err = hc.Rollback("release", "")
+	require.NoError(t, err)
+	assert.Equal(t, "1", revision)
+
+	last, status, err := hc.LastReleaseStatus("release")
+	require.NoError(t, err)
+	assert.Equal(t, "3", last)
+	assert.Equal(t, "deployed", status)
+
+	manifest, err := hc.GetReleaseManifest("release", "")
+	require.NoError(t, err)
+	assert.Contains(t, manifest, `param: "good"`)
+}
+
+func Test_Helm3LibClient_RollbackToRevision(t *testing.T) {
+	initMemoryStorage(t)
+
+	tmpDir, err := ioutil.TempDir("", "addon-operator-helm3lib-")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+	writeTestChart(t, tmpDir)
+
+	hc := NewClient(testOptions)
+	hc.WithNamespace("ns")
+
+	for _, param := range []string{"one", "two"} {
+		err = hc.UpgradeRelease(client.UpgradeOptions{ReleaseName: "release", Chart: tmpDir, SetValues: []string{"param=" + param}, Namespace: "ns"})
+		require.NoError(t, err)
+	}
+
+	_, err = hc.Rollback("release", "5")
+	assert.Error(t, err, "absent revision")
+
+	revision, err := hc.Rollback("release", "1")
+	require.NoError(t, err)
+	assert.Equal(t, "1", revision)
+
+	manifest, err := hc.GetReleaseManifest("release", "")
+	require.NoError(t, err)
+	assert.Contains(t, manifest, `param: "one"`)
+}
+
+func Test_Helm3LibClient_UpgradeActions(t *testing.T) {
+	initMemoryStorage(t)
+	hc := NewClient(testOptions).(*Helm3LibClient)
+	cfg, err := hc.actionConfig("ns")
+	require.NoError(t, err)
+
+	upg := hc.upgradeAction(cfg, client.UpgradeOptions{Namespace: "ns"})
+	assert.Equal(t, time.Minute, upg.Timeout)
+	assert.Equal(t, 2, upg.MaxHistory)
+	assert.False(t, upg.Wait)
+
+	opts := client.UpgradeOptions{
+		ReleaseName: "release",
+		Namespace:   "ns",
+		Wait:        true,
+		Atomic:      true,
+		Timeout:     10 * time.Minute,
+		HistoryMax:  5,
+		Force:       true,
+		ResetValues: true,
+	}
+	upg = hc.upgradeAction(cfg, opts)
+	assert.Equal(t, 10*time.Minute, upg.Timeout)
+	assert.Equal(t, 5, upg.MaxHistory)
+	assert.True(t, upg.Wait)
+	assert.True(t, upg.Atomic)
+	assert.True(t, upg.Force)
+	assert.True(t, upg.ResetValues)
+
+	inst := hc.installAction(cfg, opts)
+	assert.Equal(t, "release", inst.ReleaseName)
+	assert.Equal(t, 10*time.Minute, inst.Timeout)
+	assert.True(t, inst.Wait)
+	assert.True(t, inst.Atomic)
+}
+
+func Test_Helm3LibClient_ActionConfigCache(t *testing.T) {
+	initMemoryStorage(t)
+	newActionConfig := NewActionConfig
+	inits := 0
+	NewActionConfig = func(namespace string, logEntry *log.Entry) (*action.Configuration, error) {
+		inits++
+		return newActionConfig(namespace, logEntry)
+	}
+
+	cfg, err := NewClient(testOptions).(*Helm3LibClient).actionConfig("ns")
+	require.NoError(t, err)
+	cached, err := NewClient(testOptions).(*Helm3LibClient).actionConfig("ns")
+	require.NoError(t, err)
+	assert.Same(t, cfg, cached, "clients of the instance should share configuration")
+	assert.Equal(t, 1, inits)
+
+	_, err = NewClient(testOptions).(*Helm3LibClient).actionConfig("")
+	require.NoError(t, err)
+	assert.Equal(t, 2, inits, "configuration should be created for another namespace")
+}
@@ -12,13 +12,24 @@ type MockHelmClient struct {
 	DeleteSingleFailedRevisionExecuted bool
 	UpgradeReleaseExecuted             bool
 	DeleteReleaseExecuted              bool
+	RollbackExecuted                   bool
 	ReleaseNames                       []string
 }
 
+func (h *MockHelmClient) WithNamespace(_ string) {
+}
+
+func (h *MockHelmClient) WithPostRenderer(_ client.PostRenderer) {
+}
+
 func (h *MockHelmClient) DeleteOldFailedRevisions(releaseName string) error {
 	return nil
 }
 
+func (h *MockHelmClient) RecoverPendingRelease(_ string) (string, error) {
+	return "", nil
+}
+
 func (h *MockHelmClient) ListReleases(_ map[string]string) ([]string, error) {
 	if h.ReleaseNames != nil {
 		return h.ReleaseNames, nil
@@ -33,6 +44,14 @@ func (h *MockHelmClient) ListReleasesNames(_ map[string]string) ([]string, error
 	return []string{}, nil
 }
 
+func (h *MockHelmClient) LabelRelease(_ string, _ map[string]string) error {
+	return nil
+}
+
+func (h *MockHelmClient) ReleaseLabels(_ string) (map[string]string, error) {
+	return nil, nil
+}
+
 func (h *MockHelmClient) CommandEnv() []string {
 	return []string{}
 }
@@ -54,7 +73,20 @@ func (h *MockHelmClient) GetReleaseValues(_ string) (utils.Values, error) {
 	return make(utils.Values), nil
 }
 
-func (h *MockHelmClient) UpgradeRelease(_, _ string, _ []string, _ []string, _ string) error {
+func (h *MockHelmClient) GetReleaseManifest(_ string, _ string) (string, error) {
+	return "", nil
+}
+
+func (h *MockHelmClient) History(_ string) ([]client.ReleaseRevision, error) {
+	return []client.ReleaseRevision{}, nil
+}
+
+func (h *MockHelmClient) Rollback(_ string, _ string) (string, error) {
+	h.RollbackExecuted = true
+	return "1", nil
+}
+
+func (h *MockHelmClient) UpgradeRelease(_ client.UpgradeOptions) error {
 	h.UpgradeReleaseExecuted = true
 	return nil
 }
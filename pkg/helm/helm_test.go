@@ -108,7 +108,7 @@ func releasesListShouldEqual(helm client.HelmClient, expectedList []string) (err
 }
 
 func shouldUpgradeRelease(helm client.HelmClient, releaseName string, chart string, valuesPaths []string) (err error) {
-	err = helm.UpgradeRelease(releaseName, chart, []string{}, []string{}, app.Namespace)
+	err = helm.UpgradeRelease(client.UpgradeOptions{ReleaseName: releaseName, Chart: chart, Namespace: app.Namespace})
 	if err != nil {
 		return fmt.Errorf("Cannot install test release: %s", err)
 	}
@@ -240,7 +240,7 @@ func TestHelm(t *testing.T) {
 		t.Error(err)
 	}
 
-	err = helm.UpgradeRelease("hello", "no-such-chart", []string{}, []string{}, app.Namespace)
+	err = helm.UpgradeRelease(client.UpgradeOptions{ReleaseName: "hello", Chart: "no-such-chart", Namespace: app.Namespace})
 	if err == nil {
 		t.Errorf("Expected helm upgrade to fail, got no error from helm client")
 	}
@@ -0,0 +1,74 @@
+package post_renderer
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Config is a declarative configuration of built-in transformers. Transformers
+// are applied to manifests of all modules.
+type Config struct {
+	// Labels are set on all resources.
+	Labels map[string]string `json:"labels,omitempty"`
+	// Annotations are set on all resources.
+	Annotations map[string]string `json:"annotations,omitempty"`
+	// ImagePullSecrets are added to pod specs of workloads.
+	ImagePullSecrets []string `json:"imagePullSecrets,omitempty"`
+	// ImageRewrites change registries of container images, the first matched rule is used.
+	ImageRewrites []ImageRewriteRule `json:"imageRewrites,omitempty"`
+}
+
+// ImageRewriteRule replaces the From prefix of the image with To. Images from
+// Docker Hub are matched in the full form, e.g. "nginx" is "docker.io/library/nginx".
+type ImageRewriteRule struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// ConfigPath is a path to the loaded config. It is passed to the post-render command.
+var ConfigPath string
+
+var config *Config
+
+// Init loads the config from the file. Built-in transformers are disabled if the path is empty.
+func Init(configPath string) error {
+	ConfigPath = configPath
+	config = nil
+	if configPath == "" {
+		return nil
+	}
+
+	data, err := ioutil.ReadFile(configPath)
+	if err != nil {
+		return fmt.Errorf("read post-render config: %v", err)
+	}
+	cfg, err := NewConfigFromBytes(data)
+	if err != nil {
+		return fmt.Errorf("load post-render config '%s': %v", configPath, err)
+	}
+	config = cfg
+	return nil
+}
+
+// NewConfigFromBytes parses and validates the config.
+func NewConfigFromBytes(data []byte) (*Config, error) {
+	cfg := new(Config)
+	err := yaml.UnmarshalStrict(data, cfg)
+	if err != nil {
+		return nil, err
+	}
+	for i, rule := range cfg.ImageRewrites {
+		if strings.TrimSpace(rule.From) == "" || strings.TrimSpace(rule.To) == "" {
+			return nil, fmt.Errorf("imageRewrites[%d]: 'from' and 'to' are required", i)
+		}
+	}
+	for i, secret := range cfg.ImagePullSecrets {
+		if strings.TrimSpace(secret) == "" {
+			return nil, fmt.Errorf("imagePullSecrets[%d]: empty secret name", i)
+		}
+	}
+	return cfg, nil
+}
@@ -0,0 +1,106 @@
+package post_renderer
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+
+	"github.com/flant/addon-operator/pkg/helm/client"
+	"github.com/flant/addon-operator/pkg/utils"
+	"github.com/flant/addon-operator/sdk"
+	"github.com/flant/addon-operator/sdk/registry"
+)
+
+// CommandName is a name of the addon-operator command that runs the pipeline for the helm binary.
+const CommandName = "post-render"
+
+// Pipeline runs transformers over rendered manifests of the module.
+// It implements the helm post-renderer interface.
+type Pipeline struct {
+	ModuleName   string
+	Namespace    string
+	Transformers []sdk.Transformer
+}
+
+var _ client.PostRenderer = &Pipeline{}
+
+// ForModule returns a pipeline with built-in transformers from the config followed
+// by transformers registered with sdk.RegisterTransformer. It returns nil if there are
+// no transformers, so manifests are passed to helm as is.
+func ForModule(moduleName string, namespace string) client.PostRenderer {
+	transformers := append(config.Transformers(), registry.TransformerRegistry().Transformers()...)
+	if len(transformers) == 0 {
+		return nil
+	}
+	return &Pipeline{
+		ModuleName:   moduleName,
+		Namespace:    namespace,
+		Transformers: transformers,
+	}
+}
+
+// Run transforms manifests. It is called by helm or by the post-render command.
+func (p *Pipeline) Run(renderedManifests *bytes.Buffer) (*bytes.Buffer, error) {
+	res, err := p.Transform(renderedManifests.String())
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewBufferString(res), nil
+}
+
+// Args returns arguments of the addon-operator command to run the pipeline as an external program.
+func (p *Pipeline) Args() []string {
+	args := []string{CommandName, "--module", p.ModuleName, "--namespace", p.Namespace}
+	if ConfigPath != "" {
+		args = append(args, "--config", ConfigPath)
+	}
+	return args
+}
+
+// Transform applies transformers to the multi-document YAML. Helm hooks are transformed
+// too and are placed after other manifests as in 'helm template' output.
+func (p *Pipeline) Transform(manifests string) (string, error) {
+	objects := make([]*unstructured.Unstructured, 0)
+	for _, doc := range utils.SplitYamlDocuments(manifests) {
+		obj := make(map[string]interface{})
+		err := yaml.Unmarshal([]byte(doc), &obj)
+		if err != nil {
+			return "", fmt.Errorf("parse rendered manifests: %v", err)
+		}
+		if len(obj) == 0 {
+			continue
+		}
+		objects = append(objects, &unstructured.Unstructured{Object: obj})
+	}
+
+	input := &sdk.PostRenderInput{
+		ModuleName: p.ModuleName,
+		Namespace:  p.Namespace,
+	}
+	var err error
+	for _, transformer := range p.Transformers {
+		objects, err = transformer.Transform(input, objects)
+		if err != nil {
+			return "", fmt.Errorf("transformer '%s': %v", transformer.Name(), err)
+		}
+	}
+
+	docs := make([]string, 0, len(objects))
+	hooks := make([]string, 0)
+	for _, obj := range objects {
+		data, err := yaml.Marshal(obj.Object)
+		if err != nil {
+			return "", fmt.Errorf("marshal transformed manifest: %v", err)
+		}
+		if _, isHook := obj.GetAnnotations()[utils.HelmHookAnnotation]; isHook {
+			hooks = append(hooks, strings.TrimSpace(string(data)))
+			continue
+		}
+		docs = append(docs, strings.TrimSpace(string(data)))
+	}
+	docs = append(docs, hooks...)
+	return "---\n" + strings.Join(docs, "\n---\n") + "\n", nil
+}
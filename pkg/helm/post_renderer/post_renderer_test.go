@@ -0,0 +1,225 @@
+package post_renderer
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/flant/addon-operator/pkg/utils"
+	"github.com/flant/addon-operator/sdk"
+)
+
+const testManifests = `
+# Source: chart/templates/deploy.yaml
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+  labels:
+    app: app
+spec:
+  template:
+    spec:
+      initContainers:
+      - name: init
+        image: busybox
+      containers:
+      - name: app
+        image: quay.io/org/app:v1
+      imagePullSecrets:
+      - name: existing
+---
+apiVersion: batch/v1beta1
+kind: CronJob
+metadata:
+  name: job
+spec:
+  jobTemplate:
+    spec:
+      template:
+        spec:
+          containers:
+          - name: job
+            image: org/job@sha256:abc
+---
+# Source: chart/templates/empty.yaml
+---
+apiVersion: batch/v1
+kind: Job
+metadata:
+  name: hook
+  annotations:
+    helm.sh/hook: pre-install
+spec:
+  template:
+    spec:
+      containers:
+      - name: migrate
+        image: busybox
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: cm
+`
+
+func Test_RewriteImage(t *testing.T) {
+	rules := []ImageRewriteRule{
+		{From: "quay.io/", To: "registry.local/quay/"},
+		{From: "docker.io/library/", To: "registry.local/library/"},
+		{From: "docker.io/", To: "registry.local/hub/"},
+	}
+	tests := []struct {
+		image    string
+		expected string
+	}{
+		{"busybox", "registry.local/library/busybox"},
+		{"busybox:1.32", "registry.local/library/busybox:1.32"},
+		{"docker.io/library/busybox", "registry.local/library/busybox"},
+		{"org/job@sha256:abc", "registry.local/hub/org/job@sha256:abc"},
+		{"quay.io/org/app:v1", "registry.local/quay/org/app:v1"},
+		{"localhost/app", "localhost/app"},
+		{"localhost:5000/app", "localhost:5000/app"},
+		{"gcr.io/app", "gcr.io/app"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, RewriteImage(tt.image, rules), tt.image)
+	}
+}
+
+func Test_NewConfigFromBytes(t *testing.T) {
+	cfg, err := NewConfigFromBytes([]byte(`
+labels:
+  team: platform
+imagePullSecrets: [registry]
+imageRewrites:
+- from: docker.io/
+  to: registry.local/
+`))
+	require.NoError(t, err)
+	assert.Len(t, cfg.Transformers(), 3)
+
+	_, err = NewConfigFromBytes([]byte("imageRewrites:\n- from: docker.io/\n"))
+	assert.Error(t, err)
+	_, err = NewConfigFromBytes([]byte("unknownField: true\n"))
+	assert.Error(t, err)
+
+	assert.Len(t, (*Config)(nil).Transformers(), 0)
+}
+
+// moduleNameTransformer adds a ConfigMap with the module name to check the order of transformers.
+type moduleNameTransformer struct{}
+
+func (moduleNameTransformer) Name() string {
+	return "moduleName"
+}
+
+func (moduleNameTransformer) Transform(input *sdk.PostRenderInput, objects []*unstructured.Unstructured) ([]*unstructured.Unstructured, error) {
+	cm := &unstructured.Unstructured{}
+	cm.SetAPIVersion("v1")
+	cm.SetKind("ConfigMap")
+	cm.SetName(input.ModuleName)
+	cm.SetNamespace(input.Namespace)
+	return append(objects, cm), nil
+}
+
+type failedTransformer struct{}
+
+func (failedTransformer) Name() string {
+	return "failed"
+}
+
+func (failedTransformer) Transform(_ *sdk.PostRenderInput, _ []*unstructured.Unstructured) ([]*unstructured.Unstructured, error) {
+	return nil, fmt.Errorf("bad manifests")
+}
+
+func Test_Pipeline_Transform(t *testing.T) {
+	config = &Config{
+		Labels:           map[string]string{"team": "platform", "app": "override"},
+		Annotations:      map[string]string{"owner": "addon-operator"},
+		ImagePullSecrets: []string{"registry", "existing"},
+		ImageRewrites:    []ImageRewriteRule{{From: "docker.io/", To: "registry.local/"}},
+	}
+	defer func() { config = nil }()
+
+	p := &Pipeline{
+		ModuleName:   "module",
+		Namespace:    "ns",
+		Transformers: append(config.Transformers(), moduleNameTransformer{}),
+	}
+	out, err := p.Run(bytes.NewBufferString(testManifests))
+	require.NoError(t, err)
+
+	manifests, err := utils.ManifestListFromYamlDocuments(out.String())
+	require.NoError(t, err)
+	require.Len(t, manifests, 5)
+
+	deploy := &unstructured.Unstructured{Object: manifests[0]}
+	assert.Equal(t, map[string]string{"app": "override", "team": "platform"}, deploy.GetLabels())
+	assert.Equal(t, map[string]string{"owner": "addon-operator"}, deploy.GetAnnotations())
+	podSpec := podSpecOf(deploy)
+	require.NotNil(t, podSpec)
+	assert.Equal(t, "registry.local/library/busybox", podSpec["initContainers"].([]interface{})[0].(map[string]interface{})["image"])
+	assert.Equal(t, "quay.io/org/app:v1", podSpec["containers"].([]interface{})[0].(map[string]interface{})["image"])
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"name": "existing"},
+		map[string]interface{}{"name": "registry"},
+	}, podSpec["imagePullSecrets"])
+
+	cronJob := &unstructured.Unstructured{Object: manifests[1]}
+	podSpec = podSpecOf(cronJob)
+	require.NotNil(t, podSpec)
+	assert.Equal(t, "registry.local/org/job@sha256:abc", podSpec["containers"].([]interface{})[0].(map[string]interface{})["image"])
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"name": "registry"},
+		map[string]interface{}{"name": "existing"},
+	}, podSpec["imagePullSecrets"])
+
+	// Objects from transformers are after rendered objects, hooks are the last.
+	assert.Equal(t, "cm", manifests[2].Name())
+	added := &unstructured.Unstructured{Object: manifests[3]}
+	assert.Equal(t, "module", added.GetName())
+	assert.Equal(t, "ns", added.GetNamespace())
+
+	// Hooks are transformed: the hook Job uses the local registry.
+	hook := &unstructured.Unstructured{Object: manifests[4]}
+	assert.Equal(t, "hook", hook.GetName())
+	assert.Equal(t, map[string]string{"helm.sh/hook": "pre-install", "owner": "addon-operator"}, hook.GetAnnotations())
+	podSpec = podSpecOf(hook)
+	require.NotNil(t, podSpec)
+	assert.Equal(t, "registry.local/library/busybox", podSpec["containers"].([]interface{})[0].(map[string]interface{})["image"])
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"name": "registry"},
+		map[string]interface{}{"name": "existing"},
+	}, podSpec["imagePullSecrets"])
+
+	p.Transformers = []sdk.Transformer{failedTransformer{}}
+	_, err = p.Transform(testManifests)
+	assert.EqualError(t, err, "transformer 'failed': bad manifests")
+}
+
+func Test_ForModule(t *testing.T) {
+	require.NoError(t, Init(""))
+	assert.Nil(t, ForModule("module", "ns"), "pipeline should be nil without transformers")
+
+	tmpDir, err := ioutil.TempDir("", "addon-operator-post-renderer-")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+	configPath := filepath.Join(tmpDir, "config.yaml")
+	require.NoError(t, ioutil.WriteFile(configPath, []byte("labels:\n  team: platform\n"), 0644))
+
+	require.NoError(t, Init(configPath))
+	defer Init("")
+	pr := ForModule("module", "ns")
+	require.NotNil(t, pr)
+	assert.Equal(t, []string{"post-render", "--module", "module", "--namespace", "ns", "--config", configPath}, pr.Args())
+
+	assert.Error(t, Init(filepath.Join(tmpDir, "absent.yaml")))
+}
@@ -0,0 +1,182 @@
+package post_renderer
+
+import (
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/flant/addon-operator/sdk"
+)
+
+// Transformers returns built-in transformers from the config.
+func (c *Config) Transformers() []sdk.Transformer {
+	res := make([]sdk.Transformer, 0)
+	if c == nil {
+		return res
+	}
+	if len(c.Labels) > 0 || len(c.Annotations) > 0 {
+		res = append(res, &MetadataTransformer{Labels: c.Labels, Annotations: c.Annotations})
+	}
+	if len(c.ImagePullSecrets) > 0 {
+		res = append(res, &ImagePullSecretsTransformer{Secrets: c.ImagePullSecrets})
+	}
+	if len(c.ImageRewrites) > 0 {
+		res = append(res, &ImageRewriteTransformer{Rules: c.ImageRewrites})
+	}
+	return res
+}
+
+// MetadataTransformer sets labels and annotations on all resources.
+// Values from the chart are overridden.
+type MetadataTransformer struct {
+	Labels      map[string]string
+	Annotations map[string]string
+}
+
+func (t *MetadataTransformer) Name() string {
+	return "metadata"
+}
+
+func (t *MetadataTransformer) Transform(_ *sdk.PostRenderInput, objects []*unstructured.Unstructured) ([]*unstructured.Unstructured, error) {
+	for _, obj := range objects {
+		if len(t.Labels) > 0 {
+			obj.SetLabels(mergeStringMaps(obj.GetLabels(), t.Labels))
+		}
+		if len(t.Annotations) > 0 {
+			obj.SetAnnotations(mergeStringMaps(obj.GetAnnotations(), t.Annotations))
+		}
+	}
+	return objects, nil
+}
+
+func mergeStringMaps(base map[string]string, override map[string]string) map[string]string {
+	res := make(map[string]string, len(base)+len(override))
+	for k, v := range base {
+		res[k] = v
+	}
+	for k, v := range override {
+		res[k] = v
+	}
+	return res
+}
+
+// ImagePullSecretsTransformer adds image pull secrets to pod specs of workloads.
+type ImagePullSecretsTransformer struct {
+	Secrets []string
+}
+
+func (t *ImagePullSecretsTransformer) Name() string {
+	return "imagePullSecrets"
+}
+
+func (t *ImagePullSecretsTransformer) Transform(_ *sdk.PostRenderInput, objects []*unstructured.Unstructured) ([]*unstructured.Unstructured, error) {
+	for _, obj := range objects {
+		podSpec := podSpecOf(obj)
+		if podSpec == nil {
+			continue
+		}
+		secrets, _ := podSpec["imagePullSecrets"].([]interface{})
+		existing := make(map[string]bool)
+		for _, secret := range secrets {
+			if secretMap, ok := secret.(map[string]interface{}); ok {
+				name, _ := secretMap["name"].(string)
+				existing[name] = true
+			}
+		}
+		for _, name := range t.Secrets {
+			if !existing[name] {
+				secrets = append(secrets, map[string]interface{}{"name": name})
+				existing[name] = true
+			}
+		}
+		podSpec["imagePullSecrets"] = secrets
+	}
+	return objects, nil
+}
+
+// ImageRewriteTransformer changes images of containers and init containers in pod specs of workloads.
+type ImageRewriteTransformer struct {
+	Rules []ImageRewriteRule
+}
+
+func (t *ImageRewriteTransformer) Name() string {
+	return "imageRewrite"
+}
+
+func (t *ImageRewriteTransformer) Transform(_ *sdk.PostRenderInput, objects []*unstructured.Unstructured) ([]*unstructured.Unstructured, error) {
+	for _, obj := range objects {
+		podSpec := podSpecOf(obj)
+		if podSpec == nil {
+			continue
+		}
+		for _, field := range []string{"initContainers", "containers"} {
+			containers, _ := podSpec[field].([]interface{})
+			for _, container := range containers {
+				containerMap, ok := container.(map[string]interface{})
+				if !ok {
+					continue
+				}
+				if image, ok := containerMap["image"].(string); ok {
+					containerMap["image"] = RewriteImage(image, t.Rules)
+				}
+			}
+		}
+	}
+	return objects, nil
+}
+
+// RewriteImage returns the image with the prefix replaced by the first matched rule.
+// The image is not changed if no rule is matched.
+func RewriteImage(image string, rules []ImageRewriteRule) string {
+	fullImage := normalizeImage(image)
+	for _, rule := range rules {
+		if strings.HasPrefix(image, rule.From) {
+			return rule.To + strings.TrimPrefix(image, rule.From)
+		}
+		if strings.HasPrefix(fullImage, rule.From) {
+			return rule.To + strings.TrimPrefix(fullImage, rule.From)
+		}
+	}
+	return image
+}
+
+// normalizeImage returns the image with the Docker Hub registry and the "library/" repository
+// prefix if the image has no registry, as docker does.
+func normalizeImage(image string) string {
+	parts := strings.SplitN(image, "/", 2)
+	if len(parts) == 2 && (strings.ContainsAny(parts[0], ".:") || parts[0] == "localhost") {
+		return image
+	}
+	if len(parts) == 1 {
+		return "docker.io/library/" + image
+	}
+	return "docker.io/" + image
+}
+
+// podTemplatePaths are paths to pod specs in workloads.
+var podTemplatePaths = map[string][]string{
+	"Pod":                   {"spec"},
+	"Deployment":            {"spec", "template", "spec"},
+	"StatefulSet":           {"spec", "template", "spec"},
+	"DaemonSet":             {"spec", "template", "spec"},
+	"ReplicaSet":            {"spec", "template", "spec"},
+	"ReplicationController": {"spec", "template", "spec"},
+	"Job":                   {"spec", "template", "spec"},
+	"CronJob":               {"spec", "jobTemplate", "spec", "template", "spec"},
+}
+
+// podSpecOf returns a pod spec of the workload to change in place or nil.
+func podSpecOf(obj *unstructured.Unstructured) map[string]interface{} {
+	path, has := podTemplatePaths[obj.GetKind()]
+	if !has {
+		return nil
+	}
+	res := obj.Object
+	for _, field := range path {
+		res, _ = res[field].(map[string]interface{})
+		if res == nil {
+			return nil
+		}
+	}
+	return res
+}
@@ -0,0 +1,100 @@
+package helm
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+// MaxReleaseNameLength is a maximum length of a release name in Helm 3.
+const MaxReleaseNameLength = 53
+
+// releaseNameHashLength is a length of a hash suffix for truncated names.
+const releaseNameHashLength = 8
+
+// ReleaseNameData is passed to the release name template.
+type ReleaseNameData struct {
+	ModuleName string
+	Namespace  string
+	Prefix     string
+}
+
+var invalidReleaseNameChars = regexp.MustCompile(`[^a-z0-9-]+`)
+var repeatedDashes = regexp.MustCompile(`-{2,}`)
+
+// ReleaseNaming generates release names for modules of the Addon-operator instance.
+type ReleaseNaming struct {
+	template *template.Template
+	prefix   string
+}
+
+// NewReleaseNaming parses a template for release names.
+func NewReleaseNaming(tpl string, prefix string) (*ReleaseNaming, error) {
+	t, err := template.New("releaseName").Option("missingkey=error").Parse(tpl)
+	if err != nil {
+		return nil, fmt.Errorf("parse helm release name template '%s': %v", tpl, err)
+	}
+
+	// Check that template can be executed.
+	_, err = executeReleaseNameTemplate(t, ReleaseNameData{ModuleName: "module", Namespace: "namespace", Prefix: prefix})
+	if err != nil {
+		return nil, err
+	}
+
+	return &ReleaseNaming{template: t, prefix: prefix}, nil
+}
+
+// ReleaseName returns a sanitized release name for the module. Module name is
+// used as a release name if naming is not initialized.
+func (n *ReleaseNaming) ReleaseName(moduleName string, namespace string) string {
+	if n == nil {
+		return SanitizeReleaseName(moduleName)
+	}
+
+	name, err := executeReleaseNameTemplate(n.template, ReleaseNameData{
+		ModuleName: moduleName,
+		Namespace:  namespace,
+		Prefix:     n.prefix,
+	})
+	if err != nil {
+		// Template is checked in NewReleaseNaming, so this should not happen.
+		return SanitizeReleaseName(n.prefix + moduleName)
+	}
+	return SanitizeReleaseName(name)
+}
+
+func executeReleaseNameTemplate(t *template.Template, data ReleaseNameData) (string, error) {
+	var buf bytes.Buffer
+	err := t.Execute(&buf, data)
+	if err != nil {
+		return "", fmt.Errorf("execute helm release name template: %v", err)
+	}
+	name := SanitizeReleaseName(buf.String())
+	if name == "" {
+		return "", fmt.Errorf("helm release name template returns an empty name for module '%s'", data.ModuleName)
+	}
+	return name, nil
+}
+
+// SanitizeReleaseName converts name to a valid Helm release name: lowercase
+// alphanumeric characters and dashes. Names longer than MaxReleaseNameLength are
+// truncated and a hash of the full name is appended to keep names unique.
+func SanitizeReleaseName(name string) string {
+	res := strings.ToLower(strings.TrimSpace(name))
+	res = invalidReleaseNameChars.ReplaceAllString(res, "-")
+	res = repeatedDashes.ReplaceAllString(res, "-")
+	res = strings.Trim(res, "-")
+
+	if len(res) <= MaxReleaseNameLength {
+		return res
+	}
+
+	hash := sha256.Sum256([]byte(res))
+	suffix := hex.EncodeToString(hash[:])[:releaseNameHashLength]
+	res = strings.TrimRight(res[:MaxReleaseNameLength-releaseNameHashLength-1], "-")
+	return res + "-" + suffix
+}
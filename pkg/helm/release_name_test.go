@@ -0,0 +1,60 @@
+package helm
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_SanitizeReleaseName(t *testing.T) {
+	tests := []struct {
+		name     string
+		in       string
+		expected string
+	}{
+		{"valid name", "module-one", "module-one"},
+		{"upper case", "Module-One", "module-one"},
+		{"invalid chars", "my_module.v2", "my-module-v2"},
+		{"repeated dashes", "prefix--module__name", "prefix-module-name"},
+		{"trim dashes", "-module-", "module"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, SanitizeReleaseName(tt.in))
+		})
+	}
+}
+
+func Test_SanitizeReleaseName_Truncate(t *testing.T) {
+	long := strings.Repeat("a", 40) + "-" + strings.Repeat("b", 40)
+	other := strings.Repeat("a", 40) + "-" + strings.Repeat("c", 40)
+
+	name := SanitizeReleaseName(long)
+	assert.Len(t, name, MaxReleaseNameLength)
+	assert.True(t, strings.HasPrefix(name, strings.Repeat("a", 40)+"-bbb"))
+	assert.Equal(t, name, SanitizeReleaseName(long), "name should be stable")
+	assert.NotEqual(t, name, SanitizeReleaseName(other), "truncated names should be unique")
+}
+
+func Test_ReleaseName_Template(t *testing.T) {
+	var naming *ReleaseNaming
+	assert.Equal(t, "module-one", naming.ReleaseName("module-one", "default"))
+
+	naming, err := NewReleaseNaming("{{ .Prefix }}{{ .ModuleName }}", "team-")
+	require.NoError(t, err)
+	assert.Equal(t, "team-module-one", naming.ReleaseName("module-one", "default"))
+
+	naming, err = NewReleaseNaming("{{ .Namespace }}-{{ .ModuleName }}", "")
+	require.NoError(t, err)
+	assert.Equal(t, "monitoring-prometheus", naming.ReleaseName("prometheus", "monitoring"))
+
+	_, err = NewReleaseNaming("{{ .Unknown }}", "")
+	assert.Error(t, err)
+	_, err = NewReleaseNaming("{{ .ModuleName", "")
+	assert.Error(t, err)
+	_, err = NewReleaseNaming("---", "")
+	assert.Error(t, err, "empty name should be an error")
+}
@@ -2,6 +2,7 @@ package helm
 
 import (
 	"fmt"
+	"github.com/flant/addon-operator/pkg/app"
 	"github.com/flant/addon-operator/pkg/helm/helm2"
 	"github.com/flant/addon-operator/pkg/helm/helm3"
 	"os"
@@ -25,6 +26,14 @@ func DetectHelmVersion() (string, error) {
 		helm2.TillerPath = tillerPath
 	}
 
+	// Helm binary is not needed for the helm 3 library.
+	if app.Helm3Client == app.Helm3ClientLibrary {
+		if os.Getenv("HELM2") == "yes" {
+			return "", fmt.Errorf("helm 3 library client cannot be used with HELM2=yes")
+		}
+		return "v3", nil
+	}
+
 	if os.Getenv("HELM3") == "yes" {
 		return "v3", nil
 	}
@@ -5,6 +5,8 @@ import (
 	"testing"
 
 	. "github.com/onsi/gomega"
+
+	"github.com/flant/addon-operator/pkg/app"
 )
 
 // Test requires helm and helm2 binaries in $PATH.
@@ -39,3 +41,20 @@ func Test_DetectHelmVersion(t *testing.T) {
 	g.Expect(err).ShouldNot(HaveOccurred())
 	g.Expect(ver).Should(Equal("v2"))
 }
+
+func Test_DetectHelmVersion_Library(t *testing.T) {
+	g := NewWithT(t)
+
+	defer func(client string) { app.Helm3Client = client }(app.Helm3Client)
+	defer os.Unsetenv("HELM2")
+	app.Helm3Client = app.Helm3ClientLibrary
+
+	os.Unsetenv("HELM2")
+	ver, err := DetectHelmVersion()
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(ver).Should(Equal("v3"))
+
+	os.Setenv("HELM2", "yes")
+	_, err = DetectHelmVersion()
+	g.Expect(err).Should(HaveOccurred())
+}
@@ -2,6 +2,8 @@ package helm_resources_manager
 
 import (
 	"context"
+	"strings"
+	"sync"
 
 	log "github.com/sirupsen/logrus"
 
@@ -20,12 +22,16 @@ type HelmResourcesManager interface {
 	PauseMonitors()
 	ResumeMonitors()
 	StartMonitor(moduleName string, manifests []manifest.Manifest, defaultNamespace string)
+	StartPartMonitor(moduleName string, part string, manifests []manifest.Manifest, defaultNamespace string)
 	HasMonitor(moduleName string) bool
+	HasPartMonitor(moduleName string, part string) bool
 	StopMonitor(moduleName string)
+	StopPartMonitor(moduleName string, part string)
 	PauseMonitor(moduleName string)
 	ResumeMonitor(moduleName string)
 	AbsentResources(moduleName string) ([]manifest.Manifest, error)
 	GetMonitor(moduleName string) *ResourcesMonitor
+	GetMonitors(moduleName string) map[string]*ResourcesMonitor
 	GetAbsentResources(templates []manifest.Manifest, defaultNamespace string) ([]manifest.Manifest, error)
 	Ch() chan AbsentResourcesEvent
 }
@@ -38,7 +44,9 @@ type helmResourcesManager struct {
 
 	kubeClient kube.KubernetesClient
 
-	monitors map[string]*ResourcesMonitor
+	// monitors are indexed by a module name or by a module name and a part name for modules with several charts.
+	monitors     map[string]*ResourcesMonitor
+	monitorsLock sync.Mutex
 
 	eventCh chan AbsentResourcesEvent
 }
@@ -74,86 +82,193 @@ func (hm *helmResourcesManager) Ch() chan AbsentResourcesEvent {
 	return hm.eventCh
 }
 
+// monitorKey returns a key for the monitor of the module part. Monitor of the whole module has the module name as a key.
+func monitorKey(moduleName string, part string) string {
+	if part == "" {
+		return moduleName
+	}
+	return moduleName + "/" + part
+}
+
+// splitMonitorKey returns a module name and a part name.
+func splitMonitorKey(key string) (string, string) {
+	parts := strings.SplitN(key, "/", 2)
+	if len(parts) == 1 {
+		return parts[0], ""
+	}
+	return parts[0], parts[1]
+}
+
+// isModuleMonitor returns true if the key is for the module or for one of its parts.
+func isModuleMonitor(key string, moduleName string) bool {
+	return key == moduleName || strings.HasPrefix(key, moduleName+"/")
+}
+
 func (hm *helmResourcesManager) StartMonitor(moduleName string, manifests []manifest.Manifest, defaultNamespace string) {
-	log.Debugf("Start helm resources monitor for '%s'", moduleName)
-	hm.StopMonitor(moduleName)
+	hm.StartPartMonitor(moduleName, "", manifests, defaultNamespace)
+}
+
+// StartPartMonitor starts a monitor for resources of one chart of the module.
+func (hm *helmResourcesManager) StartPartMonitor(moduleName string, part string, manifests []manifest.Manifest, defaultNamespace string) {
+	key := monitorKey(moduleName, part)
+	log.Debugf("Start helm resources monitor for '%s'", key)
+	hm.monitorsLock.Lock()
+	defer hm.monitorsLock.Unlock()
+	hm.stopMonitor(key)
 
 	rm := NewResourcesMonitor()
 	rm.WithKubeClient(hm.kubeClient)
 	rm.WithContext(hm.ctx)
-	rm.WithModuleName(moduleName)
+	rm.WithModuleName(key)
 	rm.WithManifests(manifests)
 	rm.WithDefaultNamespace(defaultNamespace)
 	rm.WithAbsentCb(hm.absentResourcesCallback)
 
-	hm.monitors[moduleName] = rm
+	hm.monitors[key] = rm
 	rm.Start()
 }
 
-func (hm *helmResourcesManager) absentResourcesCallback(moduleName string, absent []manifest.Manifest, defaultNs string) {
-	log.Debugf("Detect absent resources for %s", moduleName)
+func (hm *helmResourcesManager) absentResourcesCallback(key string, absent []manifest.Manifest, defaultNs string) {
+	log.Debugf("Detect absent resources for %s", key)
 	for _, m := range absent {
 		log.Debugf("%s/%s/%s", m.Namespace(defaultNs), m.Kind(), m.Name())
 	}
+	moduleName, part := splitMonitorKey(key)
 	hm.eventCh <- AbsentResourcesEvent{
 		ModuleName: moduleName,
+		Part:       part,
 		Absent:     absent,
 	}
 }
 
 func (hm *helmResourcesManager) StopMonitors() {
+	hm.monitorsLock.Lock()
+	defer hm.monitorsLock.Unlock()
 	for moduleName := range hm.monitors {
-		hm.StopMonitor(moduleName)
+		hm.stopMonitor(moduleName)
 	}
 }
 
 func (hm *helmResourcesManager) PauseMonitors() {
+	hm.monitorsLock.Lock()
+	defer hm.monitorsLock.Unlock()
 	for _, monitor := range hm.monitors {
 		monitor.Pause()
 	}
 }
 
 func (hm *helmResourcesManager) ResumeMonitors() {
+	hm.monitorsLock.Lock()
+	defer hm.monitorsLock.Unlock()
 	for _, monitor := range hm.monitors {
 		monitor.Resume()
 	}
 }
 
+// StopMonitor stops monitors of the module and all its parts.
 func (hm *helmResourcesManager) StopMonitor(moduleName string) {
-	if monitor, ok := hm.monitors[moduleName]; ok {
+	hm.monitorsLock.Lock()
+	defer hm.monitorsLock.Unlock()
+	for key := range hm.monitors {
+		if isModuleMonitor(key, moduleName) {
+			hm.stopMonitor(key)
+		}
+	}
+}
+
+// StopPartMonitor stops a monitor for resources of one chart of the module.
+func (hm *helmResourcesManager) StopPartMonitor(moduleName string, part string) {
+	hm.monitorsLock.Lock()
+	defer hm.monitorsLock.Unlock()
+	hm.stopMonitor(monitorKey(moduleName, part))
+}
+
+// stopMonitor stops and removes a monitor. monitorsLock should be held by the caller.
+func (hm *helmResourcesManager) stopMonitor(key string) {
+	if monitor, ok := hm.monitors[key]; ok {
 		monitor.Stop()
-		delete(hm.monitors, moduleName)
+		delete(hm.monitors, key)
 	}
 }
 
 func (hm *helmResourcesManager) PauseMonitor(moduleName string) {
-	if monitor, ok := hm.monitors[moduleName]; ok {
-		monitor.Pause()
+	hm.monitorsLock.Lock()
+	defer hm.monitorsLock.Unlock()
+	for key, monitor := range hm.monitors {
+		if isModuleMonitor(key, moduleName) {
+			monitor.Pause()
+		}
 	}
 }
 
 func (hm *helmResourcesManager) ResumeMonitor(moduleName string) {
-	if monitor, ok := hm.monitors[moduleName]; ok {
-		monitor.Resume()
+	hm.monitorsLock.Lock()
+	defer hm.monitorsLock.Unlock()
+	for key, monitor := range hm.monitors {
+		if isModuleMonitor(key, moduleName) {
+			monitor.Resume()
+		}
 	}
 }
 
+// HasMonitor returns true if there is a monitor for the module or for one of its parts.
 func (hm *helmResourcesManager) HasMonitor(moduleName string) bool {
-	_, ok := hm.monitors[moduleName]
+	hm.monitorsLock.Lock()
+	defer hm.monitorsLock.Unlock()
+	for key := range hm.monitors {
+		if isModuleMonitor(key, moduleName) {
+			return true
+		}
+	}
+	return false
+}
+
+func (hm *helmResourcesManager) HasPartMonitor(moduleName string, part string) bool {
+	hm.monitorsLock.Lock()
+	defer hm.monitorsLock.Unlock()
+	_, ok := hm.monitors[monitorKey(moduleName, part)]
 	return ok
 }
 
+// AbsentResources returns absent resources of the module and all its parts.
 func (hm *helmResourcesManager) AbsentResources(moduleName string) ([]manifest.Manifest, error) {
-	if monitor, ok := hm.monitors[moduleName]; ok {
-		return monitor.AbsentResources()
+	hm.monitorsLock.Lock()
+	defer hm.monitorsLock.Unlock()
+	res := make([]manifest.Manifest, 0)
+	for key, monitor := range hm.monitors {
+		if !isModuleMonitor(key, moduleName) {
+			continue
+		}
+		absent, err := monitor.AbsentResources()
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, absent...)
 	}
-	return nil, nil
+	return res, nil
 }
 
+// GetMonitor returns a monitor of the whole module.
 func (hm *helmResourcesManager) GetMonitor(moduleName string) *ResourcesMonitor {
+	hm.monitorsLock.Lock()
+	defer hm.monitorsLock.Unlock()
 	return hm.monitors[moduleName]
 }
 
+// GetMonitors returns monitors of the module indexed by part names. Monitor of the whole module has an empty part name.
+func (hm *helmResourcesManager) GetMonitors(moduleName string) map[string]*ResourcesMonitor {
+	hm.monitorsLock.Lock()
+	defer hm.monitorsLock.Unlock()
+	res := make(map[string]*ResourcesMonitor)
+	for key, monitor := range hm.monitors {
+		if isModuleMonitor(key, moduleName) {
+			_, part := splitMonitorKey(key)
+			res[part] = monitor
+		}
+	}
+	return res
+}
+
 func (hm *helmResourcesManager) GetAbsentResources(manifests []manifest.Manifest, defaultNamespace string) ([]manifest.Manifest, error) {
 	rm := NewResourcesMonitor()
 	rm.WithKubeClient(hm.kubeClient)
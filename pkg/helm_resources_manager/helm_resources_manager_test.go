@@ -87,3 +87,21 @@ func createResource(fc *fake.FakeCluster, ns, manifestYaml string) manifest.Mani
 
 	return m
 }
+
+func Test_MonitorKeys(t *testing.T) {
+	g := NewWithT(t)
+
+	g.Expect(monitorKey("module", "")).To(Equal("module"))
+	g.Expect(monitorKey("module", "crds")).To(Equal("module/crds"))
+
+	name, part := splitMonitorKey("module/crds")
+	g.Expect(name).To(Equal("module"))
+	g.Expect(part).To(Equal("crds"))
+	name, part = splitMonitorKey("module")
+	g.Expect(name).To(Equal("module"))
+	g.Expect(part).To(Equal(""))
+
+	g.Expect(isModuleMonitor("module/crds", "module")).To(BeTrue())
+	g.Expect(isModuleMonitor("module", "module")).To(BeTrue())
+	g.Expect(isModuleMonitor("module-two", "module")).To(BeFalse())
+}
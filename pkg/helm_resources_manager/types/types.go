@@ -4,5 +4,7 @@ import "github.com/flant/shell-operator/pkg/utils/manifest"
 
 type AbsentResourcesEvent struct {
 	ModuleName string
-	Absent     []manifest.Manifest
+	// Part is a chart name for modules with several charts.
+	Part   string
+	Absent []manifest.Manifest
 }
@@ -7,17 +7,19 @@ import (
 
 // Additional binding types, specific to addon-operator
 const (
-	BeforeHelm      BindingType = "beforeHelm"
-	AfterHelm       BindingType = "afterHelm"
-	AfterDeleteHelm BindingType = "afterDeleteHelm"
-	BeforeAll       BindingType = "beforeAll"
-	AfterAll        BindingType = "afterAll"
+	BeforeHelm       BindingType = "beforeHelm"
+	AfterHelm        BindingType = "afterHelm"
+	BeforeDeleteHelm BindingType = "beforeDeleteHelm"
+	AfterDeleteHelm  BindingType = "afterDeleteHelm"
+	BeforeAll        BindingType = "beforeAll"
+	AfterAll         BindingType = "afterAll"
 )
 
 func init() {
 	// Add reverse index for additional binding types
 	ContextBindingType[BeforeHelm] = "beforeHelm"
 	ContextBindingType[AfterHelm] = "afterHelm"
+	ContextBindingType[BeforeDeleteHelm] = "beforeDeleteHelm"
 	ContextBindingType[AfterDeleteHelm] = "afterDeleteHelm"
 	ContextBindingType[BeforeAll] = "beforeAll"
 	ContextBindingType[AfterAll] = "afterAll"
@@ -27,6 +27,7 @@ type KubeConfigManager interface {
 	WithNamespace(namespace string)
 	WithConfigMapName(configMap string)
 	WithValuesChecksumsAnnotation(annotation string)
+	WithKnownModuleNames(fn func() []string)
 	SetKubeGlobalValues(values utils.Values) error
 	SetKubeModuleValues(moduleName string, values utils.Values) error
 	Init() error
@@ -34,6 +35,8 @@ type KubeConfigManager interface {
 	Stop()
 	InitialConfig() *Config
 	CurrentConfig() *Config
+	ConfigUpdated() chan Config
+	ModuleConfigsUpdated() chan ModuleConfigs
 }
 
 type kubeConfigManager struct {
@@ -45,11 +48,19 @@ type kubeConfigManager struct {
 	ConfigMapName             string
 	ValuesChecksumsAnnotation string
 
+	// knownModuleNames returns names of registered modules to match ConfigMap keys.
+	knownModuleNames func() []string
+
 	initialConfig *Config
 	currentConfig *Config
 
 	GlobalValuesChecksum  string
 	ModulesValuesChecksum map[string]string
+
+	// configUpdated chan receives a new Config when global values are changed
+	configUpdated chan Config
+	// moduleConfigsUpdated chan receives a list of all ModuleConfig in configData. Updated items marked as IsUpdated.
+	moduleConfigsUpdated chan ModuleConfigs
 }
 
 // kubeConfigManager should implement KubeConfigManager
@@ -79,10 +90,6 @@ func NewConfig() *Config {
 
 var (
 	VerboseDebug bool
-	// ConfigUpdated chan receives a new Config when global values are changed
-	ConfigUpdated chan Config
-	// ModuleConfigsUpdated chan receives a list of all ModuleConfig in configData. Updated items marked as IsUpdated.
-	ModuleConfigsUpdated chan ModuleConfigs
 )
 
 func simpleMergeConfigMapData(data map[string]string, newData map[string]string) map[string]string {
@@ -201,6 +208,19 @@ func (kcm *kubeConfigManager) WithValuesChecksumsAnnotation(annotation string) {
 	kcm.ValuesChecksumsAnnotation = annotation
 }
 
+func (kcm *kubeConfigManager) WithKnownModuleNames(fn func() []string) {
+	kcm.knownModuleNames = fn
+}
+
+// modulesNamesFromConfigData returns names of modules with keys in configData.
+func (kcm *kubeConfigManager) modulesNamesFromConfigData(configData map[string]string) map[string]bool {
+	var knownModules []string
+	if kcm.knownModuleNames != nil {
+		knownModules = kcm.knownModuleNames()
+	}
+	return GetModulesNamesFromConfigData(configData, knownModules)
+}
+
 func (kcm *kubeConfigManager) SetKubeGlobalValues(values utils.Values) error {
 	globalKubeConfig, err := GetGlobalKubeConfigFromValues(values)
 	if err != nil {
@@ -279,9 +299,21 @@ func NewKubeConfigManager() KubeConfigManager {
 	kcm := &kubeConfigManager{}
 	kcm.initialConfig = NewConfig()
 	kcm.currentConfig = NewConfig()
+	kcm.configUpdated = make(chan Config, 1)
+	kcm.moduleConfigsUpdated = make(chan ModuleConfigs, 1)
 	return kcm
 }
 
+// ConfigUpdated returns a channel with a new Config when global values are changed.
+func (kcm *kubeConfigManager) ConfigUpdated() chan Config {
+	return kcm.configUpdated
+}
+
+// ModuleConfigsUpdated returns a channel with all ModuleConfigs when module sections are changed.
+func (kcm *kubeConfigManager) ModuleConfigsUpdated() chan ModuleConfigs {
+	return kcm.moduleConfigsUpdated
+}
+
 func (kcm *kubeConfigManager) initConfig() error {
 	obj, err := kcm.getConfigMap()
 	if err != nil {
@@ -306,7 +338,7 @@ func (kcm *kubeConfigManager) initConfig() error {
 		globalValuesChecksum = globalKubeConfig.Checksum
 	}
 
-	for moduleName := range GetModulesNamesFromConfigData(obj.Data) {
+	for moduleName := range kcm.modulesNamesFromConfigData(obj.Data) {
 		// all GetModulesNamesFromConfigData must exist
 		moduleKubeConfig, err := ExtractModuleKubeConfig(moduleName, obj.Data)
 		if err != nil {
@@ -333,9 +365,6 @@ func (kcm *kubeConfigManager) Init() error {
 		VerboseDebug = true
 	}
 
-	ConfigUpdated = make(chan Config, 1)
-	ModuleConfigsUpdated = make(chan ModuleConfigs, 1)
-
 	err := kcm.initConfig()
 	if err != nil {
 		return err
@@ -411,7 +440,7 @@ func (kcm *kubeConfigManager) handleNewCm(obj *v1.ConfigMap) error {
 
 		// calculate new checksums of a module sections
 		newModulesValuesChecksum := make(map[string]string)
-		for moduleName := range GetModulesNamesFromConfigData(obj.Data) {
+		for moduleName := range kcm.modulesNamesFromConfigData(obj.Data) {
 			// all GetModulesNamesFromConfigData must exist
 			moduleKubeConfig, err := ExtractModuleKubeConfig(moduleName, obj.Data)
 			if err != nil {
@@ -429,11 +458,11 @@ func (kcm *kubeConfigManager) handleNewCm(obj *v1.ConfigMap) error {
 			log.Debugf("%s", moduleConfig.String())
 		}
 
-		ConfigUpdated <- *newConfig
+		kcm.configUpdated <- *newConfig
 
 		kcm.currentConfig = newConfig
 	} else {
-		actualModulesNames := GetModulesNamesFromConfigData(obj.Data)
+		actualModulesNames := kcm.modulesNamesFromConfigData(obj.Data)
 
 		moduleConfigsActual := make(ModuleConfigs)
 		updatedCount := 0
@@ -472,7 +501,7 @@ func (kcm *kubeConfigManager) handleNewCm(obj *v1.ConfigMap) error {
 			for _, moduleConfig := range moduleConfigsActual {
 				log.Debugf("%s", moduleConfig.String())
 			}
-			ModuleConfigsUpdated <- moduleConfigsActual
+			kcm.moduleConfigsUpdated <- moduleConfigsActual
 			kcm.currentConfig.ModuleConfigs = moduleConfigsActual
 		}
 	}
@@ -517,7 +546,7 @@ func (kcm *kubeConfigManager) handleCmDelete(obj *v1.ConfigMap) error {
 		kcm.GlobalValuesChecksum = ""
 		kcm.ModulesValuesChecksum = make(map[string]string)
 
-		ConfigUpdated <- Config{
+		kcm.configUpdated <- Config{
 			Values:        make(utils.Values),
 			ModuleConfigs: make(map[string]utils.ModuleConfig),
 		}
@@ -541,7 +570,7 @@ func (kcm *kubeConfigManager) handleCmDelete(obj *v1.ConfigMap) error {
 			}
 		}
 
-		ModuleConfigsUpdated <- moduleConfigsUpdate
+		kcm.moduleConfigsUpdated <- moduleConfigsUpdate
 	}
 
 	return nil
@@ -562,24 +591,32 @@ func (kcm *kubeConfigManager) Start() {
 	}
 
 	cmInformer := corev1.NewFilteredConfigMapInformer(kcm.KubeClient, kcm.Namespace, resyncPeriod, indexers, tweakListOptions)
-	cmInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
-		AddFunc: func(obj interface{}) {
-			err := kcm.handleCmAdd(obj.(*v1.ConfigMap))
-			if err != nil {
-				log.Errorf("Kube config manager: cannot handle ConfigMap add: %s", err)
-			}
+	// Other instances can use ConfigMaps in the same namespace, so objects are filtered
+	// by name also in handler in case the field selector is not supported.
+	cmInformer.AddEventHandler(cache.FilteringResourceEventHandler{
+		FilterFunc: func(obj interface{}) bool {
+			cm, ok := obj.(*v1.ConfigMap)
+			return ok && cm.GetName() == kcm.ConfigMapName
 		},
-		UpdateFunc: func(prevObj interface{}, obj interface{}) {
-			err := kcm.handleCmUpdate(prevObj.(*v1.ConfigMap), obj.(*v1.ConfigMap))
-			if err != nil {
-				log.Errorf("Kube config manager: cannot handle ConfigMap update: %s", err)
-			}
-		},
-		DeleteFunc: func(obj interface{}) {
-			err := kcm.handleCmDelete(obj.(*v1.ConfigMap))
-			if err != nil {
-				log.Errorf("Kube config manager: cannot handle ConfigMap delete: %s", err)
-			}
+		Handler: cache.ResourceEventHandlerFuncs{
+			AddFunc: func(obj interface{}) {
+				err := kcm.handleCmAdd(obj.(*v1.ConfigMap))
+				if err != nil {
+					log.Errorf("Kube config manager: cannot handle ConfigMap add: %s", err)
+				}
+			},
+			UpdateFunc: func(prevObj interface{}, obj interface{}) {
+				err := kcm.handleCmUpdate(prevObj.(*v1.ConfigMap), obj.(*v1.ConfigMap))
+				if err != nil {
+					log.Errorf("Kube config manager: cannot handle ConfigMap update: %s", err)
+				}
+			},
+			DeleteFunc: func(obj interface{}) {
+				err := kcm.handleCmDelete(obj.(*v1.ConfigMap))
+				if err != nil {
+					log.Errorf("Kube config manager: cannot handle ConfigMap delete: %s", err)
+				}
+			},
 		},
 	})
 
@@ -39,6 +39,8 @@ prometheus: |
   adminPassword: qwerty
   retentionDays: 20
   userPassword: qwerty
+prometheusPaused: "true"
+prometheusNamespace: monitoring
 kubeLegoEnabled: "false"
 `
 	cmData := map[string]string{}
@@ -63,10 +65,14 @@ kubeLegoEnabled: "false"
 
 	tests := map[string]struct {
 		isEnabled *bool
+		isPaused  bool
+		namespace string
 		values    utils.Values
 	}{
 		"global": {
 			nil,
+			false,
+			"",
 			utils.Values{
 				utils.GlobalValuesKey: map[string]interface{}{
 					"project":         "tfprod",
@@ -83,6 +89,8 @@ kubeLegoEnabled: "false"
 		},
 		"nginx-ingress": {
 			&utils.ModuleEnabled,
+			false,
+			"",
 			utils.Values{
 				utils.ModuleNameToValuesKey("nginx-ingress"): map[string]interface{}{
 					"config": map[string]interface{}{
@@ -97,6 +105,8 @@ kubeLegoEnabled: "false"
 		},
 		"prometheus": {
 			nil,
+			true,
+			"monitoring",
 			utils.Values{
 				utils.ModuleNameToValuesKey("prometheus"): map[string]interface{}{
 					"adminPassword": "qwerty",
@@ -107,6 +117,8 @@ kubeLegoEnabled: "false"
 		},
 		"kube-lego": {
 			&utils.ModuleDisabled,
+			false,
+			"",
 			utils.Values{},
 		},
 	}
@@ -120,6 +132,8 @@ kubeLegoEnabled: "false"
 				moduleConfig, hasConfig := config.ModuleConfigs[name]
 				assert.True(t, hasConfig)
 				assert.Equal(t, expect.isEnabled, moduleConfig.IsEnabled)
+				assert.Equal(t, expect.isPaused, moduleConfig.IsPaused)
+				assert.Equal(t, expect.namespace, moduleConfig.Namespace)
 				assert.Equal(t, expect.values, moduleConfig.Values)
 			}
 		})
@@ -302,7 +316,7 @@ param2: val2
 	wg.Add(1)
 
 	go func() {
-		newModuleConfigs = <-ModuleConfigsUpdated
+		newModuleConfigs = <-kcm.ModuleConfigsUpdated()
 		wg.Done()
 	}()
 
@@ -319,6 +333,53 @@ modParam2: val2
 	g.Expect(newModuleConfigs).To(HaveLen(1))
 }
 
+// Two instances with different ConfigMaps in one process should
+// receive updates only for their own ConfigMap.
+func TestKubeConfigManager_ModuleConfigsUpdated_instances(t *testing.T) {
+	g := NewWithT(t)
+
+	kubeClient := kube.NewFakeKubernetesClient()
+
+	newKcm := func(cmName string) (KubeConfigManager, *v1.ConfigMap) {
+		cm := &v1.ConfigMap{}
+		cm.SetNamespace("default")
+		cm.SetName(cmName)
+		cm.Data = map[string]string{}
+		_, err := kubeClient.CoreV1().ConfigMaps("default").Create(cm)
+		g.Expect(err).ShouldNot(HaveOccurred(), "ConfigMap should be created")
+
+		kcm := NewKubeConfigManager()
+		kcm.WithContext(context.Background())
+		kcm.WithKubeClient(kubeClient)
+		kcm.WithNamespace("default")
+		kcm.WithConfigMapName(cmName)
+		kcm.WithValuesChecksumsAnnotation(app.ValuesChecksumsAnnotation)
+		err = kcm.Init()
+		g.Expect(err).ShouldNot(HaveOccurred(), "KubeConfigManager should init correctly")
+		return kcm, cm
+	}
+
+	platformKcm, platformCm := newKcm("addon-operator-platform")
+	tenantKcm, _ := newKcm("addon-operator-tenant")
+
+	go platformKcm.Start()
+	defer platformKcm.Stop()
+	go tenantKcm.Start()
+	defer tenantKcm.Stop()
+
+	platformCm.Data["module1"] = `
+modParam1: val1
+`
+	_, err := kubeClient.CoreV1().ConfigMaps("default").Update(platformCm)
+	g.Expect(err).ShouldNot(HaveOccurred(), "ConfigMap should be updated")
+
+	var newModuleConfigs ModuleConfigs
+	g.Eventually(platformKcm.ModuleConfigsUpdated(), "5s").Should(Receive(&newModuleConfigs))
+	g.Expect(newModuleConfigs).To(HaveKey("module-1"))
+	g.Consistently(tenantKcm.ModuleConfigsUpdated(), "500ms").ShouldNot(Receive())
+	g.Expect(tenantKcm.CurrentConfig().ModuleConfigs).To(BeEmpty())
+}
+
 // SetKubeModuleValues should update ConfigMap's data
 func TestKubeConfigManager_SetKubeModuleValues(t *testing.T) {
 	g := NewWithT(t)
@@ -381,3 +442,24 @@ moduleLongName:
 	g.Expect(anno).To(ContainSubstring("module-long-name"))
 	g.Expect(anno).To(ContainSubstring("module1"))
 }
+
+func Test_GetModulesNamesFromConfigData(t *testing.T) {
+	g := NewWithT(t)
+
+	configData := map[string]string{
+		"global":               "param: 1\n",
+		"kubeNamespace":        "param: 1\n",
+		"kubeNamespaceEnabled": "true",
+		"kubePaused":           "true",
+		"prometheusNamespace":  "monitoring",
+		"absentHelmOptions":    "wait: true\n",
+	}
+
+	// 'kubeNamespace' is the values key of the known 'kube-namespace' module, not the namespace of 'kube'.
+	names := GetModulesNamesFromConfigData(configData, []string{"kube", "kube-namespace", "prometheus"})
+	g.Expect(names).To(Equal(map[string]bool{"kube": true, "kube-namespace": true, "prometheus": true, "absent": true}))
+
+	names = GetModulesNamesFromConfigData(configData, []string{"kube-namespace"})
+	g.Expect(names).To(HaveKey("kube-namespace"))
+	g.Expect(names).To(HaveKey("kube"), "keys of absent modules should be trimmed")
+}
@@ -11,8 +11,9 @@ import (
 // TODO make a method of KubeConfig
 // TODO LOG: multierror?
 // GetModulesNamesFromConfigData returns all keys in kube config except global
-// modNameEnabled keys are also handled
-func GetModulesNamesFromConfigData(configData map[string]string) map[string]bool {
+// modNameEnabled, modNamePaused, modNameNamespace and modNameHelmOptions keys are also handled.
+// Keys of knownModules are matched exactly, suffixes are trimmed only for keys of absent modules.
+func GetModulesNamesFromConfigData(configData map[string]string, knownModules []string) map[string]bool {
 	res := make(map[string]bool)
 
 	for key := range configData {
@@ -20,10 +21,27 @@ func GetModulesNamesFromConfigData(configData map[string]string) map[string]bool
 			continue
 		}
 
+		if modName := knownModuleNameFromConfigKey(key, knownModules); modName != "" {
+			res[modName] = true
+			continue
+		}
+
 		if strings.HasSuffix(key, "Enabled") {
 			key = strings.TrimSuffix(key, "Enabled")
 		}
 
+		if strings.HasSuffix(key, "Paused") {
+			key = strings.TrimSuffix(key, "Paused")
+		}
+
+		if strings.HasSuffix(key, "Namespace") {
+			key = strings.TrimSuffix(key, "Namespace")
+		}
+
+		if strings.HasSuffix(key, "HelmOptions") {
+			key = strings.TrimSuffix(key, "HelmOptions")
+		}
+
 		modName := utils.ModuleNameFromValuesKey(key)
 
 		if utils.ModuleNameToValuesKey(modName) != key {
@@ -36,6 +54,25 @@ func GetModulesNamesFromConfigData(configData map[string]string) map[string]bool
 	return res
 }
 
+// knownModuleNameFromConfigKey returns a name of the known module with the key or an empty string.
+// Values key has precedence: e.g. 'kubeNamespace' is the values key of the 'kube-namespace' module,
+// not the namespace key of the 'kube' module.
+func knownModuleNameFromConfigKey(key string, knownModules []string) string {
+	for _, modName := range knownModules {
+		if utils.ModuleNameToValuesKey(modName) == key {
+			return modName
+		}
+	}
+	for _, modName := range knownModules {
+		mc := utils.NewModuleConfig(modName)
+		switch key {
+		case mc.ModuleEnabledKey, mc.ModulePausedKey, mc.ModuleNamespaceKey, mc.ModuleHelmOptionsKey:
+			return modName
+		}
+	}
+	return ""
+}
+
 type ModuleKubeConfig struct {
 	utils.ModuleConfig
 	Checksum   string
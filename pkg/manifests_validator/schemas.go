@@ -0,0 +1,146 @@
+package manifests_validator
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	openapi_v2 "github.com/googleapis/gnostic/OpenAPIv2"
+	"github.com/googleapis/gnostic/compiler"
+	"k8s.io/client-go/discovery"
+	"k8s.io/kubectl/pkg/util/openapi"
+
+	"github.com/flant/addon-operator/pkg/app"
+)
+
+const (
+	// ClusterSchemasTTL is a time to keep OpenAPI schemas fetched from the API server.
+	ClusterSchemasTTL = 10 * time.Minute
+	// ClusterSchemasMinRefreshInterval limits fetches of schemas on failed validations.
+	ClusterSchemasMinRefreshInterval = time.Minute
+)
+
+// timeNow is a variable to control time in tests.
+var timeNow = time.Now
+
+// NewClusterValidator returns a validator with OpenAPI schemas from the API server.
+// Schemas are fetched on the first validation and cached for ClusterSchemasTTL, the failed
+// fetch is retried on the next validation. Invalid manifests are validated again with
+// fresh schemas if cached schemas are older than ClusterSchemasMinRefreshInterval.
+func NewClusterValidator(client discovery.OpenAPISchemaInterface) *Validator {
+	var mu sync.Mutex
+	var cached openapi.Resources
+	var fetchedAt time.Time
+	return &Validator{
+		resources: func() (openapi.Resources, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			if cached != nil && timeNow().Sub(fetchedAt) < ClusterSchemasTTL {
+				return cached, nil
+			}
+			doc, err := client.OpenAPISchema()
+			if err != nil {
+				return nil, err
+			}
+			resources, err := openapi.NewOpenAPIData(doc)
+			if err != nil {
+				return nil, err
+			}
+			cached = resources
+			fetchedAt = timeNow()
+			return cached, nil
+		},
+		refresh: func() bool {
+			mu.Lock()
+			defer mu.Unlock()
+			if cached == nil || timeNow().Sub(fetchedAt) < ClusterSchemasMinRefreshInterval {
+				return false
+			}
+			cached = nil
+			return true
+		},
+	}
+}
+
+// NewFilesValidator returns a validator with OpenAPI schemas for the Kubernetes version
+// from the '<major>.<minor>.json' file in the directory. Files are swagger.json documents
+// served by the API server at /openapi/v2.
+func NewFilesValidator(schemasDir string, kubernetesVersion string) (*Validator, error) {
+	version, err := NormalizeKubernetesVersion(kubernetesVersion)
+	if err != nil {
+		return nil, err
+	}
+	resources, err := LoadSchemaFile(filepath.Join(schemasDir, version+".json"))
+	if err != nil {
+		return nil, err
+	}
+	return NewValidator(resources), nil
+}
+
+// LoadSchemaFile loads OpenAPI v2 schemas from the JSON or YAML file.
+func LoadSchemaFile(path string) (openapi.Resources, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read OpenAPI schemas: %v", err)
+	}
+	info, err := compiler.ReadInfoFromBytes(path, data)
+	if err != nil {
+		return nil, fmt.Errorf("parse OpenAPI schemas '%s': %v", path, err)
+	}
+	doc, err := openapi_v2.NewDocument(info, compiler.NewContext("$root", nil))
+	if err != nil {
+		return nil, fmt.Errorf("load OpenAPI schemas '%s': %v", path, err)
+	}
+	resources, err := openapi.NewOpenAPIData(doc)
+	if err != nil {
+		return nil, fmt.Errorf("load OpenAPI schemas '%s': %v", path, err)
+	}
+	return resources, nil
+}
+
+// NormalizeKubernetesVersion returns '<major>.<minor>' for versions like 'v1.17.3' or '1.17'.
+func NormalizeKubernetesVersion(version string) (string, error) {
+	parts := strings.Split(strings.TrimPrefix(strings.TrimSpace(version), "v"), ".")
+	if len(parts) < 2 || parts[0] == "" || parts[1] == "" {
+		return "", fmt.Errorf("bad Kubernetes version '%s', '<major>.<minor>' is expected", version)
+	}
+	return parts[0] + "." + parts[1], nil
+}
+
+var validator *Validator
+
+// Init configures validation of rendered manifests with OpenAPI schemas from the source.
+func Init(source string, schemasDir string, kubernetesVersion string, client discovery.OpenAPISchemaInterface) error {
+	validator = nil
+	switch source {
+	case app.ManifestsValidationNone, "":
+		return nil
+	case app.ManifestsValidationCluster:
+		validator = NewClusterValidator(client)
+		return nil
+	case app.ManifestsValidationFiles:
+		v, err := NewFilesValidator(schemasDir, kubernetesVersion)
+		if err != nil {
+			return err
+		}
+		validator = v
+		return nil
+	}
+	return fmt.Errorf("unknown source of OpenAPI schemas '%s'", source)
+}
+
+// Enabled returns true if rendered manifests should be validated.
+func Enabled() bool {
+	return validator != nil
+}
+
+// Validate checks manifests with the configured validator. It does nothing if validation is disabled.
+func Validate(manifests string) error {
+	if validator == nil {
+		return nil
+	}
+	return validator.Validate(manifests)
+}
@@ -0,0 +1,143 @@
+package manifests_validator
+
+import (
+	"fmt"
+	"strings"
+
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/kubectl/pkg/util/openapi"
+	"k8s.io/kubectl/pkg/util/openapi/validation"
+	"sigs.k8s.io/yaml"
+
+	"github.com/flant/addon-operator/pkg/utils"
+)
+
+// Validator checks rendered manifests against OpenAPI schemas of Kubernetes resources.
+// Resources with kinds absent in schemas, e.g. custom resources, are not validated.
+type Validator struct {
+	resources func() (openapi.Resources, error)
+	// refresh drops cached schemas and returns true if invalid manifests should be
+	// validated again with the fresh schemas. It is nil for static schemas.
+	refresh func() bool
+}
+
+// NewValidator returns a validator for the OpenAPI schemas.
+func NewValidator(resources openapi.Resources) *Validator {
+	return &Validator{
+		resources: func() (openapi.Resources, error) {
+			return resources, nil
+		},
+	}
+}
+
+// ResourceError contains validation errors of the resource.
+type ResourceError struct {
+	Kind      string
+	Namespace string
+	Name      string
+	// Source is a template path from the '# Source:' comment of the Helm manifest.
+	Source string
+	Errors []string
+}
+
+func (e ResourceError) String() string {
+	name := e.Name
+	if e.Namespace != "" {
+		name = e.Namespace + "/" + name
+	}
+	res := fmt.Sprintf("%s '%s'", e.Kind, name)
+	if e.Source != "" {
+		res += fmt.Sprintf(" from '%s'", e.Source)
+	}
+	return res + ": " + strings.Join(e.Errors, "; ")
+}
+
+// Error is returned if some resources are invalid.
+type Error struct {
+	Resources []ResourceError
+}
+
+func (e *Error) Error() string {
+	lines := make([]string, 0, len(e.Resources)+1)
+	lines = append(lines, fmt.Sprintf("%d invalid resources:", len(e.Resources)))
+	for _, res := range e.Resources {
+		lines = append(lines, "- "+res.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Validate checks every document of the multi-document YAML and returns an *Error
+// with errors of each invalid resource.
+func (v *Validator) Validate(manifests string) error {
+	err := v.validate(manifests)
+	if _, invalid := err.(*Error); invalid && v.refresh != nil && v.refresh() {
+		// Cached schemas can be outdated after an upgrade of the API server.
+		return v.validate(manifests)
+	}
+	return err
+}
+
+func (v *Validator) validate(manifests string) error {
+	resources, err := v.resources()
+	if err != nil {
+		return fmt.Errorf("get OpenAPI schemas: %v", err)
+	}
+	schemaValidation := validation.NewSchemaValidation(resources)
+
+	var invalid []ResourceError
+	for _, doc := range utils.SplitYamlDocuments(manifests) {
+		obj := make(map[string]interface{})
+		err := yaml.Unmarshal([]byte(doc), &obj)
+		if err != nil {
+			invalid = append(invalid, ResourceError{
+				Source: templateSource(doc),
+				Errors: []string{fmt.Sprintf("bad YAML: %v", err)},
+			})
+			continue
+		}
+		if len(obj) == 0 {
+			continue
+		}
+
+		err = schemaValidation.ValidateBytes([]byte(doc))
+		if err == nil {
+			continue
+		}
+		resErr := resourceError(obj)
+		resErr.Source = templateSource(doc)
+		if agg, ok := err.(utilerrors.Aggregate); ok {
+			for _, e := range agg.Errors() {
+				resErr.Errors = append(resErr.Errors, e.Error())
+			}
+		} else {
+			resErr.Errors = []string{err.Error()}
+		}
+		invalid = append(invalid, resErr)
+	}
+
+	if len(invalid) > 0 {
+		return &Error{Resources: invalid}
+	}
+	return nil
+}
+
+func resourceError(obj map[string]interface{}) ResourceError {
+	res := ResourceError{}
+	res.Kind, _ = obj["kind"].(string)
+	if metadata, ok := obj["metadata"].(map[string]interface{}); ok {
+		res.Name, _ = metadata["name"].(string)
+		res.Namespace, _ = metadata["namespace"].(string)
+	}
+	return res
+}
+
+// templateSource returns a path from the '# Source:' comment added by helm template.
+func templateSource(doc string) string {
+	for _, line := range strings.Split(doc, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "# Source:") {
+			return strings.TrimSpace(strings.TrimPrefix(line, "# Source:"))
+		}
+	}
+	return ""
+}
@@ -0,0 +1,182 @@
+package manifests_validator
+
+import (
+	"fmt"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	openapi_v2 "github.com/googleapis/gnostic/OpenAPIv2"
+	"github.com/googleapis/gnostic/compiler"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/flant/addon-operator/pkg/app"
+)
+
+const testManifests = `
+---
+# Source: module/templates/deploy.yaml
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+  namespace: ns
+spec:
+  replicas: "2"
+  selector:
+    app: app
+  pausd: true
+---
+# Source: module/templates/cm.yaml
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: valid
+data:
+  key: value
+---
+# Source: module/templates/empty.yaml
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: no-selector
+spec:
+  replicas: 1
+---
+apiVersion: example.com/v1
+kind: Custom
+metadata:
+  name: custom
+spec:
+  anything: 1
+`
+
+func Test_Validator_Validate(t *testing.T) {
+	v, err := NewFilesValidator("testdata", "v1.17.3")
+	require.NoError(t, err)
+
+	err = v.Validate(testManifests)
+	require.Error(t, err)
+	validationErr, ok := err.(*Error)
+	require.True(t, ok, "should return *Error, got %T", err)
+	require.Len(t, validationErr.Resources, 2, "valid resources and resources without schemas should be skipped")
+
+	deploy := validationErr.Resources[0]
+	assert.Equal(t, "Deployment", deploy.Kind)
+	assert.Equal(t, "ns", deploy.Namespace)
+	assert.Equal(t, "app", deploy.Name)
+	assert.Equal(t, "module/templates/deploy.yaml", deploy.Source)
+	require.Len(t, deploy.Errors, 2)
+	assert.Contains(t, deploy.Errors[0]+deploy.Errors[1], `invalid type for io.k8s.api.apps.v1.DeploymentSpec.replicas: got "string", expected "integer"`)
+	assert.Contains(t, deploy.Errors[0]+deploy.Errors[1], `unknown field "pausd"`)
+
+	noSelector := validationErr.Resources[1]
+	assert.Equal(t, "no-selector", noSelector.Name)
+	assert.Equal(t, "", noSelector.Source)
+	assert.Contains(t, noSelector.Errors[0], `missing required field "selector"`)
+
+	assert.Contains(t, err.Error(), "2 invalid resources:\n- Deployment 'ns/app' from 'module/templates/deploy.yaml': ")
+
+	assert.NoError(t, v.Validate("apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: cm\n"))
+}
+
+func Test_NewFilesValidator(t *testing.T) {
+	_, err := NewFilesValidator("testdata", "1.16")
+	assert.Error(t, err, "schemas for the version are absent")
+	_, err = NewFilesValidator("testdata", "")
+	assert.Error(t, err)
+
+	version, err := NormalizeKubernetesVersion("1.17")
+	require.NoError(t, err)
+	assert.Equal(t, "1.17", version)
+}
+
+type openAPISchemaStub struct {
+	calls int
+	err   error
+	doc   *openapi_v2.Document
+}
+
+func (s *openAPISchemaStub) OpenAPISchema() (*openapi_v2.Document, error) {
+	s.calls++
+	if s.err != nil {
+		return nil, s.err
+	}
+	if s.doc != nil {
+		return s.doc, nil
+	}
+	return &openapi_v2.Document{}, nil
+}
+
+// stubTime sets the time returned by timeNow and returns a function to move it forward.
+func stubTime() func(d time.Duration) {
+	now := time.Now()
+	timeNow = func() time.Time { return now }
+	return func(d time.Duration) { now = now.Add(d) }
+}
+
+func loadTestDocument(t *testing.T) *openapi_v2.Document {
+	data, err := ioutil.ReadFile("testdata/1.17.json")
+	require.NoError(t, err)
+	info, err := compiler.ReadInfoFromBytes("1.17.json", data)
+	require.NoError(t, err)
+	doc, err := openapi_v2.NewDocument(info, compiler.NewContext("$root", nil))
+	require.NoError(t, err)
+	return doc
+}
+
+func Test_NewClusterValidator(t *testing.T) {
+	stub := &openAPISchemaStub{err: fmt.Errorf("connection refused")}
+	v := NewClusterValidator(stub)
+
+	assert.EqualError(t, v.Validate(testManifests), "get OpenAPI schemas: connection refused")
+
+	// Schemas are cached after the successful fetch.
+	stub.err = nil
+	assert.NoError(t, v.Validate(testManifests), "resources without schemas should be skipped")
+	assert.NoError(t, v.Validate(testManifests))
+	assert.Equal(t, 2, stub.calls)
+}
+
+func Test_NewClusterValidator_Refresh(t *testing.T) {
+	defer func() { timeNow = time.Now }()
+	advance := stubTime()
+
+	stub := &openAPISchemaStub{doc: loadTestDocument(t)}
+	v := NewClusterValidator(stub)
+
+	// Fresh schemas are not fetched again on failed validation.
+	assert.Error(t, v.Validate(testManifests))
+	assert.Error(t, v.Validate(testManifests))
+	assert.Equal(t, 1, stub.calls)
+
+	// Failed validation refreshes schemas older than ClusterSchemasMinRefreshInterval.
+	advance(ClusterSchemasMinRefreshInterval)
+	stub.doc = nil
+	assert.NoError(t, v.Validate(testManifests), "manifests should be valid with refreshed schemas")
+	assert.Equal(t, 2, stub.calls)
+
+	// Schemas are fetched again after ClusterSchemasTTL.
+	advance(ClusterSchemasTTL - time.Second)
+	assert.NoError(t, v.Validate(testManifests))
+	assert.Equal(t, 2, stub.calls)
+	advance(time.Second)
+	assert.NoError(t, v.Validate(testManifests))
+	assert.Equal(t, 3, stub.calls)
+}
+
+func Test_Init(t *testing.T) {
+	defer Init(app.ManifestsValidationNone, "", "", nil)
+
+	require.NoError(t, Init(app.ManifestsValidationNone, "", "", nil))
+	assert.False(t, Enabled())
+	assert.NoError(t, Validate(testManifests))
+
+	require.NoError(t, Init(app.ManifestsValidationFiles, "testdata", "1.17", nil))
+	assert.True(t, Enabled())
+	assert.Error(t, Validate(testManifests))
+
+	assert.Error(t, Init("unknown", "", "", nil))
+}
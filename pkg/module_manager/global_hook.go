@@ -140,6 +140,7 @@ func (h *GlobalHook) Run(bindingType BindingType, context []BindingContext, logL
 
 	globalHookExecutor := NewHookExecutor(h, context, h.Config.Version)
 	globalHookExecutor.WithLogLabels(logLabels)
+	globalHookExecutor.WithHelm(h.moduleManager.helm)
 	patches, metrics, err := globalHookExecutor.Run()
 	if err != nil {
 		return fmt.Errorf("global hook '%s' failed: %s", h.Name, err)
@@ -153,15 +154,9 @@ func (h *GlobalHook) Run(bindingType BindingType, context []BindingContext, logL
 		return err
 	}
 
-	//h.moduleManager.ValuesLock.Lock()
-	//defer h.moduleManager.ValuesLock.Unlock()
-
 	configValuesPatch, has := patches[utils.ConfigMapPatch]
 	if has && configValuesPatch != nil {
-		preparedConfigValues := utils.MergeValues(
-			utils.Values{"global": map[string]interface{}{}},
-			h.moduleManager.kubeGlobalConfigValues,
-		)
+		preparedConfigValues := h.moduleManager.GlobalConfigValues()
 
 		configValuesPatchResult, err := h.handleGlobalValuesPatch(preparedConfigValues, *configValuesPatch)
 		if err != nil {
@@ -171,12 +166,14 @@ func (h *GlobalHook) Run(bindingType BindingType, context []BindingContext, logL
 		if configValuesPatchResult != nil && configValuesPatchResult.ValuesChanged {
 			err := h.moduleManager.kubeConfigManager.SetKubeGlobalValues(configValuesPatchResult.Values)
 			if err != nil {
-				log.Debugf("Global hook '%s' kube config global values stay unchanged:\n%s", h.Name, h.moduleManager.kubeGlobalConfigValues.DebugString())
+				log.Debugf("Global hook '%s' kube config global values stay unchanged:\n%s", h.Name, preparedConfigValues.DebugString())
 				return fmt.Errorf("global hook '%s': set kube config failed: %s", h.Name, err)
 			}
 
+			h.moduleManager.ValuesLock.Lock()
 			h.moduleManager.kubeGlobalConfigValues = configValuesPatchResult.Values
-			log.Debugf("Global hook '%s': kube config global values updated:\n%s", h.Name, h.moduleManager.kubeGlobalConfigValues.DebugString())
+			h.moduleManager.ValuesLock.Unlock()
+			log.Debugf("Global hook '%s': kube config global values updated:\n%s", h.Name, configValuesPatchResult.Values.DebugString())
 		}
 	}
 
@@ -193,7 +190,9 @@ func (h *GlobalHook) Run(bindingType BindingType, context []BindingContext, logL
 		// MemoryValuesPatch from global hook can contains patches for *Enabled keys
 		// and no patches for 'global' section — valuesPatchResult will be nil in this case.
 		if valuesPatchResult != nil && valuesPatchResult.ValuesChanged {
+			h.moduleManager.ValuesLock.Lock()
 			h.moduleManager.globalDynamicValuesPatches = utils.AppendValuesPatch(h.moduleManager.globalDynamicValuesPatches, valuesPatchResult.ValuesPatch)
+			h.moduleManager.ValuesLock.Unlock()
 			newGlobalValues, err := h.moduleManager.GlobalValues()
 			if err != nil {
 				return fmt.Errorf("global hook '%s': global values after patch apply: %s", h.Name, err)
@@ -9,6 +9,7 @@ import (
 	. "github.com/flant/addon-operator/pkg/hook/types"
 	. "github.com/flant/shell-operator/pkg/hook/types"
 
+	"github.com/flant/addon-operator/pkg/task"
 	"github.com/flant/addon-operator/sdk"
 	"github.com/flant/shell-operator/pkg/hook"
 	"github.com/flant/shell-operator/pkg/hook/config"
@@ -27,6 +28,9 @@ type GlobalHookConfig struct {
 	// effective config values
 	BeforeAll *BeforeAllConfig
 	AfterAll  *AfterAllConfig
+
+	// retry policies for failed hook tasks by binding name or binding type
+	RetryPolicies map[string]*task.RetryPolicyConfig
 }
 
 type BeforeAllConfig struct {
@@ -40,10 +44,33 @@ type AfterAllConfig struct {
 }
 
 type GlobalHookConfigV0 struct {
-	BeforeAll interface{} `json:"beforeAll"`
-	AfterAll  interface{} `json:"afterAll"`
+	BeforeAll   interface{}                        `json:"beforeAll"`
+	AfterAll    interface{}                        `json:"afterAll"`
+	RetryPolicy map[string]*task.RetryPolicyConfig `json:"retryPolicy"`
 }
 
+// retryPolicySchema is a schema for retryPolicy property in global and module hooks configuration.
+const retryPolicySchema = `
+  retryPolicy:
+    type: object
+    additionalProperties:
+      type: object
+      additionalProperties: false
+      properties:
+        initialDelay:
+          type: string
+          example: 5s
+        maxDelay:
+          type: string
+          example: 5m
+        multiplier:
+          type: number
+          example: 2
+        jitter:
+          type: number
+          example: 0.1
+`
+
 func GetGlobalHookConfigSchema(version string) *spec.Schema {
 	globalHookVersion := "global-hook-" + version
 	if _, ok := config.Schemas[globalHookVersion]; !ok {
@@ -70,6 +97,7 @@ func GetGlobalHookConfigSchema(version string) *spec.Schema {
     example: 10    
 `
 		}
+		schema += retryPolicySchema
 		config.Schemas[globalHookVersion] = schema
 	}
 
@@ -147,6 +175,11 @@ func (c *GlobalHookConfig) ConvertAndCheckV0() (err error) {
 		return err
 	}
 
+	c.RetryPolicies, err = ConvertRetryPolicies(c.GlobalV0.RetryPolicy)
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -161,9 +194,49 @@ func (c *GlobalHookConfig) ConvertAndCheckV1() (err error) {
 		return err
 	}
 
+	c.RetryPolicies, err = ConvertRetryPolicies(c.GlobalV1.RetryPolicy)
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
+// ConvertRetryPolicies checks retry policies from hook configuration.
+func ConvertRetryPolicies(value map[string]*task.RetryPolicyConfig) (map[string]*task.RetryPolicyConfig, error) {
+	for name, cfg := range value {
+		if _, err := task.DefaultRetryPolicy.WithConfig(cfg); err != nil {
+			return nil, fmt.Errorf("invalid retryPolicy for '%s': %v", name, err)
+		}
+	}
+	return value, nil
+}
+
+// NewRetryPoliciesFromGoConfig converts retry policies from Go hook configuration.
+func NewRetryPoliciesFromGoConfig(input map[string]sdk.RetryPolicyConfig) map[string]*task.RetryPolicyConfig {
+	if len(input) == 0 {
+		return nil
+	}
+	res := make(map[string]*task.RetryPolicyConfig, len(input))
+	for name, cfg := range input {
+		res[name] = &task.RetryPolicyConfig{
+			InitialDelay: cfg.InitialDelay,
+			MaxDelay:     cfg.MaxDelay,
+			Multiplier:   cfg.Multiplier,
+			Jitter:       cfg.Jitter,
+		}
+	}
+	return res
+}
+
+// RetryPolicyConfigForBinding returns a retry policy for binding name or binding type.
+func RetryPolicyConfigForBinding(policies map[string]*task.RetryPolicyConfig, bindingName string, bindingType BindingType) *task.RetryPolicyConfig {
+	if cfg, ok := policies[bindingName]; ok && bindingName != "" {
+		return cfg
+	}
+	return policies[string(bindingType)]
+}
+
 func (c *GlobalHookConfig) ConvertBeforeAll(value interface{}) (*BeforeAllConfig, error) {
 	floatValue, err := hook.ConvertFloatForBinding(value, "beforeAll")
 	if err != nil || floatValue == nil {
@@ -248,6 +321,8 @@ func NewGlobalHookConfigFromGoConfig(input *sdk.HookConfig) *GlobalHookConfig {
 		cfg.AfterAll.Order = input.OnAfterAll.Order
 	}
 
+	cfg.RetryPolicies = NewRetryPoliciesFromGoConfig(input.RetryPolicy)
+
 	return cfg
 }
 
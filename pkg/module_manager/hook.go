@@ -267,79 +267,91 @@ func (mm *moduleManager) RegisterGlobalHooks() error {
 	log.Debugf("Found %d global hooks", len(hooks))
 
 	for _, globalHook := range hooks {
-		logEntry := log.WithField("hook", globalHook.Name).
-			WithField("hook.type", "global")
+		err := mm.initGlobalHook(globalHook)
+		if err != nil {
+			return err
+		}
 
-		var yamlConfigBytes []byte
-		var goConfig *sdk.HookConfig
+		// register global hook in indexes
+		for _, binding := range globalHook.Config.Bindings() {
+			mm.globalHooksOrder[binding] = append(mm.globalHooksOrder[binding], globalHook)
+		}
+		mm.globalHooksByName[globalHook.Name] = globalHook
+	}
 
-		if globalHook.GoHook != nil {
-			goConfig = globalHook.GoHook.Config()
-			if goConfig.YamlConfig != "" {
-				yamlConfigBytes = []byte(goConfig.YamlConfig)
-			}
-		} else {
-			yamlConfigBytes, err = NewHookExecutor(globalHook, nil, "").Config()
-			if err != nil {
-				logEntry.Errorf("Run --config: %s", err)
-				return fmt.Errorf("global hook --config run problem")
-			}
+	return nil
+}
+
+// initGlobalHook runs hook with --config, creates hook controller for bindings and updates binding_count metric.
+func (mm *moduleManager) initGlobalHook(globalHook *GlobalHook) (err error) {
+	logEntry := log.WithField("hook", globalHook.Name).
+		WithField("hook.type", "global")
+
+	var yamlConfigBytes []byte
+	var goConfig *sdk.HookConfig
+
+	if globalHook.GoHook != nil {
+		goConfig = globalHook.GoHook.Config()
+		if goConfig.YamlConfig != "" {
+			yamlConfigBytes = []byte(goConfig.YamlConfig)
 		}
+	} else {
+		configExecutor := NewHookExecutor(globalHook, nil, "")
+		configExecutor.WithHelm(mm.helm)
+		yamlConfigBytes, err = configExecutor.Config()
+		if err != nil {
+			logEntry.Errorf("Run --config: %s", err)
+			return fmt.Errorf("global hook --config run problem")
+		}
+	}
 
-		if len(yamlConfigBytes) > 0 {
-			err = globalHook.WithConfig(yamlConfigBytes)
+	if len(yamlConfigBytes) > 0 {
+		err = globalHook.WithConfig(yamlConfigBytes)
+		if err != nil {
+			logEntry.Errorf("Hook return bad config: %s", err)
+			return fmt.Errorf("global hook return bad config")
+		}
+	} else {
+		if goConfig != nil {
+			err := globalHook.WithGoConfig(goConfig)
 			if err != nil {
 				logEntry.Errorf("Hook return bad config: %s", err)
 				return fmt.Errorf("global hook return bad config")
 			}
-		} else {
-			if goConfig != nil {
-				err := globalHook.WithGoConfig(goConfig)
-				if err != nil {
-					logEntry.Errorf("Hook return bad config: %s", err)
-					return fmt.Errorf("global hook return bad config")
-				}
-			}
 		}
+	}
 
-		globalHook.WithModuleManager(mm)
-
-		// Add hook info as log labels
-		for _, kubeCfg := range globalHook.Config.OnKubernetesEvents {
-			kubeCfg.Monitor.Metadata.LogLabels["hook"] = globalHook.Name
-			kubeCfg.Monitor.Metadata.LogLabels["hook.type"] = "global"
-			kubeCfg.Monitor.Metadata.MetricLabels = map[string]string{
-				"hook":    globalHook.Name,
-				"binding": kubeCfg.BindingName,
-				"module":  "", // empty "module" label for label set consistency with module hooks
-				"queue":   kubeCfg.Queue,
-				"kind":    kubeCfg.Monitor.Kind,
-			}
+	globalHook.WithModuleManager(mm)
+
+	// Add hook info as log labels
+	for _, kubeCfg := range globalHook.Config.OnKubernetesEvents {
+		kubeCfg.Monitor.Metadata.LogLabels["hook"] = globalHook.Name
+		kubeCfg.Monitor.Metadata.LogLabels["hook.type"] = "global"
+		kubeCfg.Monitor.Metadata.MetricLabels = map[string]string{
+			"hook":    globalHook.Name,
+			"binding": kubeCfg.BindingName,
+			"module":  "", // empty "module" label for label set consistency with module hooks
+			"queue":   kubeCfg.Queue,
+			"kind":    kubeCfg.Monitor.Kind,
 		}
+	}
 
-		hookCtrl := controller.NewHookController()
-		hookCtrl.InitKubernetesBindings(globalHook.Hook.Config.OnKubernetesEvents, mm.kubeEventsManager)
-		hookCtrl.InitScheduleBindings(globalHook.Config.Schedules, mm.scheduleManager)
-
-		globalHook.WithHookController(hookCtrl)
-		globalHook.WithTmpDir(mm.TempDir)
+	hookCtrl := controller.NewHookController()
+	hookCtrl.InitKubernetesBindings(globalHook.Hook.Config.OnKubernetesEvents, mm.kubeEventsManager)
+	hookCtrl.InitScheduleBindings(globalHook.Config.Schedules, mm.scheduleManager)
 
-		// register global hook in indexes
-		for _, binding := range globalHook.Config.Bindings() {
-			mm.globalHooksOrder[binding] = append(mm.globalHooksOrder[binding], globalHook)
-		}
-		mm.globalHooksByName[globalHook.Name] = globalHook
+	globalHook.WithHookController(hookCtrl)
+	globalHook.WithTmpDir(mm.TempDir)
 
-		logEntry.Infof("Global hook '%s' successfully run with --config. Register with bindings: %s", globalHook.Name, globalHook.GetConfigDescription())
+	logEntry.Infof("Global hook '%s' successfully run with --config. Register with bindings: %s", globalHook.Name, globalHook.GetConfigDescription())
 
-		mm.metricStorage.GaugeSet(
-			"{PREFIX}binding_count",
-			float64(globalHook.Config.BindingsCount()),
-			map[string]string{
-				"hook":   globalHook.Name,
-				"module": "", // empty "module" label for label set consistency with module hooks
-			})
-	}
+	mm.metricStorage.GaugeSet(
+		"{PREFIX}binding_count",
+		float64(globalHook.Config.BindingsCount()),
+		map[string]string{
+			"hook":   globalHook.Name,
+			"module": "", // empty "module" label for label set consistency with module hooks
+		})
 
 	return nil
 }
@@ -375,7 +387,9 @@ func (mm *moduleManager) RegisterModuleHooks(module *Module, logLabels map[strin
 				yamlConfigBytes = []byte(goConfig.YamlConfig)
 			}
 		} else {
-			yamlConfigBytes, err = NewHookExecutor(moduleHook, nil, "").Config()
+			configExecutor := NewHookExecutor(moduleHook, nil, "")
+			configExecutor.WithHelm(mm.helm)
+			yamlConfigBytes, err = configExecutor.Config()
 			if err != nil {
 				hookLogEntry.Errorf("Run --config: %s", err)
 				return fmt.Errorf("module hook --config run problem")
@@ -438,10 +452,9 @@ func (mm *moduleManager) RegisterModuleHooks(module *Module, logLabels map[strin
 	}
 
 	// Save registered hooks in mm.modulesHooksOrderByName
-	if mm.modulesHooksOrderByName[module.Name] == nil {
-		mm.modulesHooksOrderByName[module.Name] = make(map[BindingType][]*ModuleHook)
-	}
+	mm.indexLock.Lock()
 	mm.modulesHooksOrderByName[module.Name] = registeredModuleHooks
+	mm.indexLock.Unlock()
 
 	return nil
 }
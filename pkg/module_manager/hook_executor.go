@@ -28,6 +28,8 @@ type HookExecutor struct {
 	ValuesPatchPath       string
 	MetricsPath           string
 	LogLabels             map[string]string
+	// Helm provides environment for helm binary to run it from hooks.
+	Helm *helm.Helm
 }
 
 func NewHookExecutor(h Hook, context []BindingContext, configVersion string) *HookExecutor {
@@ -43,6 +45,18 @@ func (e *HookExecutor) WithLogLabels(logLabels map[string]string) {
 	e.LogLabels = logLabels
 }
 
+func (e *HookExecutor) WithHelm(h *helm.Helm) {
+	e.Helm = h
+}
+
+// helmEnv returns environment variables for helm binary.
+func (e *HookExecutor) helmEnv() []string {
+	if e.Helm == nil {
+		return nil
+	}
+	return e.Helm.NewClient().CommandEnv()
+}
+
 func (e *HookExecutor) Run() (patches map[utils.ValuesPatchType]*utils.ValuesPatch, metrics []metric_operation.MetricOperation, err error) {
 	if e.Hook.GetGoHook() != nil {
 		return e.RunGoHook()
@@ -82,7 +96,7 @@ func (e *HookExecutor) Run() (patches map[utils.ValuesPatchType]*utils.ValuesPat
 	for envName, filePath := range tmpFiles {
 		envs = append(envs, fmt.Sprintf("%s=%s", envName, filePath))
 	}
-	envs = append(envs, helm.NewClient().CommandEnv()...)
+	envs = append(envs, e.helmEnv()...)
 
 	cmd := executor.MakeCommand("", e.Hook.GetPath(), []string{}, envs)
 
@@ -149,7 +163,7 @@ func (e *HookExecutor) Config() (configOutput []byte, err error) {
 
 	envs := []string{}
 	envs = append(envs, os.Environ()...)
-	envs = append(envs, helm.NewClient().CommandEnv()...)
+	envs = append(envs, e.helmEnv()...)
 
 	cmd := executor.MakeCommand("", e.Hook.GetPath(), []string{"--config"}, envs)
 
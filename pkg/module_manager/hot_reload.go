@@ -0,0 +1,344 @@
+package module_manager
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	log "github.com/sirupsen/logrus"
+
+	. "github.com/flant/shell-operator/pkg/hook/types"
+
+	"github.com/flant/addon-operator/pkg/utils"
+)
+
+// DirectoriesChanges describes changes in global hooks and modules directories.
+type DirectoriesChanges struct {
+	// New or changed global hooks.
+	GlobalHooks []string
+	// Enabled modules with changed content. These modules should be run again.
+	Modules []string
+	// Modules are added or removed, or their order or enabled state can be changed.
+	DiscoveryNeeded bool
+}
+
+func (c *DirectoriesChanges) IsEmpty() bool {
+	return len(c.GlobalHooks) == 0 && len(c.Modules) == 0 && !c.DiscoveryNeeded
+}
+
+// globalHookChecksum returns a checksum of a shell hook file. Go hooks are compiled in, so they are never changed.
+func globalHookChecksum(globalHook *GlobalHook) (string, error) {
+	if globalHook.GoHook != nil {
+		return "", nil
+	}
+	return utils.CalculateChecksumOfFile(globalHook.Path)
+}
+
+// moduleChecksum returns a checksum of module's directory content.
+func moduleChecksum(module *Module) (string, error) {
+	checksum, err := utils.CalculateChecksumOfDirectory(module.Path)
+	if err != nil {
+		return "", err
+	}
+	return utils.CalculateStringsChecksum(module.Path, checksum), nil
+}
+
+// moduleEnabledChecksum returns a checksum of static enabled flags and 'enabled' script.
+func moduleEnabledChecksum(module *Module) (string, error) {
+	scriptChecksum := ""
+	scriptPath := filepath.Join(module.Path, "enabled")
+	if _, err := os.Stat(scriptPath); err == nil {
+		scriptChecksum, err = utils.CalculateChecksumOfFile(scriptPath)
+		if err != nil {
+			return "", err
+		}
+	}
+	return utils.CalculateStringsChecksum(scriptChecksum, module.CommonStaticConfig.GetEnabled(), module.StaticConfig.GetEnabled()), nil
+}
+
+// commonStaticValuesChecksum returns a checksum of modules/values.yaml or an empty string if file is not exists.
+func (mm *moduleManager) commonStaticValuesChecksum() (string, error) {
+	valuesPath := filepath.Join(mm.ModulesDir, "values.yaml")
+	if _, err := os.Stat(valuesPath); os.IsNotExist(err) {
+		return "", nil
+	}
+	return utils.CalculateChecksumOfFile(valuesPath)
+}
+
+// saveDirectoriesChecksums saves checksums of registered global hooks and modules
+// to detect changes in ReloadDirectories.
+func (mm *moduleManager) saveDirectoriesChecksums() (err error) {
+	mm.globalHooksChecksums = make(map[string]string)
+	for name, globalHook := range mm.globalHooksByName {
+		mm.globalHooksChecksums[name], err = globalHookChecksum(globalHook)
+		if err != nil {
+			return fmt.Errorf("calculate checksum for global hook '%s': %v", name, err)
+		}
+	}
+
+	mm.modulesChecksums = make(map[string]string)
+	for name, module := range mm.allModulesByName {
+		mm.modulesChecksums[name], err = moduleChecksum(module)
+		if err != nil {
+			return fmt.Errorf("calculate checksum for module '%s': %v", name, err)
+		}
+	}
+
+	mm.commonStaticValuesChecksumValue, err = mm.commonStaticValuesChecksum()
+	return err
+}
+
+// ReloadDirectories searches for changes in global hooks and modules directories.
+// Changed global hooks are registered again with --config, their bindings should be
+// enabled by the caller. Changed modules get new static values, settings and hooks,
+// their bindings are disabled and module state is reset, so the next ModuleRun
+// will execute onStartup hooks and Synchronization.
+func (mm *moduleManager) ReloadDirectories(logLabels map[string]string) (*DirectoriesChanges, error) {
+	logEntry := log.WithFields(utils.LabelsToLogFields(logLabels)).
+		WithField("operator.component", "moduleManager.reloadDirectories")
+
+	res := &DirectoriesChanges{}
+
+	var err error
+	res.GlobalHooks, err = mm.reloadGlobalHooks(logEntry)
+	if err != nil {
+		return nil, err
+	}
+
+	res.Modules, res.DiscoveryNeeded, err = mm.reloadModules(logEntry, logLabels)
+	if err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (mm *moduleManager) reloadGlobalHooks(logEntry *log.Entry) ([]string, error) {
+	hooks, err := SearchGlobalHooks(mm.GlobalHooksDir)
+	if err != nil {
+		return nil, err
+	}
+
+	checksums := make(map[string]string)
+	actualHooks := make([]*GlobalHook, 0, len(hooks))
+	changed := make([]string, 0)
+
+	// Run --config for new and changed hooks. Current hooks are not touched on error.
+	for _, globalHook := range hooks {
+		checksum, err := globalHookChecksum(globalHook)
+		if err != nil {
+			return nil, fmt.Errorf("calculate checksum for global hook '%s': %v", globalHook.Name, err)
+		}
+		checksums[globalHook.Name] = checksum
+
+		current, has := mm.globalHooksByName[globalHook.Name]
+		if has && mm.globalHooksChecksums[globalHook.Name] == checksum {
+			actualHooks = append(actualHooks, current)
+			continue
+		}
+
+		err = mm.initGlobalHook(globalHook)
+		if err != nil {
+			return nil, err
+		}
+		actualHooks = append(actualHooks, globalHook)
+		changed = append(changed, globalHook.Name)
+	}
+
+	// Disable bindings of removed and changed hooks.
+	for name, globalHook := range mm.globalHooksByName {
+		if checksum, has := checksums[name]; has && checksum == mm.globalHooksChecksums[name] {
+			continue
+		}
+		globalHook.HookController.StopMonitors()
+		globalHook.HookController.DisableScheduleBindings()
+		if _, has := checksums[name]; has {
+			logEntry.Infof("Global hook '%s' is changed", name)
+		} else {
+			logEntry.Infof("Global hook '%s' is removed", name)
+		}
+	}
+
+	globalHooksOrder := make(map[BindingType][]*GlobalHook)
+	globalHooksByName := make(map[string]*GlobalHook)
+	for _, globalHook := range actualHooks {
+		for _, binding := range globalHook.Config.Bindings() {
+			globalHooksOrder[binding] = append(globalHooksOrder[binding], globalHook)
+		}
+		globalHooksByName[globalHook.Name] = globalHook
+	}
+
+	mm.indexLock.Lock()
+	mm.globalHooksOrder = globalHooksOrder
+	mm.globalHooksByName = globalHooksByName
+	mm.indexLock.Unlock()
+	mm.globalHooksChecksums = checksums
+
+	return changed, nil
+}
+
+func (mm *moduleManager) reloadModules(logEntry *log.Entry, logLabels map[string]string) ([]string, bool, error) {
+	commonChecksum, err := mm.commonStaticValuesChecksum()
+	if err != nil {
+		return nil, false, fmt.Errorf("calculate checksum for common values: %v", err)
+	}
+	commonChanged := commonChecksum != mm.commonStaticValuesChecksumValue
+	if commonChanged {
+		logEntry.Infof("Common values.yaml is changed")
+		mm.commonStaticValues = make(utils.Values)
+		if err := mm.loadCommonStaticValues(); err != nil {
+			return nil, false, fmt.Errorf("load common values for modules: %s", err)
+		}
+	}
+
+	modules, err := SearchModules(mm.ModulesDir)
+	if err != nil {
+		return nil, false, err
+	}
+
+	checksums := make(map[string]string)
+	actualModulesByName := make(map[string]*Module)
+	actualModulesNames := make([]string, 0, len(modules))
+	reloadedModules := make(map[string]*Module)
+	changed := make([]string, 0)
+	discoveryNeeded := commonChanged
+
+	// Load static values and settings for new and changed modules. Current modules are not touched on error.
+	for _, module := range modules {
+		checksum, err := moduleChecksum(module)
+		if err != nil {
+			return nil, false, fmt.Errorf("calculate checksum for module '%s': %v", module.Name, err)
+		}
+		checksums[module.Name] = checksum
+		actualModulesNames = append(actualModulesNames, module.Name)
+
+		current, has := mm.allModulesByName[module.Name]
+		if has && !current.State.Removed && mm.modulesChecksums[module.Name] == checksum && !commonChanged {
+			actualModulesByName[module.Name] = current
+			continue
+		}
+
+		err = mm.initModule(module)
+		if err != nil {
+			return nil, false, err
+		}
+
+		if !has {
+			logEntry.Infof("Module '%s' is added", module.Name)
+			actualModulesByName[module.Name] = module
+			discoveryNeeded = true
+			continue
+		}
+
+		currentEnabled, err := moduleEnabledChecksum(current)
+		if err != nil {
+			return nil, false, err
+		}
+		newEnabled, err := moduleEnabledChecksum(module)
+		if err != nil {
+			return nil, false, err
+		}
+		if current.Path != module.Path || currentEnabled != newEnabled {
+			discoveryNeeded = true
+		}
+		if current.State.Removed {
+			logEntry.Infof("Module '%s' is restored", module.Name)
+			current.State.Removed = false
+			discoveryNeeded = true
+		}
+
+		if mm.modulesChecksums[module.Name] != checksum {
+			logEntry.Infof("Module '%s' is changed", module.Name)
+			changed = append(changed, module.Name)
+		}
+		actualModulesByName[module.Name] = current
+		reloadedModules[module.Name] = module
+	}
+
+	// Removed modules are kept until ModuleDelete runs delete hooks and deletes releases
+	// and inventories, discovery queues ModuleDelete for them. Bindings are disabled:
+	// hook files are removed with the module.
+	for _, name := range mm.allModulesNamesInOrder {
+		if _, has := actualModulesByName[name]; has {
+			continue
+		}
+		module := mm.allModulesByName[name]
+		actualModulesByName[name] = module
+		actualModulesNames = append(actualModulesNames, name)
+		if module.State.Removed {
+			continue
+		}
+		logEntry.Infof("Module '%s' is removed, it is deleted by discovery", name)
+		module.State.Removed = true
+		mm.DisableModuleHooks(name)
+		if mm.HelmResourcesManager != nil {
+			mm.HelmResourcesManager.StopMonitor(name)
+		}
+		discoveryNeeded = true
+	}
+
+	// Indexes are changed only by tasks in the 'main' queue, so reads above do not need the lock.
+	mm.indexLock.Lock()
+	// Keep Module objects to preserve the module state.
+	for name, reloaded := range reloadedModules {
+		module := actualModulesByName[name]
+		module.Path = reloaded.Path
+		module.CommonStaticConfig = reloaded.CommonStaticConfig
+		module.StaticConfig = reloaded.StaticConfig
+		module.Settings = reloaded.Settings
+		module.kind = reloaded.kind
+		module.ResetRenderCache()
+	}
+
+	mm.allModulesByName = actualModulesByName
+	mm.allModulesNamesInOrder = actualModulesNames
+	mm.enabledModulesInOrder = utils.SortByReference(mm.enabledModulesInOrder, actualModulesNames)
+	mm.indexLock.Unlock()
+
+	// Changed module is restarted: hooks are registered again and onStartup hooks are executed.
+	for _, name := range changed {
+		mm.forgetModuleHooks(name)
+		module := actualModulesByName[name]
+		module.State.ResetSynchronization()
+		module.State.OnStartupDone = false
+	}
+
+	mm.modulesChecksums = checksums
+	mm.commonStaticValuesChecksumValue = commonChecksum
+
+	// Register hooks for enabled changed modules. Hooks of disabled modules are registered by discovery.
+	changedEnabled := make([]string, 0)
+	for _, name := range utils.SortByReference(changed, mm.enabledModulesInOrder) {
+		err := mm.RegisterModuleHooks(mm.allModulesByName[name], logLabels)
+		if err != nil {
+			// Force reload on the next try.
+			mm.modulesChecksums[name] = ""
+			return nil, false, err
+		}
+		changedEnabled = append(changedEnabled, name)
+	}
+
+	return changedEnabled, discoveryNeeded, nil
+}
+
+// forgetRemovedModule removes the module removed from the modules directory from indexes.
+// It is called when the module is deleted or if it has nothing to delete.
+func (mm *moduleManager) forgetRemovedModule(moduleName string) {
+	mm.forgetModuleHooks(moduleName)
+	mm.indexLock.Lock()
+	delete(mm.allModulesByName, moduleName)
+	mm.allModulesNamesInOrder = utils.ListSubtract(mm.allModulesNamesInOrder, []string{moduleName})
+	mm.enabledModulesInOrder = utils.ListSubtract(mm.enabledModulesInOrder, []string{moduleName})
+	mm.indexLock.Unlock()
+}
+
+// forgetModuleHooks disables bindings of module hooks and removes them from indexes.
+func (mm *moduleManager) forgetModuleHooks(moduleName string) {
+	if _, registered := mm.modulesHooksOrderByName[moduleName]; !registered {
+		return
+	}
+	mm.DisableModuleHooks(moduleName)
+	mm.indexLock.Lock()
+	delete(mm.modulesHooksOrderByName, moduleName)
+	mm.indexLock.Unlock()
+}
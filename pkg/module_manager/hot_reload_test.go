@@ -0,0 +1,99 @@
+package module_manager
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/flant/addon-operator/pkg/helm"
+	"github.com/flant/addon-operator/pkg/helm/client"
+	"github.com/flant/addon-operator/pkg/helm_resources_manager"
+)
+
+func Test_MainModuleManager_ReloadDirectories(t *testing.T) {
+	rootDir, err := ioutil.TempDir("", "addon-operator-hot-reload-")
+	require.NoError(t, err)
+	defer os.RemoveAll(rootDir)
+
+	modulesDir := filepath.Join(rootDir, "modules")
+	globalHooksDir := filepath.Join(rootDir, "global-hooks")
+	writeFile := func(path string, content string) {
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, ioutil.WriteFile(path, []byte(content), 0644))
+	}
+	writeFile(filepath.Join(modulesDir, "values.yaml"), "module1Enabled: true\nmodule2Enabled: true\n")
+	writeFile(filepath.Join(modulesDir, "001-module-1", "values.yaml"), "module1:\n  param: a\n")
+	writeFile(filepath.Join(modulesDir, "002-module-2", "values.yaml"), "module2:\n  param: a\n")
+	writeFile(filepath.Join(modulesDir, "002-module-2", "Chart.yaml"), "name: module-2\n")
+	require.NoError(t, os.MkdirAll(globalHooksDir, 0755))
+
+	mm := NewMainModuleManager()
+	mm.WithDirectories(modulesDir, globalHooksDir, rootDir)
+	require.NoError(t, mm.RegisterModules())
+	require.NoError(t, mm.RegisterGlobalHooks())
+	require.NoError(t, mm.saveDirectoriesChecksums())
+	mm.enabledModulesInOrder = []string{"module-1", "module-2"}
+	mm.allModulesByName["module-1"].State.OnStartupDone = true
+	mm.allModulesByName["module-2"].State.OnStartupDone = true
+
+	// No changes.
+	changes, err := mm.ReloadDirectories(map[string]string{})
+	require.NoError(t, err)
+	assert.True(t, changes.IsEmpty())
+
+	// Change module values.
+	writeFile(filepath.Join(modulesDir, "001-module-1", "values.yaml"), "module1:\n  param: b\n")
+	changes, err = mm.ReloadDirectories(map[string]string{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"module-1"}, changes.Modules)
+	assert.False(t, changes.DiscoveryNeeded)
+	assert.Equal(t, "b", mm.allModulesByName["module-1"].StaticConfig.Values["module1"].(map[string]interface{})["param"])
+	assert.False(t, mm.allModulesByName["module-1"].State.OnStartupDone)
+	assert.True(t, mm.allModulesByName["module-2"].State.OnStartupDone)
+
+	// Add a module.
+	writeFile(filepath.Join(modulesDir, "003-module-3", "values.yaml"), "module3Enabled: true\n")
+	changes, err = mm.ReloadDirectories(map[string]string{})
+	require.NoError(t, err)
+	assert.Len(t, changes.Modules, 0)
+	assert.True(t, changes.DiscoveryNeeded)
+	assert.Equal(t, []string{"module-1", "module-2", "module-3"}, mm.allModulesNamesInOrder)
+
+	// Remove a module. It is kept until ModuleDelete deletes its release.
+	require.NoError(t, os.RemoveAll(filepath.Join(modulesDir, "002-module-2")))
+	changes, err = mm.ReloadDirectories(map[string]string{})
+	require.NoError(t, err)
+	assert.True(t, changes.DiscoveryNeeded)
+	assert.Equal(t, []string{"module-1", "module-3", "module-2"}, mm.allModulesNamesInOrder)
+	assert.Equal(t, []string{"module-1", "module-2"}, mm.enabledModulesInOrder, "removed module should be disabled by discovery")
+	require.NotNil(t, mm.GetModule("module-2"))
+	assert.True(t, mm.GetModule("module-2").State.Removed)
+
+	changes, err = mm.ReloadDirectories(map[string]string{})
+	require.NoError(t, err)
+	assert.True(t, changes.IsEmpty(), "removed module should be reported once")
+
+	enabled, err := mm.RunModulesEnabledScript([]string{"module-1", "module-2"}, map[string]string{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"module-1"}, enabled)
+
+	stub := &releasesStub{releases: map[string]map[string]string{
+		"module-2": {helm.OwnerLabel: "b", ReleaseModuleLabel: "module-2"},
+	}}
+	mm.WithHelm(&helm.Helm{
+		NewClient: func(_ ...map[string]string) client.HelmClient {
+			return stub
+		},
+		OwnerID: "b",
+	})
+	mm.WithHelmResourcesManager(helm_resources_manager.NewHelmResourcesManager())
+	require.NoError(t, mm.DeleteModule("module-2", map[string]string{}))
+	assert.Empty(t, stub.releases, "release of the removed module should be deleted")
+	assert.Nil(t, mm.GetModule("module-2"))
+	assert.Equal(t, []string{"module-1", "module-3"}, mm.allModulesNamesInOrder)
+	assert.Equal(t, []string{"module-1"}, mm.enabledModulesInOrder)
+}
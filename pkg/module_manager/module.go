@@ -8,12 +8,17 @@ import (
 	"path/filepath"
 	"regexp"
 	"runtime/trace"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/kennygrant/sanitize"
 	log "github.com/sirupsen/logrus"
 	uuid "gopkg.in/satori/go.uuid.v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	. "github.com/flant/addon-operator/pkg/hook/types"
 	. "github.com/flant/shell-operator/pkg/hook/binding_context"
@@ -29,6 +34,8 @@ import (
 	"github.com/flant/addon-operator/pkg/app"
 	"github.com/flant/addon-operator/pkg/helm"
 	"github.com/flant/addon-operator/pkg/helm/client"
+	"github.com/flant/addon-operator/pkg/helm/post_renderer"
+	"github.com/flant/addon-operator/pkg/manifests_validator"
 	"github.com/flant/addon-operator/pkg/utils"
 )
 
@@ -39,6 +46,10 @@ type Module struct {
 	CommonStaticConfig *utils.ModuleConfig
 	// module values from modules/<module name>/values.yaml
 	StaticConfig *utils.ModuleConfig
+	// module settings from modules/<module name>/module.yaml
+	Settings *ModuleSettings
+	// kind is detected when the module is loaded.
+	kind string
 
 	LastReleaseManifests []manifest.Manifest
 
@@ -47,6 +58,26 @@ type Module struct {
 	// There was a successful Run() without values changes
 	IsReady bool
 
+	// Generated release name and a name of the release that is actually used for the module.
+	generatedReleaseName string
+	effectiveReleaseName string
+
+	// Diffs of failed upgrades with deployed revisions by release name, kept for debugging.
+	failedUpgradeDiffsMu sync.Mutex
+	failedUpgradeDiffs   map[string]string
+
+	// Checksums of rendered charts by release name for releases rolled back manually or after failed upgrades.
+	upgradePausesMu sync.Mutex
+	upgradePauses   map[string]string
+
+	// Last diffs between deployed releases and rendered manifests.
+	diffsMu sync.Mutex
+	diffs   []ModuleDiff
+
+	// Rendered charts by release name to skip helm template if the module and values are not changed.
+	renderCacheMu sync.Mutex
+	renderCache   map[string]renderCacheEntry
+
 	moduleManager *moduleManager
 	metricStorage *metric_storage.MetricStorage
 }
@@ -63,13 +94,63 @@ type ModuleState struct {
 
 	// flag to prevent excess monitor starts
 	MonitorsStarted bool
+
+	// Module is failed too many times and ModuleRun is retried in the background.
+	Failed bool
+	// Consecutive ModuleRun failures.
+	FailureCount int
+	// Consecutive failed helm upgrades by release name.
+	UpgradeFailures map[string]int
+	// Time of the first failure in a row.
+	FirstFailureTime time.Time
+	// Error message of the last failure.
+	LastError string
+
+	// Module is paused: ModuleRun and hooks are not executed, bindings are disabled.
+	Paused bool
+	// ModuleDelete is skipped for the paused module. Unpause starts modules discovery to delete the module.
+	DeletePaused bool
+
+	// Module directory is removed by hot reload. Module is disabled and kept in indexes until ModuleDelete succeeds.
+	Removed bool
+
+	// Target namespace of the last successful helm install. Releases are moved when the namespace is changed.
+	Namespace string
+}
+
+// ResetSynchronization resets state of kubernetes bindings and monitors, so next ModuleRun
+// will enable kubernetes bindings, run Synchronization and start monitors again.
+func (s *ModuleState) ResetSynchronization() {
+	s.SynchronizationTasksQueued = false
+	s.ShouldWaitForSynchronization = false
+	s.WaitStarted = false
+	s.SynchronizationDone = false
+	s.MonitorsStarted = false
+}
+
+// SetFailure updates failure counters after ModuleRun failure.
+func (s *ModuleState) SetFailure(err error) {
+	if s.FailureCount == 0 {
+		s.FirstFailureTime = time.Now()
+	}
+	s.FailureCount++
+	s.LastError = err.Error()
+}
+
+// ResetFailure resets failure counters and Failed state.
+func (s *ModuleState) ResetFailure() {
+	s.Failed = false
+	s.FailureCount = 0
+	s.FirstFailureTime = time.Time{}
+	s.LastError = ""
 }
 
 func NewModule(name, path string) *Module {
 	return &Module{
-		Name:  name,
-		Path:  path,
-		State: &ModuleState{},
+		Name:     name,
+		Path:     path,
+		State:    &ModuleState{},
+		Settings: &ModuleSettings{},
 	}
 }
 
@@ -85,6 +166,23 @@ func (m *Module) SafeName() string {
 	return sanitize.BaseName(m.Name)
 }
 
+// Order returns a numeric prefix of the module directory: 300 for "modules/300-prometheus".
+func (m *Module) Order() int {
+	matches := ValidModuleOrderRe.FindStringSubmatch(filepath.Base(m.Path))
+	if matches == nil {
+		return 0
+	}
+	order, _ := strconv.Atoi(matches[1])
+	return order
+}
+
+// HasEnabledScript is true if module has an 'enabled' script. The script gets a list
+// of preceding enabled modules, so the module depends on these modules.
+func (m *Module) HasEnabledScript() bool {
+	_, err := os.Stat(filepath.Join(m.Path, "enabled"))
+	return err == nil
+}
+
 // SynchronizationNeeded is true if module has at least one kubernetes hook
 // with executeHookOnSynchronization.
 func (m *Module) SynchronizationNeeded() bool {
@@ -170,8 +268,28 @@ func (m *Module) Run(logLabels map[string]string) (bool, error) {
 		return false, err
 	}
 
+	treg = trace.StartRegion(context.Background(), "ModuleRun-HelmPhase-crds")
+	err = m.runCRDsInstall(logLabels)
+	treg.End()
+	if err != nil {
+		return false, err
+	}
+
 	treg = trace.StartRegion(context.Background(), "ModuleRun-HelmPhase-helm")
-	err = m.runHelmInstall(logLabels)
+	switch m.Kind() {
+	case ModuleKindHelm:
+		err = m.runHelmInstall(logLabels)
+	case ModuleKindManifests, ModuleKindKustomize:
+		err = m.runManifestsInstall(logLabels)
+	}
+	treg.End()
+	if err != nil {
+		return false, err
+	}
+
+	// Wait for rollout of workloads, so afterHelm hooks and next modules see the ready module.
+	treg = trace.StartRegion(context.Background(), "ModuleRun-HelmPhase-readiness")
+	err = m.waitForReadiness(logLabels)
 	treg.End()
 	if err != nil {
 		return false, err
@@ -187,7 +305,7 @@ func (m *Module) Run(logLabels map[string]string) (bool, error) {
 	return valuesChanged, nil
 }
 
-// Delete removes helm release if it exists and runs afterDeleteHelm hooks.
+// Delete runs beforeDeleteHelm hooks, removes helm release if it exists and runs afterDeleteHelm hooks.
 // It is a handler for MODULE_DELETE task.
 func (m *Module) Delete(logLabels map[string]string) error {
 	defer trace.StartRegion(context.Background(), "ModuleDelete-HelmPhase").End()
@@ -199,57 +317,149 @@ func (m *Module) Delete(logLabels map[string]string) error {
 		})
 	logEntry := log.WithFields(utils.LabelsToLogFields(deleteLogLabels))
 
+	// Hooks can drain workloads or remove finalizers before the release is deleted.
+	// Deletion is aborted on error and ModuleDelete task is retried.
+	err := m.runHooksByBinding(BeforeDeleteHelm, deleteLogLabels)
+	if err != nil {
+		return err
+	}
+
 	// Stop resources monitor before deleting release
 	m.moduleManager.HelmResourcesManager.StopMonitor(m.Name)
 
 	// Если есть chart, но нет релиза — warning
 	// если нет чарта — молча перейти к хукам
 	// если есть и chart и релиз — удалить
-	chartExists, _ := m.checkHelmChart()
-	if chartExists {
-		releaseExists, err := helm.NewClient(deleteLogLabels).IsReleaseExists(m.generateHelmReleaseName())
-		if !releaseExists {
+	if m.Kind() == ModuleKindManifests || m.Kind() == ModuleKindKustomize {
+		err := m.deleteManifests(logEntry)
+		if err != nil {
+			return err
+		}
+	}
+
+	if m.Kind() == ModuleKindHelm {
+		helmClient := m.helmClient(deleteLogLabels)
+		charts, err := m.Charts()
+		if m.State.Removed {
+			charts, err = m.removedModuleCharts(helmClient)
+		}
+		if err != nil {
+			return err
+		}
+		keptCharts := make(map[string]bool)
+		// Delete releases in reverse order.
+		for i := len(charts) - 1; i >= 0; i-- {
+			chart := charts[i]
+			if chart.KeepOnDelete {
+				logEntry.Infof("Keep helm release for chart '%s' of module '%s'", chart.Name, m.Name)
+				keptCharts[chart.Name] = true
+				continue
+			}
+			err := m.deleteChartRelease(helmClient, chart, logEntry)
 			if err != nil {
-				logEntry.Warnf("Cannot find helm release '%s' for module '%s'. Helm error: %s", m.generateHelmReleaseName(), m.Name, err)
-			} else {
-				logEntry.Warnf("Cannot find helm release '%s' for module '%s'.", m.generateHelmReleaseName(), m.Name)
+				return err
 			}
-		} else {
-			// Chart and release are existed, so run helm delete command
-			err := helm.NewClient(deleteLogLabels).DeleteRelease(m.generateHelmReleaseName())
+		}
+
+		// Releases are not moved yet if the namespace is changed after the last install.
+		if m.State.Namespace != "" && m.State.Namespace != m.Namespace() {
+			namespaceClient, releases, err := m.releasesInNamespace(m.State.Namespace, deleteLogLabels)
+			if err != nil {
+				return err
+			}
+			err = m.deleteReleasesInNamespace(namespaceClient, m.State.Namespace, releases, keptCharts)
 			if err != nil {
 				return err
 			}
 		}
+		m.State.Namespace = ""
+		m.resetReleaseName()
+	}
+
+	// CRDs are kept to not delete custom resources unless it is explicitly enabled.
+	if m.Settings != nil && m.Settings.DeleteCRDsOnDelete {
+		err := m.deleteCRDs(logEntry)
+		if err != nil {
+			return err
+		}
 	}
 
 	return m.runHooksByBinding(AfterDeleteHelm, deleteLogLabels)
 }
 
-func (m *Module) cleanup() error {
-	chartExists, err := m.checkHelmChart()
-	if !chartExists {
+// deleteChartRelease deletes the release of the chart if it exists.
+func (m *Module) deleteChartRelease(helmClient client.HelmClient, chart ModuleChart, logEntry *log.Entry) error {
+	releaseName, err := m.chartReleaseName(helmClient, chart, logEntry)
+	if err != nil {
+		return err
+	}
+	releaseExists, err := helmClient.IsReleaseExists(releaseName)
+	if !releaseExists {
 		if err != nil {
-			log.Debugf("MODULE '%s': cleanup is not needed: %s", m.Name, err)
-			return nil
+			logEntry.Warnf("Cannot find helm release '%s' for module '%s'. Helm error: %s", releaseName, m.Name, err)
+		} else {
+			logEntry.Warnf("Cannot find helm release '%s' for module '%s'.", releaseName, m.Name)
 		}
+		return nil
 	}
+	// Chart and release are existed, so run helm delete command
+	return helmClient.DeleteRelease(releaseName)
+}
 
-	helmLogLabels := map[string]string{
-		"module": m.Name,
+func (m *Module) cleanup() error {
+	if m.Kind() != ModuleKindHelm {
+		return nil
 	}
 
-	if err := helm.NewClient(helmLogLabels).DeleteSingleFailedRevision(m.generateHelmReleaseName()); err != nil {
+	charts, err := m.Charts()
+	if err != nil {
 		return err
 	}
+	if len(charts) == 0 {
+		log.Debugf("MODULE '%s': cleanup is not needed: no charts", m.Name)
+		return nil
+	}
 
-	if err := helm.NewClient(helmLogLabels).DeleteOldFailedRevisions(m.generateHelmReleaseName()); err != nil {
-		return err
+	helmLogLabels := map[string]string{
+		"module": m.Name,
+	}
+
+	helmClient := m.helmClient(helmLogLabels)
+	logEntry := log.WithFields(utils.LabelsToLogFields(helmLogLabels))
+
+	for _, chart := range charts {
+		releaseName, err := m.chartReleaseName(helmClient, chart, logEntry)
+		if err != nil {
+			return err
+		}
+
+		// Release stuck in pending-* status blocks every next upgrade.
+		status, err := helmClient.RecoverPendingRelease(releaseName)
+		if err != nil {
+			return err
+		}
+		if status != "" {
+			logEntry.Warnf("Helm release '%s' stuck in '%s' status is recovered", releaseName, status)
+			m.metricStorage.CounterAdd("{PREFIX}helm_pending_release_recoveries_total", 1.0, map[string]string{
+				"module":  m.Name,
+				"release": releaseName,
+				"status":  status,
+			})
+		}
+
+		if err := helmClient.DeleteSingleFailedRevision(releaseName); err != nil {
+			return err
+		}
+
+		if err := helmClient.DeleteOldFailedRevisions(releaseName); err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
 
+// runHelmInstall upgrades releases of module charts in order.
 func (m *Module) runHelmInstall(logLabels map[string]string) error {
 	metricLabels := map[string]string{
 		"module":     m.Name,
@@ -261,55 +471,89 @@ func (m *Module) runHelmInstall(logLabels map[string]string) error {
 
 	logEntry := log.WithFields(utils.LabelsToLogFields(logLabels))
 
-	chartExists, err := m.checkHelmChart()
-	if !chartExists {
+	charts, err := m.Charts()
+	if err != nil {
+		return err
+	}
+	if len(charts) == 0 {
+		logEntry.Debugf("no Chart.yaml, helm is not needed")
+		return nil
+	}
+
+	err = m.moveReleasesFromPreviousNamespace(logLabels)
+	if err != nil {
+		return err
+	}
+
+	allManifests := make([]manifest.Manifest, 0)
+	for _, chart := range charts {
+		chartLogLabels := logLabels
+		if chart.Name != "" {
+			chartLogLabels = utils.MergeLabels(logLabels, map[string]string{"chart": chart.Name})
+		}
+		manifests, err := m.runChartInstall(chart, chartLogLabels)
 		if err != nil {
-			logEntry.Debugf("no Chart.yaml, helm is not needed: %s", err)
-			return nil
+			if chart.Name != "" {
+				return fmt.Errorf("chart '%s': %v", chart.Name, err)
+			}
+			return err
 		}
+		allManifests = append(allManifests, manifests...)
 	}
+	m.LastReleaseManifests = allManifests
 
-	helmReleaseName := m.generateHelmReleaseName()
-
-	valuesPath, err := m.PrepareValuesYamlFile()
+	err = m.deleteRemovedChartReleases(charts, logLabels)
 	if err != nil {
 		return err
 	}
+	m.State.Namespace = m.Namespace()
+	return nil
+}
 
-	helmClient := helm.NewClient(logLabels)
+// runChartInstall renders the chart and runs helm upgrade if the checksum
+// of rendered manifests is changed or some resources are absent.
+func (m *Module) runChartInstall(chart ModuleChart, logLabels map[string]string) ([]manifest.Manifest, error) {
+	logEntry := log.WithFields(utils.LabelsToLogFields(logLabels))
 
-	// Render templates to prevent excess helm runs.
-	var renderedManifests string
-	func() {
-		defer trace.StartRegion(context.Background(), "ModuleRun-HelmPhase-helm-render").End()
+	namespace := m.Namespace()
 
-		metricLabels := map[string]string{
-			"module":     m.Name,
-			"activation": logLabels["event.type"],
-			"operation":  "template",
-		}
-		defer measure.Duration(func(d time.Duration) {
-			m.metricStorage.HistogramObserve("{PREFIX}helm_operation_seconds", d.Seconds(), metricLabels)
-		})()
+	helmClient := m.helmClient(logLabels)
 
-		renderedManifests, err = helmClient.Render(
-			helmReleaseName,
-			m.Path,
-			[]string{valuesPath},
-			[]string{},
-			app.Namespace)
-	}()
+	helmReleaseName, err := m.chartReleaseName(helmClient, chart, logEntry)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	renderInput, err := m.prepareRenderInput(helmReleaseName, namespace, logLabels)
+	if err != nil {
+		return nil, err
+	}
+	renderInput.ChartPath = chart.Path
+
+	// Render templates to prevent excess helm runs.
+	renderedManifests, manifestsChecksum, err := m.renderChart(chart, renderInput, logLabels)
+	if err != nil {
+		return nil, err
+	}
+	checksum := m.releaseChecksum(manifestsChecksum)
+
+	// Invalid manifests are not installed.
+	err = manifests_validator.Validate(renderedManifests)
+	if err != nil {
+		return nil, fmt.Errorf("validate chart '%s' manifests: %v", chart.Name, err)
 	}
-	checksum := utils.CalculateStringsChecksum(renderedManifests)
 
 	manifests, err := manifest.GetManifestListFromYamlDocuments(renderedManifests)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	logEntry.Debugf("chart has %d resources", len(manifests))
-	m.LastReleaseManifests = manifests
+
+	if m.UpgradePaused(helmReleaseName, checksum) {
+		// Rendered manifests are not installed, so they are not monitored and not checked for readiness.
+		logEntry.Infof("Release '%s' is rolled back and chart is not changed: skip upgrade", helmReleaseName)
+		return nil, nil
+	}
 
 	// Skip upgrades if nothing is changes
 	var runUpgradeRelease bool
@@ -318,6 +562,7 @@ func (m *Module) runHelmInstall(logLabels map[string]string) error {
 
 		metricLabels := map[string]string{
 			"module":     m.Name,
+			"chart":      chart.Name,
 			"activation": logLabels["event.type"],
 			"operation":  "check-upgrade",
 		}
@@ -325,18 +570,27 @@ func (m *Module) runHelmInstall(logLabels map[string]string) error {
 			m.metricStorage.HistogramObserve("{PREFIX}helm_operation_seconds", d.Seconds(), metricLabels)
 		})()
 
-		runUpgradeRelease, err = m.ShouldRunHelmUpgrade(helmClient, helmReleaseName, checksum, manifests, logLabels)
+		runUpgradeRelease, err = m.ShouldRunHelmUpgrade(helmClient, helmReleaseName, namespace, checksum, manifests, logLabels)
 	}()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	if !runUpgradeRelease {
+		// Mark releases installed before ownership tracking.
+		m.markReleaseOwned(helmClient, helmReleaseName, chart, logEntry)
 		// Start resources monitor if release is not changed
-		if !m.moduleManager.HelmResourcesManager.HasMonitor(m.Name) {
-			m.moduleManager.HelmResourcesManager.StartMonitor(m.Name, manifests, app.Namespace)
+		if !m.moduleManager.HelmResourcesManager.HasPartMonitor(m.Name, chart.Name) {
+			m.moduleManager.HelmResourcesManager.StartPartMonitor(m.Name, chart.Name, manifests, namespace)
 		}
-		return nil
+		return manifests, nil
+	}
+
+	m.diffRelease(helmClient, chart, helmReleaseName, manifests, logEntry)
+
+	err = m.ensureNamespace(namespace, logEntry)
+	if err != nil {
+		return nil, err
 	}
 
 	// Run helm upgrade. Trace and measure its time.
@@ -345,6 +599,7 @@ func (m *Module) runHelmInstall(logLabels map[string]string) error {
 
 		metricLabels := map[string]string{
 			"module":     m.Name,
+			"chart":      chart.Name,
 			"activation": logLabels["event.type"],
 			"operation":  "upgrade",
 		}
@@ -352,23 +607,27 @@ func (m *Module) runHelmInstall(logLabels map[string]string) error {
 			m.metricStorage.HistogramObserve("{PREFIX}helm_operation_seconds", d.Seconds(), metricLabels)
 		})()
 
-		err = helmClient.UpgradeRelease(
-			helmReleaseName,
-			m.Path,
-			[]string{valuesPath},
-			[]string{fmt.Sprintf("_addonOperatorModuleChecksum=%s", checksum)},
-			app.Namespace,
-		)
+		opts := m.upgradeOptions()
+		opts.ReleaseName = helmReleaseName
+		opts.Chart = chart.Path
+		opts.ValuesPaths = []string{renderInput.ValuesPath}
+		opts.SetValues = []string{fmt.Sprintf("_addonOperatorModuleChecksum=%s", checksum)}
+		opts.Namespace = namespace
+		err = helmClient.UpgradeRelease(opts)
 	}()
 
 	if err != nil {
-		return err
+		m.rollbackFailedUpgrade(helmClient, chart, helmReleaseName, checksum, logLabels)
+		return nil, err
 	}
+	delete(m.State.UpgradeFailures, helmReleaseName)
+
+	m.markReleaseOwned(helmClient, helmReleaseName, chart, logEntry)
 
 	// Start monitor resources if release was successful
-	m.moduleManager.HelmResourcesManager.StartMonitor(m.Name, manifests, app.Namespace)
+	m.moduleManager.HelmResourcesManager.StartPartMonitor(m.Name, chart.Name, manifests, namespace)
 
-	return nil
+	return manifests, nil
 }
 
 // ShouldRunHelmUpgrade tells if there is a case to run `helm upgrade`:
@@ -377,7 +636,7 @@ func (m *Module) runHelmInstall(logLabels map[string]string) error {
 //  - Checksum in release values not equals to checksum argument.
 //  - Some resources installed previously are missing.
 // If all these conditions aren't met, helm upgrade can be skipped.
-func (m *Module) ShouldRunHelmUpgrade(helmClient client.HelmClient, releaseName string, checksum string, manifests []manifest.Manifest, logLabels map[string]string) (bool, error) {
+func (m *Module) ShouldRunHelmUpgrade(helmClient client.HelmClient, releaseName string, namespace string, checksum string, manifests []manifest.Manifest, logLabels map[string]string) (bool, error) {
 	logEntry := log.WithFields(utils.LabelsToLogFields(logLabels))
 
 	revision, status, err := helmClient.LastReleaseStatus(releaseName)
@@ -421,7 +680,7 @@ func (m *Module) ShouldRunHelmUpgrade(helmClient client.HelmClient, releaseName
 	}
 
 	// Check if there are absent resources
-	absent, err := m.moduleManager.HelmResourcesManager.GetAbsentResources(manifests, app.Namespace)
+	absent, err := m.moduleManager.HelmResourcesManager.GetAbsentResources(manifests, namespace)
 	if err != nil {
 		return false, err
 	}
@@ -444,11 +703,20 @@ func (m *Module) runHooksByBinding(binding BindingType, logLabels map[string]str
 	for _, moduleHookName := range moduleHooks {
 		moduleHook := m.moduleManager.GetModuleHook(moduleHookName)
 
+		// Hook files of the removed module can be removed with the module directory.
+		if m.State.Removed && moduleHook.GoHook == nil {
+			if _, err := os.Stat(moduleHook.Path); os.IsNotExist(err) {
+				log.WithFields(utils.LabelsToLogFields(logLabels)).
+					Warnf("Skip %s hook '%s' of the removed module: file is removed", binding, moduleHook.Name)
+				continue
+			}
+		}
+
 		bc := BindingContext{
 			Binding: ContextBindingType[binding],
 		}
 		// Update kubernetes snapshots just before execute a hook
-		if binding == BeforeHelm || binding == AfterHelm || binding == AfterDeleteHelm {
+		if binding == BeforeHelm || binding == AfterHelm || binding == BeforeDeleteHelm || binding == AfterDeleteHelm {
 			bc.Snapshots = moduleHook.HookController.KubernetesSnapshots()
 			bc.Metadata.IncludeAllSnapshots = true
 		}
@@ -498,7 +766,7 @@ func (m *Module) runHooksByBindingAndCheckValues(binding BindingType, logLabels
 			Binding: ContextBindingType[binding],
 		}
 		// Update kubernetes snapshots just before execute a hook
-		if binding == BeforeHelm || binding == AfterHelm || binding == AfterDeleteHelm {
+		if binding == BeforeHelm || binding == AfterHelm || binding == BeforeDeleteHelm || binding == AfterDeleteHelm {
 			bc.Snapshots = moduleHook.HookController.KubernetesSnapshots()
 			bc.Metadata.IncludeAllSnapshots = true
 		}
@@ -564,7 +832,10 @@ func (m *Module) PrepareValuesYamlFile() (string, error) {
 	if err != nil {
 		return "", err
 	}
+	return m.prepareValuesYamlFileWith(values)
+}
 
+func (m *Module) prepareValuesYamlFileWith(values utils.Values) (string, error) {
 	data, err := values.YamlBytes()
 	if err != nil {
 		return "", err
@@ -626,14 +897,227 @@ func (m *Module) checkHelmChart() (bool, error) {
 }
 
 // generateHelmReleaseName returns a string that can be used as a helm release name.
-//
-// TODO Now it returns just a module name. Should it be cleaned from special symbols?
+// Name is generated from the release name template and sanitized.
 func (m *Module) generateHelmReleaseName() string {
+	return m.moduleManager.helm.ReleaseName(m.Name, m.Namespace())
+}
+
+// legacyHelmReleaseName returns a release name used before the release name template: just a module name.
+func (m *Module) legacyHelmReleaseName() string {
 	return m.Name
 }
 
+// helmReleaseName returns a name of the module's release. Release installed with
+// the legacy name is adopted if there is no release with the generated name, so
+// changing the release name template does not install a duplicate release.
+// Release owned by another Addon-operator is never adopted.
+func (m *Module) helmReleaseName(helmClient client.HelmClient, logEntry *log.Entry) (string, error) {
+	generated := m.generateHelmReleaseName()
+	legacy := m.legacyHelmReleaseName()
+	if generated == legacy {
+		return generated, nil
+	}
+	if m.generatedReleaseName == generated {
+		return m.effectiveReleaseName, nil
+	}
+
+	effective := generated
+	exists, err := helmClient.IsReleaseExists(generated)
+	if err != nil {
+		return "", fmt.Errorf("check release '%s': %v", generated, err)
+	}
+	if !exists {
+		legacyExists, err := helmClient.IsReleaseExists(legacy)
+		if err != nil {
+			return "", fmt.Errorf("check release '%s': %v", legacy, err)
+		}
+		if legacyExists {
+			owner, err := releaseOtherOwner(m.moduleManager.helm, helmClient, legacy)
+			if err != nil {
+				return "", err
+			}
+			if owner != "" {
+				logEntry.Infof("Release '%s' with the legacy name is not owned by addon-operator, it is owned by '%s', ignore it", legacy, owner)
+			} else {
+				logEntry.Infof("Adopt release '%s' installed with the legacy name, release name '%s' is not used", legacy, generated)
+				effective = legacy
+			}
+		}
+	}
+
+	m.generatedReleaseName = generated
+	m.effectiveReleaseName = effective
+	return effective, nil
+}
+
+// resetReleaseName drops the cached release name after the release is deleted,
+// so the adopted legacy name is not used for the new installation.
+func (m *Module) resetReleaseName() {
+	m.generatedReleaseName = ""
+	m.effectiveReleaseName = ""
+}
+
+// Namespace returns a target namespace for the Helm release. Namespace from
+// ConfigMap has precedence over namespace from module.yaml. Addon-operator
+// namespace is used by default.
+func (m *Module) Namespace() string {
+	if m.moduleManager != nil && m.moduleManager.kubeConfigManager != nil {
+		if kubeConfig := m.moduleManager.kubeConfigManager.CurrentConfig(); kubeConfig != nil {
+			if moduleConfig, has := kubeConfig.ModuleConfigs[m.Name]; has && moduleConfig.Namespace != "" {
+				return moduleConfig.Namespace
+			}
+		}
+	}
+	if m.Settings != nil && m.Settings.Namespace != "" {
+		return m.Settings.Namespace
+	}
+	return app.Namespace
+}
+
+// helmClient returns a Helm client for the module's namespace with the post-render pipeline.
+func (m *Module) helmClient(logLabels map[string]string) client.HelmClient {
+	helmClient := m.moduleManager.helm.NewClient(logLabels)
+	helmClient.WithNamespace(m.Namespace())
+	helmClient.WithPostRenderer(post_renderer.ForModule(m.Name, m.Namespace()))
+	return helmClient
+}
+
+// markReleaseOwned labels the release as owned by Addon-operator and sets labels with
+// the module and the chart names. Only owned releases can be purged, so error is not fatal:
+// the release is labeled on the next run. Release owned by another Addon-operator is not relabeled.
+func (m *Module) markReleaseOwned(helmClient client.HelmClient, releaseName string, chart ModuleChart, logEntry *log.Entry) {
+	owner, err := releaseOtherOwner(m.moduleManager.helm, helmClient, releaseName)
+	if err != nil {
+		logEntry.Warnf("Cannot mark helm release '%s' as owned: %v", releaseName, err)
+		return
+	}
+	if owner != "" {
+		logEntry.Warnf("Helm release '%s' is not owned by addon-operator, it is owned by '%s', do not mark it as owned", releaseName, owner)
+		return
+	}
+	err = helmClient.LabelRelease(releaseName, m.releaseLabels(chart))
+	if err != nil {
+		logEntry.Warnf("Cannot mark helm release '%s' as owned: %v", releaseName, err)
+	}
+}
+
+// releaseOtherOwner returns an owner of the release if it is owned by another Addon-operator.
+func releaseOtherOwner(h *helm.Helm, helmClient client.HelmClient, releaseName string) (string, error) {
+	labels, err := helmClient.ReleaseLabels(releaseName)
+	if err != nil {
+		return "", fmt.Errorf("get labels of release '%s': %v", releaseName, err)
+	}
+	return h.OtherOwner(labels), nil
+}
+
+// moveReleasesFromPreviousNamespace deletes releases left in the namespace of the last install
+// if the module namespace is changed. Releases are deleted only in 'purge' mode, in other modes
+// they are left orphaned with a warning and should be deleted manually.
+func (m *Module) moveReleasesFromPreviousNamespace(logLabels map[string]string) error {
+	logEntry := log.WithFields(utils.LabelsToLogFields(logLabels))
+
+	previous := m.State.Namespace
+	if previous == "" || previous == m.Namespace() {
+		return nil
+	}
+
+	helmClient, releases, err := m.releasesInNamespace(previous, logLabels)
+	if err != nil {
+		return err
+	}
+	if len(releases) == 0 {
+		return nil
+	}
+
+	if app.PurgeMode != app.PurgeModePurge {
+		logEntry.Warnf("Module namespace is changed from '%s' to '%s', releases %v in the previous namespace are not deleted in '%s' purge mode, delete them manually", previous, m.Namespace(), releases, app.PurgeMode)
+		return nil
+	}
+
+	// Resources of releases in the previous namespace are monitored, the monitor is started again after install.
+	m.moduleManager.HelmResourcesManager.StopMonitor(m.Name)
+	logEntry.Infof("Module namespace is changed from '%s' to '%s', delete releases %v in the previous namespace", previous, m.Namespace(), releases)
+	err = m.deleteReleasesInNamespace(helmClient, previous, releases, nil)
+	if err != nil {
+		return err
+	}
+	m.resetReleaseName()
+	return nil
+}
+
+// releasesInNamespace returns a client for the namespace and names of module releases owned
+// by the instance in this namespace. Tiller keeps the namespace of the existing release,
+// so nothing is returned for Helm 2.
+func (m *Module) releasesInNamespace(namespace string, logLabels map[string]string) (client.HelmClient, []string, error) {
+	helmClient := m.moduleManager.helm.NewClient(logLabels)
+	if m.moduleManager.helm.Tiller {
+		return helmClient, nil, nil
+	}
+	helmClient.WithNamespace(namespace)
+	releases, err := m.moduleManager.helm.ListOwnedReleases(helmClient, map[string]string{ReleaseModuleLabel: m.Name})
+	if err != nil {
+		return nil, nil, fmt.Errorf("list releases of module in namespace '%s': %v", namespace, err)
+	}
+	return helmClient, releases, nil
+}
+
+// deleteReleasesInNamespace deletes releases with the namespaced client. Releases of kept charts are not deleted.
+func (m *Module) deleteReleasesInNamespace(helmClient client.HelmClient, namespace string, releases []string, keptCharts map[string]bool) error {
+	for _, releaseName := range releases {
+		if len(keptCharts) > 0 {
+			labels, err := helmClient.ReleaseLabels(releaseName)
+			if err != nil {
+				return err
+			}
+			if keptCharts[labels[ReleaseChartLabel]] {
+				continue
+			}
+		}
+		err := helmClient.DeleteRelease(releaseName)
+		if err != nil {
+			return fmt.Errorf("delete release '%s' in namespace '%s': %v", releaseName, namespace, err)
+		}
+	}
+	return nil
+}
+
+// ensureNamespace creates a namespace for the Helm release if it is not exists.
+// Labels and annotations from module.yaml are set only on creation.
+func (m *Module) ensureNamespace(namespace string, logEntry *log.Entry) error {
+	kubeClient := m.moduleManager.KubeClient
+	if namespace == app.Namespace || kubeClient == nil {
+		return nil
+	}
+
+	_, err := kubeClient.CoreV1().Namespaces().Get(namespace, metav1.GetOptions{})
+	if err == nil {
+		return nil
+	}
+	if !errors.IsNotFound(err) {
+		return fmt.Errorf("get namespace '%s': %v", namespace, err)
+	}
+
+	ns := &v1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: namespace,
+		},
+	}
+	if m.Settings != nil {
+		ns.Labels = m.Settings.NamespaceLabels
+		ns.Annotations = m.Settings.NamespaceAnnotations
+	}
+	_, err = kubeClient.CoreV1().Namespaces().Create(ns)
+	if err != nil && !errors.IsAlreadyExists(err) {
+		return fmt.Errorf("create namespace '%s': %v", namespace, err)
+	}
+	logEntry.Infof("Namespace '%s' is created for the Helm release", namespace)
+	return nil
+}
+
 // ConfigValues returns values from ConfigMap: global section and module section
 func (m *Module) ConfigValues() utils.Values {
+	m.moduleManager.ValuesLock.RLock()
+	defer m.moduleManager.ValuesLock.RUnlock()
 	return utils.MergeValues(
 		// global section
 		utils.Values{"global": map[string]interface{}{}},
@@ -652,6 +1136,9 @@ func (m *Module) ConfigValues() utils.Values {
 func (m *Module) constructValues() (utils.Values, error) {
 	var err error
 
+	m.moduleManager.ValuesLock.RLock()
+	defer m.moduleManager.ValuesLock.RUnlock()
+
 	res := utils.MergeValues(
 		// global
 		utils.Values{"global": map[string]interface{}{}},
@@ -844,6 +1331,7 @@ func (m *Module) checkIsEnabledByScript(precedingEnabledModules []string, logLab
 }
 
 var ValidModuleNameRe = regexp.MustCompile(`^[0-9][0-9][0-9]-(.*)$`)
+var ValidModuleOrderRe = regexp.MustCompile(`^([0-9][0-9][0-9])-.*$`)
 
 func SearchModules(modulesDir string) (modules []*Module, err error) {
 	files, err := ioutil.ReadDir(modulesDir) // returns a list of modules sorted by filename
@@ -893,22 +1381,45 @@ func (mm *moduleManager) RegisterModules() error {
 	}
 
 	for _, module := range modules {
-		logEntry := log.WithField("module", module.Name)
-
-		module.WithModuleManager(mm)
-		module.WithMetricStorage(mm.metricStorage)
-
-		// load static config from values.yaml
-		err := module.loadStaticValues()
+		err := mm.initModule(module)
 		if err != nil {
-			logEntry.Errorf("Load values.yaml: %s", err)
-			return fmt.Errorf("bad module values")
+			return err
 		}
 
 		mm.allModulesByName[module.Name] = module
 		mm.allModulesNamesInOrder = append(mm.allModulesNamesInOrder, module.Name)
 
-		logEntry.Infof("Module '%s' is registered", module.Name)
+		log.WithField("module", module.Name).
+			Infof("Module '%s' is registered", module.Name)
+	}
+
+	return nil
+}
+
+// initModule loads static values and settings for the module.
+func (mm *moduleManager) initModule(module *Module) error {
+	logEntry := log.WithField("module", module.Name)
+
+	module.WithModuleManager(mm)
+	module.WithMetricStorage(mm.metricStorage)
+
+	// load static config from values.yaml
+	err := module.loadStaticValues()
+	if err != nil {
+		logEntry.Errorf("Load values.yaml: %s", err)
+		return fmt.Errorf("bad module values")
+	}
+
+	err = module.loadSettings()
+	if err != nil {
+		logEntry.Errorf("Load module settings: %s", err)
+		return fmt.Errorf("bad module settings")
+	}
+
+	module.kind, err = module.detectKind()
+	if err != nil {
+		logEntry.Errorf("Detect module kind: %s", err)
+		return fmt.Errorf("bad module charts")
 	}
 
 	return nil
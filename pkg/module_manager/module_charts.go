@@ -0,0 +1,199 @@
+package module_manager
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/flant/addon-operator/pkg/app"
+	"github.com/flant/addon-operator/pkg/helm/client"
+	"github.com/flant/addon-operator/pkg/utils"
+)
+
+// ChartsDir is a directory with charts of a module with several charts.
+const ChartsDir = "charts"
+
+// Labels with module and chart names are set on Helm storage objects of module releases.
+const (
+	ReleaseModuleLabel = "addon-operator/module"
+	ReleaseChartLabel  = "addon-operator/chart"
+)
+
+// ModuleChart is a Helm chart of the module. A module with Chart.yaml
+// in the module directory has one chart with an empty name.
+type ModuleChart struct {
+	Name         string
+	Path         string
+	KeepOnDelete bool
+}
+
+// Charts returns charts of the module in the installation order. Charts from
+// module.yaml go first, other charts from the 'charts' directory are sorted by name.
+// Note that the 'charts' directory of a module with Chart.yaml contains subcharts.
+func (m *Module) Charts() ([]ModuleChart, error) {
+	if chartExists, _ := m.checkHelmChart(); chartExists {
+		return []ModuleChart{{Path: m.Path}}, nil
+	}
+
+	dir := filepath.Join(m.Path, ChartsDir)
+	entries, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read charts directory '%s': %v", dir, err)
+	}
+
+	found := make(map[string]bool)
+	names := make([]string, 0)
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(dir, entry.Name(), "Chart.yaml")); err != nil {
+			continue
+		}
+		found[entry.Name()] = true
+		names = append(names, entry.Name())
+	}
+
+	res := make([]ModuleChart, 0, len(names))
+	if m.Settings != nil {
+		for _, chart := range m.Settings.Charts {
+			if !found[chart.Name] {
+				return nil, fmt.Errorf("chart '%s' from %s is not found in '%s'", chart.Name, ModuleSettingsFileName, dir)
+			}
+			res = append(res, ModuleChart{
+				Name:         chart.Name,
+				Path:         filepath.Join(dir, chart.Name),
+				KeepOnDelete: chart.KeepOnDelete,
+			})
+			delete(found, chart.Name)
+		}
+	}
+	for _, name := range names {
+		if found[name] {
+			res = append(res, ModuleChart{
+				Name: name,
+				Path: filepath.Join(dir, name),
+			})
+		}
+	}
+	return res, nil
+}
+
+// removedModuleCharts returns charts of the module removed from the modules directory.
+// Charts cannot be read from the disk, so charts are found by labels of owned releases,
+// KeepOnDelete flags are taken from module.yaml loaded before the removal.
+func (m *Module) removedModuleCharts(helmClient client.HelmClient) ([]ModuleChart, error) {
+	keepOnDelete := make(map[string]bool)
+	if m.Settings != nil {
+		for _, chart := range m.Settings.Charts {
+			keepOnDelete[chart.Name] = chart.KeepOnDelete
+		}
+	}
+
+	res := make([]ModuleChart, 0)
+	releases, err := m.moduleManager.helm.ListOwnedReleases(helmClient, map[string]string{ReleaseModuleLabel: m.Name})
+	if err != nil {
+		return nil, err
+	}
+	for _, releaseName := range releases {
+		labels, err := helmClient.ReleaseLabels(releaseName)
+		if err != nil {
+			return nil, err
+		}
+		chartName := labels[ReleaseChartLabel]
+		if chartName == "" {
+			continue
+		}
+		res = append(res, ModuleChart{Name: chartName, KeepOnDelete: keepOnDelete[chartName]})
+	}
+	// Release of a single chart has no chart label. It can be installed without labels by a previous version.
+	if len(res) == 0 {
+		res = append(res, ModuleChart{Path: m.Path})
+	}
+	return res, nil
+}
+
+// generateChartReleaseName returns a release name for the chart. Releases of charts
+// in a module with several charts are named after the module and the chart.
+func (m *Module) generateChartReleaseName(chart ModuleChart) string {
+	if chart.Name == "" {
+		return m.generateHelmReleaseName()
+	}
+	return m.moduleManager.helm.ReleaseName(m.Name+"-"+chart.Name, m.Namespace())
+}
+
+// chartReleaseName returns a name of the chart release. Release of a single chart can be adopted by the legacy name.
+func (m *Module) chartReleaseName(helmClient client.HelmClient, chart ModuleChart, logEntry *log.Entry) (string, error) {
+	if chart.Name == "" {
+		return m.helmReleaseName(helmClient, logEntry)
+	}
+	return m.generateChartReleaseName(chart), nil
+}
+
+// knownReleaseNames returns all possible release names of the module to find its releases.
+func (m *Module) knownReleaseNames() []string {
+	names := []string{m.legacyHelmReleaseName(), m.generateHelmReleaseName()}
+	charts, _ := m.Charts()
+	for _, chart := range charts {
+		if chart.Name != "" {
+			names = append(names, m.generateChartReleaseName(chart))
+		}
+	}
+	return names
+}
+
+// releaseLabels returns labels for the release of the chart: owner labels, the module name
+// and the chart name for modules with several charts.
+func (m *Module) releaseLabels(chart ModuleChart) map[string]string {
+	labels := utils.MergeLabels(m.moduleManager.helm.OwnerLabels(), map[string]string{ReleaseModuleLabel: m.Name})
+	if chart.Name != "" {
+		labels[ReleaseChartLabel] = chart.Name
+	}
+	return labels
+}
+
+// deleteRemovedChartReleases deletes releases of charts that are removed from the 'charts' directory
+// and stops their monitors. Releases are found by labels, so releases installed before chart labels
+// are not found. Releases are only reported if releases of unknown modules are not purged.
+func (m *Module) deleteRemovedChartReleases(charts []ModuleChart, logLabels map[string]string) error {
+	logEntry := log.WithFields(utils.LabelsToLogFields(logLabels))
+	helmClient := m.helmClient(logLabels)
+
+	current := make(map[string]bool)
+	for _, chart := range charts {
+		current[chart.Name] = true
+	}
+
+	releases, err := m.moduleManager.helm.ListOwnedReleases(helmClient, map[string]string{ReleaseModuleLabel: m.Name})
+	if err != nil {
+		return fmt.Errorf("list releases of module: %v", err)
+	}
+	for _, release := range releases {
+		labels, err := helmClient.ReleaseLabels(release)
+		if err != nil {
+			return err
+		}
+		chartName := labels[ReleaseChartLabel]
+		if chartName == "" || current[chartName] {
+			continue
+		}
+
+		m.moduleManager.HelmResourcesManager.StopPartMonitor(m.Name, chartName)
+		if app.PurgeMode != app.PurgeModePurge {
+			logEntry.Warnf("Chart '%s' is removed, its release '%s' is not deleted in '%s' purge mode", chartName, release, app.PurgeMode)
+			continue
+		}
+		logEntry.Infof("Chart '%s' is removed, delete its release '%s'", chartName, release)
+		err = helmClient.DeleteRelease(release)
+		if err != nil {
+			return fmt.Errorf("delete release '%s' of removed chart '%s': %v", release, chartName, err)
+		}
+	}
+	return nil
+}
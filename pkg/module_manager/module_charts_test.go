@@ -0,0 +1,111 @@
+package module_manager
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/flant/addon-operator/pkg/app"
+	"github.com/flant/addon-operator/pkg/helm"
+	"github.com/flant/addon-operator/pkg/helm/client"
+	"github.com/flant/addon-operator/pkg/helm_resources_manager"
+	"github.com/flant/addon-operator/pkg/utils"
+)
+
+func Test_Module_Charts(t *testing.T) {
+	rootDir, err := ioutil.TempDir("", "addon-operator-module-charts-")
+	require.NoError(t, err)
+	defer os.RemoveAll(rootDir)
+
+	writeChart := func(path string) {
+		require.NoError(t, os.MkdirAll(filepath.Join(rootDir, path), 0755))
+		require.NoError(t, ioutil.WriteFile(filepath.Join(rootDir, path, "Chart.yaml"), []byte("name: chart\n"), 0644))
+	}
+	writeChart("single")
+	writeChart("single/charts/subchart")
+	writeChart("multi/charts/app")
+	writeChart("multi/charts/crds")
+	writeChart("multi/charts/monitoring")
+	require.NoError(t, os.MkdirAll(filepath.Join(rootDir, "multi", "charts", "not-a-chart"), 0755))
+
+	// Module with Chart.yaml has one chart, subcharts are not separate releases.
+	m := NewModule("single", filepath.Join(rootDir, "single"))
+	charts, err := m.Charts()
+	require.NoError(t, err)
+	assert.Equal(t, []ModuleChart{{Path: filepath.Join(rootDir, "single")}}, charts)
+
+	// Charts from module.yaml go first, other charts are sorted by name.
+	m = NewModule("multi", filepath.Join(rootDir, "multi"))
+	m.Settings = &ModuleSettings{Charts: []ModuleChartSettings{{Name: "crds", KeepOnDelete: true}}}
+	charts, err = m.Charts()
+	require.NoError(t, err)
+	require.Len(t, charts, 3)
+	assert.Equal(t, ModuleChart{Name: "crds", Path: filepath.Join(rootDir, "multi", "charts", "crds"), KeepOnDelete: true}, charts[0])
+	assert.Equal(t, "app", charts[1].Name)
+	assert.Equal(t, "monitoring", charts[2].Name)
+	assert.Equal(t, ModuleKindHelm, m.Kind())
+	mm := NewMainModuleManager()
+	mm.WithHelm(&helm.Helm{})
+	m.WithModuleManager(mm)
+	assert.Equal(t, "multi-crds", m.generateChartReleaseName(charts[0]))
+
+	// Unknown chart in module.yaml is an error.
+	m = NewModule("multi", filepath.Join(rootDir, "multi"))
+	m.Settings = &ModuleSettings{Charts: []ModuleChartSettings{{Name: "absent"}}}
+	_, err = m.Charts()
+	assert.Error(t, err)
+	_, err = m.detectKind()
+	assert.Error(t, err, "module should not be loaded with an unknown chart")
+	assert.Equal(t, ModuleKindHelm, m.Kind(), "broken Helm module should not fall back to other kinds")
+
+	_, err = NewModuleSettingsFromBytes([]byte("charts:\n- name: app\n- name: app\n"))
+	assert.Error(t, err, "duplicated charts should be rejected")
+	_, err = NewModuleSettingsFromBytes([]byte("charts:\n- name: App_1\n"))
+	assert.Error(t, err, "chart name should be a DNS label")
+}
+
+func Test_Module_DeleteRemovedChartReleases(t *testing.T) {
+	defer func(mode string) { app.PurgeMode = mode }(app.PurgeMode)
+
+	h := &helm.Helm{OwnerID: "b"}
+	chartLabels := func(module, chart string) map[string]string {
+		return utils.MergeLabels(h.OwnerLabels(), map[string]string{ReleaseModuleLabel: module, ReleaseChartLabel: chart})
+	}
+	stub := &releasesStub{releases: map[string]map[string]string{
+		"multi-app": chartLabels("multi", "app"),
+		"multi-old": chartLabels("multi", "old"),
+		"multi-other": {
+			helm.OwnerLabel: "a", ReleaseModuleLabel: "multi", ReleaseChartLabel: "other",
+		},
+		"other-old":   chartLabels("other", "old"),
+		"multi":       utils.MergeLabels(h.OwnerLabels(), map[string]string{ReleaseModuleLabel: "multi"}),
+		"not-labeled": {},
+	}}
+	h.NewClient = func(_ ...map[string]string) client.HelmClient {
+		return stub
+	}
+
+	mm := NewMainModuleManager()
+	mm.WithHelm(h)
+	mm.WithHelmResourcesManager(helm_resources_manager.NewHelmResourcesManager())
+	m := NewModule("multi", "/modules/multi")
+	m.WithModuleManager(mm)
+	charts := []ModuleChart{{Name: "app", Path: "/modules/multi/charts/app"}}
+
+	app.PurgeMode = app.PurgeModeDryRun
+	require.NoError(t, m.deleteRemovedChartReleases(charts, nil))
+	assert.Contains(t, stub.releases, "multi-old", "release should not be deleted in dry-run mode")
+
+	app.PurgeMode = app.PurgeModePurge
+	require.NoError(t, m.deleteRemovedChartReleases(charts, nil))
+	assert.NotContains(t, stub.releases, "multi-old", "release of the removed chart should be deleted")
+	for _, name := range []string{"multi-app", "multi-other", "other-old", "multi", "not-labeled"} {
+		assert.Contains(t, stub.releases, name)
+	}
+
+	assert.Equal(t, chartLabels("multi", "app"), m.releaseLabels(charts[0]))
+}
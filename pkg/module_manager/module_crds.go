@@ -0,0 +1,220 @@
+package module_manager
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/wait"
+
+	"github.com/flant/shell-operator/pkg/kube"
+	"github.com/flant/shell-operator/pkg/utils/manifest"
+
+	"github.com/flant/addon-operator/pkg/utils"
+)
+
+// CRDsDir is a directory with CustomResourceDefinitions of the module.
+const CRDsDir = "crds"
+
+// CRDsEstablishTimeout is a time to wait for the Established condition of applied CRDs.
+var CRDsEstablishTimeout = 2 * time.Minute
+
+// crdsPollInterval is an interval between checks of CRDs conditions and discovery.
+var crdsPollInterval = time.Second
+
+// LoadCRDs returns CustomResourceDefinitions from the 'crds' directory of the module.
+// Files with .yaml, .yml and .json extensions are loaded in lexical order.
+func (m *Module) LoadCRDs() ([]manifest.Manifest, error) {
+	dir := filepath.Join(m.Path, CRDsDir)
+	entries, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read crds directory '%s': %v", dir, err)
+	}
+
+	res := make([]manifest.Manifest, 0)
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		switch filepath.Ext(entry.Name()) {
+		case ".yaml", ".yml", ".json":
+		default:
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		manifests, err := utils.ManifestListFromYamlDocuments(string(content))
+		if err != nil {
+			return nil, fmt.Errorf("parse '%s': %v", path, err)
+		}
+		for _, mf := range manifests {
+			if mf.Kind() != "CustomResourceDefinition" {
+				return nil, fmt.Errorf("'%s': %s/%s is not a CustomResourceDefinition", path, mf.Kind(), mf.Name())
+			}
+			res = append(res, mf)
+		}
+	}
+	return res, nil
+}
+
+// runCRDsInstall applies CRDs from the 'crds' directory with server-side apply, waits
+// until they are established and their kinds are served by the API server.
+// CRDs are applied before the Helm chart and manifests, so resources can use them on the first install.
+func (m *Module) runCRDsInstall(logLabels map[string]string) error {
+	logEntry := log.WithFields(utils.LabelsToLogFields(logLabels))
+
+	crds, err := m.LoadCRDs()
+	if err != nil {
+		return err
+	}
+	if len(crds) == 0 {
+		return nil
+	}
+
+	kubeClient := m.moduleManager.KubeClient
+	if kubeClient == nil {
+		return fmt.Errorf("kubernetes client is not set")
+	}
+
+	for _, crd := range crds {
+		_, err := applyManifest(kubeClient, crd, "")
+		if err != nil {
+			return fmt.Errorf("apply CustomResourceDefinition/%s: %v", crd.Name(), err)
+		}
+	}
+
+	for _, crd := range crds {
+		err := waitCRDEstablished(kubeClient, crd)
+		if err != nil {
+			return fmt.Errorf("CustomResourceDefinition/%s: %v", crd.Name(), err)
+		}
+	}
+	logEntry.Infof("Applied CRDs: %s", crdNames(crds))
+	return nil
+}
+
+// deleteCRDs deletes CRDs from the 'crds' directory. Absent CRDs are ignored.
+func (m *Module) deleteCRDs(logEntry *log.Entry) error {
+	crds, err := m.LoadCRDs()
+	if err != nil {
+		return err
+	}
+	kubeClient := m.moduleManager.KubeClient
+	if len(crds) == 0 || kubeClient == nil {
+		return nil
+	}
+
+	for i := len(crds) - 1; i >= 0; i-- {
+		item := manifestsInventoryItem{
+			APIVersion: crds[i].ApiVersion(),
+			Kind:       crds[i].Kind(),
+			Name:       crds[i].Name(),
+		}
+		err := deleteInventoryItem(kubeClient, item)
+		if err != nil {
+			return fmt.Errorf("delete %s: %v", item, err)
+		}
+	}
+	logEntry.Infof("Deleted CRDs: %s", crdNames(crds))
+	return nil
+}
+
+// waitCRDEstablished waits for the Established condition of the CRD and
+// for the discovery of its kind in all served versions.
+func waitCRDEstablished(kubeClient kube.KubernetesClient, crd manifest.Manifest) error {
+	gvr, _, err := resourceGVR(kubeClient, crd.ApiVersion(), crd.Kind(), "", "")
+	if err != nil {
+		return err
+	}
+
+	var lastErr error
+	err = wait.PollImmediate(crdsPollInterval, CRDsEstablishTimeout, func() (bool, error) {
+		obj, err := kubeClient.Dynamic().Resource(gvr).Get(crd.Name(), metav1.GetOptions{})
+		if errors.IsNotFound(err) {
+			lastErr = fmt.Errorf("not found")
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		if !isCRDEstablished(obj) {
+			lastErr = fmt.Errorf("not established")
+			return false, nil
+		}
+		// The kube client has no discovery cache, so a successful lookup means new kinds are served.
+		for _, apiVersion := range crdServedVersions(obj) {
+			if _, err := kubeClient.APIResource(apiVersion, crdKind(obj)); err != nil {
+				lastErr = err
+				return false, nil
+			}
+		}
+		return true, nil
+	})
+	if err == wait.ErrWaitTimeout && lastErr != nil {
+		return fmt.Errorf("wait timeout %s: %v", CRDsEstablishTimeout, lastErr)
+	}
+	return err
+}
+
+// isCRDEstablished returns true if the CRD object has the Established condition with the "True" status.
+func isCRDEstablished(obj *unstructured.Unstructured) bool {
+	cond := findCondition(obj, "Established")
+	return cond != nil && cond["status"] == "True"
+}
+
+// crdKind returns a kind of custom resources defined by the CRD object.
+func crdKind(obj *unstructured.Unstructured) string {
+	kind, _, _ := unstructured.NestedString(obj.Object, "spec", "names", "kind")
+	return kind
+}
+
+// crdServedVersions returns sorted apiVersions of custom resources served by the CRD object.
+// Both apiextensions.k8s.io/v1 and v1beta1 objects are supported.
+func crdServedVersions(obj *unstructured.Unstructured) []string {
+	group, _, _ := unstructured.NestedString(obj.Object, "spec", "group")
+
+	res := make([]string, 0)
+	versions, _, _ := unstructured.NestedSlice(obj.Object, "spec", "versions")
+	for _, v := range versions {
+		version, ok := v.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		name, _ := version["name"].(string)
+		served, _ := version["served"].(bool)
+		if name != "" && served {
+			res = append(res, group+"/"+name)
+		}
+	}
+	if len(res) == 0 {
+		// v1beta1 CRD with a single version.
+		if version, _, _ := unstructured.NestedString(obj.Object, "spec", "version"); version != "" {
+			res = append(res, group+"/"+version)
+		}
+	}
+	sort.Strings(res)
+	return res
+}
+
+// crdNames returns names of CRDs for logs.
+func crdNames(crds []manifest.Manifest) string {
+	names := make([]string, 0, len(crds))
+	for _, crd := range crds {
+		names = append(names, crd.Name())
+	}
+	return strings.Join(names, ", ")
+}
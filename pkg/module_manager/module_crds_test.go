@@ -0,0 +1,113 @@
+package module_manager
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+)
+
+func Test_Module_LoadCRDs(t *testing.T) {
+	rootDir, err := ioutil.TempDir("", "addon-operator-module-crds-")
+	require.NoError(t, err)
+	defer os.RemoveAll(rootDir)
+
+	m := NewModule("module", rootDir)
+	crds, err := m.LoadCRDs()
+	require.NoError(t, err)
+	assert.Len(t, crds, 0, "module without crds directory has no CRDs")
+
+	crdsDir := filepath.Join(rootDir, CRDsDir)
+	require.NoError(t, os.MkdirAll(crdsDir, 0755))
+	writeFile := func(name string, content string) {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(crdsDir, name), []byte(content), 0644))
+	}
+	writeFile("02-b.yaml", `apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: bs.example.com
+`)
+	writeFile("01-a.yaml", `apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: as.example.com
+---
+apiVersion: apiextensions.k8s.io/v1beta1
+kind: CustomResourceDefinition
+metadata:
+  name: cs.example.com
+`)
+	writeFile("README.md", `not a CRD`)
+
+	crds, err = m.LoadCRDs()
+	require.NoError(t, err)
+	require.Len(t, crds, 3)
+	assert.Equal(t, "as.example.com, cs.example.com, bs.example.com", crdNames(crds))
+
+	writeFile("03-cm.yaml", `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: cm
+`)
+	_, err = m.LoadCRDs()
+	assert.Error(t, err, "only CRDs are allowed in the crds directory")
+}
+
+func Test_CRD_Status(t *testing.T) {
+	parse := func(data string) *unstructured.Unstructured {
+		obj := map[string]interface{}{}
+		require.NoError(t, yaml.Unmarshal([]byte(data), &obj))
+		return &unstructured.Unstructured{Object: obj}
+	}
+
+	crd := parse(`
+apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: crontabs.example.com
+spec:
+  group: example.com
+  names:
+    kind: CronTab
+  versions:
+  - name: v1beta1
+    served: false
+  - name: v1
+    served: true
+  - name: v2
+    served: true
+status:
+  conditions:
+  - type: NamesAccepted
+    status: "True"
+  - type: Established
+    status: "False"
+`)
+	assert.False(t, isCRDEstablished(crd))
+	assert.Equal(t, "CronTab", crdKind(crd))
+	assert.Equal(t, []string{"example.com/v1", "example.com/v2"}, crdServedVersions(crd))
+
+	crd = parse(`
+apiVersion: apiextensions.k8s.io/v1beta1
+kind: CustomResourceDefinition
+metadata:
+  name: crontabs.example.com
+spec:
+  group: example.com
+  version: v1
+status:
+  conditions:
+  - type: Established
+    status: "True"
+`)
+	assert.True(t, isCRDEstablished(crd))
+	assert.Equal(t, []string{"example.com/v1"}, crdServedVersions(crd))
+
+	_, err := NewModuleSettingsFromBytes([]byte("deleteCRDsOnDelete: true\n"))
+	assert.NoError(t, err)
+}
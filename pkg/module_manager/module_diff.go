@@ -0,0 +1,79 @@
+package module_manager
+
+import (
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/flant/shell-operator/pkg/utils/manifest"
+
+	"github.com/flant/addon-operator/pkg/app"
+	"github.com/flant/addon-operator/pkg/helm/client"
+	"github.com/flant/addon-operator/pkg/utils"
+)
+
+// ModuleDiff is a difference between the deployed release and rendered manifests before helm upgrade.
+type ModuleDiff struct {
+	Time      time.Time            `json:"time"`
+	Release   string               `json:"release"`
+	Chart     string               `json:"chart,omitempty"`
+	Summary   string               `json:"summary"`
+	Resources []utils.ResourceDiff `json:"resources"`
+}
+
+// diffRelease computes a diff between manifests of the deployed release and rendered manifests.
+// The summary is logged and the diff is kept in the module for the debug server.
+// Errors are logged: the diff is informational and should not prevent the upgrade.
+func (m *Module) diffRelease(helmClient client.HelmClient, chart ModuleChart, releaseName string, rendered []manifest.Manifest, logEntry *log.Entry) {
+	if app.ModuleDiffHistory <= 0 {
+		return
+	}
+
+	deployed := make([]manifest.Manifest, 0)
+	exists, err := helmClient.IsReleaseExists(releaseName)
+	if err != nil {
+		logEntry.Warnf("Cannot diff release '%s': %v", releaseName, err)
+		return
+	}
+	if exists {
+		deployedManifest, err := helmClient.GetReleaseManifest(releaseName, "")
+		if err != nil {
+			logEntry.Warnf("Cannot diff release '%s': %v", releaseName, err)
+			return
+		}
+		deployed, err = utils.ManifestListFromYamlDocuments(deployedManifest)
+		if err != nil {
+			logEntry.Warnf("Cannot diff release '%s': parse deployed manifest: %v", releaseName, err)
+			return
+		}
+	}
+
+	diffs := utils.DiffManifests(deployed, rendered, m.Namespace())
+	diff := ModuleDiff{
+		Time:      time.Now(),
+		Release:   releaseName,
+		Chart:     chart.Name,
+		Summary:   utils.DiffSummary(diffs),
+		Resources: diffs,
+	}
+	logEntry.Infof("Release '%s' diff: %s", releaseName, diff.Summary)
+	m.addDiff(diff)
+}
+
+func (m *Module) addDiff(diff ModuleDiff) {
+	m.diffsMu.Lock()
+	defer m.diffsMu.Unlock()
+	m.diffs = append(m.diffs, diff)
+	if extra := len(m.diffs) - app.ModuleDiffHistory; extra > 0 {
+		m.diffs = m.diffs[extra:]
+	}
+}
+
+// Diffs returns the last diffs of module releases, the latest diff is the last.
+func (m *Module) Diffs() []ModuleDiff {
+	m.diffsMu.Lock()
+	defer m.diffsMu.Unlock()
+	res := make([]ModuleDiff, len(m.diffs))
+	copy(res, m.diffs)
+	return res
+}
@@ -0,0 +1,47 @@
+package module_manager
+
+import (
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/flant/shell-operator/pkg/utils/manifest"
+
+	"github.com/flant/addon-operator/pkg/app"
+	"github.com/flant/addon-operator/pkg/helm"
+)
+
+// diffHelmClient returns a deployed release with one ConfigMap.
+type diffHelmClient struct {
+	*helm.MockHelmClient
+}
+
+func (h *diffHelmClient) GetReleaseManifest(_ string, _ string) (string, error) {
+	return "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: cm\ndata:\n  key: value\n", nil
+}
+
+func Test_Module_DiffRelease(t *testing.T) {
+	defer func(size int) { app.ModuleDiffHistory = size }(app.ModuleDiffHistory)
+	app.ModuleDiffHistory = 2
+
+	m := NewModule("module", "/modules/module")
+	m.Settings = &ModuleSettings{Namespace: "ns"}
+	hc := &diffHelmClient{MockHelmClient: &helm.MockHelmClient{}}
+
+	for _, value := range []string{"one", "two", "three"} {
+		rendered := []manifest.Manifest{
+			{"apiVersion": "v1", "kind": "ConfigMap", "metadata": map[string]interface{}{"name": "cm"}, "data": map[string]interface{}{"key": value}},
+		}
+		m.diffRelease(hc, ModuleChart{}, "module", rendered, log.WithField("test", t.Name()))
+	}
+
+	diffs := m.Diffs()
+	require.Len(t, diffs, 2, "only last diffs should be kept")
+	assert.Equal(t, "module", diffs[1].Release)
+	assert.Equal(t, "0 added, 1 changed, 0 removed: ConfigMap/ns/cm changed (data.key)", diffs[1].Summary)
+	require.Len(t, diffs[1].Resources, 1)
+	assert.Equal(t, "three", diffs[1].Resources[0].Changes[0].New)
+	assert.Equal(t, "two", diffs[0].Resources[0].Changes[0].New)
+}
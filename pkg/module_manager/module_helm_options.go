@@ -0,0 +1,61 @@
+package module_manager
+
+import (
+	"time"
+
+	"github.com/flant/addon-operator/pkg/helm/client"
+	"github.com/flant/addon-operator/pkg/utils"
+)
+
+// HelmOptions returns options of helm upgrade from module.yaml overridden by the ConfigMap.
+func (m *Module) HelmOptions() *utils.HelmOptions {
+	var settings, config *utils.HelmOptions
+	if m.Settings != nil {
+		settings = m.Settings.HelmOptions
+	}
+	if m.moduleManager != nil && m.moduleManager.kubeConfigManager != nil {
+		if kubeConfig := m.moduleManager.kubeConfigManager.CurrentConfig(); kubeConfig != nil {
+			if moduleConfig, has := kubeConfig.ModuleConfigs[m.Name]; has {
+				config = moduleConfig.HelmOptions
+			}
+		}
+	}
+	return settings.Merge(config)
+}
+
+// releaseChecksum returns a checksum of rendered manifests and helm options, so a change
+// of options triggers helm upgrade. Unset options are not included to keep checksums
+// of releases installed without options.
+func (m *Module) releaseChecksum(manifestsChecksum string) string {
+	optionsChecksum := m.HelmOptions().Checksum()
+	if optionsChecksum == "" {
+		return manifestsChecksum
+	}
+	return utils.CalculateStringsChecksum(manifestsChecksum, optionsChecksum)
+}
+
+// upgradeOptions returns flags of helm upgrade for releases of the module.
+// Options are validated on load, so errors are ignored.
+func (m *Module) upgradeOptions() client.UpgradeOptions {
+	helmOptions := m.HelmOptions()
+	opts := client.UpgradeOptions{}
+	if helmOptions.Wait != nil {
+		opts.Wait = *helmOptions.Wait
+	}
+	if helmOptions.Atomic != nil {
+		opts.Atomic = *helmOptions.Atomic
+	}
+	if helmOptions.Timeout != "" {
+		opts.Timeout, _ = time.ParseDuration(helmOptions.Timeout)
+	}
+	if helmOptions.HistoryMax != nil {
+		opts.HistoryMax = *helmOptions.HistoryMax
+	}
+	if helmOptions.Force != nil {
+		opts.Force = *helmOptions.Force
+	}
+	if helmOptions.ResetValues != nil {
+		opts.ResetValues = *helmOptions.ResetValues
+	}
+	return opts
+}
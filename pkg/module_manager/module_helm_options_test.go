@@ -0,0 +1,84 @@
+package module_manager
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/flant/addon-operator/pkg/helm/client"
+	"github.com/flant/addon-operator/pkg/kube_config_manager"
+	"github.com/flant/addon-operator/pkg/utils"
+)
+
+// currentConfigManager returns the config with module configs.
+type currentConfigManager struct {
+	MockKubeConfigManager
+	config *kube_config_manager.Config
+}
+
+func (kcm currentConfigManager) CurrentConfig() *kube_config_manager.Config {
+	return kcm.config
+}
+
+func Test_Module_UpgradeOptions(t *testing.T) {
+	m := NewModule("module", "/modules/module")
+	assert.Equal(t, client.UpgradeOptions{}, m.upgradeOptions(), "no options by default")
+
+	settings, err := NewModuleSettingsFromBytes([]byte(`
+helmOptions:
+  wait: true
+  atomic: true
+  timeout: 10m
+  historyMax: 3
+`))
+	require.NoError(t, err)
+	m.Settings = settings
+	assert.Equal(t, client.UpgradeOptions{
+		Wait:       true,
+		Atomic:     true,
+		Timeout:    10 * time.Minute,
+		HistoryMax: 3,
+	}, m.upgradeOptions())
+
+	// Options from the ConfigMap override module.yaml.
+	moduleConfig, err := utils.NewModuleConfig("module").FromConfigMapData(map[string]string{
+		"moduleHelmOptions": "atomic: false\nforce: true\ntimeout: 1m\n",
+	})
+	require.NoError(t, err)
+	config := kube_config_manager.NewConfig()
+	config.ModuleConfigs["module"] = *moduleConfig
+	m.moduleManager = &moduleManager{kubeConfigManager: currentConfigManager{config: config}}
+
+	assert.Equal(t, client.UpgradeOptions{
+		Wait:       true,
+		Atomic:     false,
+		Timeout:    time.Minute,
+		HistoryMax: 3,
+		Force:      true,
+	}, m.upgradeOptions())
+
+	_, err = NewModuleSettingsFromBytes([]byte("helmOptions:\n  timeout: -1m\n"))
+	assert.Error(t, err)
+	_, err = NewModuleSettingsFromBytes([]byte("helmOptions:\n  recreatePods: true\n"))
+	assert.Error(t, err)
+	_, err = NewModuleSettingsFromBytes([]byte("helmOptions:\n  historyMax: 0\n"))
+	assert.Error(t, err)
+}
+
+func Test_Module_ReleaseChecksum(t *testing.T) {
+	m := NewModule("module", "/modules/module")
+	assert.Equal(t, "manifests", m.releaseChecksum("manifests"), "no options should keep manifests checksum")
+
+	settings, err := NewModuleSettingsFromBytes([]byte("helmOptions:\n  wait: true\n"))
+	require.NoError(t, err)
+	m.Settings = settings
+	withWait := m.releaseChecksum("manifests")
+	assert.NotEqual(t, "manifests", withWait)
+
+	settings, err = NewModuleSettingsFromBytes([]byte("helmOptions:\n  wait: true\n  historyMax: 3\n"))
+	require.NoError(t, err)
+	m.Settings = settings
+	assert.NotEqual(t, withWait, m.releaseChecksum("manifests"), "changed options should change checksum")
+}
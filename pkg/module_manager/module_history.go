@@ -0,0 +1,165 @@
+package module_manager
+
+import (
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/flant/addon-operator/pkg/helm/client"
+	"github.com/flant/addon-operator/pkg/utils"
+)
+
+// ReleaseHistory returns histories of module releases by release name.
+func (m *Module) ReleaseHistory() (map[string][]client.ReleaseRevision, error) {
+	if m.Kind() != ModuleKindHelm {
+		return nil, fmt.Errorf("module '%s' has no Helm releases", m.Name)
+	}
+	charts, err := m.Charts()
+	if err != nil {
+		return nil, err
+	}
+
+	logLabels := map[string]string{"module": m.Name}
+	helmClient := m.helmClient(logLabels)
+
+	res := make(map[string][]client.ReleaseRevision)
+	for _, chart := range charts {
+		releaseName, err := m.chartReleaseName(helmClient, chart, log.WithFields(utils.LabelsToLogFields(logLabels)))
+		if err != nil {
+			return nil, err
+		}
+		exists, err := helmClient.IsReleaseExists(releaseName)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			res[releaseName] = []client.ReleaseRevision{}
+			continue
+		}
+		history, err := helmClient.History(releaseName)
+		if err != nil {
+			return nil, err
+		}
+		res[releaseName] = history
+	}
+	return res, nil
+}
+
+// ManualRollback rolls back the release of the module chart to the revision and pauses upgrades
+// of the release until the rendered chart or values are changed. Chart name can be empty
+// for a module with one chart. It returns the release name.
+func (m *Module) ManualRollback(chartName string, revision string) (string, error) {
+	if m.Kind() != ModuleKindHelm {
+		return "", fmt.Errorf("module '%s' has no Helm releases", m.Name)
+	}
+	charts, err := m.Charts()
+	if err != nil {
+		return "", err
+	}
+	var chart *ModuleChart
+	for i := range charts {
+		if charts[i].Name == chartName || (chartName == "" && len(charts) == 1) {
+			chart = &charts[i]
+		}
+	}
+	if chart == nil {
+		if chartName == "" {
+			return "", fmt.Errorf("module '%s' has several charts, chart name is required", m.Name)
+		}
+		return "", fmt.Errorf("module '%s' has no chart '%s'", m.Name, chartName)
+	}
+
+	logLabels := map[string]string{"module": m.Name}
+	logEntry := log.WithFields(utils.LabelsToLogFields(logLabels))
+	helmClient := m.helmClient(logLabels)
+
+	releaseName, err := m.chartReleaseName(helmClient, *chart, logEntry)
+	if err != nil {
+		return "", err
+	}
+
+	// Checksum of the current release is a checksum of the rendered chart
+	// and values if the module is converged.
+	values, err := helmClient.GetReleaseValues(releaseName)
+	if err != nil {
+		return "", err
+	}
+	checksum, _ := values["_addonOperatorModuleChecksum"].(string)
+	if checksum == "" {
+		// Release is installed without the checksum, so pause upgrades until the rendered chart is changed.
+		checksum, err = m.renderedChartChecksum(*chart, releaseName, logLabels)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	// Pause before the rollback, so a concurrent ModuleRun will not upgrade the release.
+	m.pauseUpgrade(releaseName, checksum)
+	_, err = helmClient.Rollback(releaseName, revision)
+	if err != nil {
+		m.resumeUpgrade(releaseName)
+		return "", err
+	}
+
+	// Monitor checks resources of the upgraded release, it is started again after the next upgrade.
+	m.moduleManager.HelmResourcesManager.StopPartMonitor(m.Name, chart.Name)
+	logEntry.Warnf("Release '%s' is rolled back to revision %s manually, upgrades are paused until the chart or values are changed", releaseName, revision)
+	return releaseName, nil
+}
+
+// renderedChartChecksum returns a checksum of the release with the chart rendered with current values.
+func (m *Module) renderedChartChecksum(chart ModuleChart, releaseName string, logLabels map[string]string) (string, error) {
+	renderInput, err := m.prepareRenderInput(releaseName, m.Namespace(), logLabels)
+	if err != nil {
+		return "", err
+	}
+	renderInput.ChartPath = chart.Path
+	_, manifestsChecksum, err := m.renderChart(chart, renderInput, logLabels)
+	if err != nil {
+		return "", err
+	}
+	return m.releaseChecksum(manifestsChecksum), nil
+}
+
+// UpgradePaused returns true if the release is rolled back manually and
+// the checksum of the rendered chart is not changed since then.
+// A pause for the release is removed if the checksum is changed.
+func (m *Module) UpgradePaused(releaseName string, checksum string) bool {
+	m.upgradePausesMu.Lock()
+	defer m.upgradePausesMu.Unlock()
+	pausedChecksum, has := m.upgradePauses[releaseName]
+	if !has {
+		return false
+	}
+	if pausedChecksum == checksum {
+		return true
+	}
+	delete(m.upgradePauses, releaseName)
+	return false
+}
+
+// PausedReleases returns names of releases with paused upgrades.
+func (m *Module) PausedReleases() []string {
+	m.upgradePausesMu.Lock()
+	defer m.upgradePausesMu.Unlock()
+	res := make([]string, 0, len(m.upgradePauses))
+	for releaseName := range m.upgradePauses {
+		res = append(res, releaseName)
+	}
+	return res
+}
+
+func (m *Module) pauseUpgrade(releaseName string, checksum string) {
+	m.upgradePausesMu.Lock()
+	defer m.upgradePausesMu.Unlock()
+	if m.upgradePauses == nil {
+		m.upgradePauses = make(map[string]string)
+	}
+	m.upgradePauses[releaseName] = checksum
+}
+
+func (m *Module) resumeUpgrade(releaseName string) {
+	m.upgradePausesMu.Lock()
+	defer m.upgradePausesMu.Unlock()
+	delete(m.upgradePauses, releaseName)
+}
@@ -0,0 +1,75 @@
+package module_manager
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/flant/addon-operator/pkg/helm"
+	"github.com/flant/addon-operator/pkg/helm/client"
+	"github.com/flant/addon-operator/pkg/helm_resources_manager"
+	"github.com/flant/addon-operator/pkg/utils"
+)
+
+func Test_Module_UpgradePaused(t *testing.T) {
+	m := NewModule("module", "/modules/module")
+	assert.False(t, m.UpgradePaused("module", "a123"))
+
+	m.pauseUpgrade("module", "a123")
+	assert.True(t, m.UpgradePaused("module", "a123"))
+	assert.True(t, m.UpgradePaused("module", "a123"), "pause is kept while checksum is not changed")
+	assert.Equal(t, []string{"module"}, m.PausedReleases())
+
+	assert.False(t, m.UpgradePaused("module", "b456"), "changed checksum resumes upgrades")
+	assert.False(t, m.UpgradePaused("module", "a123"))
+	assert.Len(t, m.PausedReleases(), 0)
+}
+
+// manualRollbackHelmClient renders a chart and rolls back a release without the checksum in values.
+type manualRollbackHelmClient struct {
+	renderHelmClient
+	RolledBack string
+}
+
+func (h *manualRollbackHelmClient) GetReleaseValues(_ string) (utils.Values, error) {
+	return utils.Values{}, nil
+}
+
+func (h *manualRollbackHelmClient) Rollback(releaseName string, _ string) (string, error) {
+	h.RolledBack = releaseName
+	return "1", nil
+}
+
+func Test_Module_ManualRollback_WithoutChecksum(t *testing.T) {
+	hc := &manualRollbackHelmClient{renderHelmClient: renderHelmClient{MockHelmClient: &helm.MockHelmClient{}}}
+	mm := NewMainModuleManager()
+	mm.WithHelm(&helm.Helm{NewClient: func(_ ...map[string]string) client.HelmClient {
+		return hc
+	}})
+	mm.WithHelmResourcesManager(helm_resources_manager.NewHelmResourcesManager())
+
+	tmpDir, err := ioutil.TempDir("", "addon-operator-rollback-")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+	mm.TempDir = tmpDir
+	require.NoError(t, ioutil.WriteFile(filepath.Join(tmpDir, "Chart.yaml"), []byte("name: module\n"), 0644))
+
+	m := NewModule("module", tmpDir)
+	m.WithModuleManager(mm)
+	m.CommonStaticConfig = utils.NewModuleConfig("module")
+	m.StaticConfig = utils.NewModuleConfig("module")
+
+	releaseName, err := m.ManualRollback("", "")
+	require.NoError(t, err)
+	assert.Equal(t, "module", hc.RolledBack)
+	assert.Equal(t, []string{releaseName}, m.PausedReleases())
+
+	checksum, err := m.renderedChartChecksum(ModuleChart{Path: tmpDir}, releaseName, nil)
+	require.NoError(t, err)
+	assert.NotEmpty(t, checksum)
+	assert.True(t, m.UpgradePaused(releaseName, checksum), "upgrades should be paused until the rendered chart is changed")
+}
@@ -65,6 +65,9 @@ func (m *ModuleHook) GetConfigDescription() string {
 	if m.Config.AfterHelm != nil {
 		msgs = append(msgs, fmt.Sprintf("afterHelm:%d", int64(m.Config.AfterHelm.Order)))
 	}
+	if m.Config.BeforeDeleteHelm != nil {
+		msgs = append(msgs, fmt.Sprintf("beforeDeleteHelm:%d", int64(m.Config.BeforeDeleteHelm.Order)))
+	}
 	if m.Config.AfterDeleteHelm != nil {
 		msgs = append(msgs, fmt.Sprintf("afterDeleteHelm:%d", int64(m.Config.AfterDeleteHelm.Order)))
 	}
@@ -82,6 +85,8 @@ func (m *ModuleHook) Order(binding BindingType) float64 {
 			return m.Config.BeforeHelm.Order
 		case AfterHelm:
 			return m.Config.AfterHelm.Order
+		case BeforeDeleteHelm:
+			return m.Config.BeforeDeleteHelm.Order
 		case AfterDeleteHelm:
 			return m.Config.AfterDeleteHelm.Order
 		}
@@ -142,6 +147,7 @@ func (h *ModuleHook) Run(bindingType BindingType, context []BindingContext, logL
 
 	moduleHookExecutor := NewHookExecutor(h, context, h.Config.Version)
 	moduleHookExecutor.WithLogLabels(logLabels)
+	moduleHookExecutor.WithHelm(h.moduleManager.helm)
 	patches, metrics, err := moduleHookExecutor.Run()
 	if err != nil {
 		return fmt.Errorf("module hook '%s' failed: %s", h.Name, err)
@@ -158,16 +164,14 @@ func (h *ModuleHook) Run(bindingType BindingType, context []BindingContext, logL
 		return err
 	}
 
-	// ValuesLock.Lock()
-	// defer ValuesLock.UnLock()
-	//h.moduleManager.ValuesLock.Lock()
-
 	configValuesPatch, has := patches[utils.ConfigMapPatch]
 	if has && configValuesPatch != nil {
+		h.moduleManager.ValuesLock.RLock()
 		preparedConfigValues := utils.MergeValues(
 			utils.Values{h.Module.ValuesKey(): map[string]interface{}{}},
 			h.moduleManager.kubeModulesConfigValues[moduleName],
 		)
+		h.moduleManager.ValuesLock.RUnlock()
 
 		configValuesPatchResult, err := h.handleModuleValuesPatch(preparedConfigValues, *configValuesPatch)
 		if err != nil {
@@ -176,12 +180,14 @@ func (h *ModuleHook) Run(bindingType BindingType, context []BindingContext, logL
 		if configValuesPatchResult.ValuesChanged {
 			err := h.moduleManager.kubeConfigManager.SetKubeModuleValues(moduleName, configValuesPatchResult.Values)
 			if err != nil {
-				log.Debugf("Module hook '%s' kube module config values stay unchanged:\n%s", h.Name, h.moduleManager.kubeModulesConfigValues[moduleName].DebugString())
+				log.Debugf("Module hook '%s' kube module config values stay unchanged:\n%s", h.Name, preparedConfigValues.DebugString())
 				return fmt.Errorf("module hook '%s': set kube module config failed: %s", h.Name, err)
 			}
 
+			h.moduleManager.ValuesLock.Lock()
 			h.moduleManager.kubeModulesConfigValues[moduleName] = configValuesPatchResult.Values
-			log.Debugf("Module hook '%s': kube module '%s' config values updated:\n%s", h.Name, moduleName, h.moduleManager.kubeModulesConfigValues[moduleName].DebugString())
+			h.moduleManager.ValuesLock.Unlock()
+			log.Debugf("Module hook '%s': kube module '%s' config values updated:\n%s", h.Name, moduleName, configValuesPatchResult.Values.DebugString())
 		}
 	}
 
@@ -196,7 +202,9 @@ func (h *ModuleHook) Run(bindingType BindingType, context []BindingContext, logL
 			return fmt.Errorf("module hook '%s': dynamic module values update error: %s", h.Name, err)
 		}
 		if valuesPatchResult.ValuesChanged {
+			h.moduleManager.ValuesLock.Lock()
 			h.moduleManager.modulesDynamicValuesPatches[moduleName] = utils.AppendValuesPatch(h.moduleManager.modulesDynamicValuesPatches[moduleName], valuesPatchResult.ValuesPatch)
+			h.moduleManager.ValuesLock.Unlock()
 			newValues, err := h.Module.Values()
 			if err != nil {
 				return fmt.Errorf("get module values after values patch: %s", err)
@@ -9,6 +9,7 @@ import (
 	. "github.com/flant/addon-operator/pkg/hook/types"
 	. "github.com/flant/shell-operator/pkg/hook/types"
 
+	"github.com/flant/addon-operator/pkg/task"
 	"github.com/flant/addon-operator/sdk"
 	sh_op_hook "github.com/flant/shell-operator/pkg/hook"
 	"github.com/flant/shell-operator/pkg/hook/config"
@@ -23,9 +24,13 @@ type ModuleHookConfig struct {
 	ModuleV1 *ModuleHookConfigV0
 
 	// effective config values
-	BeforeHelm      *BeforeHelmConfig
-	AfterHelm       *AfterHelmConfig
-	AfterDeleteHelm *AfterDeleteHelmConfig
+	BeforeHelm       *BeforeHelmConfig
+	AfterHelm        *AfterHelmConfig
+	BeforeDeleteHelm *BeforeDeleteHelmConfig
+	AfterDeleteHelm  *AfterDeleteHelmConfig
+
+	// retry policies for failed hook tasks by binding name or binding type
+	RetryPolicies map[string]*task.RetryPolicyConfig
 }
 
 type BeforeHelmConfig struct {
@@ -38,15 +43,22 @@ type AfterHelmConfig struct {
 	Order float64
 }
 
+type BeforeDeleteHelmConfig struct {
+	CommonBindingConfig
+	Order float64
+}
+
 type AfterDeleteHelmConfig struct {
 	CommonBindingConfig
 	Order float64
 }
 
 type ModuleHookConfigV0 struct {
-	BeforeHelm      interface{} `json:"beforeHelm"`
-	AfterHelm       interface{} `json:"afterHelm"`
-	AfterDeleteHelm interface{} `json:"afterDeleteHelm"`
+	BeforeHelm       interface{}                        `json:"beforeHelm"`
+	AfterHelm        interface{}                        `json:"afterHelm"`
+	BeforeDeleteHelm interface{}                        `json:"beforeDeleteHelm"`
+	AfterDeleteHelm  interface{}                        `json:"afterDeleteHelm"`
+	RetryPolicy      map[string]*task.RetryPolicyConfig `json:"retryPolicy"`
 }
 
 func GetModuleHookConfigSchema(version string) *spec.Schema {
@@ -55,7 +67,7 @@ func GetModuleHookConfigSchema(version string) *spec.Schema {
 		schema := config.Schemas[version]
 		switch version {
 		case "v1":
-			// add beforeHelm, afterHelm and afterDeleteHelm properties
+			// add beforeHelm, afterHelm, beforeDeleteHelm and afterDeleteHelm properties
 			schema += `
   beforeHelm:
     type: integer
@@ -63,12 +75,15 @@ func GetModuleHookConfigSchema(version string) *spec.Schema {
   afterHelm:
     type: integer
     example: 10    
+  beforeDeleteHelm:
+    type: integer
+    example: 10
   afterDeleteHelm:
     type: integer
     example: 10   
 `
 		case "v0":
-			// add beforeHelm, afterHelm and afterDeleteHelm properties
+			// add beforeHelm, afterHelm, beforeDeleteHelm and afterDeleteHelm properties
 			schema += `
   beforeHelm:
     type: integer
@@ -76,11 +91,15 @@ func GetModuleHookConfigSchema(version string) *spec.Schema {
   afterHelm:
     type: integer
     example: 10    
+  beforeDeleteHelm:
+    type: integer
+    example: 10
   afterDeleteHelm:
     type: integer
     example: 10    
 `
 		}
+		schema += retryPolicySchema
 		config.Schemas[globalHookVersion] = schema
 	}
 
@@ -156,10 +175,18 @@ func (c *ModuleHookConfig) ConvertAndCheckV0() (err error) {
 	if err != nil {
 		return err
 	}
+	c.BeforeDeleteHelm, err = c.ConvertBeforeDeleteHelm(c.ModuleV0.BeforeDeleteHelm)
+	if err != nil {
+		return err
+	}
 	c.AfterDeleteHelm, err = c.ConvertAfterDeleteHelm(c.ModuleV0.AfterDeleteHelm)
 	if err != nil {
 		return err
 	}
+	c.RetryPolicies, err = ConvertRetryPolicies(c.ModuleV0.RetryPolicy)
+	if err != nil {
+		return err
+	}
 
 	return nil
 }
@@ -173,10 +200,18 @@ func (c *ModuleHookConfig) ConvertAndCheckV1() (err error) {
 	if err != nil {
 		return err
 	}
+	c.BeforeDeleteHelm, err = c.ConvertBeforeDeleteHelm(c.ModuleV1.BeforeDeleteHelm)
+	if err != nil {
+		return err
+	}
 	c.AfterDeleteHelm, err = c.ConvertAfterDeleteHelm(c.ModuleV1.AfterDeleteHelm)
 	if err != nil {
 		return err
 	}
+	c.RetryPolicies, err = ConvertRetryPolicies(c.ModuleV1.RetryPolicy)
+	if err != nil {
+		return err
+	}
 
 	return nil
 }
@@ -205,6 +240,18 @@ func (c *ModuleHookConfig) ConvertAfterHelm(value interface{}) (*AfterHelmConfig
 	return res, nil
 }
 
+func (c *ModuleHookConfig) ConvertBeforeDeleteHelm(value interface{}) (*BeforeDeleteHelmConfig, error) {
+	floatValue, err := sh_op_hook.ConvertFloatForBinding(value, "beforeDeleteHelm")
+	if err != nil || floatValue == nil {
+		return nil, err
+	}
+
+	res := &BeforeDeleteHelmConfig{}
+	res.BindingName = ContextBindingType[BeforeDeleteHelm]
+	res.Order = *floatValue
+	return res, nil
+}
+
 func (c *ModuleHookConfig) ConvertAfterDeleteHelm(value interface{}) (*AfterDeleteHelmConfig, error) {
 	floatValue, err := sh_op_hook.ConvertFloatForBinding(value, "afterDeleteHelm")
 	if err != nil || floatValue == nil {
@@ -220,7 +267,7 @@ func (c *ModuleHookConfig) ConvertAfterDeleteHelm(value interface{}) (*AfterDele
 func (c *ModuleHookConfig) Bindings() []BindingType {
 	res := []BindingType{}
 
-	for _, binding := range []BindingType{OnStartup, Schedule, OnKubernetesEvent, BeforeHelm, AfterHelm, AfterDeleteHelm} {
+	for _, binding := range []BindingType{OnStartup, Schedule, OnKubernetesEvent, BeforeHelm, AfterHelm, BeforeDeleteHelm, AfterDeleteHelm} {
 		if c.HasBinding(binding) {
 			res = append(res, binding)
 		}
@@ -238,6 +285,8 @@ func (c *ModuleHookConfig) HasBinding(binding BindingType) bool {
 		return c.BeforeHelm != nil
 	case AfterHelm:
 		return c.AfterHelm != nil
+	case BeforeDeleteHelm:
+		return c.BeforeDeleteHelm != nil
 	case AfterDeleteHelm:
 		return c.AfterDeleteHelm != nil
 	}
@@ -247,7 +296,7 @@ func (c *ModuleHookConfig) HasBinding(binding BindingType) bool {
 func (c *ModuleHookConfig) BindingsCount() int {
 	res := 0
 
-	for _, binding := range []BindingType{OnStartup, BeforeHelm, AfterHelm, AfterDeleteHelm} {
+	for _, binding := range []BindingType{OnStartup, BeforeHelm, AfterHelm, BeforeDeleteHelm, AfterDeleteHelm} {
 		if c.HasBinding(binding) {
 			res++
 		}
@@ -279,11 +328,19 @@ func NewModuleHookConfigFromGoConfig(input *sdk.HookConfig) *ModuleHookConfig {
 		cfg.AfterHelm.Order = input.OnAfterHelm.Order
 	}
 
+	if input.OnBeforeDeleteHelm != nil {
+		cfg.BeforeDeleteHelm = &BeforeDeleteHelmConfig{}
+		cfg.BeforeDeleteHelm.BindingName = ContextBindingType[BeforeDeleteHelm]
+		cfg.BeforeDeleteHelm.Order = input.OnBeforeDeleteHelm.Order
+	}
+
 	if input.OnAfterDeleteHelm != nil {
 		cfg.AfterDeleteHelm = &AfterDeleteHelmConfig{}
 		cfg.AfterDeleteHelm.BindingName = ContextBindingType[AfterDeleteHelm]
 		cfg.AfterDeleteHelm.Order = input.OnAfterDeleteHelm.Order
 	}
 
+	cfg.RetryPolicies = NewRetryPoliciesFromGoConfig(input.RetryPolicy)
+
 	return cfg
 }
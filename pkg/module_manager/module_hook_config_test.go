@@ -27,6 +27,7 @@ func Test_ModuleHook_Config_v0_v1(t *testing.T) {
                "schedule":[{"crontab":"*/5 * * * * *"}],
                "beforeHelm": 5,
                "afterHelm": 15,
+               "beforeDeleteHelm": 20,
                "afterDeleteHelm": 25
              }`,
 			func() {
@@ -40,6 +41,8 @@ func Test_ModuleHook_Config_v0_v1(t *testing.T) {
 				g.Expect(config.BeforeHelm.Order).To(Equal(5.0))
 				g.Expect(config.HasBinding(AfterHelm)).To(BeTrue())
 				g.Expect(config.AfterHelm.Order).To(Equal(15.0))
+				g.Expect(config.HasBinding(BeforeDeleteHelm)).To(BeTrue())
+				g.Expect(config.BeforeDeleteHelm.Order).To(Equal(20.0))
 				g.Expect(config.HasBinding(AfterDeleteHelm)).To(BeTrue())
 				g.Expect(config.AfterDeleteHelm.Order).To(Equal(25.0))
 			},
@@ -88,6 +91,7 @@ kubernetes:
   watchEvent: ["Added"]
 beforeHelm: 98
 afterHelm: 58
+beforeDeleteHelm: 8
 afterDeleteHelm: 18
 `,
 			func() {
@@ -101,10 +105,37 @@ afterDeleteHelm: 18
 				g.Expect(config.BeforeHelm.Order).To(Equal(98.0))
 				g.Expect(config.HasBinding(AfterHelm)).To(BeTrue())
 				g.Expect(config.AfterHelm.Order).To(Equal(58.0))
+				g.Expect(config.HasBinding(BeforeDeleteHelm)).To(BeTrue())
+				g.Expect(config.BeforeDeleteHelm.Order).To(Equal(8.0))
+				g.Expect(config.Bindings()).To(HaveLen(6))
 				g.Expect(config.HasBinding(AfterDeleteHelm)).To(BeTrue())
 				g.Expect(config.AfterDeleteHelm.Order).To(Equal(18.0))
 			},
 		},
+		{
+			"load v1 module config with retryPolicy",
+			"hook_v1",
+			`{"configVersion": "v1",
+                 "kubernetes":[{"name":"pods", "kind":"Pod"}],
+                 "beforeHelm": 10,
+                 "retryPolicy": {"pods": {"initialDelay": "1s", "maxDelay": "30s"}, "beforeHelm": {"multiplier": 3}}}`,
+			func() {
+				g.Expect(err).ShouldNot(HaveOccurred())
+				g.Expect(config.RetryPolicies).To(HaveLen(2))
+				g.Expect(RetryPolicyConfigForBinding(config.RetryPolicies, "pods", OnKubernetesEvent).MaxDelay).To(Equal("30s"))
+				g.Expect(*RetryPolicyConfigForBinding(config.RetryPolicies, "", BeforeHelm).Multiplier).To(Equal(3.0))
+				g.Expect(RetryPolicyConfigForBinding(config.RetryPolicies, "", AfterHelm)).To(BeNil())
+			},
+		},
+		{
+			"load v1 module config with bad retryPolicy",
+			"hook_v1",
+			`{"configVersion": "v1", "beforeHelm": 10, "retryPolicy": {"beforeHelm": {"initialDelay": "1m", "maxDelay": "1s"}}}`,
+			func() {
+				g.Expect(err).Should(HaveOccurred())
+				g.Expect(err.Error()).Should(ContainSubstring("invalid retryPolicy for 'beforeHelm'"))
+			},
+		},
 		{
 			"load v1 bad module config",
 			"hook_v1",
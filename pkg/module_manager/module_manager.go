@@ -26,6 +26,7 @@ import (
 
 	"github.com/flant/addon-operator/pkg/app"
 	"github.com/flant/addon-operator/pkg/helm"
+	"github.com/flant/addon-operator/pkg/helm/client"
 	"github.com/flant/addon-operator/pkg/helm_resources_manager"
 	"github.com/flant/addon-operator/pkg/kube_config_manager"
 	"github.com/flant/addon-operator/pkg/utils"
@@ -41,12 +42,15 @@ type ModuleManager interface {
 	// Dependencies
 	WithContext(ctx context.Context)
 	WithDirectories(modulesDir string, globalHooksDir string, tempDir string) ModuleManager
+	WithKubeClient(client kube.KubernetesClient)
 	WithKubeEventManager(kube_events_manager.KubeEventsManager)
 	WithScheduleManager(schedule_manager.ScheduleManager)
 	WithKubeConfigManager(kubeConfigManager kube_config_manager.KubeConfigManager) ModuleManager
 	WithHelmResourcesManager(manager helm_resources_manager.HelmResourcesManager)
 	WithMetricStorage(storage *metric_storage.MetricStorage)
 	WithHookMetricStorage(storage *metric_storage.MetricStorage)
+	WithHelm(h *helm.Helm)
+	WithConfigMapName(name string)
 
 	GetGlobalHooksInOrder(bindingType BindingType) []string
 	GetGlobalHook(name string) *GlobalHook
@@ -56,6 +60,7 @@ type ModuleManager interface {
 	GetModuleHookNames(moduleName string) []string
 	GetModuleHook(name string) *ModuleHook
 	GetModuleHooksInOrder(moduleName string, bindingType BindingType) []string
+	IsModulePaused(moduleName string) bool
 
 	GlobalConfigValues() utils.Values
 	GlobalValues() (utils.Values, error)
@@ -63,6 +68,7 @@ type ModuleManager interface {
 
 	// Actions for tasks
 	DiscoverModulesState(logLabels map[string]string) (*ModulesState, error)
+	ReloadDirectories(logLabels map[string]string) (*DirectoriesChanges, error)
 	DeleteModule(moduleName string, logLabels map[string]string) error
 	RunModule(moduleName string, onStartup bool, logLabels map[string]string, afterStartupCb func() error) (bool, error)
 	RunGlobalHook(hookName string, binding BindingType, bindingContext []BindingContext, logLabels map[string]string) (beforeChecksum string, afterChecksum string, err error)
@@ -99,6 +105,8 @@ type ModulesState struct {
 	ModulesToDisable []string
 	// modules that should be purged
 	ReleasedUnknownModules []string
+	// releases of unknown modules that are not owned by Addon-operator and should not be purged
+	NotOwnedUnknownReleases []string
 	// modules that was disabled and now are enabled
 	NewlyEnabledModules []string
 }
@@ -107,7 +115,8 @@ type moduleManager struct {
 	ctx    context.Context
 	cancel context.CancelFunc
 
-	ValuesLock sync.Mutex
+	// ValuesLock protects values storages from concurrent access by parallel tasks.
+	ValuesLock sync.RWMutex
 
 	// Directories
 	ModulesDir     string
@@ -123,6 +132,15 @@ type moduleManager struct {
 	metricStorage        *metric_storage.MetricStorage
 	hookMetricStorage    *metric_storage.MetricStorage
 
+	// helm creates Helm clients and release names of the Addon-operator instance.
+	helm *helm.Helm
+	// configMapName is a name of the ConfigMap with values of the Addon-operator instance.
+	configMapName string
+
+	// indexLock protects indexes of modules and hooks: hot reload replaces them
+	// while hook queues and parallel queues read them.
+	indexLock sync.RWMutex
+
 	// Index of all modules in modules directory. Key is module name.
 	allModulesByName map[string]*Module
 
@@ -160,6 +178,11 @@ type moduleManager struct {
 
 	kubernetesBindingSynchronizationState map[string]*KubernetesBindingSynchronizationState
 
+	// Checksums of global hooks and modules to detect changes on hot reload.
+	globalHooksChecksums            map[string]string
+	modulesChecksums                map[string]string
+	commonStaticValuesChecksumValue string
+
 	// VALUE STORAGES
 
 	// Values from modules/values.yaml file
@@ -232,7 +255,7 @@ type Event struct {
 func NewMainModuleManager() *moduleManager {
 	return &moduleManager{
 		EventCh:    make(chan Event),
-		ValuesLock: sync.Mutex{},
+		ValuesLock: sync.RWMutex{},
 
 		allModulesByName:            make(map[string]*Module),
 		allModulesNamesInOrder:      make([]string, 0),
@@ -272,6 +295,10 @@ func (mm *moduleManager) WithKubeConfigManager(kubeConfigManager kube_config_man
 	return mm
 }
 
+func (mm *moduleManager) WithKubeClient(client kube.KubernetesClient) {
+	mm.KubeClient = client
+}
+
 func (mm *moduleManager) WithKubeEventManager(mgr kube_events_manager.KubeEventsManager) {
 	mm.kubeEventsManager = mgr
 }
@@ -292,6 +319,14 @@ func (mm *moduleManager) WithHookMetricStorage(storage *metric_storage.MetricSto
 	mm.hookMetricStorage = storage
 }
 
+func (mm *moduleManager) WithHelm(h *helm.Helm) {
+	mm.helm = h
+}
+
+func (mm *moduleManager) WithConfigMapName(name string) {
+	mm.configMapName = name
+}
+
 func (mm *moduleManager) WithContext(ctx context.Context) {
 	mm.ctx, mm.cancel = context.WithCancel(ctx)
 }
@@ -311,6 +346,10 @@ func (mm *moduleManager) RunModulesEnabledScript(enabledByConfig []string, logLa
 		moduleLogLabels := utils.MergeLabels(logLabels)
 		moduleLogLabels["module"] = name
 		module := mm.allModulesByName[name]
+		// Removed module has no enabled script, it is disabled to be deleted.
+		if module.State.Removed {
+			continue
+		}
 		moduleIsEnabled, err := module.checkIsEnabledByScript(enabledModules, moduleLogLabels)
 		if err != nil {
 			return nil, err
@@ -334,8 +373,10 @@ type kubeUpdate struct {
 
 func (mm *moduleManager) applyKubeUpdate(kubeUpdate *kubeUpdate) error {
 	log.Debugf("Apply kubeupdate %+v", kubeUpdate)
+	mm.ValuesLock.Lock()
 	mm.kubeGlobalConfigValues = kubeUpdate.KubeGlobalConfigValues
 	mm.kubeModulesConfigValues = kubeUpdate.KubeModulesConfigValues
+	mm.ValuesLock.Unlock()
 	mm.enabledModulesByConfig = kubeUpdate.EnabledModulesByConfig
 
 	for _, event := range kubeUpdate.Events {
@@ -456,6 +497,19 @@ func (mm *moduleManager) handleNewKubeModuleConfigs(moduleConfigs kube_config_ma
 			}
 		}
 
+		// ModuleDelete is skipped for paused modules, so unpause of the disabled module
+		// should start modules discovery to queue ModuleDelete again.
+		mm.indexLock.RLock()
+		for name, module := range mm.allModulesByName {
+			moduleConfig, hasKubeConfig := moduleConfigs[name]
+			if module.State.DeletePaused && !(hasKubeConfig && moduleConfig.IsPaused) {
+				logEntry.Infof("disabled module '%s' is unpaused: generate GlobalChanged event", name)
+				res.Events = append(res.Events, Event{Type: GlobalChanged})
+				break
+			}
+		}
+		mm.indexLock.RUnlock()
+
 		if len(moduleChanges) > 0 {
 			logEntry.Infof("fire ModulesChanged event for %d modules", len(moduleChanges))
 			logEntry.Debugf("event changes: %v", moduleChanges)
@@ -536,6 +590,18 @@ func (mm *moduleManager) Init() error {
 		return err
 	}
 
+	if app.HotReloadInterval > 0 {
+		if err := mm.saveDirectoriesChecksums(); err != nil {
+			return err
+		}
+	}
+
+	// ConfigMap is loaded after modules are registered: keys are matched with module names.
+	mm.kubeConfigManager.WithKnownModuleNames(mm.allModuleNames)
+	if err := mm.kubeConfigManager.Init(); err != nil {
+		return fmt.Errorf("init kube config manager: %s", err)
+	}
+
 	kubeConfig := mm.kubeConfigManager.InitialConfig()
 	mm.kubeGlobalConfigValues = kubeConfig.Values
 
@@ -547,7 +613,7 @@ func (mm *moduleManager) Init() error {
 		unknownNames = append(unknownNames, config.ModuleName)
 	}
 	if len(unknownNames) > 0 {
-		log.Warnf("ConfigMap/%s has values for absent modules: %+v", app.ConfigMapName, unknownNames)
+		log.Warnf("ConfigMap/%s has values for absent modules: %+v", mm.configMapName, unknownNames)
 	}
 
 	return nil
@@ -557,6 +623,9 @@ func (mm *moduleManager) Init() error {
 func (mm *moduleManager) Start() {
 	go mm.kubeConfigManager.Start()
 
+	configUpdated := mm.kubeConfigManager.ConfigUpdated()
+	moduleConfigsUpdated := mm.kubeConfigManager.ModuleConfigsUpdated()
+
 	go func() {
 		for {
 			select {
@@ -577,7 +646,7 @@ func (mm *moduleManager) Start() {
 					},
 				}
 
-			case newKubeConfig := <-kube_config_manager.ConfigUpdated:
+			case newKubeConfig := <-configUpdated:
 				handleRes, err := mm.handleNewKubeConfig(newKubeConfig)
 				if err != nil {
 					log.Errorf("MODULE_MANAGER_RUN unable to handle kube config update: %s", err)
@@ -589,7 +658,7 @@ func (mm *moduleManager) Start() {
 					}
 				}
 
-			case newModuleConfigs := <-kube_config_manager.ModuleConfigsUpdated:
+			case newModuleConfigs := <-moduleConfigsUpdated:
 				// Сбросить запомненные перед ошибкой конфиги
 				mm.moduleConfigsUpdateBeforeAmbiguos = kube_config_manager.ModuleConfigs{}
 
@@ -608,7 +677,7 @@ func (mm *moduleManager) Start() {
 			case <-mm.retryOnAmbiguous:
 				if len(mm.moduleConfigsUpdateBeforeAmbiguos) != 0 {
 					log.Infof("MODULE_MANAGER_RUN Retry saved moduleConfigs: %v", mm.moduleConfigsUpdateBeforeAmbiguos)
-					kube_config_manager.ModuleConfigsUpdated <- mm.moduleConfigsUpdateBeforeAmbiguos
+					moduleConfigsUpdated <- mm.moduleConfigsUpdateBeforeAmbiguos
 				} else {
 					log.Debugf("MODULE_MANAGER_RUN Retry IS NOT needed")
 				}
@@ -650,7 +719,9 @@ func (mm *moduleManager) DiscoverModulesState(logLabels map[string]string) (stat
 	updateEnabledModules = utils.SortByReference(updateEnabledModules, mm.allModulesNamesInOrder)
 
 	mm.enabledModulesByConfig = updateEnabledModules
+	mm.ValuesLock.Lock()
 	mm.kubeModulesConfigValues = updateModuleValues
+	mm.ValuesLock.Unlock()
 
 	logEntry.Debugf("DISCOVER state updated:\n"+
 		"    mm.enabledModulesByConfig: %v\n"+
@@ -661,22 +732,40 @@ func (mm *moduleManager) DiscoverModulesState(logLabels map[string]string) (stat
 	state = &ModulesState{
 		EnabledModules:         []string{},
 		ModulesToDisable:       []string{},
-		ReleasedUnknownModules: []string{},
+		ReleasedUnknownModules:  []string{},
+		NotOwnedUnknownReleases: []string{},
 		NewlyEnabledModules:    []string{},
 	}
 
-	releasedModules, err := helm.NewClient(discoverLogLabels).ListReleasesNames(nil)
+	releasedModules, unknownReleases, err := mm.listReleasedModules(discoverLogLabels)
+	if err != nil {
+		return nil, err
+	}
+
+	// Only releases created by Addon-operator can be purged.
+	ownedReleases, err := mm.helm.ListOwnedReleases(mm.helm.NewClient(discoverLogLabels), nil)
 	if err != nil {
 		return nil, err
 	}
 
 	// calculate unknown released modules to purge them in reverse order
-	state.ReleasedUnknownModules = utils.ListSubtract(releasedModules, mm.allModulesNamesInOrder)
+	state.ReleasedUnknownModules = utils.ListIntersection(unknownReleases, ownedReleases)
+	state.NotOwnedUnknownReleases = utils.ListSubtract(unknownReleases, ownedReleases)
 	// purge unknown modules in reverse order
 	state.ReleasedUnknownModules = utils.SortReverse(state.ReleasedUnknownModules)
 	if len(state.ReleasedUnknownModules) > 0 {
 		logEntry.Infof("found modules with releases: %s", state.ReleasedUnknownModules)
 	}
+	if len(state.NotOwnedUnknownReleases) > 0 {
+		logEntry.Infof("found releases not owned by addon-operator, ignore them: %s", state.NotOwnedUnknownReleases)
+	}
+
+	// Manifests modules have no releases, they are found by inventories.
+	manifestsModules, err := mm.listManifestsModules()
+	if err != nil {
+		return nil, err
+	}
+	releasedModules = utils.ListUnion(releasedModules, manifestsModules)
 
 	// ignore unknown released modules for next operations
 	releasedModules = utils.ListIntersection(releasedModules, mm.allModulesNamesInOrder)
@@ -702,7 +791,9 @@ func (mm *moduleManager) DiscoverModulesState(logLabels map[string]string) (stat
 
 	state.NewlyEnabledModules = utils.ListSubtract(enabledModules, mm.enabledModulesInOrder)
 	// save enabled modules for future usages
+	mm.indexLock.Lock()
 	mm.enabledModulesInOrder = enabledModules
+	mm.indexLock.Unlock()
 
 	// Calculate disabled known modules that has helm release and/or was enabled.
 	// Sort them in reverse order for proper deletion.
@@ -712,25 +803,128 @@ func (mm *moduleManager) DiscoverModulesState(logLabels map[string]string) (stat
 	// disable modules in reverse order
 	state.ModulesToDisable = utils.SortReverseByReference(state.ModulesToDisable, mm.allModulesNamesInOrder)
 
+	// Removed modules are forgotten after ModuleDelete. Modules without releases
+	// that were not enabled have nothing to delete.
+	for _, moduleName := range utils.ListSubtract(mm.allModulesNamesInOrder, state.ModulesToDisable) {
+		if mm.allModulesByName[moduleName].State.Removed {
+			logEntry.Infof("Module '%s' is removed and has nothing to delete", moduleName)
+			mm.forgetRemovedModule(moduleName)
+		}
+	}
+
 	logEntry.Debugf("DISCOVER state results:\n"+
 		"    mm.enabledModulesByConfig: %v\n"+
 		"    mm.enabledModulesInOrder: %v\n"+
 		"    releasedModules: %v\n"+
 		"    ReleasedUnknownModules: %v\n"+
+		"    NotOwnedUnknownReleases: %v\n"+
 		"    ModulesToDisable: %v\n"+
 		"    NewlyEnabled: %v\n",
 		mm.enabledModulesByConfig,
 		mm.enabledModulesInOrder,
 		releasedModules,
 		state.ReleasedUnknownModules,
+		state.NotOwnedUnknownReleases,
 		state.ModulesToDisable,
 		state.NewlyEnabledModules)
 	return
 }
 
+// listReleasedModules returns names of known modules with releases and names of
+// releases of unknown modules. Releases of known modules are searched by generated,
+// legacy and chart release names in the addon-operator namespace and in target namespaces of modules.
+// Releases with legacy names owned by another Addon-operator are not releases of known modules.
+// Releases of unknown modules are searched only in the addon-operator namespace.
+func (mm *moduleManager) listReleasedModules(logLabels map[string]string) ([]string, []string, error) {
+	helmClient := mm.helm.NewClient(logLabels)
+	releases, err := helmClient.ListReleasesNames(nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Module names by release names in the addon-operator namespace and in other namespaces.
+	modulesByRelease := make(map[string]string)
+	modulesByNamespace := make(map[string]map[string]string)
+	legacyNames := make(map[string]bool)
+	for _, moduleName := range mm.allModulesNamesInOrder {
+		module := mm.allModulesByName[moduleName]
+		legacyNames[module.legacyHelmReleaseName()] = true
+		names := module.knownReleaseNames()
+		for _, name := range names {
+			modulesByRelease[name] = moduleName
+		}
+		namespace := module.Namespace()
+		if namespace == app.Namespace {
+			continue
+		}
+		if _, has := modulesByNamespace[namespace]; !has {
+			modulesByNamespace[namespace] = make(map[string]string)
+		}
+		for _, name := range names {
+			modulesByNamespace[namespace][name] = moduleName
+		}
+	}
+
+	releasedModules := make([]string, 0)
+	unknownReleases := make([]string, 0)
+	for _, release := range releases {
+		moduleName, has := modulesByRelease[release]
+		if has && legacyNames[release] {
+			has, err = mm.isReleaseNotOwnedByOther(helmClient, release, logLabels)
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+		if has {
+			releasedModules = utils.ListUnion(releasedModules, []string{moduleName})
+			continue
+		}
+		unknownReleases = append(unknownReleases, release)
+	}
+
+	for namespace, namespaceModules := range modulesByNamespace {
+		helmClient := mm.helm.NewClient(logLabels)
+		helmClient.WithNamespace(namespace)
+		namespaceReleases, err := helmClient.ListReleasesNames(nil)
+		if err != nil {
+			return nil, nil, fmt.Errorf("list releases in namespace '%s': %v", namespace, err)
+		}
+		for _, release := range namespaceReleases {
+			moduleName, has := namespaceModules[release]
+			if has && legacyNames[release] {
+				has, err = mm.isReleaseNotOwnedByOther(helmClient, release, logLabels)
+				if err != nil {
+					return nil, nil, err
+				}
+			}
+			if has {
+				releasedModules = utils.ListUnion(releasedModules, []string{moduleName})
+			}
+		}
+	}
+
+	return releasedModules, unknownReleases, nil
+}
+
+// isReleaseNotOwnedByOther returns false if the release is owned by another Addon-operator.
+func (mm *moduleManager) isReleaseNotOwnedByOther(helmClient client.HelmClient, releaseName string, logLabels map[string]string) (bool, error) {
+	owner, err := releaseOtherOwner(mm.helm, helmClient, releaseName)
+	if err != nil {
+		return false, err
+	}
+	if owner != "" {
+		log.WithFields(utils.LabelsToLogFields(logLabels)).
+			Debugf("Release '%s' is not owned by addon-operator, it is owned by '%s', ignore it", releaseName, owner)
+		return false, nil
+	}
+	return true, nil
+}
+
 // TODO replace with Module and ModuleShouldExists
 func (mm *moduleManager) GetModule(name string) *Module {
+	mm.indexLock.RLock()
 	module, exist := mm.allModulesByName[name]
+	mm.indexLock.RUnlock()
 	if exist {
 		return module
 	} else {
@@ -739,12 +933,23 @@ func (mm *moduleManager) GetModule(name string) *Module {
 	}
 }
 
+// allModuleNames returns names of all registered modules.
+func (mm *moduleManager) allModuleNames() []string {
+	mm.indexLock.RLock()
+	defer mm.indexLock.RUnlock()
+	return mm.allModulesNamesInOrder
+}
+
 func (mm *moduleManager) GetModuleNamesInOrder() []string {
+	mm.indexLock.RLock()
+	defer mm.indexLock.RUnlock()
 	return mm.enabledModulesInOrder
 }
 
 func (mm *moduleManager) GetGlobalHook(name string) *GlobalHook {
+	mm.indexLock.RLock()
 	globalHook, exist := mm.globalHooksByName[name]
+	mm.indexLock.RUnlock()
 	if exist {
 		return globalHook
 	} else {
@@ -754,6 +959,8 @@ func (mm *moduleManager) GetGlobalHook(name string) *GlobalHook {
 }
 
 func (mm *moduleManager) GetModuleHook(name string) *ModuleHook {
+	mm.indexLock.RLock()
+	defer mm.indexLock.RUnlock()
 	for _, bindingHooks := range mm.modulesHooksOrderByName {
 		for _, hooks := range bindingHooks {
 			for _, hook := range hooks {
@@ -768,7 +975,11 @@ func (mm *moduleManager) GetModuleHook(name string) *ModuleHook {
 }
 
 func (mm *moduleManager) GetGlobalHooksInOrder(bindingType BindingType) []string {
+	mm.indexLock.RLock()
 	globalHooks, ok := mm.globalHooksOrder[bindingType]
+	// Sort a copy: index can be read by other queues.
+	globalHooks = append([]*GlobalHook{}, globalHooks...)
+	mm.indexLock.RUnlock()
 	if !ok {
 		return []string{}
 	}
@@ -786,14 +997,13 @@ func (mm *moduleManager) GetGlobalHooksInOrder(bindingType BindingType) []string
 }
 
 func (mm *moduleManager) GetModuleHooksInOrder(moduleName string, bindingType BindingType) []string {
-
+	mm.indexLock.RLock()
 	moduleHooksByBinding, ok := mm.modulesHooksOrderByName[moduleName]
-	if !ok {
-		return []string{}
-	}
-
-	moduleBindingHooks, ok := moduleHooksByBinding[bindingType]
-	if !ok {
+	moduleBindingHooks, hasBinding := moduleHooksByBinding[bindingType]
+	// Sort a copy: index can be read by other queues.
+	moduleBindingHooks = append([]*ModuleHook{}, moduleBindingHooks...)
+	mm.indexLock.RUnlock()
+	if !ok || !hasBinding {
 		return []string{}
 	}
 
@@ -810,6 +1020,8 @@ func (mm *moduleManager) GetModuleHooksInOrder(moduleName string, bindingType Bi
 }
 
 func (mm *moduleManager) GetModuleHookNames(moduleName string) []string {
+	mm.indexLock.RLock()
+	defer mm.indexLock.RUnlock()
 	moduleHooksByBinding, ok := mm.modulesHooksOrderByName[moduleName]
 	if !ok {
 		return []string{}
@@ -833,6 +1045,9 @@ func (mm *moduleManager) GetModuleHookNames(moduleName string) []string {
 // TODO: moduleManager.GetModule(modName).Delete()
 func (mm *moduleManager) DeleteModule(moduleName string, logLabels map[string]string) error {
 	module := mm.GetModule(moduleName)
+	if module == nil {
+		return fmt.Errorf("module '%s' is not found", moduleName)
+	}
 
 	// Stop kubernetes informers and remove scheduled functions
 	mm.DisableModuleHooks(moduleName)
@@ -841,8 +1056,15 @@ func (mm *moduleManager) DeleteModule(moduleName string, logLabels map[string]st
 		return err
 	}
 
+	if module.State.Removed {
+		mm.forgetRemovedModule(moduleName)
+		return nil
+	}
+
 	// remove module hooks from indexes
+	mm.indexLock.Lock()
 	delete(mm.modulesHooksOrderByName, moduleName)
+	mm.indexLock.Unlock()
 
 	return nil
 }
@@ -947,6 +1169,8 @@ func (mm *moduleManager) RunModuleHook(hookName string, binding BindingType, bin
 
 // GlobalConfigValues return global values defined in a ConfigMap
 func (mm *moduleManager) GlobalConfigValues() utils.Values {
+	mm.ValuesLock.RLock()
+	defer mm.ValuesLock.RUnlock()
 	return utils.MergeValues(
 		utils.Values{"global": map[string]interface{}{}},
 		mm.kubeGlobalConfigValues,
@@ -957,6 +1181,9 @@ func (mm *moduleManager) GlobalConfigValues() utils.Values {
 func (mm *moduleManager) GlobalValues() (utils.Values, error) {
 	var err error
 
+	mm.ValuesLock.RLock()
+	defer mm.ValuesLock.RUnlock()
+
 	res := utils.MergeValues(
 		utils.Values{"global": map[string]interface{}{}},
 		mm.commonStaticValues.Global(),
@@ -1056,6 +1283,15 @@ func (mm *moduleManager) StartModuleHooks(moduleName string) {
 	}
 }
 
+// IsModulePaused returns true if module is paused in ConfigMap.
+func (mm *moduleManager) IsModulePaused(moduleName string) bool {
+	if mm.kubeConfigManager == nil || mm.kubeConfigManager.CurrentConfig() == nil {
+		return false
+	}
+	moduleConfig, has := mm.kubeConfigManager.CurrentConfig().ModuleConfigs[moduleName]
+	return has && moduleConfig.IsPaused
+}
+
 func (mm *moduleManager) DisableModuleHooks(moduleName string) {
 	kubeHooks := mm.GetModuleHooksInOrder(moduleName, OnKubernetesEvent)
 
@@ -67,6 +67,7 @@ func initModuleManager(t *testing.T, mm *moduleManager, configPath string) {
 		KubeConfigManager.WithNamespace("default")
 		KubeConfigManager.WithConfigMapName("addon-operator")
 		KubeConfigManager.WithValuesChecksumsAnnotation(app.ValuesChecksumsAnnotation)
+		KubeConfigManager.WithKnownModuleNames(mm.allModuleNames)
 
 		err = KubeConfigManager.Init()
 		if err != nil {
@@ -242,23 +243,31 @@ func Test_MainModuleManager_Get_Module(t *testing.T) {
 					Name: "module",
 					Path: filepath.Join(mm.ModulesDir, "000-module"),
 					CommonStaticConfig: &utils.ModuleConfig{
-						ModuleName:       "module",
-						Values:           utils.Values{},
-						IsEnabled:        nil,
-						IsUpdated:        false,
-						ModuleConfigKey:  "module",
-						ModuleEnabledKey: "moduleEnabled",
-						RawConfig:        []string{},
+						ModuleName:           "module",
+						Values:               utils.Values{},
+						IsEnabled:            nil,
+						IsUpdated:            false,
+						ModuleConfigKey:      "module",
+						ModuleEnabledKey:     "moduleEnabled",
+						ModulePausedKey:      "modulePaused",
+						ModuleNamespaceKey:   "moduleNamespace",
+						ModuleHelmOptionsKey: "moduleHelmOptions",
+						RawConfig:            []string{},
 					},
 					StaticConfig: &utils.ModuleConfig{
-						ModuleName:       "module",
-						Values:           utils.Values{},
-						IsEnabled:        nil,
-						IsUpdated:        false,
-						ModuleConfigKey:  "module",
-						ModuleEnabledKey: "moduleEnabled",
-						RawConfig:        []string{},
+						ModuleName:           "module",
+						Values:               utils.Values{},
+						IsEnabled:            nil,
+						IsUpdated:            false,
+						ModuleConfigKey:      "module",
+						ModuleEnabledKey:     "moduleEnabled",
+						ModulePausedKey:      "modulePaused",
+						ModuleNamespaceKey:   "moduleNamespace",
+						ModuleHelmOptionsKey: "moduleHelmOptions",
+						RawConfig:            []string{},
 					},
+					Settings:      &ModuleSettings{},
+					kind:          ModuleKindHooks,
 					State:         &ModuleState{},
 					moduleManager: mm,
 				}
@@ -471,10 +480,11 @@ func Test_MainModuleManager_Get_Module(t *testing.T) {
 //}
 
 func Test_MainModuleManager_Get_ModuleHooksInOrder(t *testing.T) {
-	helm.NewClient = func(logLabels ...map[string]string) client.HelmClient {
+	newHelmClient := func(logLabels ...map[string]string) client.HelmClient {
 		return &helm.MockHelmClient{}
 	}
 	mm := NewMainModuleManager()
+	mm.WithHelm(&helm.Helm{NewClient: newHelmClient})
 
 	initModuleManager(t, mm, "get__module_hooks_in_order")
 
@@ -513,6 +523,14 @@ func Test_MainModuleManager_Get_ModuleHooksInOrder(t *testing.T) {
 				assert.Equal(t, []string{}, moduleHooks)
 			},
 		},
+		{
+			"before-delete-helm-hooks",
+			"after-helm-binding-hooks",
+			BeforeDeleteHelm,
+			func() {
+				assert.Equal(t, []string{"107-after-helm-binding-hooks/hooks/d"}, moduleHooks)
+			},
+		},
 		{
 			"error-on-non-existent-module",
 			"after-helm-binding-hookssss",
@@ -549,11 +567,12 @@ func Test_MainModuleManager_RunModule(t *testing.T) {
 	t.SkipNow()
 	hc := &helm.MockHelmClient{}
 
-	helm.NewClient = func(logLabels ...map[string]string) client.HelmClient {
+	newHelmClient := func(logLabels ...map[string]string) client.HelmClient {
 		return hc
 	}
 
 	mm := NewMainModuleManager()
+	mm.WithHelm(&helm.Helm{NewClient: newHelmClient})
 
 	mm.WithKubeConfigManager(MockKubeConfigManager{})
 
@@ -601,11 +620,12 @@ func Test_MainModuleManager_DeleteModule(t *testing.T) {
 	t.SkipNow()
 	hc := &helm.MockHelmClient{}
 
-	helm.NewClient = func(logLabels ...map[string]string) client.HelmClient {
+	newHelmClient := func(logLabels ...map[string]string) client.HelmClient {
 		return hc
 	}
 
 	mm := NewMainModuleManager()
+	mm.WithHelm(&helm.Helm{NewClient: newHelmClient})
 	mm.WithKubeConfigManager(MockKubeConfigManager{})
 
 	initModuleManager(t, mm, "test_delete_module")
@@ -645,13 +665,22 @@ func Test_MainModuleManager_DeleteModule(t *testing.T) {
 	assert.Equal(t, hc.DeleteReleaseExecuted, true, "helm.DeleteRelease must be executed!")
 }
 
+// Module removed by hot reload can still have a queued ModuleDelete task.
+func Test_MainModuleManager_DeleteModule_Unknown(t *testing.T) {
+	mm := NewMainModuleManager()
+
+	err := mm.DeleteModule("removed", map[string]string{})
+	assert.Error(t, err)
+}
+
 func Test_MainModuleManager_RunModuleHook(t *testing.T) {
 	// TODO hooks not found
 	t.SkipNow()
-	helm.NewClient = func(logLabels ...map[string]string) client.HelmClient {
+	newHelmClient := func(logLabels ...map[string]string) client.HelmClient {
 		return &helm.MockHelmClient{}
 	}
 	mm := NewMainModuleManager()
+	mm.WithHelm(&helm.Helm{NewClient: newHelmClient})
 	mm.WithKubeConfigManager(MockKubeConfigManager{})
 
 	initModuleManager(t, mm, "test_run_module_hook")
@@ -961,10 +990,11 @@ func Test_MainModuleManager_RunModuleHook(t *testing.T) {
 //}
 
 func Test_MainModuleManager_Get_GlobalHooksInOrder(t *testing.T) {
-	helm.NewClient = func(logLabels ...map[string]string) client.HelmClient {
+	newHelmClient := func(logLabels ...map[string]string) client.HelmClient {
 		return &helm.MockHelmClient{}
 	}
 	mm := NewMainModuleManager()
+	mm.WithHelm(&helm.Helm{NewClient: newHelmClient})
 
 	initModuleManager(t, mm, "get__global_hooks_in_order")
 
@@ -998,10 +1028,11 @@ func Test_MainModuleManager_Get_GlobalHooksInOrder(t *testing.T) {
 }
 
 func Test_MainModuleManager_Run_GlobalHook(t *testing.T) {
-	helm.NewClient = func(logLabels ...map[string]string) client.HelmClient {
+	newHelmClient := func(logLabels ...map[string]string) client.HelmClient {
 		return &helm.MockHelmClient{}
 	}
 	mm := NewMainModuleManager()
+	mm.WithHelm(&helm.Helm{NewClient: newHelmClient})
 	mm.WithKubeConfigManager(MockKubeConfigManager{})
 
 	initModuleManager(t, mm, "test_run_global_hook")
@@ -1174,12 +1205,13 @@ func Test_MainModuleManager_DiscoverModulesState(t *testing.T) {
 			modulesState = nil
 			err = nil
 
-			helm.NewClient = func(logLabels ...map[string]string) client.HelmClient {
+			newHelmClient := func(logLabels ...map[string]string) client.HelmClient {
 				return &helm.MockHelmClient{
 					ReleaseNames: test.helmReleases,
 				}
 			}
 			mm = NewMainModuleManager()
+			mm.WithHelm(&helm.Helm{NewClient: newHelmClient})
 			initModuleManager(t, mm, test.configPath)
 
 			modulesState, err = mm.DiscoverModulesState(map[string]string{})
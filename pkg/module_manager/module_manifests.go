@@ -0,0 +1,541 @@
+package module_manager
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	log "github.com/sirupsen/logrus"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/yaml"
+
+	"github.com/flant/shell-operator/pkg/kube"
+	"github.com/flant/shell-operator/pkg/utils/manifest"
+
+	"github.com/flant/addon-operator/pkg/app"
+	"github.com/flant/addon-operator/pkg/manifests_validator"
+	"github.com/flant/addon-operator/pkg/utils"
+)
+
+// Module kinds define how module resources are installed.
+const (
+	// ModuleKindHelm modules are installed as Helm releases.
+	ModuleKindHelm = "helm"
+	// ModuleKindManifests modules are rendered with Go templates and applied with server-side apply.
+	ModuleKindManifests = "manifests"
+	// ModuleKindKustomize modules are rendered with kustomize and applied with server-side apply.
+	ModuleKindKustomize = "kustomize"
+	// ModuleKindHooks modules have only hooks.
+	ModuleKindHooks = "hooks"
+)
+
+// ManifestsFieldManager is a field manager for server-side apply of module manifests.
+const ManifestsFieldManager = "addon-operator"
+
+// ManifestsInventoryModuleLabel is a label with a module name on inventory ConfigMaps.
+const ManifestsInventoryModuleLabel = "addon-operator/module"
+
+// manifestsDirs are directories with templates for manifests modules in order of precedence.
+var manifestsDirs = []string{"manifests", "templates"}
+
+// Kind returns a kind of the module detected when the module is loaded.
+func (m *Module) Kind() string {
+	if m.kind != "" {
+		return m.kind
+	}
+	// Module is not loaded by the module manager. Error means a broken Helm module:
+	// it is reported by the helm phase of ModuleRun.
+	kind, err := m.detectKind()
+	if err != nil {
+		return ModuleKindHelm
+	}
+	return kind
+}
+
+// detectKind returns a kind of the module from module.yaml or detects it
+// by the module directory content: Chart.yaml or charts/<name>/Chart.yaml means a Helm module,
+// kustomization.yaml means a kustomize module, 'manifests' or 'templates'
+// directory means a manifests module. Charts from module.yaml should exist.
+func (m *Module) detectKind() (string, error) {
+	charts, err := m.Charts()
+	if err != nil {
+		return "", err
+	}
+	if m.Settings != nil && m.Settings.Kind != "" {
+		return m.Settings.Kind, nil
+	}
+	if len(charts) > 0 {
+		return ModuleKindHelm, nil
+	}
+	if m.kustomizationPath() != "" {
+		return ModuleKindKustomize, nil
+	}
+	if m.manifestsDir() != "" {
+		return ModuleKindManifests, nil
+	}
+	return ModuleKindHooks, nil
+}
+
+// manifestsDir returns a path to the directory with templates or an empty string.
+func (m *Module) manifestsDir() string {
+	for _, dir := range manifestsDirs {
+		dirPath := filepath.Join(m.Path, dir)
+		if info, err := os.Stat(dirPath); err == nil && info.IsDir() {
+			return dirPath
+		}
+	}
+	return ""
+}
+
+// manifestsTemplateData is passed to templates of manifests modules.
+type manifestsTemplateData struct {
+	Values     utils.Values
+	ModuleName string
+	Namespace  string
+}
+
+var manifestsTemplateFuncs = template.FuncMap{
+	"toYaml": func(v interface{}) (string, error) {
+		data, err := yaml.Marshal(v)
+		return strings.TrimSuffix(string(data), "\n"), err
+	},
+	"toJson": func(v interface{}) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+	"indent": func(spaces int, s string) string {
+		pad := strings.Repeat(" ", spaces)
+		return pad + strings.Replace(s, "\n", "\n"+pad, -1)
+	},
+	"nindent": func(spaces int, s string) string {
+		pad := strings.Repeat(" ", spaces)
+		return "\n" + pad + strings.Replace(s, "\n", "\n"+pad, -1)
+	},
+	"quote": func(v interface{}) string {
+		return fmt.Sprintf("%q", fmt.Sprint(v))
+	},
+	"default": func(def interface{}, v interface{}) interface{} {
+		if v == nil || v == "" {
+			return def
+		}
+		return v
+	},
+	"required": func(msg string, v interface{}) (interface{}, error) {
+		if v == nil || v == "" {
+			return nil, fmt.Errorf("%s", msg)
+		}
+		return v, nil
+	},
+}
+
+// RenderManifests renders templates of the manifests module with module values.
+// Files are rendered in lexical order, files with names started with '_' can
+// contain only template definitions.
+func (m *Module) RenderManifests(values utils.Values, namespace string) (string, error) {
+	dir := m.manifestsDir()
+	if dir == "" {
+		return "", nil
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return "", fmt.Errorf("read manifests directory '%s': %v", dir, err)
+	}
+
+	tpl := template.New(m.Name).Option("missingkey=zero").Funcs(manifestsTemplateFuncs)
+	names := make([]string, 0)
+	for _, file := range files {
+		ext := filepath.Ext(file.Name())
+		if file.IsDir() || (ext != ".yaml" && ext != ".yml" && ext != ".tpl") {
+			continue
+		}
+		content, err := ioutil.ReadFile(filepath.Join(dir, file.Name()))
+		if err != nil {
+			return "", err
+		}
+		_, err = tpl.New(file.Name()).Parse(string(content))
+		if err != nil {
+			return "", fmt.Errorf("parse template '%s': %v", file.Name(), err)
+		}
+		if !strings.HasPrefix(file.Name(), "_") {
+			names = append(names, file.Name())
+		}
+	}
+
+	data := manifestsTemplateData{
+		Values:     values,
+		ModuleName: m.Name,
+		Namespace:  namespace,
+	}
+
+	var buf bytes.Buffer
+	for _, name := range names {
+		buf.WriteString("---\n")
+		err = tpl.ExecuteTemplate(&buf, name, data)
+		if err != nil {
+			return "", fmt.Errorf("render template '%s': %v", name, err)
+		}
+		buf.WriteString("\n")
+	}
+	return buf.String(), nil
+}
+
+// manifestsInventoryItem is a reference to the applied resource.
+type manifestsInventoryItem struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Namespace  string `json:"namespace,omitempty"`
+	Name       string `json:"name"`
+}
+
+func (i manifestsInventoryItem) String() string {
+	if i.Namespace == "" {
+		return fmt.Sprintf("%s/%s", i.Kind, i.Name)
+	}
+	return fmt.Sprintf("%s/%s/%s", i.Namespace, i.Kind, i.Name)
+}
+
+// manifestsInventoryKey identifies the resource regardless of the API version.
+type manifestsInventoryKey struct {
+	Group     string
+	Kind      string
+	Namespace string
+	Name      string
+}
+
+// legacyAPIGroups are groups of resources moved from the 'extensions' group.
+// The same object is served by both groups, so they are one resource for pruning.
+var legacyAPIGroups = map[string]string{
+	"DaemonSet":         "apps",
+	"Deployment":        "apps",
+	"ReplicaSet":        "apps",
+	"Ingress":           "networking.k8s.io",
+	"NetworkPolicy":     "networking.k8s.io",
+	"PodSecurityPolicy": "policy",
+}
+
+// key returns an identity of the resource: group, kind, namespace and name. Version is ignored
+// to not prune the resource that is applied with a new API version.
+func (i manifestsInventoryItem) key() manifestsInventoryKey {
+	group := ""
+	if gv, err := schema.ParseGroupVersion(i.APIVersion); err == nil {
+		group = gv.Group
+	}
+	if group == "extensions" && legacyAPIGroups[i.Kind] != "" {
+		group = legacyAPIGroups[i.Kind]
+	}
+	return manifestsInventoryKey{
+		Group:     group,
+		Kind:      i.Kind,
+		Namespace: i.Namespace,
+		Name:      i.Name,
+	}
+}
+
+// manifestsInventory is a list of resources applied for the manifests module.
+// It is stored in a ConfigMap to prune resources removed from templates.
+type manifestsInventory struct {
+	Checksum  string
+	Resources []manifestsInventoryItem
+}
+
+// pruneList returns resources that are not in the actual list.
+func (inv *manifestsInventory) pruneList(actual []manifestsInventoryItem) []manifestsInventoryItem {
+	if inv == nil {
+		return nil
+	}
+	keep := make(map[manifestsInventoryKey]struct{})
+	for _, item := range actual {
+		keep[item.key()] = struct{}{}
+	}
+	res := make([]manifestsInventoryItem, 0)
+	for _, item := range inv.Resources {
+		if _, has := keep[item.key()]; !has {
+			res = append(res, item)
+		}
+	}
+	return res
+}
+
+// manifestsInventoryName returns a name of the ConfigMap with the inventory.
+func (m *Module) manifestsInventoryName() string {
+	return fmt.Sprintf("%s-manifests-%s", m.moduleManager.configMapName, m.Name)
+}
+
+func (m *Module) loadManifestsInventory(kubeClient kube.KubernetesClient) (*manifestsInventory, error) {
+	cm, err := kubeClient.CoreV1().ConfigMaps(app.Namespace).Get(m.manifestsInventoryName(), metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get inventory ConfigMap: %v", err)
+	}
+
+	inv := &manifestsInventory{
+		Checksum: cm.Data["checksum"],
+	}
+	if cm.Data["resources"] != "" {
+		err = json.Unmarshal([]byte(cm.Data["resources"]), &inv.Resources)
+		if err != nil {
+			return nil, fmt.Errorf("parse inventory ConfigMap: %v", err)
+		}
+	}
+	return inv, nil
+}
+
+func (m *Module) saveManifestsInventory(kubeClient kube.KubernetesClient, inv *manifestsInventory) error {
+	resources, err := json.Marshal(inv.Resources)
+	if err != nil {
+		return err
+	}
+
+	cm := &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   m.manifestsInventoryName(),
+			Labels: utils.MergeLabels(m.moduleManager.helm.OwnerLabels(), map[string]string{ManifestsInventoryModuleLabel: m.Name}),
+		},
+		Data: map[string]string{
+			"checksum":  inv.Checksum,
+			"resources": string(resources),
+		},
+	}
+
+	configMaps := kubeClient.CoreV1().ConfigMaps(app.Namespace)
+	_, err = configMaps.Update(cm)
+	if errors.IsNotFound(err) {
+		_, err = configMaps.Create(cm)
+	}
+	if err != nil {
+		return fmt.Errorf("save inventory ConfigMap: %v", err)
+	}
+	return nil
+}
+
+// listManifestsModules returns names of modules with inventory ConfigMaps,
+// i.e. manifests modules with applied resources.
+func (mm *moduleManager) listManifestsModules() ([]string, error) {
+	if mm.KubeClient == nil {
+		return []string{}, nil
+	}
+
+	selector := metav1.LabelSelector{
+		MatchLabels: mm.helm.OwnerLabels(),
+		MatchExpressions: []metav1.LabelSelectorRequirement{
+			{Key: ManifestsInventoryModuleLabel, Operator: metav1.LabelSelectorOpExists},
+		},
+	}
+	list, err := mm.KubeClient.CoreV1().ConfigMaps(app.Namespace).List(metav1.ListOptions{
+		LabelSelector: metav1.FormatLabelSelector(&selector),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("list inventory ConfigMaps: %v", err)
+	}
+
+	res := make([]string, 0, len(list.Items))
+	for _, cm := range list.Items {
+		res = append(res, cm.Labels[ManifestsInventoryModuleLabel])
+	}
+	return res, nil
+}
+
+// resourceGVR returns a GroupVersionResource and a namespace of the resource. Namespace is empty for cluster resources.
+func resourceGVR(kubeClient kube.KubernetesClient, apiVersion, kind, namespace, defaultNamespace string) (schema.GroupVersionResource, string, error) {
+	apiRes, err := kubeClient.APIResource(apiVersion, kind)
+	if err != nil {
+		return schema.GroupVersionResource{}, "", err
+	}
+	gvr := schema.GroupVersionResource{Group: apiRes.Group, Version: apiRes.Version, Resource: apiRes.Name}
+	if !apiRes.Namespaced {
+		return gvr, "", nil
+	}
+	if namespace == "" {
+		namespace = defaultNamespace
+	}
+	return gvr, namespace, nil
+}
+
+// applyManifest applies the manifest with server-side apply.
+func applyManifest(kubeClient kube.KubernetesClient, m manifest.Manifest, defaultNamespace string) (manifestsInventoryItem, error) {
+	gvr, namespace, err := resourceGVR(kubeClient, m.ApiVersion(), m.Kind(), m.Namespace(""), defaultNamespace)
+	if err != nil {
+		return manifestsInventoryItem{}, err
+	}
+	if namespace != "" {
+		m.SetNamespace(namespace)
+	}
+
+	data, err := json.Marshal(m)
+	if err != nil {
+		return manifestsInventoryItem{}, err
+	}
+
+	force := true
+	_, err = kubeClient.Dynamic().Resource(gvr).Namespace(namespace).Patch(m.Name(), types.ApplyPatchType, data, metav1.PatchOptions{
+		FieldManager: ManifestsFieldManager,
+		Force:        &force,
+	})
+	if err != nil {
+		return manifestsInventoryItem{}, err
+	}
+
+	return manifestsInventoryItem{
+		APIVersion: m.ApiVersion(),
+		Kind:       m.Kind(),
+		Namespace:  namespace,
+		Name:       m.Name(),
+	}, nil
+}
+
+// deleteInventoryItem deletes the resource. Absent resources are ignored.
+func deleteInventoryItem(kubeClient kube.KubernetesClient, item manifestsInventoryItem) error {
+	gvr, namespace, err := resourceGVR(kubeClient, item.APIVersion, item.Kind, item.Namespace, item.Namespace)
+	if err != nil {
+		return err
+	}
+	err = kubeClient.Dynamic().Resource(gvr).Namespace(namespace).Delete(item.Name, &metav1.DeleteOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// applyAndPrune applies manifests and deletes resources from the inventory that are not applied.
+// It returns applied resources for the new inventory. Prune is done before saving the inventory,
+// so failed deletions are retried on the next run.
+func applyAndPrune(kubeClient kube.KubernetesClient, manifests []manifest.Manifest, namespace string, inventory *manifestsInventory, logEntry *log.Entry) ([]manifestsInventoryItem, error) {
+	applied := make([]manifestsInventoryItem, 0, len(manifests))
+	for _, mf := range manifests {
+		item, err := applyManifest(kubeClient, mf, namespace)
+		if err != nil {
+			return nil, fmt.Errorf("apply %s/%s: %v", mf.Kind(), mf.Name(), err)
+		}
+		applied = append(applied, item)
+	}
+
+	for _, item := range inventory.pruneList(applied) {
+		logEntry.Infof("Prune %s", item)
+		err := deleteInventoryItem(kubeClient, item)
+		if err != nil {
+			return nil, fmt.Errorf("prune %s: %v", item, err)
+		}
+	}
+	return applied, nil
+}
+
+// runManifestsInstall renders manifests of the manifests or kustomize module, applies resources
+// with server-side apply and prunes resources that are removed from templates.
+func (m *Module) runManifestsInstall(logLabels map[string]string) error {
+	logEntry := log.WithFields(utils.LabelsToLogFields(logLabels))
+
+	kubeClient := m.moduleManager.KubeClient
+	if kubeClient == nil {
+		return fmt.Errorf("kubernetes client is not set")
+	}
+
+	namespace := m.Namespace()
+
+	renderer := m.Renderer()
+	renderInput, err := m.prepareRenderInput(m.generateHelmReleaseName(), namespace, logLabels)
+	if err != nil {
+		return err
+	}
+
+	rendered, err := renderer.Render(m, renderInput)
+	if err != nil {
+		return fmt.Errorf("%s render: %v", renderer.Name(), err)
+	}
+	err = manifests_validator.Validate(rendered)
+	if err != nil {
+		return fmt.Errorf("validate manifests: %v", err)
+	}
+	checksum := utils.CalculateStringsChecksum(rendered)
+
+	manifests, err := utils.ManifestListFromYamlDocuments(rendered)
+	if err != nil {
+		return err
+	}
+	logEntry.Debugf("module has %d manifests", len(manifests))
+	m.LastReleaseManifests = manifests
+
+	inventory, err := m.loadManifestsInventory(kubeClient)
+	if err != nil {
+		return err
+	}
+
+	// Skip apply if templates are not changed and all resources are present.
+	if inventory != nil && inventory.Checksum == checksum {
+		absent, err := m.moduleManager.HelmResourcesManager.GetAbsentResources(manifests, namespace)
+		if err != nil {
+			return err
+		}
+		if len(absent) == 0 {
+			logEntry.Debugf("manifests are unchanged: skip apply")
+			if !m.moduleManager.HelmResourcesManager.HasMonitor(m.Name) {
+				m.moduleManager.HelmResourcesManager.StartMonitor(m.Name, manifests, namespace)
+			}
+			return nil
+		}
+		logEntry.Debugf("manifests has %d absent resources: should apply", len(absent))
+	}
+
+	err = m.ensureNamespace(namespace, logEntry)
+	if err != nil {
+		return err
+	}
+
+	applied, err := applyAndPrune(kubeClient, manifests, namespace, inventory, logEntry)
+	if err != nil {
+		return err
+	}
+
+	err = m.saveManifestsInventory(kubeClient, &manifestsInventory{Checksum: checksum, Resources: applied})
+	if err != nil {
+		return err
+	}
+	logEntry.Infof("Applied %d manifests", len(applied))
+
+	m.moduleManager.HelmResourcesManager.StartMonitor(m.Name, manifests, namespace)
+	return nil
+}
+
+// deleteManifests deletes resources from the inventory and the inventory ConfigMap.
+func (m *Module) deleteManifests(logEntry *log.Entry) error {
+	kubeClient := m.moduleManager.KubeClient
+	if kubeClient == nil {
+		return nil
+	}
+
+	inventory, err := m.loadManifestsInventory(kubeClient)
+	if err != nil {
+		return err
+	}
+	if inventory == nil {
+		logEntry.Warnf("Cannot find manifests inventory for module '%s'.", m.Name)
+		return nil
+	}
+
+	// Delete in reverse order: namespaced resources usually depend on cluster resources defined before them.
+	for i := len(inventory.Resources) - 1; i >= 0; i-- {
+		item := inventory.Resources[i]
+		err := deleteInventoryItem(kubeClient, item)
+		if err != nil {
+			return fmt.Errorf("delete %s: %v", item, err)
+		}
+	}
+
+	err = kubeClient.CoreV1().ConfigMaps(app.Namespace).Delete(m.manifestsInventoryName(), &metav1.DeleteOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		return fmt.Errorf("delete inventory ConfigMap: %v", err)
+	}
+	logEntry.Infof("Deleted %d manifests", len(inventory.Resources))
+	return nil
+}
@@ -0,0 +1,221 @@
+package module_manager
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	fakedynamic "k8s.io/client-go/dynamic/fake"
+	clienttesting "k8s.io/client-go/testing"
+
+	"github.com/flant/shell-operator/pkg/kube"
+	"github.com/flant/shell-operator/pkg/utils/manifest"
+
+	"github.com/flant/addon-operator/pkg/helm"
+	"github.com/flant/addon-operator/pkg/utils"
+)
+
+func Test_Module_Kind(t *testing.T) {
+	rootDir, err := ioutil.TempDir("", "addon-operator-module-kind-")
+	require.NoError(t, err)
+	defer os.RemoveAll(rootDir)
+
+	mkdir := func(path string) {
+		require.NoError(t, os.MkdirAll(filepath.Join(rootDir, path), 0755))
+	}
+	mkdir("helm/templates")
+	require.NoError(t, ioutil.WriteFile(filepath.Join(rootDir, "helm", "Chart.yaml"), []byte("name: helm\n"), 0644))
+	mkdir("manifests/manifests")
+	mkdir("templates/templates")
+	mkdir("hooks/hooks")
+	mkdir("kustomize")
+	require.NoError(t, ioutil.WriteFile(filepath.Join(rootDir, "kustomize", "kustomization.yaml"), []byte("resources: []\n"), 0644))
+
+	tests := []struct {
+		dir      string
+		settings *ModuleSettings
+		expected string
+	}{
+		{"helm", &ModuleSettings{}, ModuleKindHelm},
+		{"manifests", &ModuleSettings{}, ModuleKindManifests},
+		{"templates", &ModuleSettings{}, ModuleKindManifests},
+		{"hooks", &ModuleSettings{}, ModuleKindHooks},
+		{"kustomize", &ModuleSettings{}, ModuleKindKustomize},
+		{"helm", &ModuleSettings{Kind: ModuleKindHooks}, ModuleKindHooks},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.dir+"-"+tt.expected, func(t *testing.T) {
+			m := NewModule("module", filepath.Join(rootDir, tt.dir))
+			m.Settings = tt.settings
+			assert.Equal(t, tt.expected, m.Kind())
+		})
+	}
+
+	_, err = NewModuleSettingsFromBytes([]byte("kind: unknown\n"))
+	assert.Error(t, err)
+}
+
+func Test_Module_RenderManifests(t *testing.T) {
+	rootDir, err := ioutil.TempDir("", "addon-operator-module-manifests-")
+	require.NoError(t, err)
+	defer os.RemoveAll(rootDir)
+
+	manifestsDir := filepath.Join(rootDir, "manifests")
+	require.NoError(t, os.MkdirAll(manifestsDir, 0755))
+	writeFile := func(name string, content string) {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(manifestsDir, name), []byte(content), 0644))
+	}
+	writeFile("_helpers.tpl", `{{ define "labels" }}app: {{ .ModuleName }}{{ end }}`)
+	writeFile("01-cm.yaml", `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: {{ .ModuleName }}-config
+  labels:
+    {{ template "labels" . }}
+data:
+  param: {{ .Values.moduleOne.param | quote }}
+  replicas: {{ .Values.moduleOne.replicas | default 1 | quote }}
+`)
+	writeFile("02-ns.yaml", `apiVersion: v1
+kind: Namespace
+metadata:
+  name: {{ .Namespace }}
+`)
+	writeFile("README.md", `not a template`)
+
+	m := NewModule("module-one", rootDir)
+	values := utils.Values{
+		"moduleOne": map[string]interface{}{
+			"param": "value",
+		},
+	}
+
+	rendered, err := m.RenderManifests(values, "ns-one")
+	require.NoError(t, err)
+
+	manifests, err := utils.ManifestListFromYamlDocuments(rendered)
+	require.NoError(t, err)
+	require.Len(t, manifests, 2)
+
+	assert.Equal(t, "module-one-config", manifests[0].Name())
+	assert.Equal(t, map[string]interface{}{"param": "value", "replicas": "1"}, manifests[0]["data"])
+	assert.Equal(t, map[string]interface{}{"app": "module-one"}, manifests[0].Metadata()["labels"])
+	assert.Equal(t, "Namespace", manifests[1].Kind())
+	assert.Equal(t, "ns-one", manifests[1].Name())
+}
+
+func Test_Module_ManifestsInventory(t *testing.T) {
+	kubeClient := kube.NewFakeKubernetesClient()
+
+	mm := NewMainModuleManager()
+	mm.WithKubeClient(kubeClient)
+	mm.WithHelm(&helm.Helm{OwnerID: "default"})
+	m := NewModule("module-one", "/modules/module-one")
+	m.WithModuleManager(mm)
+
+	inv, err := m.loadManifestsInventory(kubeClient)
+	require.NoError(t, err)
+	assert.Nil(t, inv)
+	assert.Len(t, inv.pruneList(nil), 0, "nil inventory should not prune anything")
+
+	cm := manifestsInventoryItem{APIVersion: "v1", Kind: "ConfigMap", Namespace: "ns", Name: "cm"}
+	ns := manifestsInventoryItem{APIVersion: "v1", Kind: "Namespace", Name: "ns"}
+	err = m.saveManifestsInventory(kubeClient, &manifestsInventory{Checksum: "123", Resources: []manifestsInventoryItem{cm, ns}})
+	require.NoError(t, err)
+
+	inv, err = m.loadManifestsInventory(kubeClient)
+	require.NoError(t, err)
+	assert.Equal(t, "123", inv.Checksum)
+	assert.Equal(t, []manifestsInventoryItem{cm, ns}, inv.Resources)
+	assert.Equal(t, []manifestsInventoryItem{cm}, inv.pruneList([]manifestsInventoryItem{ns}))
+
+	// Update existing inventory.
+	err = m.saveManifestsInventory(kubeClient, &manifestsInventory{Checksum: "456", Resources: []manifestsInventoryItem{ns}})
+	require.NoError(t, err)
+	inv, err = m.loadManifestsInventory(kubeClient)
+	require.NoError(t, err)
+	assert.Equal(t, "456", inv.Checksum)
+
+	modules, err := mm.listManifestsModules()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"module-one"}, modules)
+}
+
+func Test_ManifestsInventory_PruneList(t *testing.T) {
+	deployV1beta1 := manifestsInventoryItem{APIVersion: "extensions/v1beta1", Kind: "Deployment", Namespace: "ns", Name: "app"}
+	deployV1 := manifestsInventoryItem{APIVersion: "apps/v1", Kind: "Deployment", Namespace: "ns", Name: "app"}
+	cronJobV1beta1 := manifestsInventoryItem{APIVersion: "batch/v1beta1", Kind: "CronJob", Namespace: "ns", Name: "job"}
+	cronJobV2alpha1 := manifestsInventoryItem{APIVersion: "batch/v2alpha1", Kind: "CronJob", Namespace: "ns", Name: "job"}
+	customA := manifestsInventoryItem{APIVersion: "a.example.com/v1", Kind: "Custom", Name: "custom"}
+	customB := manifestsInventoryItem{APIVersion: "b.example.com/v1", Kind: "Custom", Name: "custom"}
+
+	inv := &manifestsInventory{Resources: []manifestsInventoryItem{deployV1beta1, cronJobV1beta1, customA}}
+	assert.Equal(t, []manifestsInventoryItem{customA}, inv.pruneList([]manifestsInventoryItem{deployV1, cronJobV2alpha1, customB}),
+		"resources with a new API version should not be pruned, resources of other groups should be pruned")
+}
+
+func Test_ApplyAndPrune(t *testing.T) {
+	kubeClient := kube.NewFakeKubernetesClient()
+	kubeClient.Discovery().(*fakediscovery.FakeDiscovery).Resources = []*metav1.APIResourceList{
+		{
+			GroupVersion: "v1",
+			APIResources: []metav1.APIResource{
+				{Name: "configmaps", Kind: "ConfigMap", Namespaced: true, Verbs: metav1.Verbs{"get", "patch", "delete"}},
+			},
+		},
+		{
+			GroupVersion: "apps/v1",
+			APIResources: []metav1.APIResource{
+				{Name: "deployments", Kind: "Deployment", Namespaced: true, Verbs: metav1.Verbs{"get", "patch", "delete"}},
+			},
+		},
+		{
+			GroupVersion: "extensions/v1beta1",
+			APIResources: []metav1.APIResource{
+				{Name: "deployments", Kind: "Deployment", Namespaced: true, Verbs: metav1.Verbs{"get", "patch", "delete"}},
+			},
+		},
+	}
+
+	// Fake dynamic client does not support server-side apply, so applies and deletions are recorded.
+	var patched, deleted []string
+	dynamicClient := kubeClient.Dynamic().(*fakedynamic.FakeDynamicClient)
+	dynamicClient.PrependReactor("patch", "*", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		patch := action.(clienttesting.PatchAction)
+		patched = append(patched, patch.GetResource().GroupVersion().String()+"/"+patch.GetNamespace()+"/"+patch.GetName())
+		return true, &unstructured.Unstructured{}, nil
+	})
+	dynamicClient.PrependReactor("delete", "*", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		del := action.(clienttesting.DeleteAction)
+		deleted = append(deleted, del.GetResource().GroupVersion().String()+"/"+del.GetNamespace()+"/"+del.GetName())
+		return true, nil, nil
+	})
+
+	logEntry := log.WithField("test", t.Name())
+	deploy := func(apiVersion string) manifest.Manifest {
+		return manifest.Manifest{"apiVersion": apiVersion, "kind": "Deployment", "metadata": map[string]interface{}{"name": "app"}}
+	}
+	cm := manifest.Manifest{"apiVersion": "v1", "kind": "ConfigMap", "metadata": map[string]interface{}{"name": "cm"}}
+
+	applied, err := applyAndPrune(kubeClient, []manifest.Manifest{deploy("extensions/v1beta1"), cm}, "ns", nil, logEntry)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"extensions/v1beta1/ns/app", "v1/ns/cm"}, patched)
+	assert.Empty(t, deleted)
+
+	// Deployment is moved to apps/v1 and the ConfigMap is removed from templates.
+	patched = nil
+	applied, err = applyAndPrune(kubeClient, []manifest.Manifest{deploy("apps/v1")}, "ns", &manifestsInventory{Resources: applied}, logEntry)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"apps/v1/ns/app"}, patched)
+	assert.Equal(t, []string{"v1/ns/cm"}, deleted, "Deployment applied with a new API version should not be pruned")
+	assert.Equal(t, []manifestsInventoryItem{{APIVersion: "apps/v1", Kind: "Deployment", Namespace: "ns", Name: "app"}}, applied)
+}
@@ -0,0 +1,256 @@
+package module_manager
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/wait"
+
+	"github.com/flant/shell-operator/pkg/utils/manifest"
+
+	"github.com/flant/addon-operator/pkg/utils"
+)
+
+// DefaultReadinessTimeout is a time to wait for module workloads if timeout is not set in module.yaml.
+const DefaultReadinessTimeout = 5 * time.Minute
+
+// readinessPollInterval is an interval between checks of workloads status.
+var readinessPollInterval = 2 * time.Second
+
+// readinessKinds are kinds of workloads that are checked for readiness.
+var readinessKinds = map[string]bool{
+	"Deployment":  true,
+	"StatefulSet": true,
+	"DaemonSet":   true,
+	"Job":         true,
+}
+
+// ReadinessTimeout returns a timeout for the readiness check or 0 if the check is disabled.
+func (m *Module) ReadinessTimeout() time.Duration {
+	if m.Settings == nil || m.Settings.Readiness == nil {
+		return 0
+	}
+	if m.Settings.Readiness.Timeout == "" {
+		return DefaultReadinessTimeout
+	}
+	// Timeout is validated when module.yaml is loaded.
+	timeout, _ := time.ParseDuration(m.Settings.Readiness.Timeout)
+	return timeout
+}
+
+// waitForReadiness waits until Deployments, StatefulSets and DaemonSets from the last
+// installed manifests are rolled out and Jobs are completed. It returns an error with
+// not ready workloads if timeout is reached or a workload is failed. Helm hooks are
+// skipped: they can be deleted by hook-delete-policy or never created. It is called
+// after the successful install, so an absent Job is considered completed and deleted.
+func (m *Module) waitForReadiness(logLabels map[string]string) error {
+	timeout := m.ReadinessTimeout()
+	if timeout == 0 {
+		return nil
+	}
+	logEntry := log.WithFields(utils.LabelsToLogFields(logLabels))
+
+	workloads := make([]manifest.Manifest, 0)
+	for _, mf := range m.LastReleaseManifests {
+		if readinessKinds[mf.Kind()] && !utils.IsHelmHook(mf) {
+			workloads = append(workloads, mf)
+		}
+	}
+	if len(workloads) == 0 {
+		return nil
+	}
+
+	kubeClient := m.moduleManager.KubeClient
+	if kubeClient == nil {
+		return fmt.Errorf("kubernetes client is not set")
+	}
+
+	namespace := m.Namespace()
+	notReady := make(map[string]string)
+	err := wait.PollImmediate(readinessPollInterval, timeout, func() (bool, error) {
+		notReady = make(map[string]string)
+		for _, mf := range workloads {
+			id := fmt.Sprintf("%s/%s", mf.Kind(), mf.Name())
+			gvr, ns, err := resourceGVR(kubeClient, mf.ApiVersion(), mf.Kind(), mf.Namespace(""), namespace)
+			if err != nil {
+				notReady[id] = err.Error()
+				continue
+			}
+			obj, err := kubeClient.Dynamic().Resource(gvr).Namespace(ns).Get(mf.Name(), metav1.GetOptions{})
+			if errors.IsNotFound(err) && mf.Kind() == "Job" {
+				logEntry.Debugf("%s is not found, consider it completed", id)
+				continue
+			}
+			if errors.IsNotFound(err) {
+				notReady[id] = "not found"
+				continue
+			}
+			if err != nil {
+				notReady[id] = err.Error()
+				continue
+			}
+			ready, reason, err := ResourceReadiness(obj)
+			if err != nil {
+				return false, fmt.Errorf("%s: %v", id, err)
+			}
+			if !ready {
+				notReady[id] = reason
+			}
+		}
+		if len(notReady) > 0 {
+			logEntry.Debugf("Wait for %d of %d workloads", len(notReady), len(workloads))
+			return false, nil
+		}
+		return true, nil
+	})
+	if err == wait.ErrWaitTimeout {
+		return fmt.Errorf("workloads are not ready in %s: %s", timeout, formatNotReady(notReady))
+	}
+	if err != nil {
+		return err
+	}
+	logEntry.Infof("All %d workloads are ready", len(workloads))
+	return nil
+}
+
+func formatNotReady(notReady map[string]string) string {
+	ids := make([]string, 0, len(notReady))
+	for id := range notReady {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	msgs := make([]string, 0, len(ids))
+	for _, id := range ids {
+		msgs = append(msgs, fmt.Sprintf("%s: %s", id, notReady[id]))
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// ResourceReadiness evaluates the status of Deployment, StatefulSet, DaemonSet or Job
+// like 'kubectl rollout status' does. It returns a reason if the workload is not ready
+// and an error if the workload is failed and waiting is useless. Objects of other kinds are ready.
+func ResourceReadiness(obj *unstructured.Unstructured) (bool, string, error) {
+	if obj.GetKind() != "Job" {
+		observed, _, _ := unstructured.NestedInt64(obj.Object, "status", "observedGeneration")
+		if obj.GetGeneration() > observed {
+			return false, "waiting for the spec update to be observed", nil
+		}
+	}
+
+	switch obj.GetKind() {
+	case "Deployment":
+		return deploymentReadiness(obj)
+	case "StatefulSet":
+		return statefulSetReadiness(obj)
+	case "DaemonSet":
+		return daemonSetReadiness(obj)
+	case "Job":
+		return jobReadiness(obj)
+	}
+	return true, "", nil
+}
+
+func deploymentReadiness(obj *unstructured.Unstructured) (bool, string, error) {
+	if cond := findCondition(obj, "Progressing"); cond != nil && cond["reason"] == "ProgressDeadlineExceeded" {
+		return false, "", fmt.Errorf("progress deadline exceeded")
+	}
+	replicas := specReplicas(obj)
+	updated := statusInt(obj, "updatedReplicas")
+	total := statusInt(obj, "replicas")
+	available := statusInt(obj, "availableReplicas")
+	switch {
+	case updated < replicas:
+		return false, fmt.Sprintf("%d of %d replicas are updated", updated, replicas), nil
+	case total > updated:
+		return false, fmt.Sprintf("%d old replicas are pending termination", total-updated), nil
+	case available < updated:
+		return false, fmt.Sprintf("%d of %d updated replicas are available", available, updated), nil
+	}
+	return true, "", nil
+}
+
+func statefulSetReadiness(obj *unstructured.Unstructured) (bool, string, error) {
+	strategy, _, _ := unstructured.NestedString(obj.Object, "spec", "updateStrategy", "type")
+	if strategy == "OnDelete" {
+		// Pods are not updated automatically, so rollout can't be checked.
+		return true, "", nil
+	}
+	replicas := specReplicas(obj)
+	ready := statusInt(obj, "readyReplicas")
+	if ready < replicas {
+		return false, fmt.Sprintf("%d of %d replicas are ready", ready, replicas), nil
+	}
+	partition, found, _ := unstructured.NestedInt64(obj.Object, "spec", "updateStrategy", "rollingUpdate", "partition")
+	if found && partition > 0 {
+		updated := statusInt(obj, "updatedReplicas")
+		if updated < replicas-partition {
+			return false, fmt.Sprintf("%d of %d replicas are updated", updated, replicas-partition), nil
+		}
+		return true, "", nil
+	}
+	updateRevision, _, _ := unstructured.NestedString(obj.Object, "status", "updateRevision")
+	currentRevision, _, _ := unstructured.NestedString(obj.Object, "status", "currentRevision")
+	if updateRevision != currentRevision {
+		return false, fmt.Sprintf("waiting for revision %s to be rolled out", updateRevision), nil
+	}
+	return true, "", nil
+}
+
+func daemonSetReadiness(obj *unstructured.Unstructured) (bool, string, error) {
+	strategy, _, _ := unstructured.NestedString(obj.Object, "spec", "updateStrategy", "type")
+	if strategy == "OnDelete" {
+		return true, "", nil
+	}
+	desired := statusInt(obj, "desiredNumberScheduled")
+	updated := statusInt(obj, "updatedNumberScheduled")
+	available := statusInt(obj, "numberAvailable")
+	switch {
+	case updated < desired:
+		return false, fmt.Sprintf("%d of %d pods are updated", updated, desired), nil
+	case available < desired:
+		return false, fmt.Sprintf("%d of %d pods are available", available, desired), nil
+	}
+	return true, "", nil
+}
+
+func jobReadiness(obj *unstructured.Unstructured) (bool, string, error) {
+	if cond := findCondition(obj, "Failed"); cond != nil && cond["status"] == "True" {
+		return false, "", fmt.Errorf("job is failed: %v", cond["reason"])
+	}
+	if cond := findCondition(obj, "Complete"); cond != nil && cond["status"] == "True" {
+		return true, "", nil
+	}
+	return false, "job is not completed", nil
+}
+
+// specReplicas returns spec.replicas or 1 if replicas are not set.
+func specReplicas(obj *unstructured.Unstructured) int64 {
+	replicas, found, _ := unstructured.NestedInt64(obj.Object, "spec", "replicas")
+	if !found {
+		return 1
+	}
+	return replicas
+}
+
+func statusInt(obj *unstructured.Unstructured, field string) int64 {
+	value, _, _ := unstructured.NestedInt64(obj.Object, "status", field)
+	return value
+}
+
+// findCondition returns a status condition with the type or nil.
+func findCondition(obj *unstructured.Unstructured, condType string) map[string]interface{} {
+	conditions, _, _ := unstructured.NestedSlice(obj.Object, "status", "conditions")
+	for _, c := range conditions {
+		cond, ok := c.(map[string]interface{})
+		if ok && cond["type"] == condType {
+			return cond
+		}
+	}
+	return nil
+}
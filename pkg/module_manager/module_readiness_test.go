@@ -0,0 +1,315 @@
+package module_manager
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	"sigs.k8s.io/yaml"
+
+	"github.com/flant/shell-operator/pkg/kube"
+	"github.com/flant/shell-operator/pkg/utils/manifest"
+)
+
+func Test_ResourceReadiness(t *testing.T) {
+	tests := []struct {
+		name     string
+		object   string
+		ready    bool
+		reason   string
+		hasError bool
+	}{
+		{
+			"deployment is rolled out",
+			`
+kind: Deployment
+metadata: {generation: 2}
+spec: {replicas: 2}
+status: {observedGeneration: 2, replicas: 2, updatedReplicas: 2, availableReplicas: 2}
+`,
+			true, "", false,
+		},
+		{
+			"deployment spec is not observed",
+			`
+kind: Deployment
+metadata: {generation: 3}
+spec: {replicas: 2}
+status: {observedGeneration: 2, replicas: 2, updatedReplicas: 2, availableReplicas: 2}
+`,
+			false, "waiting for the spec update to be observed", false,
+		},
+		{
+			"deployment with default replicas is updating",
+			`
+kind: Deployment
+metadata: {generation: 1}
+status: {observedGeneration: 1}
+`,
+			false, "0 of 1 replicas are updated", false,
+		},
+		{
+			"deployment has old replicas",
+			`
+kind: Deployment
+metadata: {generation: 1}
+spec: {replicas: 2}
+status: {observedGeneration: 1, replicas: 3, updatedReplicas: 2, availableReplicas: 2}
+`,
+			false, "1 old replicas are pending termination", false,
+		},
+		{
+			"deployment replicas are not available",
+			`
+kind: Deployment
+metadata: {generation: 1}
+spec: {replicas: 2}
+status: {observedGeneration: 1, replicas: 2, updatedReplicas: 2, availableReplicas: 1}
+`,
+			false, "1 of 2 updated replicas are available", false,
+		},
+		{
+			"deployment progress deadline exceeded",
+			`
+kind: Deployment
+metadata: {generation: 1}
+spec: {replicas: 1}
+status:
+  observedGeneration: 1
+  conditions:
+  - {type: Progressing, status: "False", reason: ProgressDeadlineExceeded}
+`,
+			false, "", true,
+		},
+		{
+			"statefulset revision is not rolled out",
+			`
+kind: StatefulSet
+metadata: {generation: 1}
+spec: {replicas: 2}
+status: {observedGeneration: 1, readyReplicas: 2, currentRevision: sts-1, updateRevision: sts-2}
+`,
+			false, "waiting for revision sts-2 to be rolled out", false,
+		},
+		{
+			"statefulset partition is updated",
+			`
+kind: StatefulSet
+metadata: {generation: 1}
+spec:
+  replicas: 3
+  updateStrategy: {type: RollingUpdate, rollingUpdate: {partition: 2}}
+status: {observedGeneration: 1, readyReplicas: 3, updatedReplicas: 1, currentRevision: sts-1, updateRevision: sts-2}
+`,
+			true, "", false,
+		},
+		{
+			"statefulset replicas are not ready",
+			`
+kind: StatefulSet
+metadata: {generation: 1}
+spec: {replicas: 2}
+status: {observedGeneration: 1, readyReplicas: 1}
+`,
+			false, "1 of 2 replicas are ready", false,
+		},
+		{
+			"statefulset with OnDelete strategy",
+			`
+kind: StatefulSet
+metadata: {generation: 1}
+spec:
+  replicas: 2
+  updateStrategy: {type: OnDelete}
+status: {observedGeneration: 1}
+`,
+			true, "", false,
+		},
+		{
+			"daemonset pods are not updated",
+			`
+kind: DaemonSet
+metadata: {generation: 1}
+status: {observedGeneration: 1, desiredNumberScheduled: 3, updatedNumberScheduled: 2, numberAvailable: 3}
+`,
+			false, "2 of 3 pods are updated", false,
+		},
+		{
+			"daemonset is rolled out",
+			`
+kind: DaemonSet
+metadata: {generation: 1}
+status: {observedGeneration: 1, desiredNumberScheduled: 3, updatedNumberScheduled: 3, numberAvailable: 3}
+`,
+			true, "", false,
+		},
+		{
+			"job is running",
+			`
+kind: Job
+metadata: {generation: 1}
+status: {active: 1}
+`,
+			false, "job is not completed", false,
+		},
+		{
+			"job is completed",
+			`
+kind: Job
+metadata: {generation: 1}
+status:
+  conditions:
+  - {type: Complete, status: "True"}
+`,
+			true, "", false,
+		},
+		{
+			"job is failed",
+			`
+kind: Job
+metadata: {generation: 1}
+status:
+  conditions:
+  - {type: Failed, status: "True", reason: BackoffLimitExceeded}
+`,
+			false, "", true,
+		},
+		{
+			"other kinds are ready",
+			`
+kind: ConfigMap
+metadata: {name: cm}
+`,
+			true, "", false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := yaml.YAMLToJSON([]byte(tt.object))
+			require.NoError(t, err)
+			obj := &unstructured.Unstructured{}
+			require.NoError(t, obj.UnmarshalJSON(data))
+
+			ready, reason, err := ResourceReadiness(obj)
+			if tt.hasError {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.ready, ready)
+			assert.Equal(t, tt.reason, reason)
+		})
+	}
+}
+
+func Test_Module_ReadinessTimeout(t *testing.T) {
+	m := NewModule("module", "/modules/module")
+	m.Settings = &ModuleSettings{}
+	assert.Equal(t, time.Duration(0), m.ReadinessTimeout(), "readiness check is disabled by default")
+
+	settings, err := NewModuleSettingsFromBytes([]byte("readiness: {}\n"))
+	require.NoError(t, err)
+	m.Settings = settings
+	assert.Equal(t, DefaultReadinessTimeout, m.ReadinessTimeout())
+
+	settings, err = NewModuleSettingsFromBytes([]byte("readiness:\n  timeout: 10m\n"))
+	require.NoError(t, err)
+	m.Settings = settings
+	assert.Equal(t, 10*time.Minute, m.ReadinessTimeout())
+
+	_, err = NewModuleSettingsFromBytes([]byte("readiness:\n  timeout: ten\n"))
+	assert.Error(t, err)
+}
+
+func Test_Module_WaitForReadiness(t *testing.T) {
+	kubeClient := kube.NewFakeKubernetesClient()
+	kubeClient.Discovery().(*fakediscovery.FakeDiscovery).Resources = []*metav1.APIResourceList{
+		{
+			GroupVersion: "apps/v1",
+			APIResources: []metav1.APIResource{
+				{Name: "deployments", Kind: "Deployment", Namespaced: true, Verbs: metav1.Verbs{"get"}},
+			},
+		},
+	}
+	deployments := kubeClient.Dynamic().Resource(schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}).Namespace("ns")
+
+	mm := NewMainModuleManager()
+	mm.WithKubeClient(kubeClient)
+	m := NewModule("module", "/modules/module")
+	m.WithModuleManager(mm)
+	m.Settings = &ModuleSettings{Namespace: "ns", Readiness: &ModuleReadinessSettings{Timeout: "100ms"}}
+	m.LastReleaseManifests = []manifest.Manifest{
+		{"apiVersion": "apps/v1", "kind": "Deployment", "metadata": map[string]interface{}{"name": "app"}},
+		{"apiVersion": "v1", "kind": "ConfigMap", "metadata": map[string]interface{}{"name": "cm"}},
+	}
+
+	defer func(interval time.Duration) { readinessPollInterval = interval }(readinessPollInterval)
+	readinessPollInterval = 10 * time.Millisecond
+
+	err := m.waitForReadiness(nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "Deployment/app: not found")
+
+	deploy := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata":   map[string]interface{}{"name": "app", "namespace": "ns", "generation": int64(1)},
+		"spec":       map[string]interface{}{"replicas": int64(1)},
+		"status":     map[string]interface{}{"observedGeneration": int64(1), "replicas": int64(1), "updatedReplicas": int64(1)},
+	}}
+	_, err = deployments.Create(deploy, metav1.CreateOptions{})
+	require.NoError(t, err)
+
+	err = m.waitForReadiness(nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "Deployment/app: 0 of 1 updated replicas are available")
+
+	require.NoError(t, unstructured.SetNestedField(deploy.Object, int64(1), "status", "availableReplicas"))
+	_, err = deployments.Update(deploy, metav1.UpdateOptions{})
+	require.NoError(t, err)
+
+	assert.NoError(t, m.waitForReadiness(nil))
+}
+
+func Test_Module_WaitForReadiness_HooksAndJobs(t *testing.T) {
+	kubeClient := kube.NewFakeKubernetesClient()
+	kubeClient.Discovery().(*fakediscovery.FakeDiscovery).Resources = []*metav1.APIResourceList{
+		{
+			GroupVersion: "batch/v1",
+			APIResources: []metav1.APIResource{
+				{Name: "jobs", Kind: "Job", Namespaced: true, Verbs: metav1.Verbs{"get"}},
+			},
+		},
+		{
+			GroupVersion: "apps/v1",
+			APIResources: []metav1.APIResource{
+				{Name: "deployments", Kind: "Deployment", Namespaced: true, Verbs: metav1.Verbs{"get"}},
+			},
+		},
+	}
+
+	mm := NewMainModuleManager()
+	mm.WithKubeClient(kubeClient)
+	m := NewModule("module", "/modules/module")
+	m.WithModuleManager(mm)
+	m.Settings = &ModuleSettings{Namespace: "ns", Readiness: &ModuleReadinessSettings{Timeout: "100ms"}}
+	hookAnnotations := map[string]interface{}{"helm.sh/hook": "pre-upgrade", "helm.sh/hook-delete-policy": "hook-succeeded"}
+	m.LastReleaseManifests = []manifest.Manifest{
+		// Hooks are deleted after success or are not created at all.
+		{"apiVersion": "batch/v1", "kind": "Job", "metadata": map[string]interface{}{"name": "migrate", "annotations": hookAnnotations}},
+		{"apiVersion": "apps/v1", "kind": "Deployment", "metadata": map[string]interface{}{"name": "test", "annotations": map[string]interface{}{"helm.sh/hook": "test"}}},
+		// Completed Job is deleted by ttlSecondsAfterFinished.
+		{"apiVersion": "batch/v1", "kind": "Job", "metadata": map[string]interface{}{"name": "ttl"}},
+	}
+
+	defer func(interval time.Duration) { readinessPollInterval = interval }(readinessPollInterval)
+	readinessPollInterval = 10 * time.Millisecond
+
+	assert.NoError(t, m.waitForReadiness(nil))
+}
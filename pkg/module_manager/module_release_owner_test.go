@@ -0,0 +1,324 @@
+package module_manager
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	kblabels "k8s.io/apimachinery/pkg/labels"
+
+	"github.com/flant/addon-operator/pkg/app"
+	"github.com/flant/addon-operator/pkg/helm"
+	"github.com/flant/addon-operator/pkg/helm/client"
+	"github.com/flant/addon-operator/pkg/helm_resources_manager"
+	"github.com/flant/addon-operator/pkg/utils"
+)
+
+// releasesStub stores labels of releases by release names.
+type releasesStub struct {
+	helm.MockHelmClient
+	releases map[string]map[string]string
+}
+
+func (h *releasesStub) IsReleaseExists(releaseName string) (bool, error) {
+	_, has := h.releases[releaseName]
+	return has, nil
+}
+
+func (h *releasesStub) ListReleasesNames(labelSelector map[string]string) ([]string, error) {
+	names := make([]string, 0)
+	for name, labels := range h.releases {
+		if kblabels.SelectorFromSet(labelSelector).Matches(kblabels.Set(labels)) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (h *releasesStub) ReleaseLabels(releaseName string) (map[string]string, error) {
+	return h.releases[releaseName], nil
+}
+
+func (h *releasesStub) DeleteRelease(releaseName string) error {
+	delete(h.releases, releaseName)
+	return nil
+}
+
+func (h *releasesStub) LabelRelease(releaseName string, labels map[string]string) error {
+	h.releases[releaseName] = utils.MergeLabels(h.releases[releaseName], labels)
+	return nil
+}
+
+func Test_Module_LegacyReleaseOwners(t *testing.T) {
+	// Instance 'b' in the namespace 'ns' generates release names with the 'b-' prefix.
+	releaseNaming, err := helm.NewReleaseNaming(app.HelmReleaseNameTemplate, "b-")
+	require.NoError(t, err)
+
+	logEntry := log.WithField("test", t.Name())
+
+	tests := []struct {
+		name          string
+		legacyLabels  map[string]string
+		expectRelease string
+		expectOwner   string
+		expectKnown   bool
+	}{
+		{"owned by another instance", map[string]string{helm.OwnerLabel: "a"}, "b-module", "a", false},
+		{"owned by this instance", map[string]string{helm.OwnerLabel: "b"}, "module", "b", true},
+		{"without owner", map[string]string{}, "module", "b", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stub := &releasesStub{releases: map[string]map[string]string{"module": tt.legacyLabels}}
+
+			mm := &moduleManager{
+				allModulesByName:       make(map[string]*Module),
+				allModulesNamesInOrder: []string{"module"},
+				helm: &helm.Helm{
+					NewClient: func(_ ...map[string]string) client.HelmClient {
+						return stub
+					},
+					OwnerID:       "b",
+					ReleaseNaming: releaseNaming,
+				},
+			}
+			m := NewModule("module", "/modules/module")
+			m.WithModuleManager(mm)
+			mm.allModulesByName["module"] = m
+
+			releaseName, err := m.helmReleaseName(stub, logEntry)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectRelease, releaseName)
+
+			m.markReleaseOwned(stub, "module", ModuleChart{}, logEntry)
+			assert.Equal(t, tt.expectOwner, stub.releases["module"][helm.OwnerLabel], "release of another instance should not be relabeled")
+
+			stub.releases["module"] = tt.legacyLabels
+			released, unknown, err := mm.listReleasedModules(nil)
+			require.NoError(t, err)
+			if tt.expectKnown {
+				assert.Equal(t, []string{"module"}, released)
+				assert.Empty(t, unknown)
+			} else {
+				assert.Empty(t, released)
+				assert.Equal(t, []string{"module"}, unknown, "release of another instance should not be counted as a module release")
+			}
+
+			owned, err := mm.helm.ListOwnedReleases(stub, nil)
+			require.NoError(t, err)
+			if tt.expectKnown && len(tt.legacyLabels) > 0 {
+				assert.Equal(t, []string{"module"}, owned)
+			}
+		})
+	}
+}
+
+func Test_Module_HelmReleaseName_ResetAfterDelete(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "addon-operator-release-name-")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(tmpDir, "Chart.yaml"), []byte("name: module\n"), 0644))
+
+	releaseNaming, err := helm.NewReleaseNaming(app.HelmReleaseNameTemplate, "b-")
+	require.NoError(t, err)
+	logEntry := log.WithField("test", t.Name())
+
+	stub := &releasesStub{releases: map[string]map[string]string{"module": {helm.OwnerLabel: "b"}}}
+	mm := NewMainModuleManager()
+	mm.WithHelmResourcesManager(helm_resources_manager.NewHelmResourcesManager())
+	mm.WithHelm(&helm.Helm{
+		NewClient: func(_ ...map[string]string) client.HelmClient {
+			return stub
+		},
+		OwnerID:       "b",
+		ReleaseNaming: releaseNaming,
+	})
+	m := NewModule("module", tmpDir)
+	m.WithModuleManager(mm)
+
+	releaseName, err := m.helmReleaseName(stub, logEntry)
+	require.NoError(t, err)
+	assert.Equal(t, "module", releaseName, "release with the legacy name should be adopted")
+
+	require.NoError(t, m.Delete(nil))
+	assert.Empty(t, stub.releases)
+
+	releaseName, err = m.helmReleaseName(stub, logEntry)
+	require.NoError(t, err)
+	assert.Equal(t, "b-module", releaseName, "deleted legacy release should not be used for the new installation")
+}
+
+// namespacedReleasesStub is a view of releases in one namespace. Releases are stored
+// by namespaces and by release names.
+type namespacedReleasesStub struct {
+	helm.MockHelmClient
+	namespace string
+	releases  map[string]map[string]map[string]string
+}
+
+func (h *namespacedReleasesStub) WithNamespace(namespace string) {
+	h.namespace = namespace
+}
+
+func (h *namespacedReleasesStub) ListReleasesNames(labelSelector map[string]string) ([]string, error) {
+	res := make([]string, 0)
+	for name, labels := range h.releases[h.namespace] {
+		if kblabels.SelectorFromSet(labelSelector).Matches(kblabels.Set(labels)) {
+			res = append(res, name)
+		}
+	}
+	return res, nil
+}
+
+func (h *namespacedReleasesStub) ReleaseLabels(releaseName string) (map[string]string, error) {
+	return h.releases[h.namespace][releaseName], nil
+}
+
+func (h *namespacedReleasesStub) DeleteRelease(releaseName string) error {
+	delete(h.releases[h.namespace], releaseName)
+	return nil
+}
+
+func Test_Module_MoveReleasesFromPreviousNamespaces(t *testing.T) {
+	defer func(mode string) {
+		app.PurgeMode = mode
+	}(app.PurgeMode)
+
+	newReleases := func() map[string]map[string]map[string]string {
+		return map[string]map[string]map[string]string{
+			"new":   {"module": {helm.OwnerLabel: "b", ReleaseModuleLabel: "module"}},
+			"old":   {"module": {helm.OwnerLabel: "b", ReleaseModuleLabel: "module"}},
+			"other": {"module": {helm.OwnerLabel: "a", ReleaseModuleLabel: "module"}},
+		}
+	}
+
+	newModule := func(releases map[string]map[string]map[string]string) *Module {
+		mm := NewMainModuleManager()
+		mm.WithHelmResourcesManager(helm_resources_manager.NewHelmResourcesManager())
+		mm.WithHelm(&helm.Helm{
+			NewClient: func(_ ...map[string]string) client.HelmClient {
+				return &namespacedReleasesStub{releases: releases}
+			},
+			OwnerID: "b",
+		})
+		m := NewModule("module", "/modules/module")
+		m.WithModuleManager(mm)
+		m.Settings = &ModuleSettings{Namespace: "new"}
+		return m
+	}
+
+	t.Run("purge", func(t *testing.T) {
+		app.PurgeMode = app.PurgeModePurge
+		releases := newReleases()
+		m := newModule(releases)
+		m.State.Namespace = "old"
+
+		err := m.moveReleasesFromPreviousNamespace(nil)
+		require.NoError(t, err)
+		assert.Empty(t, releases["old"], "owned release in the previous namespace should be deleted")
+		assert.Contains(t, releases["new"], "module")
+		assert.Contains(t, releases["other"], "module", "release of another instance should not be deleted")
+	})
+
+	t.Run("owned by another instance", func(t *testing.T) {
+		app.PurgeMode = app.PurgeModePurge
+		releases := newReleases()
+		m := newModule(releases)
+		m.State.Namespace = "other"
+
+		err := m.moveReleasesFromPreviousNamespace(nil)
+		require.NoError(t, err)
+		assert.Contains(t, releases["other"], "module", "release of another instance should not be deleted")
+	})
+
+	t.Run("dry-run", func(t *testing.T) {
+		app.PurgeMode = app.PurgeModeDryRun
+		releases := newReleases()
+		m := newModule(releases)
+		m.State.Namespace = "old"
+
+		err := m.moveReleasesFromPreviousNamespace(nil)
+		require.NoError(t, err, "namespace change should not fail ModuleRun")
+		assert.Contains(t, releases["old"], "module")
+	})
+
+	t.Run("namespace is not changed", func(t *testing.T) {
+		app.PurgeMode = app.PurgeModePurge
+		releases := newReleases()
+		m := newModule(releases)
+
+		err := m.moveReleasesFromPreviousNamespace(nil)
+		require.NoError(t, err)
+		assert.Contains(t, releases["old"], "module", "releases should not be searched without the previous install")
+
+		m.State.Namespace = "new"
+		err = m.moveReleasesFromPreviousNamespace(nil)
+		require.NoError(t, err)
+		assert.Contains(t, releases["old"], "module")
+	})
+
+	t.Run("keep on delete", func(t *testing.T) {
+		releases := newReleases()
+		m := newModule(releases)
+
+		helmClient, previous, err := m.releasesInNamespace("old", nil)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"module"}, previous)
+
+		err = m.deleteReleasesInNamespace(helmClient, "old", previous, map[string]bool{"": true})
+		require.NoError(t, err)
+		assert.Contains(t, releases["old"], "module", "release of the kept chart should not be deleted")
+	})
+}
+
+// renderReleasesStub renders manifests with the release name.
+type renderReleasesStub struct {
+	releasesStub
+}
+
+func (h *renderReleasesStub) Render(releaseName string, _ string, _ []string, _ []string, _ string) (string, error) {
+	return "kind: ConfigMap\nmetadata:\n  name: " + releaseName + "\n", nil
+}
+
+func Test_Module_Render_AdoptedReleaseName(t *testing.T) {
+	releaseNaming, err := helm.NewReleaseNaming(app.HelmReleaseNameTemplate, "b-")
+	require.NoError(t, err)
+	stub := &renderReleasesStub{releasesStub{releases: map[string]map[string]string{"module": {}}}}
+
+	mm := NewMainModuleManager()
+	mm.WithHelm(&helm.Helm{
+		NewClient: func(_ ...map[string]string) client.HelmClient {
+			return stub
+		},
+		OwnerID:       "b",
+		ReleaseNaming: releaseNaming,
+	})
+
+	tmpDir, err := ioutil.TempDir("", "addon-operator-render-")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+	mm.TempDir = tmpDir
+	require.NoError(t, ioutil.WriteFile(filepath.Join(tmpDir, "Chart.yaml"), []byte("name: module\n"), 0644))
+
+	m := NewModule("module", tmpDir)
+	m.WithModuleManager(mm)
+	m.CommonStaticConfig = utils.NewModuleConfig("module")
+	m.StaticConfig = utils.NewModuleConfig("module")
+
+	out, err := m.Render(nil)
+	require.NoError(t, err)
+	assert.Contains(t, out, "name: module\n", "release with the legacy name should be rendered")
+
+	delete(stub.releases, "module")
+	m.generatedReleaseName = ""
+	out, err = m.Render(nil)
+	require.NoError(t, err)
+	assert.Contains(t, out, "name: b-module\n")
+}
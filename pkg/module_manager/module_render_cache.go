@@ -0,0 +1,107 @@
+package module_manager
+
+import (
+	"context"
+	"runtime/trace"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/flant/shell-operator/pkg/utils/measure"
+
+	"github.com/flant/addon-operator/pkg/utils"
+)
+
+// renderCacheEntry is a rendered chart and a key of the render input.
+type renderCacheEntry struct {
+	Key       string
+	Manifests string
+	Checksum  string
+}
+
+// renderChart renders the chart and returns manifests with their checksum. Manifests
+// are taken from the cache if the module directory and values are not changed since
+// the last render of the release.
+func (m *Module) renderChart(chart ModuleChart, input RenderInput, logLabels map[string]string) (string, string, error) {
+	logEntry := log.WithFields(utils.LabelsToLogFields(logLabels))
+	metricLabels := map[string]string{
+		"module": m.Name,
+		"chart":  chart.Name,
+	}
+
+	key, err := m.renderCacheKey(input)
+	if err != nil {
+		// Render without the cache.
+		logEntry.Warnf("Cannot calculate render cache key: %v", err)
+	}
+	if entry, has := m.cachedRender(input.ReleaseName); has && key != "" && entry.Key == key {
+		logEntry.Debugf("Module and values are not changed, use cached manifests of release '%s'", input.ReleaseName)
+		m.metricStorage.CounterAdd("{PREFIX}helm_render_cache_hits_total", 1.0, metricLabels)
+		return entry.Manifests, entry.Checksum, nil
+	}
+	m.metricStorage.CounterAdd("{PREFIX}helm_render_cache_misses_total", 1.0, metricLabels)
+
+	var manifests string
+	func() {
+		defer trace.StartRegion(context.Background(), "ModuleRun-HelmPhase-helm-render").End()
+
+		operationLabels := utils.MergeLabels(metricLabels, map[string]string{
+			"activation": logLabels["event.type"],
+			"operation":  "template",
+		})
+		defer measure.Duration(func(d time.Duration) {
+			m.metricStorage.HistogramObserve("{PREFIX}helm_operation_seconds", d.Seconds(), operationLabels)
+		})()
+
+		manifests, err = helmRenderer{}.Render(m, input)
+	}()
+	if err != nil {
+		return "", "", err
+	}
+	checksum := utils.CalculateStringsChecksum(manifests)
+
+	if key != "" {
+		m.cacheRender(input.ReleaseName, renderCacheEntry{
+			Key:       key,
+			Manifests: manifests,
+			Checksum:  checksum,
+		})
+	}
+	return manifests, checksum, nil
+}
+
+// renderCacheKey returns a checksum of the module directory content, values and release parameters.
+func (m *Module) renderCacheKey(input RenderInput) (string, error) {
+	dirChecksum, err := utils.CalculateChecksumOfDirectory(m.Path)
+	if err != nil {
+		return "", err
+	}
+	valuesChecksum, err := input.Values.Checksum()
+	if err != nil {
+		return "", err
+	}
+	return utils.CalculateStringsChecksum(dirChecksum, valuesChecksum, input.ChartPath, input.ReleaseName, input.Namespace), nil
+}
+
+func (m *Module) cachedRender(releaseName string) (renderCacheEntry, bool) {
+	m.renderCacheMu.Lock()
+	defer m.renderCacheMu.Unlock()
+	entry, has := m.renderCache[releaseName]
+	return entry, has
+}
+
+func (m *Module) cacheRender(releaseName string, entry renderCacheEntry) {
+	m.renderCacheMu.Lock()
+	defer m.renderCacheMu.Unlock()
+	if m.renderCache == nil {
+		m.renderCache = make(map[string]renderCacheEntry)
+	}
+	m.renderCache[releaseName] = entry
+}
+
+// ResetRenderCache removes cached manifests of the module, so charts are rendered on the next run.
+func (m *Module) ResetRenderCache() {
+	m.renderCacheMu.Lock()
+	defer m.renderCacheMu.Unlock()
+	m.renderCache = nil
+}
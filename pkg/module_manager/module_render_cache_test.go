@@ -0,0 +1,86 @@
+package module_manager
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/flant/addon-operator/pkg/helm"
+	"github.com/flant/addon-operator/pkg/helm/client"
+	"github.com/flant/addon-operator/pkg/utils"
+)
+
+// renderHelmClient counts renders.
+type renderHelmClient struct {
+	*helm.MockHelmClient
+	Renders int
+}
+
+func (h *renderHelmClient) Render(releaseName string, _ string, _ []string, _ []string, _ string) (string, error) {
+	h.Renders++
+	return "kind: ConfigMap\nmetadata:\n  name: " + releaseName + "\n", nil
+}
+
+func Test_Module_RenderChart_Cache(t *testing.T) {
+	hc := &renderHelmClient{MockHelmClient: &helm.MockHelmClient{}}
+	mm := NewMainModuleManager()
+	mm.WithHelm(&helm.Helm{NewClient: func(_ ...map[string]string) client.HelmClient {
+		return hc
+	}})
+
+	tmpDir, err := ioutil.TempDir("", "addon-operator-render-cache-")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(tmpDir, "Chart.yaml"), []byte("name: module\n"), 0644))
+
+	m := NewModule("module", tmpDir)
+	m.WithModuleManager(mm)
+	input := RenderInput{
+		ReleaseName: "module",
+		Namespace:   "ns",
+		Values:      utils.Values{"module": map[string]interface{}{"param": "a"}},
+		ChartPath:   tmpDir,
+	}
+
+	manifests, checksum, err := m.renderChart(ModuleChart{}, input, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 1, hc.Renders)
+	assert.Contains(t, manifests, "name: module")
+	assert.Equal(t, utils.CalculateStringsChecksum(manifests), checksum)
+
+	cachedManifests, cachedChecksum, err := m.renderChart(ModuleChart{}, input, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 1, hc.Renders, "should use cached manifests")
+	assert.Equal(t, manifests, cachedManifests)
+	assert.Equal(t, checksum, cachedChecksum)
+
+	// Values are changed.
+	input.Values = utils.Values{"module": map[string]interface{}{"param": "b"}}
+	_, _, err = m.renderChart(ModuleChart{}, input, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 2, hc.Renders)
+
+	// Module files are changed.
+	require.NoError(t, ioutil.WriteFile(filepath.Join(tmpDir, "values.yaml"), []byte("param: c\n"), 0644))
+	_, _, err = m.renderChart(ModuleChart{}, input, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 3, hc.Renders)
+
+	// Another release of the module is cached separately.
+	other := input
+	other.ReleaseName = "module-other"
+	_, _, err = m.renderChart(ModuleChart{Name: "other"}, other, nil)
+	require.NoError(t, err)
+	_, _, err = m.renderChart(ModuleChart{}, input, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 4, hc.Renders)
+
+	m.ResetRenderCache()
+	_, _, err = m.renderChart(ModuleChart{}, input, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 5, hc.Renders, "should render after reset")
+}
@@ -0,0 +1,135 @@
+package module_manager
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/flant/shell-operator/pkg/utils/manifest"
+	"github.com/pmezard/go-difflib/difflib"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/flant/addon-operator/pkg/helm/client"
+	"github.com/flant/addon-operator/pkg/utils"
+)
+
+// RollbackAfterFailures returns a number of consecutive failed upgrades before rollback
+// or 0 if the automatic rollback is disabled.
+func (m *Module) RollbackAfterFailures() int {
+	if m.Settings == nil || m.Settings.Rollback == nil {
+		return 0
+	}
+	if m.Settings.Rollback.AfterFailures == 0 {
+		return 1
+	}
+	return m.Settings.Rollback.AfterFailures
+}
+
+// rollbackFailedUpgrade counts failed upgrades of the release and rolls it back to
+// the last deployed revision when the threshold from module.yaml is reached.
+// A summary of changed resources is logged, the full diff is kept for debugging: it can contain Secret data.
+// Upgrades of the release are paused after the rollback until the checksum of the rendered chart is changed,
+// so the same failed upgrade is not repeated. Rollback errors are logged: the module task
+// is retried because of the upgrade error anyway.
+func (m *Module) rollbackFailedUpgrade(helmClient client.HelmClient, chart ModuleChart, releaseName string, checksum string, logLabels map[string]string) {
+	afterFailures := m.RollbackAfterFailures()
+	if afterFailures == 0 {
+		return
+	}
+	logEntry := log.WithFields(utils.LabelsToLogFields(logLabels))
+
+	if m.State.UpgradeFailures == nil {
+		m.State.UpgradeFailures = make(map[string]int)
+	}
+	m.State.UpgradeFailures[releaseName]++
+	failures := m.State.UpgradeFailures[releaseName]
+	if failures < afterFailures {
+		logEntry.Infof("Helm upgrade of release '%s' failed %d of %d times before rollback", releaseName, failures, afterFailures)
+		return
+	}
+
+	metricLabels := map[string]string{
+		"module": m.Name,
+		"chart":  chart.Name,
+	}
+
+	failedManifest, err := helmClient.GetReleaseManifest(releaseName, "")
+	if err != nil {
+		logEntry.Warnf("Cannot get manifest of the failed release '%s': %v", releaseName, err)
+	}
+
+	// Pause before the rollback, so a concurrent ModuleRun will not upgrade the release.
+	m.pauseUpgrade(releaseName, checksum)
+	revision, err := helmClient.Rollback(releaseName, "")
+	if err != nil {
+		m.resumeUpgrade(releaseName)
+		logEntry.Errorf("Rollback of the failed release '%s': %v", releaseName, err)
+		metricLabels["result"] = "error"
+		m.metricStorage.CounterAdd("{PREFIX}helm_rollbacks_total", 1.0, metricLabels)
+		return
+	}
+	delete(m.State.UpgradeFailures, releaseName)
+	if revision == "" {
+		m.resumeUpgrade(releaseName)
+		logEntry.Infof("Rollback of release '%s' is not needed: last revision is deployed", releaseName)
+		return
+	}
+	metricLabels["result"] = "success"
+	m.metricStorage.CounterAdd("{PREFIX}helm_rollbacks_total", 1.0, metricLabels)
+
+	// Rollback creates a new revision with manifests of the deployed one.
+	deployedManifest, err := helmClient.GetReleaseManifest(releaseName, revision)
+	if err != nil {
+		logEntry.Warnf("Cannot get manifest of release '%s' revision %s: %v", releaseName, revision, err)
+	}
+	m.setFailedUpgradeDiff(releaseName, ManifestsDiff(deployedManifest, failedManifest, "revision "+revision, "failed upgrade"))
+	logEntry.Warnf("Release '%s' is rolled back to revision %s after %d failed upgrades, upgrades are paused until the chart or values are changed. Changes of the failed upgrade: %s",
+		releaseName, revision, failures, m.manifestsDiffSummary(deployedManifest, failedManifest))
+}
+
+// manifestsDiffSummary returns changed resources and paths of changed fields without values.
+func (m *Module) manifestsDiffSummary(from, to string) string {
+	fromManifests, err := manifest.GetManifestListFromYamlDocuments(from)
+	if err != nil {
+		return fmt.Sprintf("cannot parse manifests: %v", err)
+	}
+	toManifests, err := manifest.GetManifestListFromYamlDocuments(to)
+	if err != nil {
+		return fmt.Sprintf("cannot parse manifests: %v", err)
+	}
+	return utils.DiffSummary(utils.DiffManifests(fromManifests, toManifests, m.Namespace()))
+}
+
+// ManifestsDiff returns a unified diff of two multi-document manifests.
+func ManifestsDiff(from, to string, fromName, toName string) string {
+	diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(strings.TrimSpace(from) + "\n"),
+		B:        difflib.SplitLines(strings.TrimSpace(to) + "\n"),
+		FromFile: fromName,
+		ToFile:   toName,
+		Context:  3,
+	})
+	if err != nil {
+		return err.Error()
+	}
+	return diff
+}
+
+func (m *Module) setFailedUpgradeDiff(releaseName string, diff string) {
+	m.failedUpgradeDiffsMu.Lock()
+	defer m.failedUpgradeDiffsMu.Unlock()
+	if m.failedUpgradeDiffs == nil {
+		m.failedUpgradeDiffs = make(map[string]string)
+	}
+	m.failedUpgradeDiffs[releaseName] = diff
+}
+
+// FailedUpgradeDiffs returns diffs of the last rolled back upgrades by release name.
+func (m *Module) FailedUpgradeDiffs() map[string]string {
+	m.failedUpgradeDiffsMu.Lock()
+	defer m.failedUpgradeDiffsMu.Unlock()
+	res := make(map[string]string, len(m.failedUpgradeDiffs))
+	for name, diff := range m.failedUpgradeDiffs {
+		res[name] = diff
+	}
+	return res
+}
@@ -0,0 +1,90 @@
+package module_manager
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/flant/addon-operator/pkg/helm"
+)
+
+// rollbackHelmClient returns manifests of the failed and the deployed revisions.
+type rollbackHelmClient struct {
+	*helm.MockHelmClient
+	Rollbacks int
+}
+
+func (h *rollbackHelmClient) GetReleaseManifest(_ string, revision string) (string, error) {
+	if revision == "" {
+		return "kind: ConfigMap\nmetadata:\n  name: cm\ndata:\n  key: broken\n", nil
+	}
+	return "kind: ConfigMap\nmetadata:\n  name: cm\ndata:\n  key: value\n", nil
+}
+
+func (h *rollbackHelmClient) Rollback(_ string, _ string) (string, error) {
+	h.Rollbacks++
+	return "1", nil
+}
+
+func Test_Module_RollbackAfterFailures(t *testing.T) {
+	m := NewModule("module", "/modules/module")
+	assert.Equal(t, 0, m.RollbackAfterFailures(), "rollback is disabled by default")
+
+	settings, err := NewModuleSettingsFromBytes([]byte("rollback: {}\n"))
+	require.NoError(t, err)
+	m.Settings = settings
+	assert.Equal(t, 1, m.RollbackAfterFailures())
+
+	settings, err = NewModuleSettingsFromBytes([]byte("rollback:\n  afterFailures: 3\n"))
+	require.NoError(t, err)
+	m.Settings = settings
+	assert.Equal(t, 3, m.RollbackAfterFailures())
+
+	_, err = NewModuleSettingsFromBytes([]byte("rollback:\n  afterFailures: -1\n"))
+	assert.Error(t, err)
+}
+
+func Test_Module_RollbackFailedUpgrade(t *testing.T) {
+	m := NewModule("module", "/modules/module")
+	hc := &rollbackHelmClient{MockHelmClient: &helm.MockHelmClient{}}
+
+	// Rollback is disabled.
+	m.rollbackFailedUpgrade(hc, ModuleChart{}, "module", "checksum", nil)
+	assert.Equal(t, 0, hc.Rollbacks)
+
+	m.Settings = &ModuleSettings{Rollback: &ModuleRollbackSettings{AfterFailures: 2}}
+
+	m.rollbackFailedUpgrade(hc, ModuleChart{}, "module", "checksum", nil)
+	assert.Equal(t, 0, hc.Rollbacks, "should not rollback before the threshold")
+	assert.Len(t, m.FailedUpgradeDiffs(), 0)
+
+	m.rollbackFailedUpgrade(hc, ModuleChart{}, "module", "checksum", nil)
+	assert.Equal(t, 1, hc.Rollbacks)
+	assert.Equal(t, 0, m.State.UpgradeFailures["module"], "counter should be reset after rollback")
+
+	diff := m.FailedUpgradeDiffs()["module"]
+	assert.Contains(t, diff, "--- revision 1")
+	assert.Contains(t, diff, "+++ failed upgrade")
+	assert.Contains(t, diff, "-  key: value")
+	assert.Contains(t, diff, "+  key: broken")
+
+	// The same failed upgrade is not repeated after the rollback.
+	assert.True(t, m.UpgradePaused("module", "checksum"))
+	assert.False(t, m.UpgradePaused("module", "new-checksum"), "pause should be removed if the chart is changed")
+
+	m.rollbackFailedUpgrade(hc, ModuleChart{}, "module", "new-checksum", nil)
+	assert.Equal(t, 1, hc.Rollbacks, "counter should start from zero after rollback")
+}
+
+func Test_Module_ManifestsDiffSummary(t *testing.T) {
+	m := NewModule("module", "/modules/module")
+	from := "apiVersion: v1\nkind: Secret\nmetadata:\n  name: s\ndata:\n  password: b2xk\n"
+	to := "apiVersion: v1\nkind: Secret\nmetadata:\n  name: s\ndata:\n  password: bmV3\n"
+
+	summary := m.manifestsDiffSummary(from, to)
+	assert.Contains(t, summary, "Secret/")
+	assert.Contains(t, summary, "data.password")
+	assert.NotContains(t, summary, "b2xk", "summary should not contain values")
+	assert.NotContains(t, summary, "bmV3", "summary should not contain values")
+}
@@ -0,0 +1,140 @@
+package module_manager
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/yaml"
+
+	"github.com/flant/addon-operator/pkg/task"
+	"github.com/flant/addon-operator/pkg/utils"
+)
+
+const ModuleSettingsFileName = "module.yaml"
+
+// ModuleSettings are settings that control how addon-operator handles the module.
+// Settings are not passed to hooks and to the Helm chart. They are defined
+// in the module.yaml file in the module directory.
+type ModuleSettings struct {
+	// Kind defines how module resources are installed: "helm", "manifests", "kustomize" or "hooks".
+	// Kind is detected by the module directory content if it is empty.
+	Kind string `json:"kind,omitempty"`
+	// RetryPolicy overrides the retry policy for failed module tasks.
+	RetryPolicy *task.RetryPolicyConfig `json:"retryPolicy,omitempty"`
+	// Namespace is a target namespace for the Helm release. It can be
+	// overridden in ConfigMap with the <moduleName>Namespace key.
+	Namespace string `json:"namespace,omitempty"`
+	// NamespaceLabels and NamespaceAnnotations are set when the namespace is created.
+	NamespaceLabels      map[string]string `json:"namespaceLabels,omitempty"`
+	NamespaceAnnotations map[string]string `json:"namespaceAnnotations,omitempty"`
+	// Charts defines an order and options of charts in the 'charts' directory
+	// of a module with several charts.
+	Charts []ModuleChartSettings `json:"charts,omitempty"`
+	// DeleteCRDsOnDelete enables deletion of CRDs from the 'crds' directory
+	// when the module is deleted. CRDs are kept by default to keep custom resources.
+	DeleteCRDsOnDelete bool `json:"deleteCRDsOnDelete,omitempty"`
+	// Readiness enables waiting for module workloads before afterHelm hooks.
+	Readiness *ModuleReadinessSettings `json:"readiness,omitempty"`
+	// Rollback enables rollback of Helm releases to the last deployed revision after failed upgrades.
+	Rollback *ModuleRollbackSettings `json:"rollback,omitempty"`
+	// HelmOptions are flags of helm upgrade for releases of the module. They can be
+	// overridden in ConfigMap with the <moduleName>HelmOptions key.
+	HelmOptions *utils.HelmOptions `json:"helmOptions,omitempty"`
+}
+
+// ModuleRollbackSettings are settings of the automatic rollback of failed Helm upgrades.
+type ModuleRollbackSettings struct {
+	// AfterFailures is a number of consecutive failed upgrades of the release before rollback. Default is 1.
+	AfterFailures int `json:"afterFailures,omitempty"`
+}
+
+// ModuleReadinessSettings are settings of the readiness check for module workloads.
+type ModuleReadinessSettings struct {
+	// Timeout is a duration to wait for workloads, e.g. "10m". Default is 5m.
+	Timeout string `json:"timeout,omitempty"`
+}
+
+// ModuleChartSettings are settings of one chart in a module with several charts.
+type ModuleChartSettings struct {
+	// Name is a name of the directory in 'charts'.
+	Name string `json:"name"`
+	// KeepOnDelete charts are not deleted with the module, e.g. charts with CRDs.
+	KeepOnDelete bool `json:"keepOnDelete,omitempty"`
+}
+
+// NewModuleSettingsFromBytes parses and validates settings.
+func NewModuleSettingsFromBytes(data []byte) (*ModuleSettings, error) {
+	settings := &ModuleSettings{}
+	err := yaml.UnmarshalStrict(data, settings)
+	if err != nil {
+		return nil, err
+	}
+	switch settings.Kind {
+	case "", ModuleKindHelm, ModuleKindManifests, ModuleKindKustomize, ModuleKindHooks:
+	default:
+		return nil, fmt.Errorf("kind: unknown kind '%s'", settings.Kind)
+	}
+	if settings.RetryPolicy != nil {
+		if _, err := task.DefaultRetryPolicy.WithConfig(settings.RetryPolicy); err != nil {
+			return nil, fmt.Errorf("retryPolicy: %v", err)
+		}
+	}
+	if settings.Namespace != "" {
+		if errs := validation.IsDNS1123Label(settings.Namespace); len(errs) > 0 {
+			return nil, fmt.Errorf("namespace: %s", strings.Join(errs, ", "))
+		}
+	}
+	if settings.Readiness != nil && settings.Readiness.Timeout != "" {
+		timeout, err := time.ParseDuration(settings.Readiness.Timeout)
+		if err != nil {
+			return nil, fmt.Errorf("readiness: timeout: %v", err)
+		}
+		if timeout <= 0 {
+			return nil, fmt.Errorf("readiness: timeout should be positive")
+		}
+	}
+	if settings.Rollback != nil && settings.Rollback.AfterFailures < 0 {
+		return nil, fmt.Errorf("rollback: afterFailures should not be negative")
+	}
+	if settings.HelmOptions != nil {
+		if err := settings.HelmOptions.Validate(); err != nil {
+			return nil, fmt.Errorf("helmOptions: %v", err)
+		}
+	}
+	names := make(map[string]bool)
+	for _, chart := range settings.Charts {
+		if errs := validation.IsDNS1123Label(chart.Name); len(errs) > 0 {
+			return nil, fmt.Errorf("charts: name '%s': %s", chart.Name, strings.Join(errs, ", "))
+		}
+		if names[chart.Name] {
+			return nil, fmt.Errorf("charts: duplicate name '%s'", chart.Name)
+		}
+		names[chart.Name] = true
+	}
+	return settings, nil
+}
+
+// loadSettings loads module settings from module.yaml. Settings are empty if file is not exists.
+func (m *Module) loadSettings() error {
+	settingsPath := filepath.Join(m.Path, ModuleSettingsFileName)
+
+	data, err := ioutil.ReadFile(settingsPath)
+	if os.IsNotExist(err) {
+		m.Settings = &ModuleSettings{}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("read %s: %v", settingsPath, err)
+	}
+
+	m.Settings, err = NewModuleSettingsFromBytes(data)
+	if err != nil {
+		return fmt.Errorf("load %s: %v", settingsPath, err)
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+package module_manager
+
+import (
+	"fmt"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/flant/addon-operator/pkg/helm/client"
+	"github.com/flant/addon-operator/pkg/helm/post_renderer"
+	"github.com/flant/addon-operator/pkg/utils"
+)
+
+// RenderInput contains everything renderers need to produce manifests.
+type RenderInput struct {
+	ReleaseName string
+	Namespace   string
+	// Values are merged module values with the global section.
+	Values utils.Values
+	// ValuesPath is a path to the YAML file with Values.
+	ValuesPath string
+	// ChartPath is a path to the chart for the helm renderer. Module directory is used if empty.
+	ChartPath string
+	LogLabels map[string]string
+}
+
+// Renderer produces manifests for the module from module values.
+type Renderer interface {
+	// Name is used in logs and metrics.
+	Name() string
+	// Render returns manifests as a multi-document YAML.
+	Render(m *Module, input RenderInput) (string, error)
+}
+
+// Renderer returns a renderer for the module kind or nil for modules without manifests.
+func (m *Module) Renderer() Renderer {
+	switch m.Kind() {
+	case ModuleKindHelm:
+		return helmRenderer{}
+	case ModuleKindManifests:
+		return templatesRenderer{}
+	case ModuleKindKustomize:
+		return kustomizeRenderer{}
+	}
+	return nil
+}
+
+// prepareRenderInput prepares values for the renderer.
+func (m *Module) prepareRenderInput(releaseName string, namespace string, logLabels map[string]string) (RenderInput, error) {
+	values, err := m.Values()
+	if err != nil {
+		return RenderInput{}, err
+	}
+	valuesPath, err := m.prepareValuesYamlFileWith(values)
+	if err != nil {
+		return RenderInput{}, err
+	}
+	return RenderInput{
+		ReleaseName: releaseName,
+		Namespace:   namespace,
+		Values:      values,
+		ValuesPath:  valuesPath,
+		LogLabels:   logLabels,
+	}, nil
+}
+
+// Render renders manifests of the module with the current values.
+func (m *Module) Render(logLabels map[string]string) (string, error) {
+	renderer := m.Renderer()
+	if renderer == nil {
+		return "", fmt.Errorf("module '%s' has no manifests", m.Name)
+	}
+	namespace := m.Namespace()
+	input, err := m.prepareRenderInput(m.generateHelmReleaseName(), namespace, logLabels)
+	if err != nil {
+		return "", err
+	}
+	if m.Kind() != ModuleKindHelm {
+		return renderer.Render(m, input)
+	}
+
+	// Render all charts of the module with release names in use, e.g. the adopted legacy name.
+	charts, err := m.Charts()
+	if err != nil {
+		return "", err
+	}
+	helmClient := m.helmClient(logLabels)
+	logEntry := log.WithFields(utils.LabelsToLogFields(logLabels))
+	var res strings.Builder
+	for _, chart := range charts {
+		input.ChartPath = chart.Path
+		input.ReleaseName, err = m.chartReleaseName(helmClient, chart, logEntry)
+		if err != nil {
+			return "", err
+		}
+		out, err := renderer.Render(m, input)
+		if err != nil {
+			return "", err
+		}
+		res.WriteString(out)
+	}
+	return res.String(), nil
+}
+
+// helmRenderer renders the Helm chart with 'helm template'.
+type helmRenderer struct{}
+
+func (helmRenderer) Name() string {
+	return ModuleKindHelm
+}
+
+func (helmRenderer) Render(m *Module, input RenderInput) (string, error) {
+	chartPath := input.ChartPath
+	if chartPath == "" {
+		chartPath = m.Path
+	}
+	return m.helmClient(input.LogLabels).Render(
+		input.ReleaseName,
+		chartPath,
+		[]string{input.ValuesPath},
+		[]string{},
+		input.Namespace)
+}
+
+// templatesRenderer renders Go templates from the 'manifests' or the 'templates' directory.
+type templatesRenderer struct{}
+
+func (templatesRenderer) Name() string {
+	return ModuleKindManifests
+}
+
+func (templatesRenderer) Render(m *Module, input RenderInput) (string, error) {
+	out, err := m.RenderManifests(input.Values, input.Namespace)
+	if err != nil {
+		return "", err
+	}
+	return m.postRender(out, input.Namespace)
+}
+
+// postRender applies the post-render pipeline to manifests rendered without Helm.
+// The Helm client of the module applies the pipeline itself.
+func (m *Module) postRender(manifests string, namespace string) (string, error) {
+	return client.PostRender(post_renderer.ForModule(m.Name, namespace), manifests)
+}
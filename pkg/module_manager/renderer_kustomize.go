@@ -0,0 +1,92 @@
+package module_manager
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"text/template"
+
+	"sigs.k8s.io/kustomize/api/filesys"
+	"sigs.k8s.io/kustomize/api/konfig"
+	"sigs.k8s.io/kustomize/api/krusty"
+)
+
+// kustomizeRenderer builds the kustomization in the module directory.
+// The kustomization file is rendered as a Go template with module values
+// before the build, so values can set images, replicas, namespace, etc.
+type kustomizeRenderer struct{}
+
+func (kustomizeRenderer) Name() string {
+	return ModuleKindKustomize
+}
+
+func (kustomizeRenderer) Render(m *Module, input RenderInput) (string, error) {
+	kustomizationPath := m.kustomizationPath()
+	if kustomizationPath == "" {
+		return "", fmt.Errorf("no kustomization file in '%s'", m.Path)
+	}
+	kustomizationPath, err := filepath.Abs(kustomizationPath)
+	if err != nil {
+		return "", err
+	}
+
+	content, err := ioutil.ReadFile(kustomizationPath)
+	if err != nil {
+		return "", err
+	}
+	tpl, err := template.New(filepath.Base(kustomizationPath)).Option("missingkey=zero").Funcs(manifestsTemplateFuncs).Parse(string(content))
+	if err != nil {
+		return "", fmt.Errorf("parse %s: %v", filepath.Base(kustomizationPath), err)
+	}
+	var buf bytes.Buffer
+	err = tpl.Execute(&buf, manifestsTemplateData{
+		Values:     input.Values,
+		ModuleName: m.Name,
+		Namespace:  input.Namespace,
+	})
+	if err != nil {
+		return "", fmt.Errorf("render %s: %v", filepath.Base(kustomizationPath), err)
+	}
+
+	fSys := &kustomizationFs{
+		FileSystem: filesys.MakeFsOnDisk(),
+		path:       kustomizationPath,
+		content:    buf.Bytes(),
+	}
+	resMap, err := krusty.MakeKustomizer(fSys, krusty.MakeDefaultOptions()).Run(filepath.Dir(kustomizationPath))
+	if err != nil {
+		return "", err
+	}
+	out, err := resMap.AsYaml()
+	if err != nil {
+		return "", err
+	}
+	return m.postRender(string(out), input.Namespace)
+}
+
+// kustomizationPath returns a path to the kustomization file in the module directory or an empty string.
+func (m *Module) kustomizationPath() string {
+	for _, name := range konfig.RecognizedKustomizationFileNames() {
+		path := filepath.Join(m.Path, name)
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return path
+		}
+	}
+	return ""
+}
+
+// kustomizationFs is a disk file system with the rendered kustomization file.
+type kustomizationFs struct {
+	filesys.FileSystem
+	path    string
+	content []byte
+}
+
+func (fs *kustomizationFs) ReadFile(path string) ([]byte, error) {
+	if filepath.Clean(path) == fs.path {
+		return fs.content, nil
+	}
+	return fs.FileSystem.ReadFile(path)
+}
@@ -0,0 +1,62 @@
+package module_manager
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/flant/addon-operator/pkg/utils"
+)
+
+func Test_KustomizeRenderer(t *testing.T) {
+	rootDir, err := ioutil.TempDir("", "addon-operator-kustomize-")
+	require.NoError(t, err)
+	defer os.RemoveAll(rootDir)
+
+	writeFile := func(name string, content string) {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(rootDir, name), []byte(content), 0644))
+	}
+	writeFile("kustomization.yaml", `namespace: {{ .Namespace }}
+namePrefix: {{ .Values.moduleOne.prefix }}-
+commonLabels:
+  module: {{ .ModuleName }}
+resources:
+- cm.yaml
+`)
+	writeFile("cm.yaml", `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: config
+data:
+  param: value
+`)
+
+	m := NewModule("module-one", rootDir)
+	m.Settings = &ModuleSettings{}
+	require.Equal(t, ModuleKindKustomize, m.Kind())
+	require.Equal(t, ModuleKindKustomize, m.Renderer().Name())
+
+	rendered, err := m.Renderer().Render(m, RenderInput{
+		Namespace: "ns-one",
+		Values: utils.Values{
+			"moduleOne": map[string]interface{}{"prefix": "one"},
+		},
+	})
+	require.NoError(t, err)
+
+	manifests, err := utils.ManifestListFromYamlDocuments(rendered)
+	require.NoError(t, err)
+	require.Len(t, manifests, 1)
+	assert.Equal(t, "one-config", manifests[0].Name())
+	assert.Equal(t, "ns-one", manifests[0].Namespace(""))
+	assert.Equal(t, map[string]interface{}{"module": "module-one"}, manifests[0].Metadata()["labels"])
+
+	// Kustomization file on disk is not changed.
+	content, err := ioutil.ReadFile(filepath.Join(rootDir, "kustomization.yaml"))
+	require.NoError(t, err)
+	assert.Contains(t, string(content), "{{ .Namespace }}")
+}
@@ -3,7 +3,9 @@ package task
 import (
 	"fmt"
 	log "github.com/sirupsen/logrus"
+	"sort"
 	"strings"
+	"time"
 
 	. "github.com/flant/shell-operator/pkg/hook/binding_context"
 	"github.com/flant/shell-operator/pkg/hook/task_metadata"
@@ -30,6 +32,12 @@ type HookMetadata struct {
 
 	KubernetesBindingId    string // Unique id for kubernetes bindings
 	WaitForSynchronization bool   // kubernetes.Synchronization task should be waited
+
+	ParallelRunModules map[string]bool // Modules to run in parallel with OnStartupHooks flag for each module
+	ParallelRunId      string          // Id of the ParallelModuleRun task that waits for this ModuleRun task
+	ParallelRunQueued  map[string]bool // Modules with ModuleRun tasks already queued into parallel queues
+
+	NextRetryTime time.Time // Time of the next execution of a failed task
 }
 
 var _ task_metadata.HookNameAccessor = HookMetadata{}
@@ -51,6 +59,13 @@ func HookMetadataAccessor(t task.Task) (meta HookMetadata) {
 }
 
 func (hm HookMetadata) GetDescription() string {
+	if hm.NextRetryTime.IsZero() {
+		return hm.description()
+	}
+	return fmt.Sprintf("%s:retry at %s", hm.description(), hm.NextRetryTime.Format(time.RFC3339))
+}
+
+func (hm HookMetadata) description() string {
 	bindings := []string{}
 	for _, bc := range hm.BindingContext {
 		bindings = append(bindings, bc.Binding)
@@ -60,6 +75,16 @@ func (hm HookMetadata) GetDescription() string {
 		bindingNames = ":" + strings.Join(bindings, ",")
 	}
 
+	if len(hm.ParallelRunModules) > 0 {
+		// parallel module run
+		names := make([]string, 0, len(hm.ParallelRunModules))
+		for name := range hm.ParallelRunModules {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return fmt.Sprintf("%s:%s", strings.Join(names, ","), hm.EventDescription)
+	}
+
 	if hm.ModuleName == "" {
 		// global hook
 		return fmt.Sprintf("%s:%s%s:%s", string(hm.BindingType), hm.HookName, bindingNames, hm.EventDescription)
@@ -0,0 +1,186 @@
+package task
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/flant/shell-operator/pkg/task"
+	"github.com/flant/shell-operator/pkg/task/queue"
+)
+
+// RetryPolicy defines a delay before the next execution of a failed task.
+// Delay is growing exponentially from InitialDelay to MaxDelay, random
+// jitter is added to spread retries of tasks failed at the same time.
+type RetryPolicy struct {
+	InitialDelay time.Duration
+	MaxDelay     time.Duration
+	Multiplier   float64
+	Jitter       float64 // Fraction of the delay to add randomly, 0.1 is for ±10%
+}
+
+// RetryPolicyConfig is a partial RetryPolicy from configuration: module.yaml, hook configuration
+// or command line flags. Empty fields are inherited from the parent policy.
+type RetryPolicyConfig struct {
+	InitialDelay string   `json:"initialDelay,omitempty"`
+	MaxDelay     string   `json:"maxDelay,omitempty"`
+	Multiplier   *float64 `json:"multiplier,omitempty"`
+	Jitter       *float64 `json:"jitter,omitempty"`
+}
+
+// DefaultRetryPolicy is used for task types without configured policy.
+var DefaultRetryPolicy = RetryPolicy{
+	InitialDelay: queue.DelayOnFailedTask,
+	MaxDelay:     5 * time.Minute,
+	Multiplier:   2.0,
+	Jitter:       0.1,
+}
+
+// TaskRetryPolicies are policies for task types configured with flags.
+var TaskRetryPolicies = map[task.TaskType]RetryPolicy{}
+
+// RetryPolicyForTaskType returns a policy for task type or a default policy.
+func RetryPolicyForTaskType(taskType task.TaskType) RetryPolicy {
+	if policy, ok := TaskRetryPolicies[taskType]; ok {
+		return policy
+	}
+	return DefaultRetryPolicy
+}
+
+// Delay returns a delay before the next retry for a task failed failureCount times.
+func (p RetryPolicy) Delay(failureCount int) time.Duration {
+	if failureCount < 0 {
+		failureCount = 0
+	}
+	delay := float64(p.InitialDelay) * math.Pow(p.Multiplier, float64(failureCount))
+	if p.MaxDelay > 0 && delay > float64(p.MaxDelay) {
+		delay = float64(p.MaxDelay)
+	}
+	if p.Jitter > 0 {
+		delay += delay * p.Jitter * (2*rand.Float64() - 1)
+	}
+	if p.MaxDelay > 0 && delay > float64(p.MaxDelay) {
+		delay = float64(p.MaxDelay)
+	}
+	if delay < 0 {
+		delay = 0
+	}
+	return time.Duration(delay).Truncate(time.Millisecond)
+}
+
+// WithConfig returns a copy of the policy with fields overridden by non-empty fields from cfg.
+func (p RetryPolicy) WithConfig(cfg *RetryPolicyConfig) (RetryPolicy, error) {
+	if cfg == nil {
+		return p, nil
+	}
+	res := p
+	if cfg.InitialDelay != "" {
+		d, err := time.ParseDuration(cfg.InitialDelay)
+		if err != nil {
+			return p, fmt.Errorf("parse initialDelay: %v", err)
+		}
+		res.InitialDelay = d
+	}
+	if cfg.MaxDelay != "" {
+		d, err := time.ParseDuration(cfg.MaxDelay)
+		if err != nil {
+			return p, fmt.Errorf("parse maxDelay: %v", err)
+		}
+		res.MaxDelay = d
+	}
+	if cfg.Multiplier != nil {
+		res.Multiplier = *cfg.Multiplier
+	}
+	if cfg.Jitter != nil {
+		res.Jitter = *cfg.Jitter
+	}
+	return res, res.Validate()
+}
+
+func (p RetryPolicy) Validate() error {
+	if p.InitialDelay <= 0 {
+		return fmt.Errorf("initialDelay should be positive, got %s", p.InitialDelay)
+	}
+	if p.MaxDelay > 0 && p.MaxDelay < p.InitialDelay {
+		return fmt.Errorf("maxDelay %s should not be less than initialDelay %s", p.MaxDelay, p.InitialDelay)
+	}
+	if p.Multiplier < 1.0 {
+		return fmt.Errorf("multiplier should be 1.0 or greater, got %v", p.Multiplier)
+	}
+	if p.Jitter < 0 || p.Jitter > 1.0 {
+		return fmt.Errorf("jitter should be in range [0, 1], got %v", p.Jitter)
+	}
+	return nil
+}
+
+// ParseRetryPolicyFlag parses a flag value in format '<TaskType>:initialDelay=5s,maxDelay=5m,multiplier=2,jitter=0.1'.
+// Task type "default" is used to override DefaultRetryPolicy.
+func ParseRetryPolicyFlag(value string) (task.TaskType, *RetryPolicyConfig, error) {
+	parts := strings.SplitN(value, ":", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return "", nil, fmt.Errorf("retry policy '%s': expect format '<TaskType>:key=value,...'", value)
+	}
+
+	cfg := &RetryPolicyConfig{}
+	for _, field := range strings.Split(parts[1], ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		kv := strings.SplitN(field, "=", 2)
+		if len(kv) != 2 {
+			return "", nil, fmt.Errorf("retry policy '%s': expect key=value, got '%s'", value, field)
+		}
+		switch kv[0] {
+		case "initialDelay":
+			cfg.InitialDelay = kv[1]
+		case "maxDelay":
+			cfg.MaxDelay = kv[1]
+		case "multiplier", "jitter":
+			f, err := strconv.ParseFloat(kv[1], 64)
+			if err != nil {
+				return "", nil, fmt.Errorf("retry policy '%s': parse %s: %v", value, kv[0], err)
+			}
+			if kv[0] == "multiplier" {
+				cfg.Multiplier = &f
+			} else {
+				cfg.Jitter = &f
+			}
+		default:
+			return "", nil, fmt.Errorf("retry policy '%s': unknown key '%s'", value, kv[0])
+		}
+	}
+
+	return task.TaskType(parts[0]), cfg, nil
+}
+
+// InitRetryPolicies fills TaskRetryPolicies from flag values.
+func InitRetryPolicies(values []string) error {
+	var err error
+	for _, value := range values {
+		taskType, cfg, err := ParseRetryPolicyFlag(value)
+		if err != nil {
+			return err
+		}
+		if taskType == "default" {
+			DefaultRetryPolicy, err = DefaultRetryPolicy.WithConfig(cfg)
+			if err != nil {
+				return fmt.Errorf("retry policy '%s': %v", value, err)
+			}
+		}
+	}
+	for _, value := range values {
+		taskType, cfg, _ := ParseRetryPolicyFlag(value)
+		if taskType == "default" {
+			continue
+		}
+		TaskRetryPolicies[taskType], err = RetryPolicyForTaskType(taskType).WithConfig(cfg)
+		if err != nil {
+			return fmt.Errorf("retry policy '%s': %v", value, err)
+		}
+	}
+	return nil
+}
@@ -22,4 +22,8 @@ const (
 	ModulePurge task.TaskType = "ModulePurge"
 	// Task to call ModuleManager.Retry
 	ModuleManagerRetry task.TaskType = "ModuleManagerRetry"
+	// Run independent modules in parallel queues and wait until they are done
+	ParallelModuleRun task.TaskType = "ParallelModuleRun"
+	// Reload changed global hooks and modules
+	HotReload task.TaskType = "HotReload"
 )
@@ -0,0 +1,71 @@
+package task_test
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+
+	. "github.com/flant/addon-operator/pkg/task"
+)
+
+func Test_RetryPolicy_Delay(t *testing.T) {
+	g := NewWithT(t)
+
+	policy := RetryPolicy{
+		InitialDelay: time.Second,
+		MaxDelay:     10 * time.Second,
+		Multiplier:   2.0,
+	}
+
+	g.Expect(policy.Delay(0)).Should(Equal(time.Second))
+	g.Expect(policy.Delay(1)).Should(Equal(2 * time.Second))
+	g.Expect(policy.Delay(3)).Should(Equal(8 * time.Second))
+	g.Expect(policy.Delay(4)).Should(Equal(10 * time.Second))
+	g.Expect(policy.Delay(100)).Should(Equal(10 * time.Second))
+
+	policy.Jitter = 0.1
+	for i := 0; i < 100; i++ {
+		delay := policy.Delay(2)
+		g.Expect(delay).Should(BeNumerically(">=", 3600*time.Millisecond))
+		g.Expect(delay).Should(BeNumerically("<=", 4400*time.Millisecond))
+	}
+}
+
+func Test_RetryPolicy_WithConfig(t *testing.T) {
+	g := NewWithT(t)
+
+	multiplier := 3.0
+	policy, err := DefaultRetryPolicy.WithConfig(&RetryPolicyConfig{
+		MaxDelay:   "1m",
+		Multiplier: &multiplier,
+	})
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(policy.InitialDelay).Should(Equal(DefaultRetryPolicy.InitialDelay))
+	g.Expect(policy.MaxDelay).Should(Equal(time.Minute))
+	g.Expect(policy.Multiplier).Should(Equal(3.0))
+
+	_, err = DefaultRetryPolicy.WithConfig(&RetryPolicyConfig{InitialDelay: "10m", MaxDelay: "1m"})
+	g.Expect(err).Should(HaveOccurred())
+
+	_, err = DefaultRetryPolicy.WithConfig(&RetryPolicyConfig{InitialDelay: "abc"})
+	g.Expect(err).Should(HaveOccurred())
+}
+
+func Test_ParseRetryPolicyFlag(t *testing.T) {
+	g := NewWithT(t)
+
+	taskType, cfg, err := ParseRetryPolicyFlag("ModuleRun:initialDelay=1s,maxDelay=30s,multiplier=1.5,jitter=0")
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(taskType).Should(Equal(ModuleRun))
+	g.Expect(cfg.InitialDelay).Should(Equal("1s"))
+	g.Expect(cfg.MaxDelay).Should(Equal("30s"))
+	g.Expect(*cfg.Multiplier).Should(Equal(1.5))
+	g.Expect(*cfg.Jitter).Should(Equal(0.0))
+
+	_, _, err = ParseRetryPolicyFlag("initialDelay=1s")
+	g.Expect(err).Should(HaveOccurred())
+
+	_, _, err = ParseRetryPolicyFlag("ModuleRun:delay=1s")
+	g.Expect(err).Should(HaveOccurred())
+}
@@ -0,0 +1,95 @@
+package utils
+
+import (
+	"fmt"
+	"time"
+
+	"sigs.k8s.io/yaml"
+)
+
+// HelmOptions are flags of helm upgrade for releases of the module. Unset fields
+// are inherited: options from the ConfigMap override options from module.yaml.
+type HelmOptions struct {
+	// Wait waits until all resources of the release are ready.
+	Wait *bool `json:"wait,omitempty"`
+	// Atomic rolls back the failed upgrade. It implies Wait.
+	Atomic *bool `json:"atomic,omitempty"`
+	// Timeout is a time to wait for Kubernetes operations, e.g. "10m". Default is HELM_TIMEOUT.
+	Timeout string `json:"timeout,omitempty"`
+	// HistoryMax is a limit of release revisions. Default is HELM_HISTORY_MAX.
+	HistoryMax *int32 `json:"historyMax,omitempty"`
+	// Force recreates resources that cannot be updated.
+	Force *bool `json:"force,omitempty"`
+	// ResetValues ignores values stored in the release.
+	ResetValues *bool `json:"resetValues,omitempty"`
+}
+
+// NewHelmOptionsFromBytes parses and validates helm options.
+func NewHelmOptionsFromBytes(data []byte) (*HelmOptions, error) {
+	opts := &HelmOptions{}
+	err := yaml.UnmarshalStrict(data, opts)
+	if err != nil {
+		return nil, err
+	}
+	err = opts.Validate()
+	if err != nil {
+		return nil, err
+	}
+	return opts, nil
+}
+
+// Validate checks the timeout and the history limit.
+func (o *HelmOptions) Validate() error {
+	if o.Timeout != "" {
+		timeout, err := time.ParseDuration(o.Timeout)
+		if err != nil {
+			return fmt.Errorf("timeout: %v", err)
+		}
+		if timeout <= 0 {
+			return fmt.Errorf("timeout should be positive")
+		}
+	}
+	// Zero is rejected: it is not distinguished from the unset limit in helm upgrade flags.
+	if o.HistoryMax != nil && *o.HistoryMax <= 0 {
+		return fmt.Errorf("historyMax should be positive")
+	}
+	return nil
+}
+
+// Checksum returns a checksum of set options or an empty string if no options are set.
+func (o *HelmOptions) Checksum() string {
+	if o == nil || *o == (HelmOptions{}) {
+		return ""
+	}
+	data, _ := yaml.Marshal(o)
+	return CalculateStringsChecksum(string(data))
+}
+
+// Merge returns options with fields from override set over fields of o.
+func (o *HelmOptions) Merge(override *HelmOptions) *HelmOptions {
+	res := &HelmOptions{}
+	for _, opts := range []*HelmOptions{o, override} {
+		if opts == nil {
+			continue
+		}
+		if opts.Wait != nil {
+			res.Wait = opts.Wait
+		}
+		if opts.Atomic != nil {
+			res.Atomic = opts.Atomic
+		}
+		if opts.Timeout != "" {
+			res.Timeout = opts.Timeout
+		}
+		if opts.HistoryMax != nil {
+			res.HistoryMax = opts.HistoryMax
+		}
+		if opts.Force != nil {
+			res.Force = opts.Force
+		}
+		if opts.ResetValues != nil {
+			res.ResetValues = opts.ResetValues
+		}
+	}
+	return res
+}
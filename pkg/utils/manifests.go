@@ -0,0 +1,49 @@
+package utils
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/flant/shell-operator/pkg/utils/manifest"
+)
+
+var yamlDocumentSeparator = regexp.MustCompile(`(?:^|\s*\n)---\s*`)
+
+// ManifestListFromYamlDocuments parses a multi-document YAML into manifests.
+// Unlike manifest.GetManifestListFromYamlDocuments, the order of documents is preserved.
+// Documents without apiVersion, kind and name are skipped.
+func ManifestListFromYamlDocuments(rawManifests string) ([]manifest.Manifest, error) {
+	manifests := make([]manifest.Manifest, 0)
+	for _, doc := range SplitYamlDocuments(rawManifests) {
+		m, err := manifest.NewManifestFromYaml(doc)
+		if err != nil {
+			return nil, err
+		}
+		if m.HasBasicFields() {
+			manifests = append(manifests, m)
+		}
+	}
+	return manifests, nil
+}
+
+// HelmHookAnnotation marks resources of Helm hooks.
+const HelmHookAnnotation = "helm.sh/hook"
+
+// IsHelmHook returns true if the manifest is a Helm hook. Hooks are not a part of the
+// release manifest: Helm creates and deletes them on release events.
+func IsHelmHook(m manifest.Manifest) bool {
+	_, isHook := annotations(m)[HelmHookAnnotation]
+	return isHook
+}
+
+// SplitYamlDocuments returns non-empty documents of a multi-document YAML in order.
+func SplitYamlDocuments(rawManifests string) []string {
+	docs := make([]string, 0)
+	for _, doc := range yamlDocumentSeparator.Split(rawManifests, -1) {
+		if strings.TrimSpace(doc) == "" {
+			continue
+		}
+		docs = append(docs, doc)
+	}
+	return docs
+}
@@ -0,0 +1,249 @@
+package utils
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/flant/shell-operator/pkg/utils/manifest"
+)
+
+const (
+	ResourceAdded   = "added"
+	ResourceRemoved = "removed"
+	ResourceChanged = "changed"
+)
+
+// ResourceDiff is a difference of one resource between deployed and rendered manifests.
+type ResourceDiff struct {
+	// ID is a "Kind/namespace/name" string.
+	ID      string        `json:"id"`
+	Action  string        `json:"action"`
+	Changes []FieldChange `json:"changes,omitempty"`
+}
+
+// FieldChange is a changed field of the resource. Old is empty for added fields
+// and New is empty for removed fields. Values of Secret data are replaced with RedactedValue.
+type FieldChange struct {
+	Path string      `json:"path"`
+	Old  interface{} `json:"old,omitempty"`
+	New  interface{} `json:"new,omitempty"`
+}
+
+// noiseMetadataFields are set by the API server or Helm and are not a part of the chart.
+var noiseMetadataFields = []string{
+	"creationTimestamp",
+	"generation",
+	"managedFields",
+	"resourceVersion",
+	"selfLink",
+	"uid",
+}
+
+// RedactedValue replaces values of Secret data in field changes.
+const RedactedValue = "(redacted)"
+
+// secretDataFields are fields of the Secret with sensitive values.
+var secretDataFields = []string{"data", "stringData"}
+
+var noiseAnnotations = []string{
+	"kubectl.kubernetes.io/last-applied-configuration",
+	"meta.helm.sh/release-name",
+	"meta.helm.sh/release-namespace",
+}
+
+// DiffManifests returns differences between deployed and rendered manifests sorted by resource ID.
+// Resources are matched by kind, namespace and name, resources without namespace are in
+// the defaultNamespace. Status, fields set by the API server, empty fields and Helm hooks are ignored.
+func DiffManifests(deployed []manifest.Manifest, rendered []manifest.Manifest, defaultNamespace string) []ResourceDiff {
+	oldResources := indexManifests(deployed, defaultNamespace)
+	newResources := indexManifests(rendered, defaultNamespace)
+
+	res := make([]ResourceDiff, 0)
+	for id, oldObj := range oldResources {
+		newObj, has := newResources[id]
+		if !has {
+			res = append(res, ResourceDiff{ID: id, Action: ResourceRemoved})
+			continue
+		}
+		changes := diffValues("", oldObj, newObj, nil)
+		if oldObj["kind"] == "Secret" {
+			redactSecretData(changes)
+		}
+		if len(changes) > 0 {
+			sort.Slice(changes, func(i, j int) bool {
+				return changes[i].Path < changes[j].Path
+			})
+			res = append(res, ResourceDiff{ID: id, Action: ResourceChanged, Changes: changes})
+		}
+	}
+	for id := range newResources {
+		if _, has := oldResources[id]; !has {
+			res = append(res, ResourceDiff{ID: id, Action: ResourceAdded})
+		}
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].ID < res[j].ID
+	})
+	return res
+}
+
+// DiffSummary returns a one-line description of differences, e.g.
+// "1 added, 1 changed, 0 removed: Deployment/ns/app changed (spec.replicas)".
+func DiffSummary(diffs []ResourceDiff) string {
+	if len(diffs) == 0 {
+		return "no changes"
+	}
+	counts := map[string]int{}
+	descs := make([]string, 0, len(diffs))
+	for _, diff := range diffs {
+		counts[diff.Action]++
+		desc := fmt.Sprintf("%s %s", diff.ID, diff.Action)
+		if len(diff.Changes) > 0 {
+			paths := make([]string, 0, len(diff.Changes))
+			for _, change := range diff.Changes {
+				paths = append(paths, change.Path)
+			}
+			desc += " (" + strings.Join(paths, ", ") + ")"
+		}
+		descs = append(descs, desc)
+	}
+	return fmt.Sprintf("%d added, %d changed, %d removed: %s",
+		counts[ResourceAdded], counts[ResourceChanged], counts[ResourceRemoved], strings.Join(descs, "; "))
+}
+
+// indexManifests returns normalized manifests by ID. Helm hooks are
+// skipped: they are not stored in the release manifest.
+func indexManifests(manifests []manifest.Manifest, defaultNamespace string) map[string]map[string]interface{} {
+	res := make(map[string]map[string]interface{})
+	for _, m := range manifests {
+		if IsHelmHook(m) {
+			continue
+		}
+		id := fmt.Sprintf("%s/%s/%s", m.Kind(), m.Namespace(defaultNamespace), m.Name())
+		res[id] = normalizeManifest(m, defaultNamespace)
+	}
+	return res
+}
+
+func annotations(m manifest.Manifest) map[string]interface{} {
+	metadata, _ := m["metadata"].(map[string]interface{})
+	annos, _ := metadata["annotations"].(map[string]interface{})
+	return annos
+}
+
+// normalizeManifest returns a copy of the manifest without status, noise fields and empty values.
+func normalizeManifest(m manifest.Manifest, defaultNamespace string) map[string]interface{} {
+	obj, _ := pruneEmpty(map[string]interface{}(m)).(map[string]interface{})
+	if obj == nil {
+		obj = map[string]interface{}{}
+	}
+	delete(obj, "status")
+
+	metadata, _ := obj["metadata"].(map[string]interface{})
+	if metadata == nil {
+		return obj
+	}
+	for _, field := range noiseMetadataFields {
+		delete(metadata, field)
+	}
+	if metadata["namespace"] == defaultNamespace {
+		delete(metadata, "namespace")
+	}
+	if annos, ok := metadata["annotations"].(map[string]interface{}); ok {
+		for _, anno := range noiseAnnotations {
+			delete(annos, anno)
+		}
+		if len(annos) == 0 {
+			delete(metadata, "annotations")
+		}
+	}
+	return obj
+}
+
+// pruneEmpty returns a copy of the value without nil values, empty maps and empty lists.
+func pruneEmpty(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		res := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			if item = pruneEmpty(item); item != nil {
+				res[key] = item
+			}
+		}
+		if len(res) == 0 {
+			return nil
+		}
+		return res
+	case []interface{}:
+		if len(v) == 0 {
+			return nil
+		}
+		res := make([]interface{}, 0, len(v))
+		for _, item := range v {
+			res = append(res, pruneEmpty(item))
+		}
+		return res
+	}
+	return value
+}
+
+// redactSecretData hides values of changed Secret data: only a fact of the change is reported.
+func redactSecretData(changes []FieldChange) {
+	for i := range changes {
+		for _, field := range secretDataFields {
+			if changes[i].Path != field && !strings.HasPrefix(changes[i].Path, field+".") {
+				continue
+			}
+			if changes[i].Old != nil {
+				changes[i].Old = RedactedValue
+			}
+			if changes[i].New != nil {
+				changes[i].New = RedactedValue
+			}
+		}
+	}
+}
+
+// diffValues appends changes of nested fields. Lists of different lengths are compared as a whole.
+func diffValues(path string, oldValue, newValue interface{}, changes []FieldChange) []FieldChange {
+	oldMap, oldIsMap := oldValue.(map[string]interface{})
+	newMap, newIsMap := newValue.(map[string]interface{})
+	if oldIsMap && newIsMap {
+		for key, oldItem := range oldMap {
+			changes = diffValues(joinPath(path, key), oldItem, newMap[key], changes)
+		}
+		for key, newItem := range newMap {
+			if _, has := oldMap[key]; !has {
+				changes = append(changes, FieldChange{Path: joinPath(path, key), New: newItem})
+			}
+		}
+		return changes
+	}
+
+	oldList, oldIsList := oldValue.([]interface{})
+	newList, newIsList := newValue.([]interface{})
+	if oldIsList && newIsList && len(oldList) == len(newList) {
+		for i := range oldList {
+			changes = diffValues(fmt.Sprintf("%s[%d]", path, i), oldList[i], newList[i], changes)
+		}
+		return changes
+	}
+
+	if !reflect.DeepEqual(oldValue, newValue) {
+		changes = append(changes, FieldChange{Path: path, Old: oldValue, New: newValue})
+	}
+	return changes
+}
+
+func joinPath(path string, key string) string {
+	if strings.ContainsAny(key, "./") {
+		key = "\"" + key + "\""
+	}
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
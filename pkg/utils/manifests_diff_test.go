@@ -0,0 +1,177 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_DiffManifests(t *testing.T) {
+	deployed, err := ManifestListFromYamlDocuments(`
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+  annotations:
+    meta.helm.sh/release-name: module
+spec:
+  replicas: 1
+  template:
+    metadata:
+      creationTimestamp: null
+    spec:
+      containers:
+      - name: app
+        image: app:v1
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: removed
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: same
+  namespace: ns
+data:
+  key: value
+`)
+	require.NoError(t, err)
+
+	rendered, err := ManifestListFromYamlDocuments(`
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+  namespace: ns
+  labels:
+    app: app
+spec:
+  replicas: 2
+  template:
+    spec:
+      containers:
+      - name: app
+        image: app:v2
+status: {}
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: same
+  labels: {}
+data:
+  key: value
+---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: added
+---
+apiVersion: batch/v1
+kind: Job
+metadata:
+  name: hook
+  annotations:
+    helm.sh/hook: post-install
+`)
+	require.NoError(t, err)
+
+	diffs := DiffManifests(deployed, rendered, "ns")
+	require.Len(t, diffs, 3)
+
+	assert.Equal(t, ResourceDiff{ID: "ConfigMap/ns/removed", Action: ResourceRemoved}, diffs[0])
+	assert.Equal(t, ResourceDiff{
+		ID:     "Deployment/ns/app",
+		Action: ResourceChanged,
+		Changes: []FieldChange{
+			{Path: "metadata.labels", New: map[string]interface{}{"app": "app"}},
+			{Path: "spec.replicas", Old: float64(1), New: float64(2)},
+			{Path: "spec.template.spec.containers[0].image", Old: "app:v1", New: "app:v2"},
+		},
+	}, diffs[1])
+	assert.Equal(t, ResourceDiff{ID: "Secret/ns/added", Action: ResourceAdded}, diffs[2])
+
+	assert.Equal(t, "1 added, 1 changed, 1 removed: "+
+		"ConfigMap/ns/removed removed; "+
+		"Deployment/ns/app changed (metadata.labels, spec.replicas, spec.template.spec.containers[0].image); "+
+		"Secret/ns/added added",
+		DiffSummary(diffs))
+	assert.Equal(t, "no changes", DiffSummary(DiffManifests(deployed, deployed, "ns")))
+}
+
+func Test_DiffManifests_Lists(t *testing.T) {
+	deployed, err := ManifestListFromYamlDocuments(`
+apiVersion: v1
+kind: Service
+metadata:
+  name: svc
+  annotations:
+    example.com/key: value
+spec:
+  ports:
+  - port: 80
+`)
+	require.NoError(t, err)
+	rendered, err := ManifestListFromYamlDocuments(`
+apiVersion: v1
+kind: Service
+metadata:
+  name: svc
+spec:
+  ports:
+  - port: 80
+  - port: 443
+`)
+	require.NoError(t, err)
+
+	diffs := DiffManifests(deployed, rendered, "ns")
+	require.Len(t, diffs, 1)
+	assert.Equal(t, []FieldChange{
+		{Path: "metadata.annotations", Old: map[string]interface{}{"example.com/key": "value"}},
+		{
+			Path: "spec.ports",
+			Old:  []interface{}{map[string]interface{}{"port": float64(80)}},
+			New:  []interface{}{map[string]interface{}{"port": float64(80)}, map[string]interface{}{"port": float64(443)}},
+		},
+	}, diffs[0].Changes)
+}
+
+func Test_DiffManifests_SecretData(t *testing.T) {
+	deployed, err := ManifestListFromYamlDocuments(`
+apiVersion: v1
+kind: Secret
+metadata:
+  name: creds
+  labels:
+    app: old
+data:
+  password: b2xk
+`)
+	require.NoError(t, err)
+	rendered, err := ManifestListFromYamlDocuments(`
+apiVersion: v1
+kind: Secret
+metadata:
+  name: creds
+  labels:
+    app: new
+data:
+  password: bmV3
+  token: dG9rZW4=
+stringData:
+  user: admin
+`)
+	require.NoError(t, err)
+
+	diffs := DiffManifests(deployed, rendered, "ns")
+	require.Len(t, diffs, 1)
+	assert.Equal(t, []FieldChange{
+		{Path: "data.password", Old: RedactedValue, New: RedactedValue},
+		{Path: "data.token", New: RedactedValue},
+		{Path: "metadata.labels.app", Old: "old", New: "new"},
+		{Path: "stringData", New: RedactedValue},
+	}, diffs[0].Changes)
+}
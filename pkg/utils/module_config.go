@@ -5,6 +5,7 @@ import (
 	"strings"
 
 	"github.com/davecgh/go-spew/spew"
+	"k8s.io/apimachinery/pkg/util/validation"
 	"sigs.k8s.io/yaml"
 
 	utils_checksum "github.com/flant/shell-operator/pkg/utils/checksum"
@@ -14,13 +15,19 @@ var ModuleEnabled = true
 var ModuleDisabled = false
 
 type ModuleConfig struct {
-	ModuleName       string
-	IsEnabled        *bool
-	Values           Values
-	IsUpdated        bool
-	ModuleConfigKey  string
-	ModuleEnabledKey string
-	RawConfig        []string
+	ModuleName           string
+	IsEnabled            *bool
+	Values               Values
+	IsUpdated            bool
+	IsPaused             bool
+	Namespace            string
+	HelmOptions          *HelmOptions
+	ModuleConfigKey      string
+	ModuleEnabledKey     string
+	ModulePausedKey      string
+	ModuleNamespaceKey   string
+	ModuleHelmOptionsKey string
+	RawConfig            []string
 }
 
 // String returns description of ModuleConfig values.
@@ -42,12 +49,15 @@ func (mc *ModuleConfig) GetEnabled() string {
 
 func NewModuleConfig(moduleName string) *ModuleConfig {
 	return &ModuleConfig{
-		ModuleName:       moduleName,
-		IsEnabled:        nil,
-		Values:           make(Values),
-		ModuleConfigKey:  ModuleNameToValuesKey(moduleName),
-		ModuleEnabledKey: ModuleNameToValuesKey(moduleName) + "Enabled",
-		RawConfig:        make([]string, 0),
+		ModuleName:           moduleName,
+		IsEnabled:            nil,
+		Values:               make(Values),
+		ModuleConfigKey:      ModuleNameToValuesKey(moduleName),
+		ModuleEnabledKey:     ModuleNameToValuesKey(moduleName) + "Enabled",
+		ModulePausedKey:      ModuleNameToValuesKey(moduleName) + "Paused",
+		ModuleNamespaceKey:   ModuleNameToValuesKey(moduleName) + "Namespace",
+		ModuleHelmOptionsKey: ModuleNameToValuesKey(moduleName) + "HelmOptions",
+		RawConfig:            make([]string, 0),
 	}
 }
 
@@ -60,6 +70,21 @@ func (mc *ModuleConfig) WithEnabled(v bool) *ModuleConfig {
 	return mc
 }
 
+func (mc *ModuleConfig) WithPaused(v bool) *ModuleConfig {
+	mc.IsPaused = v
+	return mc
+}
+
+func (mc *ModuleConfig) WithNamespace(v string) *ModuleConfig {
+	mc.Namespace = v
+	return mc
+}
+
+func (mc *ModuleConfig) WithHelmOptions(v *HelmOptions) *ModuleConfig {
+	mc.HelmOptions = v
+	return mc
+}
+
 func (mc *ModuleConfig) WithUpdated(v bool) *ModuleConfig {
 	mc.IsUpdated = v
 	return mc
@@ -100,6 +125,44 @@ func (mc *ModuleConfig) LoadFromValues(values Values) (*ModuleConfig, error) {
 		}
 	}
 
+	if modulePaused, hasModulePaused := values[mc.ModulePausedKey]; hasModulePaused {
+		switch v := modulePaused.(type) {
+		case bool:
+			mc.WithPaused(v)
+		default:
+			return nil, fmt.Errorf("load '%s' paused config: paused value should be bool. Got: %#v", mc.ModuleName, modulePaused)
+		}
+	}
+
+	if moduleNamespace, hasModuleNamespace := values[mc.ModuleNamespaceKey]; hasModuleNamespace {
+		switch v := moduleNamespace.(type) {
+		case string:
+			if errs := validation.IsDNS1123Label(v); len(errs) > 0 {
+				return nil, fmt.Errorf("load '%s' namespace config: invalid namespace '%s': %s", mc.ModuleName, v, strings.Join(errs, ", "))
+			}
+			mc.WithNamespace(v)
+		default:
+			return nil, fmt.Errorf("load '%s' namespace config: namespace value should be string. Got: %#v", mc.ModuleName, moduleNamespace)
+		}
+	}
+
+	if moduleHelmOptions, hasModuleHelmOptions := values[mc.ModuleHelmOptionsKey]; hasModuleHelmOptions {
+		switch v := moduleHelmOptions.(type) {
+		case map[string]interface{}:
+			data, err := yaml.Marshal(v)
+			if err != nil {
+				return nil, fmt.Errorf("load '%s' helm options config: %v", mc.ModuleName, err)
+			}
+			helmOptions, err := NewHelmOptionsFromBytes(data)
+			if err != nil {
+				return nil, fmt.Errorf("load '%s' helm options config: %v", mc.ModuleName, err)
+			}
+			mc.WithHelmOptions(helmOptions)
+		default:
+			return nil, fmt.Errorf("load '%s' helm options config: helm options value should be map. Got: %#v", mc.ModuleName, moduleHelmOptions)
+		}
+	}
+
 	return mc, nil
 }
 
@@ -130,6 +193,10 @@ func (mc *ModuleConfig) FromYaml(yamlString []byte) (*ModuleConfig, error) {
 //   param1: 10
 //   param2: 120
 // simpleModuleEnabled: "true"
+// simpleModulePaused: "false"
+// simpleModuleNamespace: "simple"
+// simpleModuleHelmOptions: |
+//   wait: true
 
 // TODO "msg": "Kube config manager: cannot handle ConfigMap update: ConfigMap:
 //  bad yaml at key 'deployWithHooks':
@@ -175,6 +242,48 @@ func (mc *ModuleConfig) FromConfigMapData(configData map[string]string) (*Module
 		mc.RawConfig = append(mc.RawConfig, enabledString)
 	}
 
+	// if there is paused key, treat it as boolean
+	pausedString, hasKey := configData[mc.ModulePausedKey]
+	if hasKey {
+		var paused bool
+
+		if pausedString == "true" {
+			paused = true
+		} else if pausedString == "false" {
+			paused = false
+		} else {
+			return nil, fmt.Errorf("module paused key '%s' should have a boolean value, got '%v'", mc.ModulePausedKey, pausedString)
+		}
+
+		configValues[mc.ModulePausedKey] = paused
+
+		// Prefix is needed to distinguish paused from enabled in a checksum.
+		mc.RawConfig = append(mc.RawConfig, "paused:"+pausedString)
+	}
+
+	// namespace key is a plain string
+	namespaceString, hasKey := configData[mc.ModuleNamespaceKey]
+	if hasKey {
+		configValues[mc.ModuleNamespaceKey] = namespaceString
+
+		mc.RawConfig = append(mc.RawConfig, "namespace:"+namespaceString)
+	}
+
+	// helm options key is a yaml map
+	helmOptionsYaml, hasKey := configData[mc.ModuleHelmOptionsKey]
+	if hasKey {
+		var helmOptions interface{}
+
+		err := yaml.Unmarshal([]byte(helmOptionsYaml), &helmOptions)
+		if err != nil {
+			return nil, fmt.Errorf("unmarshal yaml data in a module helm options key '%s': %v", mc.ModuleHelmOptionsKey, err)
+		}
+
+		configValues[mc.ModuleHelmOptionsKey] = helmOptions
+
+		mc.RawConfig = append(mc.RawConfig, "helmOptions:"+helmOptionsYaml)
+	}
+
 	if len(configValues) == 0 {
 		return mc, nil
 	}
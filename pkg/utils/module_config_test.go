@@ -269,3 +269,38 @@ func Test_GetEnabled(t *testing.T) {
 	}
 
 }
+
+func Test_HelmOptions(t *testing.T) {
+	g := NewWithT(t)
+
+	config, err := NewModuleConfig("test-module").FromConfigMapData(map[string]string{
+		"testModuleHelmOptions": "wait: true\ntimeout: 10m\nhistoryMax: 3\n",
+	})
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(config.HelmOptions).ToNot(BeNil())
+	g.Expect(*config.HelmOptions.Wait).To(BeTrue())
+	g.Expect(config.HelmOptions.Timeout).To(Equal("10m"))
+	g.Expect(*config.HelmOptions.HistoryMax).To(Equal(int32(3)))
+	g.Expect(config.RawConfig).To(ContainElement("helmOptions:wait: true\ntimeout: 10m\nhistoryMax: 3\n"))
+
+	_, err = NewModuleConfig("test-module").FromConfigMapData(map[string]string{
+		"testModuleHelmOptions": "timeout: soon\n",
+	})
+	g.Expect(err).Should(HaveOccurred())
+
+	_, err = NewModuleConfig("test-module").FromConfigMapData(map[string]string{
+		"testModuleHelmOptions": "unknown: true\n",
+	})
+	g.Expect(err).Should(HaveOccurred())
+
+	_, err = NewModuleConfig("test-module").LoadFromValues(Values{"testModuleHelmOptions": "wait"})
+	g.Expect(err).Should(HaveOccurred())
+
+	// Fields of override are set over base fields.
+	wait, noWait := true, false
+	base := &HelmOptions{Wait: &wait, Timeout: "5m"}
+	merged := base.Merge(&HelmOptions{Wait: &noWait})
+	g.Expect(*merged.Wait).To(BeFalse())
+	g.Expect(merged.Timeout).To(Equal("5m"))
+	g.Expect((*HelmOptions)(nil).Merge(nil)).To(Equal(&HelmOptions{}))
+}
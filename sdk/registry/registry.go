@@ -13,6 +13,10 @@ func initRegistry() bool {
 		Registry().Add(h)
 		return true
 	}
+	RegisterTransformer = func(t Transformer) bool {
+		TransformerRegistry().Add(t)
+		return true
+	}
 	return true
 }
 
@@ -49,3 +53,37 @@ func (h *hookRegistry) Add(hook GoHook) {
 	defer h.m.Unlock()
 	h.hooks = append(h.hooks, hook)
 }
+
+type TransformerRegistryInterface interface {
+	Transformers() []Transformer
+	Add(transformer Transformer)
+}
+
+type transformerRegistry struct {
+	transformers []Transformer
+	m            sync.Mutex
+}
+
+var transformersInstance *transformerRegistry
+var transformersOnce sync.Once
+
+func TransformerRegistry() TransformerRegistryInterface {
+	transformersOnce.Do(func() {
+		transformersInstance = new(transformerRegistry)
+	})
+	return transformersInstance
+}
+
+func (t *transformerRegistry) Transformers() []Transformer {
+	t.m.Lock()
+	defer t.m.Unlock()
+	res := make([]Transformer, len(t.transformers))
+	copy(res, t.transformers)
+	return res
+}
+
+func (t *transformerRegistry) Add(transformer Transformer) {
+	t.m.Lock()
+	defer t.m.Unlock()
+	t.transformers = append(t.transformers, transformer)
+}
@@ -62,16 +62,20 @@ type BindingHandler func(input *BindingInput) (*BindingOutput, error)
 type HookConfig struct {
 	YamlConfig string // define bindings with YAML as in shell hooks.
 
-	Schedule          []ScheduleConfig
-	Kubernetes        []KubernetesConfig
-	OnStartup         *OrderedConfig
-	OnBeforeHelm      *OrderedConfig
-	OnAfterHelm       *OrderedConfig
-	OnAfterDeleteHelm *OrderedConfig
-	OnBeforeAll       *OrderedConfig
-	OnAfterAll        *OrderedConfig
-	MainHandler       BindingHandler
-	GroupHandlers     map[string]BindingHandler
+	Schedule           []ScheduleConfig
+	Kubernetes         []KubernetesConfig
+	OnStartup          *OrderedConfig
+	OnBeforeHelm       *OrderedConfig
+	OnAfterHelm        *OrderedConfig
+	OnBeforeDeleteHelm *OrderedConfig
+	OnAfterDeleteHelm  *OrderedConfig
+	OnBeforeAll        *OrderedConfig
+	OnAfterAll         *OrderedConfig
+	MainHandler        BindingHandler
+	GroupHandlers      map[string]BindingHandler
+
+	// RetryPolicy overrides retry policy for failed hook tasks by binding name or binding type.
+	RetryPolicy map[string]RetryPolicyConfig
 }
 
 type ScheduleConfig struct {
@@ -105,6 +109,13 @@ type KubernetesConfig struct {
 	FilterFunc                   func(obj *unstructured.Unstructured) (string, error)
 }
 
+type RetryPolicyConfig struct {
+	InitialDelay string
+	MaxDelay     string
+	Multiplier   *float64
+	Jitter       *float64
+}
+
 type OrderedConfig struct {
 	Order   float64
 	Handler BindingHandler
@@ -126,16 +137,17 @@ type HookBindingContext struct {
 }
 
 type Handlers struct {
-	Main              func()
-	Group             map[string]func()
-	Kubernetes        map[string]func()
-	Schedule          map[string]func()
-	OnStartup         func()
-	OnBeforeAll       func()
-	OnAfterAll        func()
-	OnBeforeHelm      func()
-	OnAfterHelm       func()
-	OnAfterDeleteHelm func()
+	Main               func()
+	Group              map[string]func()
+	Kubernetes         map[string]func()
+	Schedule           map[string]func()
+	OnStartup          func()
+	OnBeforeAll        func()
+	OnAfterAll         func()
+	OnBeforeHelm       func()
+	OnAfterHelm        func()
+	OnBeforeDeleteHelm func()
+	OnAfterDeleteHelm  func()
 }
 
 type GoHook interface {
@@ -149,6 +161,25 @@ type GoHook interface {
 //   var _ =
 var Register = func(_ GoHook) bool { return false }
 
+// PostRenderInput describes manifests passed to the Transformer.
+type PostRenderInput struct {
+	ModuleName string
+	Namespace  string
+}
+
+// Transformer changes rendered manifests of modules before helm upgrade.
+// Transformers are applied in the order of registration after transformers from
+// the post-render config. Helm hooks are passed too, they have the 'helm.sh/hook' annotation.
+type Transformer interface {
+	Name() string
+	Transform(input *PostRenderInput, objects []*unstructured.Unstructured) ([]*unstructured.Unstructured, error)
+}
+
+// RegisterTransformer is a method to define post-render transformers.
+// return value is for trick with
+//   var _ =
+var RegisterTransformer = func(_ Transformer) bool { return false }
+
 type HookLoader interface {
 	Load()
 }
@@ -282,6 +313,10 @@ func (c *CommonGoHook) Run(input *HookInput) (*HookOutput, error) {
 				if c.HookConfig.OnAfterHelm != nil {
 					h = c.HookConfig.OnAfterHelm.Handler
 				}
+			case hook_types.BeforeDeleteHelm:
+				if c.HookConfig.OnBeforeDeleteHelm != nil {
+					h = c.HookConfig.OnBeforeDeleteHelm.Handler
+				}
 			case hook_types.AfterDeleteHelm:
 				if c.HookConfig.OnAfterDeleteHelm != nil {
 					h = c.HookConfig.OnAfterDeleteHelm.Handler